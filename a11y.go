@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// a11yIssue is an accessibility problem found in a generated page
+type a11yIssue struct {
+	Page    string // Source path of the page within the content tree
+	Message string
+}
+
+// checkAccessibility looks for common accessibility problems in the pages
+// written by the last build: a missing lang attribute or main landmark,
+// images without alt text, links and buttons without an accessible name,
+// skipped heading levels and duplicate ids
+func (s *Site) checkAccessibility() ([]a11yIssue, error) {
+	var issues []a11yIssue
+
+	for _, meta := range s.renderedPages {
+		f, err := os.Open(meta.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", meta.Output, err)
+		}
+		doc, err := html.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", meta.Output, err)
+		}
+
+		for _, message := range auditDocument(doc) {
+			issues = append(issues, a11yIssue{Page: s.checkedPage(meta), Message: message})
+		}
+	}
+
+	return issues, nil
+}
+
+// auditDocument returns the accessibility problems of a parsed HTML page
+func auditDocument(doc *html.Node) []string {
+	var problems []string
+	hasMain := false
+	lastHeading := 0
+	ids := make(map[string]bool)
+
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id := attr(n, "id"); id != "" {
+				if ids[id] {
+					problems = append(problems, fmt.Sprintf("duplicate id %q", id))
+				}
+				ids[id] = true
+			}
+
+			switch n.DataAtom {
+			case atom.Html:
+				if strings.TrimSpace(attr(n, "lang")) == "" {
+					problems = append(problems, "<html> has no lang attribute")
+				}
+			case atom.Main:
+				hasMain = true
+			case atom.Img:
+				if _, ok := attrValue(n, "alt"); !ok {
+					problems = append(problems, fmt.Sprintf("image %q has no alt text", attr(n, "src")))
+				}
+			case atom.A:
+				if _, ok := attrValue(n, "href"); ok && accessibleName(n) == "" {
+					problems = append(problems, fmt.Sprintf("link to %q has no text", attr(n, "href")))
+				}
+			case atom.Button:
+				if accessibleName(n) == "" {
+					problems = append(problems, "button has no text or aria-label")
+				}
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				level := int(n.Data[1] - '0')
+				if lastHeading > 0 && level > lastHeading+1 {
+					problems = append(problems, fmt.Sprintf("heading level skipped from h%d to h%d", lastHeading, level))
+				}
+				lastHeading = level
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	if !hasMain {
+		problems = append(problems, "page has no <main> landmark")
+	}
+
+	return problems
+}
+
+// accessibleName returns the name assistive technology would announce for
+// an element: its aria-label, or its text including image alt text
+func accessibleName(n *html.Node) string {
+	if label := strings.TrimSpace(attr(n, "aria-label")); label != "" {
+		return label
+	}
+
+	var text strings.Builder
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			text.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			text.WriteString(attr(n, "alt"))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+
+	return strings.TrimSpace(text.String())
+}
+
+// attrValue returns an attribute of an element and whether it is set
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// attr returns an attribute of an element, "" when it is not set
+func attr(n *html.Node, key string) string {
+	value, _ := attrValue(n, key)
+	return value
+}
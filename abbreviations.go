@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+const abbreviationsFile = "./data/abbreviations.yaml" // Abbreviations shared by every page
+
+// abbreviationDefinition matches a definition such as *[HTML]: HyperText Markup Language
+var abbreviationDefinition = regexp.MustCompile(`^ {0,3}\*\[([^\]]+)\]:[ \t]*(.*?)\s*$`)
+
+// abbreviationsKey holds the abbreviations a page defines in the parser context
+var abbreviationsKey = parser.NewContextKey()
+
+// loadAbbreviations reads the abbreviations every page gets. A site without
+// the file has none besides those its pages define.
+func (s *Site) loadAbbreviations() error {
+	s.abbreviations, s.abbreviationPattern = nil, nil
+	file := s.Abbreviations
+	if file == "" {
+		file = filepath.Join(s.dataDir, abbreviationsFile)
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && s.Abbreviations == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read abbreviations: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, &s.abbreviations)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	s.abbreviationPattern = abbreviationPattern(s.abbreviations)
+	return nil
+}
+
+// abbreviationPattern returns a pattern matching any of the abbreviations,
+// longest first, or nil when there are none
+func abbreviationPattern(abbreviations map[string]string) *regexp.Regexp {
+	if len(abbreviations) == 0 {
+		return nil
+	}
+	words := make([]string, 0, len(abbreviations))
+	for abbr := range abbreviations {
+		words = append(words, regexp.QuoteMeta(abbr))
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	return regexp.MustCompile(strings.Join(words, "|"))
+}
+
+// kindAbbreviation and kindAbbreviationDefinition are the AST node kinds of
+// abbreviations in the text and of the lines defining them
+var (
+	kindAbbreviation           = ast.NewNodeKind("Abbreviation")
+	kindAbbreviationDefinition = ast.NewNodeKind("AbbreviationDefinition")
+)
+
+// abbreviationNode is an abbreviation used in the text, holding the text it
+// was written as
+type abbreviationNode struct {
+	ast.BaseInline
+	Title string // What the abbreviation stands for
+}
+
+// Kind returns the node kind of abbreviations
+func (n *abbreviationNode) Kind() ast.NodeKind {
+	return kindAbbreviation
+}
+
+// Dump prints the abbreviation for debugging
+func (n *abbreviationNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Title": n.Title}, nil)
+}
+
+// abbreviationDefinitionNode is a line defining an abbreviation, which
+// isn't shown
+type abbreviationDefinitionNode struct {
+	ast.BaseBlock
+}
+
+// Kind returns the node kind of abbreviation definitions
+func (n *abbreviationDefinitionNode) Kind() ast.NodeKind {
+	return kindAbbreviationDefinition
+}
+
+// Dump prints the abbreviation definition for debugging
+func (n *abbreviationDefinitionNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// abbreviationParser reads definitions written as *[abbr]: meaning on a line
+// of their own, in the style of PHP Markdown Extra
+type abbreviationParser struct{}
+
+func (abbreviationParser) Trigger() []byte {
+	return []byte{'*'}
+}
+
+func (abbreviationParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	m := abbreviationDefinition.FindSubmatch(line)
+	if m == nil {
+		return nil, parser.NoChildren
+	}
+
+	defined, _ := pc.Get(abbreviationsKey).(map[string]string)
+	if defined == nil {
+		defined = make(map[string]string)
+		pc.Set(abbreviationsKey, defined)
+	}
+	defined[strings.TrimSpace(string(m[1]))] = string(m[2])
+
+	reader.Advance(segment.Len() - 1)
+	return &abbreviationDefinitionNode{}, parser.NoChildren
+}
+
+func (abbreviationParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	return parser.Close
+}
+
+func (abbreviationParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (abbreviationParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (abbreviationParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// abbreviationMarker marks up every use of an abbreviation defined by the
+// site or the page, leaving out code
+type abbreviationMarker struct {
+	site *Site
+}
+
+// Transform marks up the abbreviations of a parsed page. Definitions on the
+// page win over the site's.
+func (am abbreviationMarker) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	abbreviations := am.site.abbreviations
+	pattern := am.site.abbreviationPattern
+	if defined, ok := pc.Get(abbreviationsKey).(map[string]string); ok {
+		abbreviations = make(map[string]string, len(am.site.abbreviations)+len(defined))
+		for abbr, title := range am.site.abbreviations {
+			abbreviations[abbr] = title
+		}
+		for abbr, title := range defined {
+			abbreviations[abbr] = title
+		}
+		pattern = abbreviationPattern(abbreviations)
+	}
+	if pattern == nil {
+		return
+	}
+
+	var texts []*ast.Text
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeSpan, *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.RawHTML, *abbreviationNode:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			texts = append(texts, n)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, node := range texts {
+		wrapWords(node, reader.Source(), pattern, func(word string) ast.Node {
+			return &abbreviationNode{Title: abbreviations[word]}
+		})
+	}
+}
+
+// abbreviationRenderer writes abbreviations as abbr elements, and nothing
+// for their definitions
+type abbreviationRenderer struct{}
+
+// RegisterFuncs registers the abbreviation renderers with goldmark
+func (r abbreviationRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAbbreviation, r.render)
+	reg.Register(kindAbbreviationDefinition, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+func (r abbreviationRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</abbr>")
+		return ast.WalkContinue, nil
+	}
+	title := n.(*abbreviationNode).Title
+	if title == "" {
+		w.WriteString("<abbr>")
+	} else {
+		fmt.Fprintf(w, `<abbr title="%s">`, template.HTMLEscapeString(title))
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	headersFile         = "_headers"   // Response headers by path, as Netlify and Cloudflare Pages read them
+	redirectsFile       = "_redirects" // Redirects by path, as Netlify and Cloudflare Pages read them
+	visibilityPublic    = "public"     // Pages anyone may read
+	visibilityProtected = "protected"  // Pages the host should only serve after a login
+)
+
+// AccessConfig decides which audiences a build is for and how the host is
+// told to protect pages that need a login, so one content tree can be
+// built for the public and for internal readers
+type AccessConfig struct {
+	Audiences []string `yaml:"audiences"` // Audiences the build is for, pages for none of them are left out; every page is built when unset
+	Headers   bool     `yaml:"headers"`   // Write a _headers file keeping protected pages out of search engines and asking for BasicAuth
+	BasicAuth string   `yaml:"basicAuth"` // user:password logins Netlify asks for on protected pages, separated by spaces, written with $VARIABLES left for the deploy to fill in
+	Flags     []string `yaml:"flags"`     // Names flag conditions of conditional blocks test for, such as beta
+}
+
+// protected reports whether the page needs a login at the host
+func (p *Page) protected() bool {
+	return p.Visibility == visibilityProtected
+}
+
+// parseAudience reads the audience front matter value, a name or a list
+// of names
+func parseAudience(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		audience := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid audience %v", item)
+			}
+			audience = append(audience, name)
+		}
+		return audience, nil
+	}
+	return nil, fmt.Errorf("audience must be a name or a list of names")
+}
+
+// isForBuild reports whether the page is written for one of the audiences
+// the build is for. Pages without an audience are for everyone.
+func (p *Page) isForBuild(audiences []string) bool {
+	if len(audiences) == 0 || len(p.Audience) == 0 {
+		return true
+	}
+	for _, name := range p.Audience {
+		if slices.Contains(audiences, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterAudience removes the pages written for audiences other than the
+// ones the build is for
+func (s *Site) filterAudience() {
+	kept := s.pages[:0]
+	left := 0
+	for _, page := range s.pages {
+		if page.isForBuild(s.Access.Audiences) {
+			kept = append(kept, page)
+		} else {
+			left++
+		}
+	}
+	s.pages = kept
+	if left > 0 {
+		fmt.Printf("%s: %d page(s) for other audiences than %s left out\n", s.label(), left, strings.Join(s.Access.Audiences, ", "))
+	}
+}
+
+// pageOutputs returns the paths within the output of the files generated
+// for a page: its HTML, print variant, outline, other output formats and the
+// redirects of its aliases
+func (s *Site) pageOutputs(page *Page) []string {
+	htmlFileName := s.outputPath(page.Path)
+	outputs := append([]string{htmlFileName, printName(htmlFileName), outlinePath(htmlFileName)}, s.aliasPaths(page)...)
+	for _, name := range page.Outputs {
+		outputs = append(outputs, formatPath(htmlFileName, outputFormats[name]))
+	}
+	return outputs
+}
+
+// writeAccessHeaders adds the rules telling Netlify and Cloudflare Pages to
+// keep the protected pages out of search engines, and Netlify to ask for a
+// login before serving them, to the _headers file. Rules of a _headers
+// file in the content tree come first. The logins are written as they are
+// configured, so the credentials behind their variables never end up in
+// the output.
+func (s *Site) writeAccessHeaders() error {
+	if !s.Access.Headers {
+		return nil
+	}
+
+	basicAuth := s.Access.BasicAuth
+	var b bytes.Buffer
+	if s.output.Exists(headersFile) {
+		data, err := s.output.ReadFile(headersFile)
+		if err != nil {
+			return err
+		}
+		b.Write(bytes.TrimRight(data, "\n"))
+		b.WriteString("\n\n")
+	}
+	start := b.Len()
+	for _, page := range s.pages {
+		if !page.protected() {
+			continue
+		}
+		paths := []string{page.URL}
+		for _, out := range s.pageOutputs(page) {
+			if link := s.url(out); link != page.URL && s.output.Exists(out) {
+				paths = append(paths, link)
+			}
+		}
+		for _, p := range paths {
+			fmt.Fprintf(&b, "%s\n  X-Robots-Tag: noindex\n", p)
+			if basicAuth != "" {
+				fmt.Fprintf(&b, "  Basic-Auth: %s\n", basicAuth)
+			}
+		}
+	}
+	if b.Len() == start {
+		return nil
+	}
+	return s.output.WriteFile(headersFile, b.Bytes())
+}
+
+// isHostFile reports whether a request is for one of the files configuring
+// the host, which the server keeps to itself like the hosts do
+func isHostFile(urlPath string) bool {
+	name := path.Base(path.Clean("/" + urlPath))
+	return strings.EqualFold(name, headersFile) || strings.EqualFold(name, redirectsFile)
+}
+
+// hideHostFiles answers requests for the host's configuration files with a
+// 404 instead of passing them on
+func hideHostFiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHostFile(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
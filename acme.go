@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const defaultACMEListen = ":443" // Address the sites are served on with -acme, unless -listen is given
+
+// acmeDomains returns the domains given with -domain
+func acmeDomains() []string {
+	var domains []string
+	for _, domain := range strings.Split(*acmeDomain, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// serveACME obtains certificates for the -domain names from Let's Encrypt
+// and renews them before they expire, for serving the sites over HTTPS
+// straight from mindoc. The listeners are wrapped to speak TLS, and plain
+// HTTP is served on -acme-http to answer the HTTP challenges and redirect
+// everything else to HTTPS.
+func serveACME(listeners []net.Listener, cfg ServerConfig) ([]net.Listener, error) {
+	domains := acmeDomains()
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("-acme needs the domain names to get certificates for with -domain")
+	}
+
+	cacheDir := *acmeCache
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find a directory for the certificates, give one with -acme-cache: %w", err)
+		}
+		cacheDir = filepath.Join(userCache, "mindoc", "acme")
+	}
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      *acmeEmail,
+	}
+
+	if *acmeHTTP != "" {
+		ln, err := net.Listen("tcp", *acmeHTTP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for HTTP challenges: %w", err)
+		}
+		go func() {
+			err := newServer(cfg, m.HTTPHandler(nil)).Serve(ln)
+			log.Fatalf("Failed to serve HTTP challenges: %v", err)
+		}()
+	}
+
+	// Certificates can also be obtained through TLS-ALPN challenges on the
+	// HTTPS port, which the manager's TLS config answers
+	tlsConfig := m.TLSConfig()
+	for i, ln := range listeners {
+		listeners[i] = tls.NewListener(ln, tlsConfig)
+	}
+	fmt.Printf("Certificates for %s are kept in %s\n", strings.Join(domains, ", "), cacheDir)
+	return listeners, nil
+}
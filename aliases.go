@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// aliasTemplate is the page written at each alias of a page, sending
+// browsers and search engines on to the page
+var aliasTemplate = template.Must(template.New("alias").Parse(`<!DOCTYPE html>
+<html lang="{{ .Lang }}">
+<head>
+    <meta charset="UTF-8">
+    <title>{{ .Title }}</title>
+    <link rel="canonical" href="{{ .Canonical }}">
+    <meta name="robots" content="noindex">
+    <meta http-equiv="refresh" content="0; url={{ .URL }}">
+</head>
+<body>
+    <p><a href="{{ .URL }}">{{ .Title }}</a></p>
+</body>
+</html>
+`))
+
+// movedPage is a page URL of the previous build that the latest build no
+// longer generates
+type movedPage struct {
+	Path   string // Path within the output of the previous build
+	Source string // Page it was made from
+	Page   *Page  // Page it moved to, nil when unknown
+}
+
+// aliasPath returns the path within the output of the redirect written for
+// an alias, which is a URL path of the site such as /guide/setup.html or
+// /guide/setup/
+func (s *Site) aliasPath(alias string) (string, error) {
+	p := strings.TrimPrefix(path.Clean("/"+alias), "/")
+	if base := strings.Trim(s.basePath, "/"); base != "" && strings.HasPrefix(p+"/", base+"/") {
+		p = strings.TrimPrefix(strings.TrimPrefix(p, base), "/")
+	}
+	if p == "" || p == "." {
+		return "", fmt.Errorf("alias %q is the site's root", alias)
+	}
+	if strings.HasSuffix(alias, "/") || path.Ext(p) == "" {
+		p = path.Join(p, "index.html")
+	}
+	return p, nil
+}
+
+// aliasPaths returns the paths within the output of the redirects of a
+// page's aliases
+func (s *Site) aliasPaths(page *Page) []string {
+	var paths []string
+	for _, alias := range page.Aliases {
+		if p, err := s.aliasPath(alias); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// writeAliases writes a redirect to the page at each of its aliases, the
+// URLs it had before it moved, so links to them keep working
+func (s *Site) writeAliases() error {
+	for _, page := range s.pages {
+		for _, alias := range page.Aliases {
+			p, err := s.aliasPath(alias)
+			if err != nil {
+				return fmt.Errorf("invalid alias of %s: %w", page.Path, err)
+			}
+			if s.output.Exists(p) {
+				return fmt.Errorf("alias %s of %s is the path of another file", alias, page.Path)
+			}
+
+			var b strings.Builder
+			err = aliasTemplate.Execute(&b, struct {
+				Lang, Title, URL, Canonical string
+			}{s.Language, page.Title, page.URL, s.absURL(page.URL)})
+			if err != nil {
+				return err
+			}
+			err = s.output.WriteFile(p, []byte(b.String()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findMovedPages compares the pages of the build with the build manifest
+// of the previous build, returning the URLs of pages it had that are gone,
+// such as after a page was renamed or its section moved. A page that moved
+// is found by its source file, which git's rename detection follows when
+// it was renamed too.
+func (s *Site) findMovedPages() ([]movedPage, error) {
+	previous, err := s.previousManifest()
+	if err != nil || previous == nil {
+		return nil, err
+	}
+
+	var moved []movedPage
+	for _, entry := range previous.Files {
+		if entry.Source == "" || !s.isPage(entry.Source) || path.Ext(entry.Path) != ".html" ||
+			strings.HasSuffix(entry.Path, printSuffix) || s.output.Exists(entry.Path) {
+			continue
+		}
+		moved = append(moved, movedPage{Path: entry.Path, Source: entry.Source})
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	bySource := make(map[string]*Page, len(s.pages))
+	for _, page := range s.pages {
+		bySource[page.Path] = page
+	}
+	renames := s.contentRenames()
+	for i := range moved {
+		source := moved[i].Source
+		for seen := 0; bySource[source] == nil && renames[source] != "" && seen < len(renames); seen++ {
+			source = renames[source]
+		}
+		moved[i].Page = bySource[source]
+	}
+	return moved, nil
+}
+
+// contentRenames returns the files of the content tree git saw renamed, in
+// the history of the local mounts and in their uncommitted changes, by
+// their old path within the content tree
+func (s *Site) contentRenames() map[string]string {
+	renames := make(map[string]string)
+	for _, mount := range s.mounts() {
+		prefix := strings.Trim(path.Clean("/"+mount.Target), "/")
+		for _, args := range [][]string{
+			{"log", "-M", "--diff-filter=R", "--name-status", "--format=", "--relative", "HEAD"},
+			{"diff", "-M", "--diff-filter=R", "--name-status", "--relative", "HEAD"},
+		} {
+			output, err := exec.Command("git", append([]string{"-C", mount.Source}, args...)...).Output()
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(output), "\n") {
+				fields := strings.Split(line, "\t")
+				if len(fields) != 3 || !strings.HasPrefix(fields[0], "R") {
+					continue
+				}
+				renames[path.Join(prefix, fields[1])] = path.Join(prefix, fields[2])
+			}
+		}
+	}
+	return renames
+}
+
+// reportMovedPages warns about the URLs of the previous build that are
+// gone, suggesting the aliases that keep links to them working, and
+// returns how many there are
+func (s *Site) reportMovedPages() (int, error) {
+	moved, err := s.findMovedPages()
+	if err != nil || len(moved) == 0 {
+		return 0, err
+	}
+
+	fmt.Printf("%s: %d page URL(s) of the previous build are gone:\n", s.label(), len(moved))
+	suggestions := make(map[*Page][]string)
+	var pages []*Page
+	for _, m := range moved {
+		if m.Page == nil {
+			fmt.Printf("  %s (from %s) is no longer generated; add it to the aliases of the page replacing it\n", s.aliasURL(m.Path), m.Source)
+			continue
+		}
+		if suggestions[m.Page] == nil {
+			pages = append(pages, m.Page)
+		}
+		suggestions[m.Page] = append(suggestions[m.Page], s.aliasURL(m.Path))
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Path < pages[j].Path
+	})
+	for _, page := range pages {
+		fmt.Printf("  %s moved to %s; add to its front matter:\n    aliases: [%s]\n", strings.Join(suggestions[page], ", "), page.Path,
+			strings.Join(append(append([]string{}, page.Aliases...), suggestions[page]...), ", "))
+	}
+	return len(moved), nil
+}
+
+// aliasURL returns the URL path a file of the output was linked with, as
+// an alias names it
+func (s *Site) aliasURL(outputPath string) string {
+	if s.URLs.TrailingSlash {
+		outputPath = strings.TrimSuffix(outputPath, "index.html")
+	}
+	return s.url(outputPath)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	authorsFile      = "./data/authors.yaml" // File describing the authors pages can name
+	authorsPath      = "authors"             // Directory of the generated author pages
+	authorLayoutFile = "author.html"         // Template of the author pages, page.html when missing
+)
+
+// AuthorsConfig locates the author profiles and their listing pages
+type AuthorsConfig struct {
+	File string `yaml:"file"` // YAML file of the profiles by ID, ./data/authors.yaml when unset
+	Path string `yaml:"path"` // Directory the author pages are generated in, "authors" when unset
+}
+
+// Author is a profile pages can name in their authors front matter
+type Author struct {
+	ID     string       `yaml:"-" json:"id"`
+	Name   string       `yaml:"name" json:"name"`
+	Avatar string       `yaml:"avatar" json:"avatar,omitempty"` // Image URL
+	Bio    string       `yaml:"bio" json:"bio,omitempty"`
+	Links  []AuthorLink `yaml:"links" json:"links,omitempty"`
+	URL    string       `yaml:"-" json:"url"` // URL of the author's page
+	Pages  Pages        `yaml:"-" json:"-"`   // Published pages naming the author, newest first
+}
+
+// AuthorLink is a link on an author's profile, such as a GitHub account
+type AuthorLink struct {
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+// loadAuthors reads the author profiles. A site without the file has no
+// authors.
+func (s *Site) loadAuthors() (map[string]*Author, error) {
+	file := s.Authors.File
+	if file == "" {
+		file = filepath.Join(s.dataDir, authorsFile)
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && s.Authors.File == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authors: %w", err)
+	}
+
+	var authors map[string]*Author
+	err = yaml.Unmarshal(data, &authors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	for id, author := range authors {
+		author.ID = id
+		if author.Name == "" {
+			author.Name = id
+		}
+		author.URL = s.pageURL(s.authorPagePath(id))
+	}
+	return authors, nil
+}
+
+// authorPagePath returns where an author's page is in the content tree, as
+// if it were a page file
+func (s *Site) authorPagePath(id string) string {
+	dir := s.Authors.Path
+	if dir == "" {
+		dir = authorsPath
+	}
+	return path.Join(strings.Trim(dir, "/"), slugify(id)+".md")
+}
+
+// resolveAuthors gives every page the profiles its authors front matter
+// names and lists the pages on each profile
+func (s *Site) resolveAuthors() error {
+	authors, err := s.loadAuthors()
+	if err != nil {
+		return err
+	}
+
+	s.authors = nil
+	for _, page := range s.pages {
+		page.Authors = nil
+		for _, id := range page.authorIDs {
+			author, ok := authors[id]
+			if !ok {
+				return fmt.Errorf("%s: unknown author %q", page.srcPath, id)
+			}
+			if len(author.Pages) == 0 {
+				s.authors = append(s.authors, author)
+			}
+			author.Pages = append(author.Pages, page)
+			page.Authors = append(page.Authors, author)
+		}
+	}
+
+	sort.Slice(s.authors, func(i, j int) bool {
+		return s.authors[i].Name < s.authors[j].Name
+	})
+	for _, author := range s.authors {
+		author.Pages = author.Pages.ByDate().Reverse()
+	}
+	return nil
+}
+
+// AuthorList returns the authors with published pages, by name, as in
+// {{ range .Site.AuthorList }}
+func (s *Site) AuthorList() []*Author {
+	return s.authors
+}
+
+// writeAuthorPages generates a page for every author listing their pages
+func (s *Site) writeAuthorPages() error {
+	for _, author := range s.authors {
+		page := s.generatedPage(s.authorPagePath(author.ID), author.Name, authorLayoutFile)
+		data := s.newPageData(page)
+		data.Author = author
+		data.Content = s.authorListing(author)
+
+		err := s.writeGeneratedPage(data)
+		if err != nil {
+			return fmt.Errorf("failed to write the page of author %s: %w", author.ID, err)
+		}
+	}
+	return nil
+}
+
+// authorListing returns the profile of an author and the list of their
+// pages, the content of the author's page with the default layout
+func (s *Site) authorListing(author *Author) template.HTML {
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	out.WriteString(`<div class="author-profile">`)
+	if author.Avatar != "" {
+		fmt.Fprintf(&out, `<img class="avatar" src="%s" alt="" width="96" height="96">`, esc(author.Avatar))
+	}
+	fmt.Fprintf(&out, `<h1>%s</h1>`, esc(author.Name))
+	if author.Bio != "" {
+		fmt.Fprintf(&out, `<p>%s</p>`, esc(author.Bio))
+	}
+	if len(author.Links) > 0 {
+		out.WriteString(`<ul class="author-links">`)
+		for _, link := range author.Links {
+			fmt.Fprintf(&out, `<li><a href="%s" rel="me">%s</a></li>`, esc(link.URL), esc(link.Name))
+		}
+		out.WriteString(`</ul>`)
+	}
+	out.WriteString("</div>\n")
+
+	fmt.Fprintf(&out, "<h2>%s</h2>\n<ul>\n", esc(s.translate("pagesByAuthor", author.Name)))
+	for _, page := range author.Pages.Visible() {
+		fmt.Fprintf(&out, `<li>%s<a href="%s">%s</a>`, s.thumbnailTag(page), esc(page.URL), esc(page.Title))
+		if !page.Date.IsZero() {
+			fmt.Fprintf(&out, ` <time datetime="%s">%s</time>`, page.Date.Format("2006-01-02"), page.Date.Format("2006-01-02"))
+		}
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</ul>\n")
+	return template.HTML(out.String())
+}
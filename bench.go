@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const benchPagesPerSection = 20 // Pages in each section of the synthetic site
+
+// runBenchmarks generates a synthetic site and benchmarks the stages of
+// building it: loading the pages, building the navigation, rendering and a
+// full build. The same seed always produces the same site, so results can
+// be compared between versions.
+func runBenchmarks(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	pages := fs.Int("pages", 1000, "number of pages in the synthetic site")
+	images := fs.Int("images", 100, "number of images in the synthetic site")
+	seed := fs.Int64("seed", 1, "seed for the generated content")
+	keep := fs.String("keep", "", "write the synthetic site to this directory and keep it")
+	save := fs.String("save", "", "save the results as JSON to this file, to compare later runs against")
+	compare := fs.String("compare", "", "compare the results with ones saved earlier, failing on regressions")
+	threshold := fs.Float64("threshold", 0.2, "slowdown over the saved results that counts as a regression")
+	fs.Parse(args)
+
+	dir := *keep
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "mindoc-bench-")
+		if err != nil {
+			return fmt.Errorf("failed to create benchmark directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	contentDir := filepath.Join(dir, "content")
+	err := generateSyntheticSite(contentDir, *pages, *images, *seed)
+	if err != nil {
+		return fmt.Errorf("failed to generate the synthetic site: %w", err)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.Sites = nil
+	cfg.ContentDir = contentDir
+	cfg.OutputDir = filepath.Join(dir, "public")
+	cfg.Hooks = Hooks{}
+	cfg.Remotes = nil
+	cfg.GoDoc = GoDocConfig{}
+	cfg.CLI = nil
+	cfg.Mounts = nil
+
+	sites, err := newSites(cfg)
+	if err != nil {
+		return err
+	}
+	site := sites[0]
+	site.output = newMemoryOutput()
+	err = site.loadPages()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Synthetic site: %d pages, %d images in %s\n", *pages, *images, contentDir)
+	fmt.Printf("%-8s %8s %14s %14s %12s\n", "stage", "runs", "time/op", "bytes/op", "allocs/op")
+
+	stages := []struct {
+		name string
+		run  func() error
+	}{
+		{"load", site.loadPages},
+		{"nav", func() error {
+			for _, page := range site.pages {
+				site.generateNavBar(page.Path)
+				markActive(site.navTree, page.Path)
+			}
+			return nil
+		}},
+		{"render", func() error {
+			site.output = newMemoryOutput()
+			for _, page := range site.pages {
+				err := site.convertMarkdownToHTML(page)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"build", func() error {
+			site.output = newMemoryOutput()
+			return site.build()
+		}},
+	}
+
+	results := make(map[string]benchResult)
+	for _, stage := range stages {
+		var stageErr error
+		result := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := stage.run()
+				if err != nil {
+					stageErr = err
+					b.FailNow()
+				}
+			}
+		})
+		if stageErr != nil {
+			return fmt.Errorf("%s failed: %w", stage.name, stageErr)
+		}
+
+		fmt.Printf("%-8s %8d %14s %14d %12d\n", stage.name, result.N,
+			time.Duration(result.NsPerOp()).Round(time.Microsecond), result.AllocedBytesPerOp(), result.AllocsPerOp())
+		results[stage.name] = benchResult{
+			NsPerOp:     result.NsPerOp(),
+			BytesPerOp:  result.AllocedBytesPerOp(),
+			AllocsPerOp: result.AllocsPerOp(),
+		}
+	}
+
+	if *save != "" {
+		data, err := json.MarshalIndent(benchResults{Pages: *pages, Images: *images, Seed: *seed, Stages: results}, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(*save, data, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to save results: %w", err)
+		}
+	}
+
+	if *compare != "" {
+		return compareBenchmarks(*compare, results, *threshold)
+	}
+
+	return nil
+}
+
+// benchResults are the saved results of a benchmark run
+type benchResults struct {
+	Pages  int                    `json:"pages"`
+	Images int                    `json:"images"`
+	Seed   int64                  `json:"seed"`
+	Stages map[string]benchResult `json:"stages"`
+}
+
+// benchResult is the cost of running a stage once
+type benchResult struct {
+	NsPerOp     int64 `json:"nsPerOp"`
+	BytesPerOp  int64 `json:"bytesPerOp"`
+	AllocsPerOp int64 `json:"allocsPerOp"`
+}
+
+// compareBenchmarks reports how the results differ from saved ones and
+// fails when a stage got slower by more than the threshold
+func compareBenchmarks(baselinePath string, results map[string]benchResult, threshold float64) error {
+	data, err := ioutil.ReadFile(baselinePath)
+	if err != nil {
+		return fmt.Errorf("failed to read saved results: %w", err)
+	}
+	var baseline benchResults
+	err = json.Unmarshal(data, &baseline)
+	if err != nil {
+		return fmt.Errorf("failed to parse saved results %s: %w", baselinePath, err)
+	}
+
+	fmt.Printf("\nCompared with %s (%d pages, %d images):\n", baselinePath, baseline.Pages, baseline.Images)
+	var regressions []string
+	for _, name := range []string{"load", "nav", "render", "build"} {
+		old, ok := baseline.Stages[name]
+		if !ok || old.NsPerOp == 0 {
+			continue
+		}
+		change := float64(results[name].NsPerOp-old.NsPerOp) / float64(old.NsPerOp)
+		fmt.Printf("%-8s %+7.1f%% time %+7.1f%% bytes\n", name, change*100,
+			100*float64(results[name].BytesPerOp-old.BytesPerOp)/float64(max(old.BytesPerOp, 1)))
+		if change > threshold {
+			regressions = append(regressions, name)
+		}
+	}
+
+	if len(regressions) > 0 {
+		return fmt.Errorf("slower than the saved results: %s", strings.Join(regressions, ", "))
+	}
+	return nil
+}
+
+// generateSyntheticSite writes a content tree of pages spread over nested
+// sections, linking to each other and to generated images
+func generateSyntheticSite(dir string, pages, images int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+
+	imagePaths := make([]string, images)
+	for i := range imagePaths {
+		imagePaths[i] = fmt.Sprintf("images/image-%04d.png", i)
+		data, err := syntheticImage(rng)
+		if err != nil {
+			return err
+		}
+		err = writeSyntheticFile(dir, imagePaths[i], data)
+		if err != nil {
+			return err
+		}
+	}
+
+	pagePaths := make([]string, pages)
+	for i := range pagePaths {
+		section := i / benchPagesPerSection
+		pagePaths[i] = fmt.Sprintf("section-%03d/part-%d/page-%05d.md", section/5, section%5, i)
+		if i == 0 {
+			pagePaths[i] = "index.md"
+		}
+	}
+
+	for i, pagePath := range pagePaths {
+		var page strings.Builder
+		fmt.Fprintf(&page, "---\ntitle: Page %d\nweight: %d\ntags: [tag-%d, tag-%d]\ndate: 2024-01-%02d\n---\n\n", i, rng.Intn(100), rng.Intn(10), rng.Intn(10), 1+rng.Intn(28))
+		fmt.Fprintf(&page, "# Page %d\n\n", i)
+
+		sections := 3 + rng.Intn(5)
+		for section := 0; section < sections; section++ {
+			fmt.Fprintf(&page, "## Section %d\n\n", section)
+			paragraphs := 2 + rng.Intn(4)
+			for p := 0; p < paragraphs; p++ {
+				page.WriteString(syntheticParagraph(rng))
+				if len(pagePaths) > 1 && rng.Intn(3) == 0 {
+					target := pagePaths[rng.Intn(len(pagePaths))]
+					rel, _ := filepath.Rel(filepath.Dir(pagePath), target)
+					fmt.Fprintf(&page, " See [page](%s).", filepath.ToSlash(rel))
+				}
+				page.WriteString("\n\n")
+			}
+			if len(imagePaths) > 0 && rng.Intn(2) == 0 {
+				rel, _ := filepath.Rel(filepath.Dir(pagePath), imagePaths[rng.Intn(len(imagePaths))])
+				fmt.Fprintf(&page, "![Figure](%s)\n\n", filepath.ToSlash(rel))
+			}
+			if rng.Intn(2) == 0 {
+				page.WriteString("- first item\n- second item with `code`\n- third item\n\n")
+			}
+			if rng.Intn(3) == 0 {
+				page.WriteString("```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```\n\n")
+			}
+		}
+
+		err := writeSyntheticFile(dir, pagePath, []byte(page.String()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syntheticWords are the words synthetic paragraphs are made of
+var syntheticWords = strings.Fields("the site generator renders markdown pages into documentation with navigation search and templates for every section of content")
+
+// syntheticParagraph returns a paragraph of random words with some inline
+// formatting
+func syntheticParagraph(rng *rand.Rand) string {
+	words := make([]string, 30+rng.Intn(50))
+	for i := range words {
+		words[i] = syntheticWords[rng.Intn(len(syntheticWords))]
+		switch rng.Intn(20) {
+		case 0:
+			words[i] = "**" + words[i] + "**"
+		case 1:
+			words[i] = "*" + words[i] + "*"
+		}
+	}
+	return strings.Join(words, " ") + "."
+}
+
+// syntheticImage returns a small PNG of random colors
+func syntheticImage(rng *rand.Rand) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// writeSyntheticFile writes a file of the synthetic site
+func writeSyntheticFile(dir, relPath string, data []byte) error {
+	destPath := filepath.Join(dir, filepath.FromSlash(relPath))
+	err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(destPath, data, 0644)
+}
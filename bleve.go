@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	_ "github.com/blevesearch/bleve/v2/config" // Analyzers of the languages bleve supports
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	bleveDir         = ".mindoc/bleve" // Directory keeping the bleve index of each site
+	bleveAPIPath     = "api/search"    // Path of the bleve search endpoint below the site's base path
+	bleveBatchSize   = 500             // Records indexed per batch
+	bleveFragmentMax = 3               // Highlighted fragments of the text returned per result
+)
+
+// bleveResult is a record matching a query, with its matches highlighted,
+// as the bleve search endpoint returns it
+type bleveResult struct {
+	URL       string   `json:"url"`
+	Page      string   `json:"page"`
+	Title     string   `json:"title"`
+	Section   string   `json:"section,omitempty"`
+	Headings  []string `json:"headings"`
+	Fragments []string `json:"fragments"` // Parts of the text with the matches in <mark> elements
+	Score     float64  `json:"score"`
+}
+
+// bleveIndexDir returns the directory of the site's bleve index
+func (s *Site) bleveIndexDir() string {
+	name := s.Name
+	if name == "" {
+		name = "site"
+	}
+	return filepath.Join(bleveDir, slugify(name))
+}
+
+// bleveMapping describes how the fields of the search records are indexed.
+// Only the ones results show are stored, and the text is analysed in the
+// site's language when bleve knows it.
+func (s *Site) bleveMapping() mapping.IndexMapping {
+	m := bleve.NewIndexMapping()
+	analyzer := "standard"
+	if code := strings.ToLower(strings.SplitN(s.Language, "-", 2)[0]); code != "" && m.AnalyzerNamed(code) != nil {
+		analyzer = code
+	}
+
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = analyzer
+	text.IncludeTermVectors = true
+	keyword := bleve.NewKeywordFieldMapping()
+	unindexed := bleve.NewTextFieldMapping()
+	unindexed.Index = false
+
+	record := bleve.NewDocumentStaticMapping()
+	record.AddFieldMappingsAt("title", text)
+	record.AddFieldMappingsAt("headings", text)
+	record.AddFieldMappingsAt("text", text)
+	record.AddFieldMappingsAt("tags", keyword)
+	record.AddFieldMappingsAt("section", keyword)
+	record.AddFieldMappingsAt("url", unindexed)
+	record.AddFieldMappingsAt("page", unindexed)
+
+	m.DefaultMapping = record
+	m.DefaultAnalyzer = analyzer
+	return m
+}
+
+// updateBleveIndex indexes the search records of the build that was just
+// put in place with bleve, for large sites searched on the server. The
+// index is built next to the previous one and replaces it once complete,
+// and is opened for the search endpoint when the site is served.
+func (s *Site) updateBleveIndex() error {
+	if !s.Search.Bleve {
+		return nil
+	}
+
+	dir := s.bleveIndexDir()
+	err := os.MkdirAll(filepath.Dir(dir), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create bleve index directory: %w", err)
+	}
+	buildDir, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-build-")
+	if err != nil {
+		return fmt.Errorf("failed to create bleve index directory: %w", err)
+	}
+	// bleve creates the directory itself
+	os.Remove(buildDir)
+
+	index, err := bleve.New(buildDir, s.bleveMapping())
+	if err != nil {
+		return fmt.Errorf("failed to create bleve index: %w", err)
+	}
+	batch := index.NewBatch()
+	for _, record := range s.searchRecords() {
+		err = batch.Index(record.ID, record)
+		if err == nil && batch.Size() >= bleveBatchSize {
+			err = index.Batch(batch)
+			batch.Reset()
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = index.Batch(batch)
+	}
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(buildDir)
+		return fmt.Errorf("failed to build bleve index: %w", err)
+	}
+
+	// Searches being answered finish before the index is replaced
+	s.serveMu.Lock()
+	defer s.serveMu.Unlock()
+	if s.bleve != nil {
+		s.bleve.Close()
+		s.bleve = nil
+	}
+	err = replaceDir(buildDir, dir)
+	if err != nil {
+		os.RemoveAll(buildDir)
+		return fmt.Errorf("failed to replace bleve index: %w", err)
+	}
+	if s.indexing {
+		return s.openBleveIndex()
+	}
+	return nil
+}
+
+// openBleveIndex opens the site's bleve index for the search endpoint,
+// such as the one of an earlier build when the sites aren't built on start
+func (s *Site) openBleveIndex() error {
+	index, err := bleve.OpenUsing(s.bleveIndexDir(), map[string]interface{}{"read_only": true})
+	if err != nil {
+		return fmt.Errorf("failed to open bleve index: %w", err)
+	}
+	s.bleve = index
+	return nil
+}
+
+// serveBleveSearch answers queries from the site's bleve index. The q
+// parameter takes bleve's query string syntax, such as +install -docker
+// or title:upgrade, and size and from page through the results.
+func (s *Site) serveBleveSearch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.bleve == nil {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, s.label()+" has no search index until it is built", http.StatusServiceUnavailable)
+			return
+		}
+
+		params := r.URL.Query()
+		size := searchResultLimit
+		if n, err := strconv.Atoi(params.Get("size")); err == nil && n > 0 {
+			size = min(n, searchResultMax)
+		}
+		from, _ := strconv.Atoi(params.Get("from"))
+
+		q := query.NewQueryStringQuery(params.Get("q"))
+		if _, err := q.Parse(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+			return
+		}
+		// Matches in titles and headings rank above ones in the text
+		title := query.NewMatchQuery(params.Get("q"))
+		title.SetField("title")
+		title.SetBoost(3)
+		headings := query.NewMatchQuery(params.Get("q"))
+		headings.SetField("headings")
+		headings.SetBoost(2)
+		ranked := query.NewBooleanQuery([]query.Query{q}, []query.Query{title, headings}, nil)
+
+		req := bleve.NewSearchRequestOptions(ranked, size, max(0, from), false)
+		req.Fields = []string{"url", "page", "title", "section", "headings"}
+		req.Highlight = bleve.NewHighlightWithStyle("html")
+		req.Highlight.AddField("text")
+		res, err := s.bleve.Search(req)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("search failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		results := make([]bleveResult, len(res.Hits))
+		for i, hit := range res.Hits {
+			fragments := hit.Fragments["text"]
+			if len(fragments) > bleveFragmentMax {
+				fragments = fragments[:bleveFragmentMax]
+			}
+			results[i] = bleveResult{
+				URL:       storedString(hit.Fields["url"]),
+				Page:      storedString(hit.Fields["page"]),
+				Title:     storedString(hit.Fields["title"]),
+				Section:   storedString(hit.Fields["section"]),
+				Headings:  storedStrings(hit.Fields["headings"]),
+				Fragments: append([]string{}, fragments...),
+				Score:     hit.Score,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Query   string        `json:"query"`
+			Total   uint64        `json:"total"`
+			Results []bleveResult `json:"results"`
+		}{params.Get("q"), res.Total, results})
+	})
+}
+
+// storedString returns a stored field of a hit as text
+func storedString(value interface{}) string {
+	text, _ := value.(string)
+	return text
+}
+
+// storedStrings returns a stored list field of a hit, which bleve gives as
+// a single string when it has one item
+func storedStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, storedString(item))
+		}
+		return list
+	}
+	return []string{}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	renderCacheDir     = ".mindoc/cache/render" // Directory where rendered page bodies are cached
+	renderCacheVersion = "2"                    // Changed whenever the cached rendering changes
+)
+
+// CacheConfig describes the cache of rendered page bodies, kept locally and
+// optionally shared between machines through an HTTP server
+type CacheConfig struct {
+	Enabled  bool              `yaml:"enabled"`  // Cache rendered pages in the local cache directory
+	Dir      string            `yaml:"dir"`      // Local cache directory, .mindoc/cache/render when unset
+	Remote   string            `yaml:"remote"`   // Base URL of a shared cache answering GET and PUT, enables the cache
+	Headers  map[string]string `yaml:"headers"`  // Headers sent to the shared cache, with $VARIABLES expanded
+	ReadOnly bool              `yaml:"readOnly"` // Only read from the shared cache, never upload to it
+}
+
+// renderCache stores rendered page bodies by a hash of everything the
+// rendering depends on
+type renderCache struct {
+	CacheConfig
+	client       *http.Client
+	hits, misses int
+}
+
+// renderCacheEntry is a cached rendering of a page body
+type renderCacheEntry struct {
+	HTML    []byte            `json:"html"`
+	TOC     template.HTML     `json:"toc,omitempty"`
+	Outline []*OutlineHeading `json:"outline"`
+}
+
+// newRenderCache returns the site's render cache, or nil when caching is off
+func newRenderCache(cfg CacheConfig) *renderCache {
+	if !cfg.Enabled && cfg.Remote == "" {
+		return nil
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = renderCacheDir
+	}
+	return &renderCache{CacheConfig: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// renderCacheKey hashes what the HTML of a markdown page depends on: its
+// source, its path (links are resolved relative to it), the markdown
+// flavour, the settings deciding page paths and URLs, the files its
+// shortcodes read, and the language and theme strings its controls are
+// written in, so translations never share entries
+func (s *Site) renderCacheKey(page *Page, flavour markdownFlavour) string {
+	exts := make([]string, 0, len(s.renderers)+len(s.markdownConfigs))
+	for ext := range s.renderers {
+		exts = append(exts, ext)
+	}
+	for ext := range s.markdownConfigs {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	// Code block and feedback controls carry theme strings
+	var strs map[string]map[string]string
+	if s.theme != nil {
+		strs = s.theme.translations
+	}
+
+	settings, _ := json.Marshal(struct {
+		Version  string
+		Path     string
+		Flavour  markdownFlavour
+		URLs     URLConfig
+		BasePath string
+		Exts     []string
+		Feedback FeedbackConfig
+		Glossary GlossaryConfig
+		Terms    []*GlossaryEntry
+		Works    []string
+		Abbrs    map[string]string
+		Code     CodeBlocksConfig
+		Files    map[string]string
+		Images   ImagesConfig
+		Stamps   map[string]string
+		Media    MediaConfig
+		Diagrams map[string]DiagramConfig
+		Language string
+		Strings  map[string]map[string]string
+	}{renderCacheVersion, page.Path, flavour, s.URLs, s.basePath, exts, s.Feedback, s.Glossary, s.GlossaryEntries(), s.bibliographyEntries(), s.abbreviations, s.CodeBlocks, shortcodeFileHashes(page.body), s.Images, s.imageStamps(page), s.Media, s.Diagrams, s.Language, strs})
+
+	hash := sha256.New()
+	hash.Write(settings)
+	hash.Write([]byte{0})
+	hash.Write(page.body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns a cached rendering from the local cache, or from the shared
+// cache, keeping a local copy of it
+func (c *renderCache) get(key string) (renderCacheEntry, bool) {
+	var entry renderCacheEntry
+
+	data, err := ioutil.ReadFile(c.localPath(key))
+	if err != nil && c.Remote != "" {
+		data, err = c.fetch(key)
+		if err == nil {
+			c.store(key, data)
+		}
+	}
+	if err == nil && json.Unmarshal(data, &entry) == nil {
+		c.hits++
+		return entry, true
+	}
+
+	c.misses++
+	return entry, false
+}
+
+// put adds a rendering to the local cache and uploads it to the shared one
+func (c *renderCache) put(key string, entry renderCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.store(key, data)
+
+	if c.Remote != "" && !c.ReadOnly {
+		err = c.upload(key, data)
+		if err != nil {
+			log.Printf("Failed to upload to the render cache: %v", err)
+		}
+	}
+}
+
+// localPath returns the file a rendering is cached in locally
+func (c *renderCache) localPath(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// store writes a rendering to the local cache
+func (c *renderCache) store(key string, data []byte) {
+	p := c.localPath(key)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(p, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to write to the render cache: %v", err)
+	}
+}
+
+// request sends a request for a key to the shared cache
+func (c *renderCache) request(method, key string, body io.Reader) (*http.Response, error) {
+	base := c.Remote
+	if base[len(base)-1] != '/' {
+		base += "/"
+	}
+	req, err := http.NewRequest(method, base+key, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	return c.client.Do(req)
+}
+
+// fetch downloads a rendering from the shared cache
+func (c *renderCache) fetch(key string) ([]byte, error) {
+	resp, err := c.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// upload stores a rendering in the shared cache
+func (c *renderCache) upload(key string, data []byte) error {
+	resp, err := c.request(http.MethodPut, key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// cachedBody returns a body writer that stores what it renders in the cache
+func (s *Site) cachedBody(key string, toc template.HTML, outline []*OutlineHeading, writeBody bodyWriter) bodyWriter {
+	return func(w io.Writer) error {
+		var buf bytes.Buffer
+		err := writeBody(io.MultiWriter(w, &buf))
+		if err != nil {
+			return err
+		}
+		s.cache.put(key, renderCacheEntry{HTML: buf.Bytes(), TOC: toc, Outline: outline})
+		return nil
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const chunksFile = "chunks.jsonl" // Export of the page chunks, one JSON object per line
+
+// ChunksConfig controls the export of pages split into chunks, ready to be
+// embedded into a vector database
+type ChunksConfig struct {
+	Enabled  bool   `yaml:"enabled"`  // Write the chunks export
+	File     string `yaml:"file"`     // Output path of the export, chunks.jsonl when unset
+	Level    int    `yaml:"level"`    // Deepest heading level starting a chunk, 3 when unset
+	MaxWords int    `yaml:"maxWords"` // Split longer chunks at paragraphs, 0 for no limit
+}
+
+// textChunk is a part of a page under one heading
+type textChunk struct {
+	ID       string   `json:"id"`                // Page path and anchor, with the part number for split chunks
+	URL      string   `json:"url"`               // Link to the chunk's heading
+	Page     string   `json:"page"`              // Source path of the page
+	Title    string   `json:"title"`             // Title of the page
+	Section  string   `json:"section,omitempty"` // Top-level section of the page
+	Headings []string `json:"headings"`          // Headings above the chunk, outermost first
+	Tags     []string `json:"tags,omitempty"`    // Tags of the page
+	Text     string   `json:"text"`              // Plain text of the chunk
+}
+
+// chunkSegment is the HTML under a heading before it is turned into chunks
+type chunkSegment struct {
+	anchor   string
+	headings []string
+	html     bytes.Buffer
+}
+
+// collectChunks splits a page's rendered body at its headings and keeps the
+// chunks for the export. Headings are given IDs while the export is on, so
+// every chunk after one can link to it.
+func (s *Site) collectChunks(page *Page, content string) {
+	if !s.collectsChunks() || page.Hidden || page.protected() {
+		return
+	}
+
+	level := s.Chunks.Level
+	if level == 0 {
+		level = 3
+	}
+
+	// Split the body at every heading up to the chunk level, keeping track
+	// of the headings above each part
+	var headings []string
+	segments := []*chunkSegment{{headings: []string{}}}
+	z := html.NewTokenizer(strings.NewReader(content))
+	for z.Next() != html.ErrorToken {
+		token := z.Token()
+		depth := headingLevel(token.Data)
+		if token.Type != html.StartTagToken || depth == 0 || depth > level {
+			segments[len(segments)-1].html.Write(z.Raw())
+			continue
+		}
+
+		// Read the heading's text, leaving the tokenizer after its end tag
+		raw := append([]byte(nil), z.Raw()...)
+		var text strings.Builder
+		for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+			raw = append(raw, z.Raw()...)
+			if tt == html.TextToken {
+				text.Write(z.Text())
+			}
+			if name, _ := z.TagName(); tt == html.EndTagToken && string(name) == token.Data {
+				break
+			}
+		}
+
+		if depth-1 < len(headings) {
+			headings = headings[:depth-1]
+		}
+		for len(headings) < depth-1 {
+			headings = append(headings, "")
+		}
+		headings = append(headings, strings.TrimSpace(text.String()))
+
+		segment := &chunkSegment{headings: compactStrings(headings)}
+		for _, a := range token.Attr {
+			if a.Key == "id" {
+				segment.anchor = a.Val
+			}
+		}
+		segment.html.Write(raw)
+		segments = append(segments, segment)
+	}
+
+	for _, segment := range segments {
+		for i, text := range splitWords(plainText(segment.html.String()), s.Chunks.MaxWords) {
+			id := page.Path
+			link := page.URL
+			if segment.anchor != "" {
+				id += "#" + segment.anchor
+				link += "#" + segment.anchor
+			}
+			if i > 0 {
+				id += fmt.Sprintf(":%d", i+1)
+			}
+
+			s.chunks = append(s.chunks, textChunk{
+				ID:       id,
+				URL:      s.absURL(link),
+				Page:     page.Path,
+				Title:    page.Title,
+				Section:  page.Section,
+				Headings: segment.headings,
+				Tags:     page.Tags,
+				Text:     text,
+			})
+		}
+	}
+}
+
+// collectsChunks reports whether pages are split into chunks while they are
+// rendered, for the export or for a search index
+func (s *Site) collectsChunks() bool {
+	return s.Chunks.Enabled || s.indexing || s.Search.Static != "" || s.Search.Bleve
+}
+
+// headingLevel returns the level of a heading element, or 0 for any other
+func headingLevel(tag string) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+	return 0
+}
+
+// compactStrings returns a copy of a list without its empty strings
+func compactStrings(list []string) []string {
+	result := []string{}
+	for _, item := range list {
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// splitWords splits text at paragraphs into parts of at most maxWords
+// words, unless a single paragraph is longer. Empty text has no parts.
+func splitWords(text string, maxWords int) []string {
+	if text == "" {
+		return nil
+	}
+	if maxWords <= 0 {
+		return []string{text}
+	}
+
+	var parts []string
+	var part []string
+	words := 0
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		n := len(strings.Fields(paragraph))
+		if words > 0 && words+n > maxWords {
+			parts = append(parts, strings.Join(part, "\n\n"))
+			part, words = nil, 0
+		}
+		part = append(part, paragraph)
+		words += n
+	}
+	return append(parts, strings.Join(part, "\n\n"))
+}
+
+// writeChunks writes the collected chunks as JSON lines
+func (s *Site) writeChunks() error {
+	if !s.Chunks.Enabled {
+		return nil
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	for _, chunk := range s.chunks {
+		err := encoder.Encode(chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	file := s.Chunks.File
+	if file == "" {
+		file = chunksFile
+	}
+	return s.output.WriteFile(file, out.Bytes())
+}
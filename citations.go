@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// bibEntry is a work pages can cite, read from a BibTeX or CSL-JSON file
+type bibEntry struct {
+	Key       string
+	Type      string    // Kind of work, such as article or book
+	Authors   []bibName // Authors, or editors when there are none
+	Year      string
+	Title     string
+	Container string // Journal, book or proceedings the work appeared in
+	Volume    string
+	Pages     string
+	Publisher string
+	URL       string
+	DOI       string
+}
+
+// bibName is the name of an author of a cited work
+type bibName struct {
+	Family string
+	Given  string
+}
+
+// citation is a reference to a work in a page, such as [@smith2020, p. 4]
+type citation struct {
+	Key     string
+	Locator string // Part of the work cited, such as a page
+}
+
+// loadBibliography reads the works the site's pages can cite
+func (s *Site) loadBibliography() error {
+	s.bibliography = nil
+	if s.Bibliography == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.Bibliography)
+	if err != nil {
+		return fmt.Errorf("failed to read bibliography: %w", err)
+	}
+	var entries []*bibEntry
+	if strings.ToLower(filepath.Ext(s.Bibliography)) == ".json" {
+		entries, err = parseCSLJSON(data)
+	} else {
+		entries, err = parseBibTeX(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.Bibliography, err)
+	}
+
+	s.bibliography = make(map[string]*bibEntry)
+	for _, entry := range entries {
+		s.bibliography[entry.Key] = entry
+	}
+	return nil
+}
+
+// parseCSLJSON reads works from CSL-JSON, as exported by Zotero and pandoc
+func parseCSLJSON(data []byte) ([]*bibEntry, error) {
+	var items []struct {
+		ID     string    `json:"id"`
+		Type   string    `json:"type"`
+		Title  string    `json:"title"`
+		Author []cslName `json:"author"`
+		Editor []cslName `json:"editor"`
+		Issued struct {
+			DateParts [][]interface{} `json:"date-parts"`
+			Literal   string          `json:"literal"`
+		} `json:"issued"`
+		Container string      `json:"container-title"`
+		Volume    interface{} `json:"volume"`
+		Page      string      `json:"page"`
+		Publisher string      `json:"publisher"`
+		URL       string      `json:"URL"`
+		DOI       string      `json:"DOI"`
+	}
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*bibEntry, 0, len(items))
+	for _, item := range items {
+		entry := &bibEntry{
+			Key:       item.ID,
+			Type:      item.Type,
+			Year:      item.Issued.Literal,
+			Title:     item.Title,
+			Container: item.Container,
+			Pages:     item.Page,
+			Publisher: item.Publisher,
+			URL:       item.URL,
+			DOI:       item.DOI,
+		}
+		if item.Volume != nil {
+			entry.Volume = fmt.Sprint(item.Volume)
+		}
+		if len(item.Issued.DateParts) > 0 && len(item.Issued.DateParts[0]) > 0 {
+			entry.Year = fmt.Sprint(item.Issued.DateParts[0][0])
+		}
+		names := item.Author
+		if len(names) == 0 {
+			names = item.Editor
+		}
+		for _, name := range names {
+			if name.Literal != "" {
+				entry.Authors = append(entry.Authors, bibName{Family: name.Literal})
+			} else {
+				entry.Authors = append(entry.Authors, bibName{Family: name.Family, Given: name.Given})
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// cslName is a name in CSL-JSON
+type cslName struct {
+	Family  string `json:"family"`
+	Given   string `json:"given"`
+	Literal string `json:"literal"`
+}
+
+var (
+	bibEntryStart = regexp.MustCompile(`@(\w+)\s*[{(]`)
+	bibFieldName  = regexp.MustCompile(`^\s*([\w-]+)\s*=\s*`)
+	bibAnd        = regexp.MustCompile(`\s+and\s+`)
+)
+
+// parseBibTeX reads works from a BibTeX file. Field values can be braced,
+// quoted or bare numbers; @string macros and LaTeX commands beyond simple
+// escapes aren't supported.
+func parseBibTeX(data string) ([]*bibEntry, error) {
+	var entries []*bibEntry
+	for {
+		m := bibEntryStart.FindStringSubmatchIndex(data)
+		if m == nil {
+			return entries, nil
+		}
+		kind := strings.ToLower(data[m[2]:m[3]])
+		data = data[m[1]:]
+		if kind == "comment" || kind == "string" || kind == "preamble" {
+			_, rest, err := bibValue("{" + data)
+			if err != nil {
+				return nil, fmt.Errorf("unterminated @%s", kind)
+			}
+			data = rest
+			continue
+		}
+
+		comma := strings.IndexByte(data, ',')
+		if comma < 0 {
+			return nil, fmt.Errorf("@%s entry without a key", kind)
+		}
+		entry := &bibEntry{Key: strings.TrimSpace(data[:comma]), Type: kind}
+		data = data[comma+1:]
+
+		fields := make(map[string]string)
+		for {
+			data = strings.TrimLeft(data, " \t\r\n,")
+			if data == "" {
+				return nil, fmt.Errorf("entry %s is not closed", entry.Key)
+			}
+			if data[0] == '}' || data[0] == ')' {
+				data = data[1:]
+				break
+			}
+			fm := bibFieldName.FindStringSubmatch(data)
+			if fm == nil {
+				return nil, fmt.Errorf("entry %s: expected a field near %q", entry.Key, truncate(20, data))
+			}
+			data = data[len(fm[0]):]
+			value, rest, err := bibValue(data)
+			if err != nil {
+				return nil, fmt.Errorf("entry %s: %w", entry.Key, err)
+			}
+			fields[strings.ToLower(fm[1])] = value
+			data = rest
+		}
+
+		entry.Title = fields["title"]
+		entry.Year = fields["year"]
+		if entry.Year == "" && len(fields["date"]) >= 4 {
+			entry.Year = fields["date"][:4]
+		}
+		entry.Container = fields["journal"]
+		for _, name := range []string{"journaltitle", "booktitle"} {
+			if entry.Container == "" {
+				entry.Container = fields[name]
+			}
+		}
+		entry.Volume = fields["volume"]
+		entry.Pages = fields["pages"]
+		entry.Publisher = fields["publisher"]
+		if entry.Publisher == "" {
+			entry.Publisher = fields["institution"]
+		}
+		entry.URL = fields["url"]
+		entry.DOI = fields["doi"]
+		names := fields["author"]
+		if names == "" {
+			names = fields["editor"]
+		}
+		entry.Authors = parseBibNames(names)
+		entries = append(entries, entry)
+	}
+}
+
+// bibValue reads a field value, returning it without its delimiters and
+// with LaTeX escapes resolved, and what follows it
+func bibValue(data string) (string, string, error) {
+	var value strings.Builder
+	for {
+		data = strings.TrimLeft(data, " \t\r\n")
+		if data == "" {
+			return "", "", fmt.Errorf("missing value")
+		}
+		switch data[0] {
+		case '{', '"':
+			depth := 0
+			end := -1
+			for i := 0; i < len(data) && end < 0; i++ {
+				switch {
+				case data[i] == '\\':
+					i++
+				case data[i] == '{':
+					depth++
+				case data[i] == '}':
+					depth--
+					if depth == 0 && data[0] == '{' {
+						end = i
+					}
+				case data[i] == '"' && i > 0 && depth == 0 && data[0] == '"':
+					end = i
+				}
+			}
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated value")
+			}
+			value.WriteString(data[1:end])
+			data = data[end+1:]
+		default:
+			end := strings.IndexAny(data, ",}) \t\r\n#")
+			if end < 0 {
+				end = len(data)
+			}
+			value.WriteString(data[:end])
+			data = data[end:]
+		}
+
+		// Values can be joined with #
+		data = strings.TrimLeft(data, " \t\r\n")
+		if !strings.HasPrefix(data, "#") {
+			break
+		}
+		data = data[1:]
+	}
+	return cleanLaTeX(value.String()), data, nil
+}
+
+// latexEscapes are the LaTeX sequences turned into plain text
+var latexEscapes = strings.NewReplacer(`\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#", "---", "—", "--", "–", "~", " ", "{", "", "}", "")
+
+// latexCommand matches LaTeX commands, which are reduced to their names
+var latexCommand = regexp.MustCompile(`\\([A-Za-z]+)`)
+
+// cleanLaTeX strips braces and simple escapes from a BibTeX value
+func cleanLaTeX(value string) string {
+	value = latexCommand.ReplaceAllString(latexEscapes.Replace(value), "$1")
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// parseBibNames splits a BibTeX name list, written as "Family, Given" or
+// "Given Family" and joined with "and"
+func parseBibNames(names string) []bibName {
+	if strings.TrimSpace(names) == "" {
+		return nil
+	}
+	var result []bibName
+	for _, name := range bibAnd.Split(strings.TrimSpace(names), -1) {
+		if family, given, ok := strings.Cut(name, ","); ok {
+			result = append(result, bibName{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)})
+			continue
+		}
+		fields := strings.Fields(name)
+		last := len(fields) - 1
+		result = append(result, bibName{Family: fields[last], Given: strings.Join(fields[:last], " ")})
+	}
+	return result
+}
+
+// citeLabel returns how a work is named in the text: its authors' family
+// names and year, such as "Smith & Jones, 2020" or "Smith et al., 2021"
+func (e *bibEntry) citeLabel() string {
+	var names string
+	switch len(e.Authors) {
+	case 0:
+		names = e.Title
+	case 1:
+		names = e.Authors[0].Family
+	case 2:
+		names = e.Authors[0].Family + " & " + e.Authors[1].Family
+	default:
+		names = e.Authors[0].Family + " et al."
+	}
+	if e.Year == "" {
+		return names
+	}
+	return names + ", " + e.Year
+}
+
+// referenceHTML returns the entry of a work in a references list
+func (e *bibEntry) referenceHTML() string {
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	names := make([]string, len(e.Authors))
+	for i, name := range e.Authors {
+		names[i] = name.Family
+		if name.Given != "" {
+			names[i] += ", " + initials(name.Given)
+		}
+	}
+	switch len(names) {
+	case 0:
+	case 1:
+		out.WriteString(esc(names[0]) + " ")
+	default:
+		out.WriteString(esc(strings.Join(names[:len(names)-1], ", ")+", & "+names[len(names)-1]) + " ")
+	}
+	if e.Year != "" {
+		fmt.Fprintf(&out, "(%s). ", esc(e.Year))
+	}
+	if e.Title != "" {
+		fmt.Fprintf(&out, "<cite>%s</cite>. ", esc(strings.TrimSuffix(e.Title, ".")))
+	}
+	if e.Container != "" {
+		out.WriteString("<i>" + esc(e.Container) + "</i>")
+		if e.Volume != "" {
+			out.WriteString(", " + esc(e.Volume))
+		}
+		if e.Pages != "" {
+			out.WriteString(", " + esc(e.Pages))
+		}
+		out.WriteString(". ")
+	}
+	if e.Publisher != "" {
+		out.WriteString(esc(e.Publisher) + ". ")
+	}
+	link := e.URL
+	if e.DOI != "" {
+		link = "https://doi.org/" + strings.TrimPrefix(e.DOI, "https://doi.org/")
+	}
+	if link != "" {
+		fmt.Fprintf(&out, `<a href="%s">%s</a>`, esc(link), esc(link))
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// initials shortens given names to their initials, such as "J. R."
+func initials(given string) string {
+	fields := strings.Fields(given)
+	for i, field := range fields {
+		r := []rune(field)
+		fields[i] = string(r[0]) + "."
+	}
+	return strings.Join(fields, " ")
+}
+
+// kindCitation and kindReferences are the AST node kinds of citations and
+// of the references list added to pages that cite works
+var (
+	kindCitation   = ast.NewNodeKind("Citation")
+	kindReferences = ast.NewNodeKind("References")
+)
+
+// citationNode is a group of citations written together, such as
+// [@smith2020; @jones2019, ch. 2]
+type citationNode struct {
+	ast.BaseInline
+	Citations []citation
+}
+
+// Kind returns the node kind of citations
+func (n *citationNode) Kind() ast.NodeKind {
+	return kindCitation
+}
+
+// Dump prints the citations for debugging
+func (n *citationNode) Dump(source []byte, level int) {
+	keys := make([]string, len(n.Citations))
+	for i, c := range n.Citations {
+		keys[i] = c.Key
+	}
+	ast.DumpHelper(n, source, level, map[string]string{"Keys": strings.Join(keys, ", ")}, nil)
+}
+
+// referencesNode is the list of works cited on a page
+type referencesNode struct {
+	ast.BaseBlock
+	Keys []string // Cited works in the order they are listed
+}
+
+// Kind returns the node kind of references lists
+func (n *referencesNode) Kind() ast.NodeKind {
+	return kindReferences
+}
+
+// Dump prints the references list for debugging
+func (n *referencesNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Keys": strings.Join(n.Keys, ", ")}, nil)
+}
+
+var citationKey = regexp.MustCompile(`^@([\w:.#$%&+?<>~/-]*\w)`)
+
+// citationParser finds citations of the bibliography's works
+type citationParser struct {
+	site *Site
+}
+
+func (p citationParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p citationParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if p.site.bibliography == nil {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if !strings.HasPrefix(string(line), "[@") {
+		return nil
+	}
+	end := strings.IndexByte(string(line), ']')
+	if end < 0 {
+		return nil
+	}
+
+	node := &citationNode{}
+	for _, part := range strings.Split(string(line[1:end]), ";") {
+		part = strings.TrimSpace(part)
+		m := citationKey.FindStringSubmatch(part)
+		if m == nil {
+			return nil
+		}
+		locator := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part[len(m[0]):]), ","))
+		node.Citations = append(node.Citations, citation{Key: m[1], Locator: locator})
+	}
+
+	block.Advance(end + 1)
+	return node
+}
+
+// referencesAdder adds the list of works cited to the end of each page
+// that cites any
+type referencesAdder struct{}
+
+// Transform lists the works cited on a parsed page, ordered by author and year
+func (referencesAdder) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	seen := make(map[string]bool)
+	var keys []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if node, ok := n.(*citationNode); ok && entering {
+			for _, c := range node.Citations {
+				if !seen[c.Key] {
+					seen[c.Key] = true
+					keys = append(keys, c.Key)
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(keys) > 0 {
+		doc.AppendChild(doc, &referencesNode{Keys: keys})
+	}
+}
+
+// citationRenderer writes the HTML of citations and references lists
+type citationRenderer struct {
+	site *Site
+}
+
+// RegisterFuncs registers the citation renderers with goldmark
+func (r citationRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindCitation, r.renderCitation)
+	reg.Register(kindReferences, r.renderReferences)
+}
+
+func (r citationRenderer) renderCitation(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	esc := template.HTMLEscapeString
+	var parts []string
+	for _, c := range n.(*citationNode).Citations {
+		entry, ok := r.site.bibliography[c.Key]
+		if !ok {
+			return ast.WalkStop, fmt.Errorf("unknown citation key %q", c.Key)
+		}
+		label := entry.citeLabel()
+		if c.Locator != "" {
+			label += ", " + c.Locator
+		}
+		parts = append(parts, fmt.Sprintf(`<a href="#ref-%s">%s</a>`, esc(slugify(c.Key)), esc(label)))
+	}
+	fmt.Fprintf(w, `<span class="citation">(%s)</span>`, strings.Join(parts, "; "))
+	return ast.WalkContinue, nil
+}
+
+func (r citationRenderer) renderReferences(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	entries := make([]*bibEntry, 0, len(n.(*referencesNode).Keys))
+	for _, key := range n.(*referencesNode).Keys {
+		if entry, ok := r.site.bibliography[key]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].citeLabel(), entries[j].citeLabel()
+		return strings.ToLower(a) < strings.ToLower(b)
+	})
+
+	fmt.Fprintf(w, "<section class=\"references\">\n<h2>%s</h2>\n<ul>\n", template.HTMLEscapeString(r.site.translate("references")))
+	for _, entry := range entries {
+		fmt.Fprintf(w, "<li id=\"ref-%s\">%s</li>\n", template.HTMLEscapeString(slugify(entry.Key)), entry.referenceHTML())
+	}
+	w.WriteString("</ul>\n</section>\n")
+	return ast.WalkContinue, nil
+}
+
+// bibliographyEntries returns the works that can be cited by key, as the
+// render cache hashes them to notice changes
+func (s *Site) bibliographyEntries() []string {
+	entries := make([]string, 0, len(s.bibliography))
+	for key, entry := range s.bibliography {
+		entries = append(entries, key+"\x00"+entry.citeLabel()+"\x00"+entry.referenceHTML())
+	}
+	sort.Strings(entries)
+	return entries
+}
@@ -0,0 +1,94 @@
+// Package clidoc describes the commands and flags of a command-line program
+// as JSON, which mindoc generates a reference page per command from. A
+// program prints its description, usually from a hidden command run by the
+// docs build, so the reference always matches the binary:
+//
+//	if len(os.Args) > 1 && os.Args[1] == "describe" {
+//		clidoc.FromFlagSet("tool", flag.CommandLine).WriteJSON(os.Stdout)
+//		return
+//	}
+//
+// Programs built with cobra fill a Command from each of their commands and
+// its flags instead.
+package clidoc
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Command describes a command and the commands below it
+type Command struct {
+	Name     string     `json:"name"`               // Name the command is run by
+	Aliases  []string   `json:"aliases,omitempty"`  // Other names it can be run by
+	Short    string     `json:"short,omitempty"`    // One-line summary
+	Long     string     `json:"long,omitempty"`     // Full description, in markdown
+	Usage    string     `json:"usage,omitempty"`    // Usage line, such as "tool deploy [flags] <target>"
+	Example  string     `json:"example,omitempty"`  // Examples of running it, shown as they are
+	Flags    []Flag     `json:"flags,omitempty"`    // Flags of the command
+	Commands []*Command `json:"commands,omitempty"` // Subcommands
+}
+
+// Flag describes a flag of a command
+type Flag struct {
+	Name       string `json:"name"`                 // Long name, without dashes
+	Shorthand  string `json:"shorthand,omitempty"`  // One-letter name, without the dash
+	Type       string `json:"type,omitempty"`       // Kind of value, such as string or duration, empty for a switch
+	Default    string `json:"default,omitempty"`    // Default value as it would be given on the command line
+	Usage      string `json:"usage,omitempty"`      // What the flag does
+	Persistent bool   `json:"persistent,omitempty"` // The subcommands take the flag too
+}
+
+// FromFlagSet describes a command whose flags are those of a flag set,
+// with the usage line and type names the flag package prints
+func FromFlagSet(name string, fs *flag.FlagSet) *Command {
+	cmd := &Command{Name: name, Usage: name + " [flags]"}
+	fs.VisitAll(func(f *flag.Flag) {
+		typeName, usage := flag.UnquoteUsage(f)
+		def := f.DefValue
+		if typeName == "" && def == "false" {
+			def = ""
+		}
+		cmd.Flags = append(cmd.Flags, Flag{Name: f.Name, Type: typeName, Default: def, Usage: usage})
+	})
+	return cmd
+}
+
+// WriteJSON writes the description of the command as indented JSON
+func (c *Command) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// Read reads the description of a command written by WriteJSON
+func Read(r io.Reader) (*Command, error) {
+	var cmd Command
+	err := json.NewDecoder(r).Decode(&cmd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command description: %w", err)
+	}
+	return &cmd, cmd.validate()
+}
+
+// validate reports commands and flags without names, which can't be run
+func (c *Command) validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("a command has no name")
+	}
+	for _, f := range c.Flags {
+		if strings.TrimSpace(f.Name) == "" && f.Shorthand == "" {
+			return fmt.Errorf("a flag of %s has no name", c.Name)
+		}
+	}
+	for _, sub := range c.Commands {
+		err := sub.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
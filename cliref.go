@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"mindoc/clidoc"
+)
+
+const (
+	cliCacheDir = ".mindoc/cache/cli" // Directory the CLI reference pages are generated into
+	cliTarget   = "cli"               // Where the CLI reference is placed in the content tree by default
+)
+
+// CLIReference is a command-line program documented with a page per
+// command, from the JSON description package clidoc writes
+type CLIReference struct {
+	File    string `yaml:"file"`    // JSON description of the program's commands
+	Command string `yaml:"command"` // Command printing the description, run on every build instead of reading a file
+	Target  string `yaml:"target"`  // Where the pages are placed in the content tree, cli when unset
+}
+
+// name describes the reference in errors
+func (r CLIReference) name() string {
+	if r.Command != "" {
+		return r.Command
+	}
+	return r.File
+}
+
+// description reads the description of the program's commands, running
+// the command when one is set
+func (r CLIReference) description() (*clidoc.Command, error) {
+	switch {
+	case r.File != "" && r.Command != "":
+		return nil, fmt.Errorf("CLI reference %s sets both file and command", r.name())
+	case strings.TrimSpace(r.Command) != "":
+		args := strings.Fields(r.Command)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w", args[0], err)
+		}
+		return clidoc.Read(bytes.NewReader(output))
+	case r.File != "":
+		f, err := os.Open(r.File)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return clidoc.Read(f)
+	default:
+		return nil, fmt.Errorf("CLI reference has neither file nor command set")
+	}
+}
+
+// generateCLIReference writes the reference pages of the configured
+// programs and mounts them into the content tree, anew on every build so
+// they follow the programs
+func (s *Site) generateCLIReference() error {
+	s.cliMounts = nil
+
+	for _, ref := range s.CLI {
+		cmd, err := ref.description()
+		if err != nil {
+			return fmt.Errorf("failed to describe %s: %w", ref.name(), err)
+		}
+		sum := sha256.Sum256([]byte(s.Name + "\x00" + ref.File + "\x00" + ref.Command))
+		out := filepath.Join(cliCacheDir, hex.EncodeToString(sum[:8]))
+		err = os.RemoveAll(out)
+		if err != nil {
+			return fmt.Errorf("failed to clear %s: %w", out, err)
+		}
+		err = writeCLIPages(cmd, out)
+		if err != nil {
+			return fmt.Errorf("failed to write the reference of %s: %w", ref.name(), err)
+		}
+
+		target := ref.Target
+		if target == "" {
+			target = cliTarget
+		}
+		s.cliMounts = append(s.cliMounts, Mount{Source: out, Target: target})
+	}
+	return nil
+}
+
+// cliPages writes the reference pages of a program into a directory, for
+// mindoc cli: either the description in a file, or the one a command
+// prints with -command
+func cliPages(args []string) error {
+	fs := flag.NewFlagSet("cli", flag.ExitOnError)
+	out := fs.String("o", cliTarget, "directory the pages are written to")
+	command := fs.String("command", "", "command printing the description of the program")
+	fs.Parse(args)
+	ref := CLIReference{Command: *command}
+	if fs.NArg() == 1 {
+		ref.File = fs.Arg(0)
+	} else if fs.NArg() > 1 || *command == "" {
+		return fmt.Errorf("usage: mindoc cli [-o dir] <description.json> or mindoc cli [-o dir] -command <command>")
+	}
+
+	cmd, err := ref.description()
+	if err != nil {
+		return err
+	}
+	err = writeCLIPages(cmd, *out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reference of %s written to %s.\n", cmd.Name, *out)
+	return nil
+}
+
+// cliPage is a command's page in the reference
+type cliPage struct {
+	cmd       *clidoc.Command
+	title     string        // Names of the command and those above it, such as "tool deploy"
+	relPath   string        // Path of the page within the reference
+	parent    *cliPage      // Page of the command above, nil for the program
+	children  []*cliPage    // Pages of the subcommands
+	inherited []clidoc.Flag // Persistent flags of the commands above
+}
+
+// writeCLIPages writes a markdown page for the program and each of its
+// commands into dir. A command with subcommands gets the _index.md of a
+// directory holding theirs, so they nest in the navigation.
+func writeCLIPages(cmd *clidoc.Command, dir string) error {
+	var pages []*cliPage
+	var collect func(cmd *clidoc.Command, parent *cliPage, dirPath string)
+	collect = func(cmd *clidoc.Command, parent *cliPage, dirPath string) {
+		page := &cliPage{cmd: cmd, title: cmd.Name, parent: parent}
+		if parent != nil {
+			page.title = parent.title + " " + cmd.Name
+			page.inherited = append(page.inherited, parent.inherited...)
+			for _, f := range parent.cmd.Flags {
+				if f.Persistent {
+					page.inherited = append(page.inherited, f)
+				}
+			}
+		}
+		switch {
+		case parent == nil:
+			page.relPath = "_index.md"
+		case len(cmd.Commands) > 0:
+			dirPath = path.Join(dirPath, slugify(cmd.Name))
+			page.relPath = path.Join(dirPath, "_index.md")
+		default:
+			page.relPath = path.Join(dirPath, slugify(cmd.Name)+".md")
+		}
+		pages = append(pages, page)
+		if parent != nil {
+			parent.children = append(parent.children, page)
+		}
+		for _, sub := range cmd.Commands {
+			collect(sub, page, dirPath)
+		}
+	}
+	collect(cmd, nil, "")
+
+	for _, page := range pages {
+		data, err := page.markdown()
+		if err != nil {
+			return err
+		}
+		pagePath := filepath.Join(dir, filepath.FromSlash(page.relPath))
+		err = os.MkdirAll(filepath.Dir(pagePath), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(pagePath, data, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write the page of %s: %w", page.title, err)
+		}
+	}
+	return nil
+}
+
+// markdown renders the page of a command: its summary and usage, its
+// description and examples, its own and inherited flags, and links to its
+// subcommands and to the command above it
+func (p *cliPage) markdown() ([]byte, error) {
+	cmd := p.cmd
+	meta := map[string]string{"title": p.title}
+	if cmd.Short != "" {
+		meta["description"] = cmd.Short
+	}
+	fm, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\n%s---\n\n# %s\n\n", fm, p.title)
+	if cmd.Short != "" {
+		fmt.Fprintf(&b, "%s\n\n", cmd.Short)
+	}
+	usage := cmd.Usage
+	if usage == "" {
+		usage = p.title + " [flags]"
+	}
+	fmt.Fprintf(&b, "```\n%s\n```\n\n", usage)
+	if len(cmd.Aliases) > 0 {
+		fmt.Fprintf(&b, "Aliases: `%s`\n\n", strings.Join(cmd.Aliases, "`, `"))
+	}
+	if cmd.Long != "" {
+		fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(cmd.Long))
+	}
+	if cmd.Example != "" {
+		fmt.Fprintf(&b, "## Examples\n\n```\n%s\n```\n\n", strings.Trim(cmd.Example, "\n"))
+	}
+	writeCLIFlags(&b, "Flags", cmd.Flags)
+	writeCLIFlags(&b, "Inherited flags", p.inherited)
+
+	link := func(to *cliPage) string {
+		rel, _ := filepath.Rel(path.Dir(p.relPath), to.relPath)
+		return filepath.ToSlash(rel)
+	}
+	if len(p.children) > 0 {
+		b.WriteString("## Commands\n\n")
+		for _, sub := range p.children {
+			fmt.Fprintf(&b, "- [%s](%s)", sub.title, link(sub))
+			if sub.cmd.Short != "" {
+				fmt.Fprintf(&b, ": %s", sub.cmd.Short)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	if p.parent != nil {
+		fmt.Fprintf(&b, "## See also\n\n- [%s](%s)", p.parent.title, link(p.parent))
+		if p.parent.cmd.Short != "" {
+			fmt.Fprintf(&b, ": %s", p.parent.cmd.Short)
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes(), nil
+}
+
+// writeCLIFlags writes a list of flags under a heading, such as
+// "-o, --output string: where to write (default "out")"
+func writeCLIFlags(b *bytes.Buffer, heading string, flags []clidoc.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "## %s\n\n", heading)
+	for _, f := range flags {
+		var names []string
+		if f.Shorthand != "" {
+			names = append(names, "-"+f.Shorthand)
+		}
+		// A name of one letter is a shorthand too, as in the flag package
+		if len(f.Name) == 1 {
+			names = append(names, "-"+f.Name)
+		} else if f.Name != "" {
+			names = append(names, "--"+f.Name)
+		}
+		spec := strings.Join(names, ", ")
+		if f.Type != "" {
+			spec += " " + f.Type
+		}
+		fmt.Fprintf(b, "- `%s`", spec)
+		if f.Usage != "" {
+			fmt.Fprintf(b, ": %s", f.Usage)
+		}
+		if f.Default != "" {
+			fmt.Fprintf(b, " (default `%s`)", f.Default)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
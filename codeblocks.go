@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// CodeBlocksConfig decides what is shown around the code blocks of pages
+type CodeBlocksConfig struct {
+	Copy     bool `yaml:"copy"`     // Add a button copying the code to the clipboard
+	Language bool `yaml:"language"` // Label fenced blocks with their language
+}
+
+// codeAttribute matches an attribute in the braces after the language of a
+// fenced code block, such as linenos=true or hl_lines=[3,7-9]
+var codeAttribute = regexp.MustCompile(`([A-Za-z][\w-]*)\s*=\s*(\[[^\]]*\]|"[^"]*"|[^,\s}]+)`)
+
+// codeInfo is what the info string of a fenced code block says about it,
+// as in ```go {linenos=true, hl_lines=[3,7-9]}
+type codeInfo struct {
+	Language  string
+	Words     []string     // Words after the language outside the braces
+	LineNos   bool         // Number the lines
+	LineStart int          // Number of the first line
+	Highlight map[int]bool // Numbers of the lines to highlight
+}
+
+// parseCodeInfo reads the info string of a fenced code block
+func parseCodeInfo(info string) (codeInfo, error) {
+	ci := codeInfo{LineStart: 1}
+	var attrs string
+	if i := strings.IndexByte(info, '{'); i >= 0 {
+		if !strings.HasSuffix(strings.TrimSpace(info), "}") {
+			return ci, fmt.Errorf("unclosed attributes in %q", info)
+		}
+		info, attrs = info[:i], strings.TrimSuffix(strings.TrimSpace(info[i+1:]), "}")
+	}
+	words := strings.Fields(info)
+	if len(words) > 0 {
+		ci.Language, ci.Words = words[0], words[1:]
+	}
+
+	if leftover := strings.Trim(codeAttribute.ReplaceAllString(attrs, ""), ", \t"); leftover != "" {
+		return ci, fmt.Errorf("invalid attributes %q", attrs)
+	}
+	var err error
+	for _, m := range codeAttribute.FindAllStringSubmatch(attrs, -1) {
+		value := strings.Trim(m[2], `"`)
+		switch m[1] {
+		case "linenos":
+			// Hugo's table and inline styles both number the lines
+			ci.LineNos = value != "false"
+		case "linenostart":
+			ci.LineStart, err = strconv.Atoi(value)
+			if err != nil {
+				return ci, fmt.Errorf("invalid linenostart %q", value)
+			}
+		case "hl_lines":
+			ci.Highlight, err = parseLineRanges(strings.Trim(value, "[]"))
+			if err != nil {
+				return ci, err
+			}
+		}
+	}
+	return ci, nil
+}
+
+// parseLineRanges reads a list of line numbers and ranges such as 3,7-9,
+// separated by commas or spaces
+func parseLineRanges(list string) (map[int]bool, error) {
+	lines := make(map[int]bool)
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || to < from {
+			return nil, fmt.Errorf("invalid line range %q", item)
+		}
+		for n := from; n <= to; n++ {
+			lines[n] = true
+		}
+	}
+	return lines, nil
+}
+
+// codeBlockRenderer writes code blocks, wrapped with a copy button and a
+// language label when the site asks for them
+type codeBlockRenderer struct {
+	site *Site
+}
+
+// RegisterFuncs registers the code block renderers with goldmark
+func (r codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeBlock, r.render)
+	reg.Register(ast.KindFencedCodeBlock, r.render)
+}
+
+func (r codeBlockRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	ci := codeInfo{LineStart: 1}
+	if fenced, ok := n.(*ast.FencedCodeBlock); ok && fenced.Info != nil {
+		var err error
+		ci, err = parseCodeInfo(string(fenced.Info.Segment.Value(source)))
+		if err != nil {
+			return ast.WalkStop, fmt.Errorf("code block: %w", err)
+		}
+	}
+
+	nodeLines := n.Lines()
+	lines := make([]string, nodeLines.Len())
+	for i := range lines {
+		line := nodeLines.At(i)
+		lines[i] = string(line.Value(source))
+	}
+
+	// Blocks of diagram languages are drawn instead of shown as code
+	svg, ok, err := r.site.drawDiagram(ci.Language, strings.Join(lines, ""))
+	if err != nil {
+		return ast.WalkStop, fmt.Errorf("%s diagram: %w", ci.Language, err)
+	}
+	if ok {
+		fmt.Fprintf(w, "<div class=\"diagram diagram-%s\">\n", template.HTMLEscapeString(ci.Language))
+		w.Write(svg)
+		w.WriteString("\n</div>\n")
+		return ast.WalkSkipChildren, nil
+	}
+
+	w.WriteString(r.site.codeBlockHTML(ci, lines))
+	return ast.WalkSkipChildren, nil
+}
+
+// codeBlockHTML returns the markup of a code block with the given lines,
+// each ending in a newline
+func (s *Site) codeBlockHTML(ci codeInfo, lines []string) string {
+	cfg := s.CodeBlocks
+	language := ci.Language
+	wrapped := cfg.Copy || (cfg.Language && language != "")
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	if wrapped {
+		out.WriteString(`<div class="code-block">`)
+		if cfg.Language && language != "" {
+			fmt.Fprintf(&out, `<span class="code-language">%s</span>`, esc(language))
+		}
+		if cfg.Copy {
+			fmt.Fprintf(&out, `<button type="button" class="code-copy" data-copied="%s" hidden>%s</button>`,
+				esc(s.translate("copied")), esc(s.translate("copy")))
+		}
+		out.WriteString("\n")
+	}
+
+	// Numbered or highlighted listings put every line in a span of its own,
+	// with the number in an attribute so copying leaves it out
+	listing := ci.LineNos || len(ci.Highlight) > 0
+	out.WriteString("<pre")
+	if ci.LineNos {
+		out.WriteString(` class="numbered"`)
+	}
+	out.WriteString("><code")
+	if language != "" {
+		fmt.Fprintf(&out, ` class="language-%s"`, esc(language))
+	}
+	out.WriteString(">")
+	for i, line := range lines {
+		if !listing {
+			out.Write(util.EscapeHTML([]byte(line)))
+			continue
+		}
+		number := ci.LineStart + i
+		out.WriteString(`<span class="line`)
+		if ci.Highlight[number] {
+			out.WriteString(` highlighted`)
+		}
+		fmt.Fprintf(&out, `" data-line="%d">`, number)
+		out.Write(util.EscapeHTML([]byte(line)))
+		out.WriteString("</span>")
+	}
+	out.WriteString("</code></pre>\n")
+
+	if wrapped {
+		out.WriteString("</div>\n")
+		if cfg.Copy {
+			fmt.Fprintf(&out, "<script src=\"%s\" defer></script>\n", esc(s.url(cssDestDir+"/code.js")))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// CodeRunner tells mindoc test how to check and run the code blocks of a
+// language. The commands are run in a directory holding only the code,
+// with a minimal environment but otherwise unsandboxed: the code can do
+// whatever the user running mindoc can.
+type CodeRunner struct {
+	File  string `yaml:"file"`  // Name of the file the code is written to
+	Check string `yaml:"check"` // Command checking blocks marked test, such as compiling them
+	Run   string `yaml:"run"`   // Command running blocks marked run
+}
+
+// defaultCodeRunners are the languages mindoc test knows without any config
+var defaultCodeRunners = map[string]CodeRunner{
+	"go":         {File: "main.go", Check: "go vet main.go", Run: "go run main.go"},
+	"sh":         {File: "snippet.sh", Check: "sh -n snippet.sh", Run: "sh -e snippet.sh"},
+	"bash":       {File: "snippet.sh", Check: "bash -n snippet.sh", Run: "bash -e snippet.sh"},
+	"python":     {File: "snippet.py", Check: "python3 -m py_compile snippet.py", Run: "python3 snippet.py"},
+	"javascript": {File: "snippet.js", Check: "node --check snippet.js", Run: "node snippet.js"},
+	"js":         {File: "snippet.js", Check: "node --check snippet.js", Run: "node snippet.js"},
+}
+
+// codeTest is a code block marked for testing
+type codeTest struct {
+	Page string // File the block is in
+	Line int    // Line of the block's opening fence in the file
+	Mode string // "test" to check the code, "run" to run it
+	Info codeInfo
+	Code string
+}
+
+// testSites checks or runs the code blocks marked test or run on the pages
+// of the sites, failing when any of them fails
+func testSites(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	timeout := fs.Duration("timeout", time.Minute, "time limit of each code block")
+	fs.Parse(args)
+
+	tested, failed := 0, 0
+	for _, site := range sites {
+		tests, err := site.codeTests()
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+
+		for _, test := range tests {
+			tested++
+			output, err := site.runCodeTest(test, *timeout)
+			if err == nil {
+				continue
+			}
+			failed++
+			fmt.Printf("%s:%d: %s block %s: %v\n", test.Page, test.Line, test.Info.Language, test.Mode, err)
+			for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+				if line != "" {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d code block(s) failed", failed, tested)
+	}
+	fmt.Printf("%d code block(s) passed.\n", tested)
+	return nil
+}
+
+// codeTests returns the code blocks marked test or run on the site's
+// markdown pages, as in ```go run
+func (s *Site) codeTests() ([]codeTest, error) {
+	err := s.fetchRemotes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote content: %w", err)
+	}
+	err = s.generateGoDoc()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the API reference: %w", err)
+	}
+	err = s.generateCLIReference()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the CLI reference: %w", err)
+	}
+	err = s.generateGraphQLReference()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the GraphQL reference: %w", err)
+	}
+	err = s.loadPages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the content: %w", err)
+	}
+
+	var tests []codeTest
+	for _, page := range s.pages {
+		if !s.isMarkdown(page.Path) {
+			continue
+		}
+
+		// Lines are counted in the file, front matter included
+		firstLine := page.bodyLine
+
+		doc := s.markdown.Parser().Parse(text.NewReader(page.body))
+		err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			block, ok := n.(*ast.FencedCodeBlock)
+			if !entering || !ok || block.Info == nil {
+				return ast.WalkContinue, nil
+			}
+			info := block.Info.Segment
+			line := firstLine + bytes.Count(page.body[:info.Start], []byte("\n"))
+			ci, err := parseCodeInfo(string(info.Value(page.body)))
+			if err != nil {
+				return ast.WalkStop, fmt.Errorf("%s:%d: %w", page.srcPath, line, err)
+			}
+
+			for _, word := range ci.Words {
+				if word != "test" && word != "run" {
+					continue
+				}
+				var code strings.Builder
+				lines := block.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					segment := lines.At(i)
+					code.Write(segment.Value(page.body))
+				}
+				tests = append(tests, codeTest{
+					Page: page.srcPath,
+					Line: line,
+					Mode: word,
+					Info: ci,
+					Code: code.String(),
+				})
+				break
+			}
+			return ast.WalkSkipChildren, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tests, nil
+}
+
+// runCodeTest writes a code block to a directory of its own and checks or
+// runs it there, returning what the command printed
+func (s *Site) runCodeTest(test codeTest, timeout time.Duration) (string, error) {
+	runner, ok := s.CodeRunners[test.Info.Language]
+	if !ok {
+		runner, ok = defaultCodeRunners[test.Info.Language]
+	}
+	command := runner.Check
+	if test.Mode == "run" {
+		command = runner.Run
+	}
+	args := strings.Fields(command)
+	if !ok || runner.File == "" || len(args) == 0 {
+		return "", fmt.Errorf("no command to %s %q code with", test.Mode, test.Info.Language)
+	}
+
+	dir, err := os.MkdirTemp("", "mindoc-test-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create test directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, runner.File), []byte(test.Code), 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write the code: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	// Leave the caller's environment, with whatever secrets it holds, out
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"MINDOC_TEST=" + test.Mode,
+	}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return string(output), fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("%s: %w", command, err)
+	}
+	return string(output), nil
+}
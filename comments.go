@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"maps"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CommentsConfig selects the comment system embedded on pages that have
+// comments turned on
+type CommentsConfig struct {
+	Provider string            `yaml:"provider"` // giscus, utterances or disqus
+	Params   map[string]string `yaml:"params"`   // Embed settings, such as repo and categoryId for Giscus or shortname for Disqus
+}
+
+// commentsData is what templates receive on a page with comments
+type commentsData struct {
+	Provider string            // Comment system in use
+	Params   map[string]string // Embed settings, including the defaults filled in for the page
+	HTML     template.HTML     // Ready-made embed code
+}
+
+// requiredCommentParams lists the settings each comment system needs
+var requiredCommentParams = map[string][]string{
+	"giscus":     {"repo", "repoId", "categoryId"},
+	"utterances": {"repo"},
+	"disqus":     {"shortname"},
+}
+
+// check reports an unknown comment system or a missing setting it needs
+func (c CommentsConfig) check() error {
+	if c.Provider == "" {
+		return nil
+	}
+	required, ok := requiredCommentParams[c.Provider]
+	if !ok {
+		return fmt.Errorf("unknown comments provider %q", c.Provider)
+	}
+	for _, name := range required {
+		if c.Params[name] == "" {
+			return fmt.Errorf("comments provider %s needs the %s param", c.Provider, name)
+		}
+	}
+	return nil
+}
+
+// wantsComments reports whether comments are embedded on the page. The
+// page's comments front matter wins over its section's default.
+func (p *Page) wantsComments() bool {
+	if comments, ok := p.Params["comments"].(bool); ok {
+		return comments
+	}
+	return boolSetting(p.settings.Comments, false)
+}
+
+// pageComments returns the comment embed of a page, or nil when the page
+// has no comments
+func (s *Site) pageComments(page *Page) *commentsData {
+	if s.Comments.Provider == "" || !page.wantsComments() {
+		return nil
+	}
+
+	params := make(map[string]string)
+	var embed string
+	switch s.Comments.Provider {
+	case "giscus":
+		params["mapping"] = "pathname"
+		params["reactionsEnabled"] = "1"
+		params["theme"] = "preferred_color_scheme"
+		params["lang"] = s.Language
+		maps.Copy(params, s.Comments.Params)
+		embed = `<script src="https://giscus.app/client.js"` + embedAttrs(params, "data-") + ` crossorigin="anonymous" async></script>`
+	case "utterances":
+		params["issueTerm"] = "pathname"
+		params["theme"] = "preferred-color-scheme"
+		maps.Copy(params, s.Comments.Params)
+		embed = `<script src="https://utteranc.es/client.js"` + embedAttrs(params, "") + ` crossorigin="anonymous" async></script>`
+	case "disqus":
+		params["url"] = s.absURL(page.URL)
+		params["identifier"] = page.Path
+		maps.Copy(params, s.Comments.Params)
+		embed = fmt.Sprintf(`<div id="disqus_thread"></div>
+<script>
+var disqus_config = function () { this.page.url = "%s"; this.page.identifier = "%s"; };
+(function () { var s = document.createElement("script"); s.src = "https://%s.disqus.com/embed.js"; s.setAttribute("data-timestamp", +new Date()); document.body.appendChild(s); })();
+</script>`, template.JSEscapeString(params["url"]), template.JSEscapeString(params["identifier"]), template.JSEscapeString(params["shortname"]))
+	}
+
+	return &commentsData{Provider: s.Comments.Provider, Params: params, HTML: template.HTML(embed)}
+}
+
+// embedAttrs returns embed settings as HTML attributes in name order, with
+// camelCase names written in kebab-case after the prefix
+func embedAttrs(params map[string]string, prefix string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attrs strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&attrs, ` %s%s="%s"`, prefix, kebabCase(name), template.HTMLEscapeString(params[name]))
+	}
+	return attrs.String()
+}
+
+// kebabCase turns a camelCase name into kebab-case, such as repoId into repo-id
+func kebabCase(name string) string {
+	var out strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				out.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	conditionTag   = regexp.MustCompile(`^\s*\{\{%\s*(if|else|end)\b(.*?)%\}\}\s*$`) // Line opening, switching or closing a conditional block
+	conditionNames = regexp.MustCompile(`"([^"]*)"`)                                 // Quoted names of a condition
+)
+
+// conditionBlock is a conditional block being read
+type conditionBlock struct {
+	line      int  // Line of its if in the file
+	include   bool // The lines of the current branch are kept
+	elseShown bool // The else branch has been reached
+}
+
+// applyConditions keeps or removes the conditional blocks of a page's
+// body, such as {{% if audience "internal" %}} ... {{% else %}} ...
+// {{% end %}}, by the audiences and flags of the build. Blocks are removed
+// before the page is rendered, so their text doesn't appear in its table
+// of contents, search records or any other output. Blocks may be nested,
+// and lines within code blocks are left as they are.
+func (s *Site) applyConditions(page *Page) error {
+	if !bytes.Contains(page.body, []byte("{{%")) {
+		return nil
+	}
+
+	var out bytes.Buffer
+	var blocks []conditionBlock
+	fence := ""
+	lines := bytes.SplitAfter(page.body, []byte("\n"))
+	for i, line := range lines {
+		kept := true
+		for _, block := range blocks {
+			kept = kept && block.include
+		}
+
+		trimmed := strings.TrimSpace(string(line))
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		} else if f := codeFence(trimmed); f != "" {
+			fence = f
+		} else if m := conditionTag.FindStringSubmatch(trimmed); m != nil {
+			switch m[1] {
+			case "if":
+				include, err := s.condition(m[2])
+				if err != nil {
+					return fmt.Errorf("line %d: %w", page.bodyLine+i, err)
+				}
+				blocks = append(blocks, conditionBlock{line: page.bodyLine + i, include: include})
+			case "else":
+				if len(blocks) == 0 {
+					return fmt.Errorf("line %d: else outside of an if block", page.bodyLine+i)
+				}
+				block := &blocks[len(blocks)-1]
+				if block.elseShown {
+					return fmt.Errorf("line %d: second else in the if block of line %d", page.bodyLine+i, block.line)
+				}
+				block.include = !block.include
+				block.elseShown = true
+			case "end":
+				if len(blocks) == 0 {
+					return fmt.Errorf("line %d: end outside of an if block", page.bodyLine+i)
+				}
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+		}
+
+		if kept {
+			out.Write(line)
+		}
+	}
+	if len(blocks) > 0 {
+		return fmt.Errorf("line %d: if block is never closed with {{%% end %%}}", blocks[len(blocks)-1].line)
+	}
+
+	page.body = out.Bytes()
+	return nil
+}
+
+// condition evaluates the condition of an if block: audience followed by
+// names, true when the build is for one of them, or flag followed by names,
+// true when one of them is among the build's flags. not inverts it.
+func (s *Site) condition(expr string) (bool, error) {
+	fields := strings.Fields(expr)
+	negate := len(fields) > 0 && fields[0] == "not"
+	if negate {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return false, fmt.Errorf("if block without a condition")
+	}
+
+	var names []string
+	for _, m := range conditionNames.FindAllStringSubmatch(expr, -1) {
+		names = append(names, m[1])
+	}
+	if len(names) == 0 {
+		return false, fmt.Errorf("%s condition names nothing, such as %s \"internal\"", fields[0], fields[0])
+	}
+
+	var result bool
+	switch fields[0] {
+	case "audience":
+		// Every audience is built when the build names none
+		result = len(s.Access.Audiences) == 0
+		for _, name := range names {
+			result = result || slices.Contains(s.Access.Audiences, name)
+		}
+	case "flag":
+		for _, name := range names {
+			result = result || slices.Contains(s.Access.Flags, name)
+		}
+	default:
+		return false, fmt.Errorf("unknown condition %q, expected audience or flag", fields[0])
+	}
+	return result != negate, nil
+}
+
+// codeFence returns the fence a line opens a fenced code block with, or ""
+func codeFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		if strings.HasPrefix(line, strings.Repeat(c, 3)) {
+			return strings.Repeat(c, len(line)-len(strings.TrimLeft(line, c)))
+		}
+	}
+	return ""
+}
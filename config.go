@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "mindoc.yaml" // Optional config file in the working directory
+
+// Config is the contents of the mindoc.yaml config file
+type Config struct {
+	SiteConfig `yaml:",inline"`
+
+	ThemeDir      string         `yaml:"theme"`         // Directory with the CSS shared by all sites
+	LayoutDir     string         `yaml:"layouts"`       // Directory with the page templates shared by all sites
+	I18nDir       string         `yaml:"i18n"`          // Directory with the translations of theme strings
+	TemplateFuncs []TemplateFunc `yaml:"templateFuncs"` // Custom template functions implemented in WASM
+	Sites         []SiteConfig   `yaml:"sites"`         // Several sites built in one run
+
+	RebuildHook RebuildHookConfig `yaml:"rebuildHook"` // Webhook rebuilding the served sites
+	Server      ServerConfig      `yaml:"server"`      // Timeouts and limits of the built-in server
+	Previews    PreviewConfig     `yaml:"previews"`    // Previews of the branches of the content repository, served next to the sites
+}
+
+// SiteConfig holds the settings of a single site
+type SiteConfig struct {
+	Name         string   `yaml:"name"`
+	ContentDir   string   `yaml:"content"`
+	OutputDir    string   `yaml:"output"`
+	BaseURL      string   `yaml:"baseURL"`
+	Language     string   `yaml:"language"`     // Language code of the content, "en" when unset
+	Direction    string   `yaml:"direction"`    // Text direction, "ltr" or "rtl", worked out from the language when unset
+	Translations string   `yaml:"translations"` // Sites with the same value are translations of one another
+	Mounts       []Mount  `yaml:"mounts"`       // Directories combined into the content tree
+	Remotes      []Remote `yaml:"remotes"`      // Remote content fetched into the content tree
+	Hooks        Hooks    `yaml:"hooks"`        // Commands or plugins run during the build
+
+	Renderers          map[string]RendererConfig `yaml:"renderers"`          // How each file extension is rendered
+	Passthrough        []string                  `yaml:"passthrough"`        // Extensions of non-page files copied to the output, all when unset
+	Sidebar            SidebarConfig             `yaml:"sidebar"`            // Depth and collapsing of the sidebar
+	PrintPages         bool                      `yaml:"printPages"`         // Also write a print variant of every page
+	PrintExpandDetails bool                      `yaml:"printExpandDetails"` // Open every details block when a page is printed from the browser
+	Icons              IconsConfig               `yaml:"icons"`              // Favicons and web manifest made from a logo
+	Offline            bool                      `yaml:"offline"`            // Write a service worker caching the site for offline reading
+	NavJSON            bool                      `yaml:"navJSON"`            // Write the navigation tree as nav.json for client-side apps
+	Outline            bool                      `yaml:"outline"`            // Write the heading outline of every page, and of all of them as outline.json
+	OutdatedBanner     bool                      `yaml:"outdatedBanner"`     // Show a banner on translations older than the page they translate
+	LanguageFallback   bool                      `yaml:"languageFallback"`   // Take the pages a translation lacks from the source language
+	WarnIfOlderThan    Age                       `yaml:"warnIfOlderThan"`    // Mark pages not updated for longer as possibly outdated, never when unset
+
+	Replacements  []Replacement            `yaml:"replacements"`  // Find and replace rules applied to page sources
+	URLs          URLConfig                `yaml:"urls"`          // Paths pages are written to and linked with
+	Cache         CacheConfig              `yaml:"cache"`         // Cache of rendered pages, optionally shared between machines
+	LLMs          LLMsConfig               `yaml:"llms"`          // llms.txt files and plain page mirrors for AI tools
+	Chunks        ChunksConfig             `yaml:"chunks"`        // Export of the pages split at headings, for embeddings
+	Search        SearchConfig             `yaml:"search"`        // Search service the index command pushes to
+	Comments      CommentsConfig           `yaml:"comments"`      // Comment system embedded on pages with comments on
+	Feedback      FeedbackConfig           `yaml:"feedback"`      // Where the feedback widget's submissions go
+	Authors       AuthorsConfig            `yaml:"authors"`       // Author profiles and the pages listing their pages
+	Glossary      GlossaryConfig           `yaml:"glossary"`      // Glossary terms marked up in pages and the glossary page
+	Bibliography  string                   `yaml:"bibliography"`  // BibTeX or CSL-JSON file of the works pages cite as [@key]
+	Abbreviations string                   `yaml:"abbreviations"` // YAML file of abbreviations shown as abbr in every page
+	CodeBlocks    CodeBlocksConfig         `yaml:"codeBlocks"`    // Copy buttons and language labels on code blocks
+	CodeRunners   map[string]CodeRunner    `yaml:"codeRunners"`   // Commands mindoc test checks and runs code blocks with, by language
+	Images        ImagesConfig             `yaml:"images"`        // Captions and the lightbox of page images
+	Media         MediaConfig              `yaml:"media"`         // Video and audio players, and whether other sites' players are embedded
+	Diagrams      map[string]DiagramConfig `yaml:"diagrams"`      // Commands drawing fenced diagram blocks as SVG, by language
+	Social        SocialConfig             `yaml:"social"`        // Share images drawn for every page and the og:image tags showing them
+	Integrity     IntegrityConfig          `yaml:"integrity"`     // Integrity hashes or local copies of the external scripts and stylesheets pages load
+	Deploy        DeployConfig             `yaml:"deploy"`        // Where the deploy command uploads the site
+	Access        AccessConfig             `yaml:"access"`        // Audiences the build is for and how protected pages are protected
+	Sitemap       SitemapConfig            `yaml:"sitemap"`       // sitemap.xml and the defaults of its entries
+	GoDoc         GoDocConfig              `yaml:"godoc"`         // Go packages whose API reference is rendered into the content tree
+	CLI           []CLIReference           `yaml:"cli"`           // Command-line programs with a reference page rendered for each command
+
+	dataDir string // Directory the default data files are looked up in, the working directory unless set for a branch preview
+}
+
+// loadConfig reads the config file, falling back to the defaults when the
+// file does not exist
+func loadConfig(configPath string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err == nil {
+		err = yaml.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, err)
+		}
+	}
+
+	// Settings can also come from the environment, such as in containers
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	applyEnvSettings(root)
+	err = root.Decode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, err)
+	}
+
+	if cfg.ThemeDir == "" {
+		cfg.ThemeDir = cssSourceDir
+	}
+	if cfg.LayoutDir == "" {
+		cfg.LayoutDir = layoutDir
+	}
+	if cfg.I18nDir == "" {
+		cfg.I18nDir = i18nDir
+	}
+	if cfg.ContentDir == "" {
+		cfg.ContentDir = inputDir
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = outputDir
+	}
+	if cfg.Language == "" {
+		cfg.Language = "en"
+	}
+
+	return cfg, nil
+}
+
+// siteConfigs returns the settings of every site to build. Without a
+// sites list the top-level settings describe the only site.
+func (cfg *Config) siteConfigs() ([]SiteConfig, error) {
+	if len(cfg.Sites) == 0 {
+		return []SiteConfig{cfg.SiteConfig}, nil
+	}
+
+	sites := make([]SiteConfig, 0, len(cfg.Sites))
+	names := make(map[string]bool)
+	for i, site := range cfg.Sites {
+		if site.Name == "" {
+			return nil, fmt.Errorf("site %d has no name", i+1)
+		}
+		if names[site.Name] {
+			return nil, fmt.Errorf("site %q is defined more than once", site.Name)
+		}
+		names[site.Name] = true
+
+		if site.ContentDir == "" && len(site.Mounts) == 0 {
+			return nil, fmt.Errorf("site %q has no content directory or mounts", site.Name)
+		}
+		if site.OutputDir == "" {
+			site.OutputDir = filepath.Join(cfg.OutputDir, site.Name)
+		}
+		site.inherit(cfg.SiteConfig)
+
+		sites = append(sites, site)
+	}
+
+	return sites, nil
+}
+
+// inherit fills in the settings a site leaves unset from the top-level
+// settings, which act as defaults for every site
+func (site *SiteConfig) inherit(defaults SiteConfig) {
+	if site.BaseURL == "" {
+		site.BaseURL = defaults.BaseURL
+	}
+	if site.Language == "" {
+		site.Language = defaults.Language
+	}
+	if site.Direction == "" {
+		site.Direction = defaults.Direction
+	}
+	if site.Translations == "" {
+		site.Translations = defaults.Translations
+	}
+	if site.Hooks.PreBuild == nil && site.Hooks.PostRender == nil && site.Hooks.PostBuild == nil {
+		site.Hooks = defaults.Hooks
+	}
+	if site.Renderers == nil {
+		site.Renderers = defaults.Renderers
+	}
+	if site.Passthrough == nil {
+		site.Passthrough = defaults.Passthrough
+	}
+	if site.Sidebar == (SidebarConfig{}) {
+		site.Sidebar = defaults.Sidebar
+	}
+	if !site.PrintPages {
+		site.PrintPages = defaults.PrintPages
+	}
+	if !site.PrintExpandDetails {
+		site.PrintExpandDetails = defaults.PrintExpandDetails
+	}
+	if site.Icons == (IconsConfig{}) {
+		site.Icons = defaults.Icons
+	}
+	if !site.Offline {
+		site.Offline = defaults.Offline
+	}
+	if !site.NavJSON {
+		site.NavJSON = defaults.NavJSON
+	}
+	if !site.Outline {
+		site.Outline = defaults.Outline
+	}
+	if !site.OutdatedBanner {
+		site.OutdatedBanner = defaults.OutdatedBanner
+	}
+	if !site.LanguageFallback {
+		site.LanguageFallback = defaults.LanguageFallback
+	}
+	if site.WarnIfOlderThan == 0 {
+		site.WarnIfOlderThan = defaults.WarnIfOlderThan
+	}
+	if site.Replacements == nil {
+		site.Replacements = defaults.Replacements
+	}
+	if !site.URLs.TrailingSlash && !site.URLs.Lowercase && site.URLs.Rewrites == nil {
+		site.URLs = defaults.URLs
+	}
+	if !site.Cache.Enabled && site.Cache.Remote == "" {
+		site.Cache = defaults.Cache
+	}
+	if !site.LLMs.Enabled && site.LLMs.Description == "" && site.LLMs.Mirrors == nil {
+		site.LLMs = defaults.LLMs
+	}
+	if site.Chunks == (ChunksConfig{}) {
+		site.Chunks = defaults.Chunks
+	}
+	if site.Search == (SearchConfig{}) {
+		site.Search = defaults.Search
+	}
+	if site.Comments.Provider == "" && site.Comments.Params == nil {
+		site.Comments = defaults.Comments
+	}
+	if site.Feedback == (FeedbackConfig{}) {
+		site.Feedback = defaults.Feedback
+	}
+	if site.Authors == (AuthorsConfig{}) {
+		site.Authors = defaults.Authors
+	}
+	if site.Glossary == (GlossaryConfig{}) {
+		site.Glossary = defaults.Glossary
+	}
+	if site.Bibliography == "" {
+		site.Bibliography = defaults.Bibliography
+	}
+	if site.Abbreviations == "" {
+		site.Abbreviations = defaults.Abbreviations
+	}
+	if site.CodeBlocks == (CodeBlocksConfig{}) {
+		site.CodeBlocks = defaults.CodeBlocks
+	}
+	if site.CodeRunners == nil {
+		site.CodeRunners = defaults.CodeRunners
+	}
+	if !site.Images.Lightbox && !site.Images.Eager && site.Images.Formats == nil && site.Images.Quality == 0 && site.Images.Skip == nil && site.Images.InlineSVG == 0 {
+		site.Images = defaults.Images
+	}
+	if site.Media == (MediaConfig{}) {
+		site.Media = defaults.Media
+	}
+	if site.Diagrams == nil {
+		site.Diagrams = defaults.Diagrams
+	}
+	if site.Social == (SocialConfig{}) {
+		site.Social = defaults.Social
+	}
+	if site.Integrity.Mode == "" && site.Integrity.Skip == nil {
+		site.Integrity = defaults.Integrity
+	}
+	// Sites deployed to the same target get a directory of their own, like
+	// their output directories
+	if site.Deploy == (DeployConfig{}) && defaults.Deploy.Target != "" {
+		site.Deploy = defaults.Deploy
+		site.Deploy.Path = path.Join(defaults.Deploy.Path, site.Name)
+	}
+	if site.Access.Audiences == nil && !site.Access.Headers && site.Access.BasicAuth == "" && site.Access.Flags == nil {
+		site.Access = defaults.Access
+	}
+	if site.Sitemap == (SitemapConfig{}) {
+		site.Sitemap = defaults.Sitemap
+	}
+	if len(site.GoDoc.Packages) == 0 {
+		site.GoDoc = defaults.GoDoc
+	}
+	if len(site.CLI) == 0 {
+		site.CLI = defaults.CLI
+	}
+}
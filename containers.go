@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// containerFunc writes the HTML around the content of a container block,
+// called when entering and again when leaving the block
+type containerFunc func(s *Site, w util.BufWriter, node *containerNode, entering bool) error
+
+// containers are the container blocks markdown pages can use, written as
+// :::name arguments on a line of their own and closed by a line of as many
+// colons. A container inside another needs fewer colons than the outer one.
+var containers = map[string]containerFunc{
+	"tabs":    (*Site).renderTabs,
+	"tab":     (*Site).renderTab,
+	"details": (*Site).renderDetails,
+}
+
+var (
+	containerOpening = regexp.MustCompile(`^ {0,3}(:{3,})[ \t]*([A-Za-z][\w-]*)[ \t]*(.*?)\s*$`)
+	containerClosing = regexp.MustCompile(`^ {0,3}(:{3,})\s*$`)
+)
+
+// kindContainer is the AST node kind of container blocks
+var kindContainer = ast.NewNodeKind("Container")
+
+// containerNode is a container block holding markdown content
+type containerNode struct {
+	ast.BaseBlock
+	Name   string
+	Args   string // Rest of the opening line, such as a title
+	fence  int    // Number of colons the block was opened with
+	offset int    // Position of the opening line in the source, unique in the page
+}
+
+// Kind returns the node kind of containers
+func (n *containerNode) Kind() ast.NodeKind {
+	return kindContainer
+}
+
+// Dump prints the container for debugging
+func (n *containerNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name, "Args": n.Args}, nil)
+}
+
+// containerParser finds container blocks
+type containerParser struct{}
+
+func (containerParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (containerParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	m := containerOpening.FindSubmatch(line)
+	if m == nil {
+		return nil, parser.NoChildren
+	}
+
+	node := &containerNode{
+		Name:   string(m[2]),
+		Args:   string(m[3]),
+		fence:  len(m[1]),
+		offset: segment.Start,
+	}
+	reader.Advance(segment.Len() - 1)
+	return node, parser.HasChildren
+}
+
+func (containerParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if m := containerClosing.FindSubmatch(line); m != nil && len(m[1]) >= node.(*containerNode).fence {
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+func (containerParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (containerParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (containerParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// containerRenderer writes the HTML of container blocks
+type containerRenderer struct {
+	site *Site
+}
+
+// RegisterFuncs registers the container renderer with goldmark
+func (r containerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindContainer, r.render)
+}
+
+func (r containerRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	node := n.(*containerNode)
+	fn, ok := containers[node.Name]
+	if !ok {
+		return ast.WalkStop, fmt.Errorf("unknown container %q", node.Name)
+	}
+	err := fn(r.site, w, node, entering)
+	if err != nil {
+		return ast.WalkStop, fmt.Errorf("container %s: %w", node.Name, err)
+	}
+	return ast.WalkContinue, nil
+}
+
+// childContainers returns the containers directly inside a container,
+// failing when it holds anything else or containers with another name
+func childContainers(node *containerNode, name string) ([]*containerNode, error) {
+	var children []*containerNode
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		child, ok := c.(*containerNode)
+		if !ok || child.Name != name {
+			return nil, fmt.Errorf("may only contain %s blocks", name)
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// containerTitle returns the title given on a container's opening line
+func containerTitle(node *containerNode) string {
+	return strings.TrimSpace(node.Args)
+}
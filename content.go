@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mount maps a source directory into the site's content tree
+type Mount struct {
+	Source string `yaml:"source"` // Directory on disk
+	Target string `yaml:"target"` // Path prefix within the content tree
+}
+
+// contentWalkFunc is called for each content file with its path on disk and
+// its slash-separated path within the content tree
+type contentWalkFunc func(srcPath, relPath string, info os.FileInfo) error
+
+// contentFile is a file of the content tree, found once per build and
+// shared by every stage that needs it
+type contentFile struct {
+	SrcPath string      // Path on disk
+	RelPath string      // Slash-separated path within the content tree
+	Info    os.FileInfo // File information from the walk
+}
+
+// mounts returns the directories that make up the content tree. Without
+// configured mounts the content directory is mounted at the root. Fetched
+// remote content and the generated API, CLI and GraphQL references come
+// after the local mounts.
+func (s *Site) mounts() []Mount {
+	mounts := s.localMounts()
+	mounts = append(mounts[:len(mounts):len(mounts)], s.remoteMounts...)
+	mounts = append(mounts, s.godocMounts...)
+	mounts = append(mounts, s.cliMounts...)
+	return append(mounts, s.graphqlMounts...)
+}
+
+// localMounts returns the directories on disk that make up the content
+// tree, leaving out fetched remote content
+func (s *Site) localMounts() []Mount {
+	if len(s.Mounts) == 0 {
+		return []Mount{{Source: s.ContentDir}}
+	}
+	return s.Mounts
+}
+
+// walkContent calls fn for every file in the content tree. When several
+// mounts provide the same path, the first mount listed wins.
+func (s *Site) walkContent(fn contentWalkFunc) error {
+	return walkMounts(s.mounts(), fn)
+}
+
+// walkMounts calls fn for every file of the mounted directories, the first
+// mount listed winning when several provide the same path
+func walkMounts(mounts []Mount, fn contentWalkFunc) error {
+	seen := make(map[string]bool)
+
+	for _, mount := range mounts {
+		prefix := strings.Trim(path.Clean("/"+filepath.ToSlash(mount.Target)), "/")
+
+		err := filepath.Walk(mount.Source, func(srcPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Skip directories, not descending into hidden ones such as .git
+			if info.IsDir() {
+				if srcPath != mount.Source && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relPath, err := filepath.Rel(mount.Source, srcPath)
+			if err != nil {
+				return err
+			}
+			relPath = path.Join(prefix, filepath.ToSlash(relPath))
+
+			if seen[relPath] {
+				return nil
+			}
+			seen[relPath] = true
+
+			return fn(srcPath, relPath, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanContent lists the files of the content tree, walking the mounts once
+// for the whole build
+func (s *Site) scanContent() error {
+	s.files = nil
+	s.filesByPath = make(map[string]contentFile)
+	return s.walkContent(func(srcPath, relPath string, info os.FileInfo) error {
+		file := contentFile{SrcPath: srcPath, RelPath: relPath, Info: info}
+		s.files = append(s.files, file)
+		s.filesByPath[relPath] = file
+		return nil
+	})
+}
+
+// copyStaticFiles copies the files of the content tree that are not pages,
+// such as images and downloads, to the same place in the output directory.
+// When passthrough extensions are configured only those files are copied.
+func (s *Site) copyStaticFiles() error {
+	for _, file := range s.files {
+		name := file.Info.Name()
+		if s.isPage(file.RelPath) || name == sectionConfigFile || strings.HasPrefix(name, ".") || !s.isPassthrough(file.RelPath) {
+			continue
+		}
+
+		err := s.output.CopyFile(file.RelPath, file.SrcPath)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file.SrcPath, err)
+		}
+		if s.convertsImage(file) {
+			err = s.writeConvertedImages(file)
+			if err != nil {
+				return fmt.Errorf("failed to convert %s: %w", file.SrcPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isPassthrough reports whether a non-page file may be copied to the output
+func (s *Site) isPassthrough(relPath string) bool {
+	if s.Passthrough == nil {
+		return true
+	}
+
+	ext := strings.ToLower(path.Ext(relPath))
+	for _, allowed := range s.Passthrough {
+		if !strings.HasPrefix(allowed, ".") {
+			allowed = "." + allowed
+		}
+		if strings.ToLower(allowed) == ext {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+// Copy buttons on code blocks generated by mindoc. The buttons stay hidden
+// where the clipboard can't be written to.
+(function () {
+  if (window.mindocCode) {
+    return;
+  }
+  window.mindocCode = true;
+
+  document.addEventListener("DOMContentLoaded", function () {
+    if (!navigator.clipboard) {
+      return;
+    }
+    Array.prototype.forEach.call(document.querySelectorAll(".code-copy"), function (button) {
+      var label = button.textContent;
+      var timer;
+      button.hidden = false;
+      button.addEventListener("click", function () {
+        var code = button.parentNode.querySelector("code");
+        navigator.clipboard.writeText(code.textContent).then(function () {
+          button.textContent = button.getAttribute("data-copied");
+          clearTimeout(timer);
+          timer = setTimeout(function () {
+            button.textContent = label;
+          }, 2000);
+        });
+      });
+    });
+  });
+})();
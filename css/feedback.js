@@ -0,0 +1,42 @@
+// Feedback widget generated by mindoc. The answer is sent in the background
+// and the question replaced by a thank-you note; without scripts the form
+// is posted as usual.
+(function () {
+  if (window.mindocFeedback) {
+    return;
+  }
+  window.mindocFeedback = true;
+
+  document.addEventListener("submit", function (event) {
+    var form = event.target;
+    if (!form.classList || !form.classList.contains("feedback") || !window.fetch) {
+      return;
+    }
+    event.preventDefault();
+
+    var data = new URLSearchParams(new FormData(form));
+    if (event.submitter && event.submitter.name) {
+      data.set(event.submitter.name, event.submitter.value);
+    }
+    if (!data.get("page")) {
+      data.set("page", location.pathname);
+    }
+
+    fetch(form.action, {
+      method: "POST",
+      headers: { "Accept": "application/json" },
+      body: data
+    }).then(function (response) {
+      if (!response.ok) {
+        throw new Error(response.statusText);
+      }
+      var thanks = document.createElement("p");
+      thanks.className = "feedback-thanks";
+      thanks.setAttribute("role", "status");
+      thanks.textContent = form.getAttribute("data-thanks");
+      form.replaceChildren(thanks);
+    }).catch(function () {
+      form.submit();
+    });
+  });
+})();
@@ -0,0 +1,45 @@
+// Lightbox for the images of pages generated by mindoc. Clicking an image,
+// or pressing Enter on it, shows it enlarged over the page until clicked
+// again or closed with Escape.
+(function () {
+  if (window.mindocLightbox) {
+    return;
+  }
+  window.mindocLightbox = true;
+
+  document.addEventListener("DOMContentLoaded", function () {
+    var dialog = document.createElement("dialog");
+    if (!dialog.showModal) {
+      return;
+    }
+    dialog.className = "lightbox";
+    var large = document.createElement("img");
+    dialog.appendChild(large);
+    document.body.appendChild(dialog);
+
+    dialog.addEventListener("click", function () {
+      dialog.close();
+    });
+    dialog.addEventListener("close", function () {
+      large.removeAttribute("src");
+    });
+
+    Array.prototype.forEach.call(document.querySelectorAll("img[data-lightbox]"), function (img) {
+      img.tabIndex = 0;
+      img.setAttribute("role", "button");
+
+      function open() {
+        large.src = img.currentSrc || img.src;
+        large.alt = img.alt;
+        dialog.showModal();
+      }
+      img.addEventListener("click", open);
+      img.addEventListener("keydown", function (event) {
+        if (event.key === "Enter" || event.key === " ") {
+          event.preventDefault();
+          open();
+        }
+      });
+    });
+  });
+})();
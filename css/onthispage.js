@@ -0,0 +1,65 @@
+// "On this page" navigation generated by mindoc. The link to the heading
+// of the part being read is highlighted while the page scrolls. Without
+// scripts the navigation is a plain list of links.
+(function () {
+  if (window.mindocOnThisPage) {
+    return;
+  }
+  window.mindocOnThisPage = true;
+
+  // Headings this close to the top of the window count as being read
+  var offset = 80;
+
+  document.addEventListener("DOMContentLoaded", function () {
+    var links = document.querySelectorAll(".on-this-page a[href^='#']");
+    var targets = [];
+    Array.prototype.forEach.call(links, function (link) {
+      var heading = document.getElementById(decodeURIComponent(link.getAttribute("href").slice(1)));
+      if (heading) {
+        targets.push({ link: link, heading: heading });
+      }
+    });
+    if (targets.length === 0) {
+      return;
+    }
+
+    var active = null;
+    function update() {
+      var current = targets[0];
+      targets.forEach(function (target) {
+        if (target.heading.getBoundingClientRect().top <= offset) {
+          current = target;
+        }
+      });
+      // At the bottom of the page the last headings can't reach the top
+      if (window.innerHeight + window.scrollY >= document.documentElement.scrollHeight - 2) {
+        current = targets[targets.length - 1];
+      }
+      if (current === active) {
+        return;
+      }
+      if (active) {
+        active.link.classList.remove("is-active");
+        active.link.removeAttribute("aria-current");
+      }
+      current.link.classList.add("is-active");
+      current.link.setAttribute("aria-current", "location");
+      active = current;
+    }
+
+    var scheduled = false;
+    function schedule() {
+      if (!scheduled) {
+        scheduled = true;
+        window.requestAnimationFrame(function () {
+          scheduled = false;
+          update();
+        });
+      }
+    }
+
+    window.addEventListener("scroll", schedule, { passive: true });
+    window.addEventListener("resize", schedule);
+    update();
+  });
+})();
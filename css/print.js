@@ -0,0 +1,24 @@
+// Opens every collapsed details element while a page generated by mindoc is
+// printed, and closes them again afterwards.
+(function () {
+  if (window.mindocPrint) {
+    return;
+  }
+  window.mindocPrint = true;
+
+  var opened = [];
+
+  window.addEventListener("beforeprint", function () {
+    Array.prototype.forEach.call(document.querySelectorAll("details:not([open])"), function (details) {
+      details.open = true;
+      opened.push(details);
+    });
+  });
+
+  window.addEventListener("afterprint", function () {
+    opened.forEach(function (details) {
+      details.open = false;
+    });
+    opened = [];
+  });
+})();
@@ -0,0 +1,48 @@
+// Collapsible sidebar sections generated by mindoc. The open or closed
+// state of each section is remembered for the browser session.
+(function () {
+  var storageKey = "mindoc-sidebar";
+
+  function loadState() {
+    try {
+      return JSON.parse(sessionStorage.getItem(storageKey)) || {};
+    } catch (e) {
+      return {};
+    }
+  }
+
+  function saveState(state) {
+    try {
+      sessionStorage.setItem(storageKey, JSON.stringify(state));
+    } catch (e) {}
+  }
+
+  function setExpanded(toggle, expanded) {
+    var list = document.getElementById(toggle.getAttribute("aria-controls"));
+    toggle.setAttribute("aria-expanded", expanded ? "true" : "false");
+    toggle.parentNode.classList.toggle("is-expanded", expanded);
+    toggle.parentNode.classList.toggle("is-collapsed", !expanded);
+    if (list) {
+      list.hidden = !expanded;
+    }
+  }
+
+  document.addEventListener("DOMContentLoaded", function () {
+    var state = loadState();
+    var toggles = document.querySelectorAll(".sidebar-toggle");
+
+    Array.prototype.forEach.call(toggles, function (toggle) {
+      var id = toggle.getAttribute("aria-controls");
+      if (id in state) {
+        setExpanded(toggle, state[id]);
+      }
+
+      toggle.addEventListener("click", function () {
+        var expanded = toggle.getAttribute("aria-expanded") !== "true";
+        setExpanded(toggle, expanded);
+        state[id] = expanded;
+        saveState(state);
+      });
+    });
+  });
+})();
@@ -0,0 +1,106 @@
+// Tabbed content generated by mindoc. Choosing a tab chooses the tab with
+// the same label in every set of tabs on the page, and the choice is
+// remembered for later pages. Without scripts every panel is shown.
+(function () {
+  if (window.mindocTabs) {
+    return;
+  }
+  window.mindocTabs = true;
+
+  var storageKey = "mindoc-tabs";
+
+  function loadPreferred() {
+    try {
+      return JSON.parse(localStorage.getItem(storageKey)) || [];
+    } catch (e) {
+      return [];
+    }
+  }
+
+  function savePreferred(label) {
+    var preferred = loadPreferred().filter(function (other) {
+      return other !== label;
+    });
+    preferred.unshift(label);
+    try {
+      localStorage.setItem(storageKey, JSON.stringify(preferred.slice(0, 20)));
+    } catch (e) {}
+  }
+
+  function tabsOf(set) {
+    return Array.prototype.slice.call(set.querySelectorAll(":scope > .tab-list > [role=tab]"));
+  }
+
+  function select(set, index, focus) {
+    tabsOf(set).forEach(function (tab, i) {
+      var panel = document.getElementById(tab.getAttribute("aria-controls"));
+      tab.setAttribute("aria-selected", i === index ? "true" : "false");
+      tab.tabIndex = i === index ? 0 : -1;
+      panel.hidden = i !== index;
+      if (i === index && focus) {
+        tab.focus();
+      }
+    });
+  }
+
+  function selectLabel(sets, label) {
+    sets.forEach(function (set) {
+      var index = tabsOf(set).findIndex(function (tab) {
+        return tab.textContent === label;
+      });
+      if (index >= 0) {
+        select(set, index, false);
+      }
+    });
+  }
+
+  document.addEventListener("DOMContentLoaded", function () {
+    // The print variant shows every panel
+    if (document.body.classList.contains("print")) {
+      return;
+    }
+
+    var sets = Array.prototype.slice.call(document.querySelectorAll(".tabs"));
+    var preferred = loadPreferred();
+
+    sets.forEach(function (set) {
+      var tabs = tabsOf(set);
+      set.querySelector(".tab-list").hidden = false;
+      set.classList.add("tabs-ready");
+
+      var index = 0;
+      for (var p = preferred.length - 1; p >= 0; p--) {
+        tabs.forEach(function (tab, i) {
+          if (tab.textContent === preferred[p]) {
+            index = i;
+          }
+        });
+      }
+      select(set, index, false);
+
+      tabs.forEach(function (tab, i) {
+        tab.addEventListener("click", function () {
+          selectLabel(sets, tab.textContent);
+          savePreferred(tab.textContent);
+        });
+
+        tab.addEventListener("keydown", function (event) {
+          var next = {
+            ArrowRight: (i + 1) % tabs.length,
+            ArrowLeft: (i - 1 + tabs.length) % tabs.length,
+            Home: 0,
+            End: tabs.length - 1
+          }[event.key];
+          if (next === undefined) {
+            return;
+          }
+          if (document.documentElement.dir === "rtl" && event.key.indexOf("Arrow") === 0) {
+            next = event.key === "ArrowRight" ? (i - 1 + tabs.length) % tabs.length : (i + 1) % tabs.length;
+          }
+          event.preventDefault();
+          select(set, next, true);
+        });
+      });
+    });
+  });
+})();
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"cdr.dev/slog"
+	"oss.terrastruct.com/d2/d2graph"
+	"oss.terrastruct.com/d2/d2layouts/d2dagrelayout"
+	"oss.terrastruct.com/d2/d2lib"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	d2log "oss.terrastruct.com/d2/lib/log"
+	"oss.terrastruct.com/d2/lib/textmeasure"
+	"oss.terrastruct.com/util-go/go2"
+)
+
+// builtinDiagrams are the diagram languages mindoc draws itself, without
+// any tools installed
+var builtinDiagrams = map[string]func(source string) ([]byte, error){
+	"d2": drawD2,
+}
+
+// drawD2 draws a D2 diagram as SVG with the dagre layout
+func drawD2(source string) ([]byte, error) {
+	ruler, err := textmeasure.NewRuler()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %w", err)
+	}
+	layout := func(engine string) (d2graph.LayoutGraph, error) {
+		return d2dagrelayout.DefaultLayout, nil
+	}
+
+	renderOpts := &d2svg.RenderOpts{Pad: go2.Pointer(int64(d2svg.DEFAULT_PADDING))}
+	compileOpts := &d2lib.CompileOptions{LayoutResolver: layout, Ruler: ruler}
+	// D2 logs its progress, which a build has no use for, so it gets a
+	// logger without any sinks
+	ctx := d2log.With(context.Background(), slog.Make())
+	diagram, _, err := d2lib.Compile(ctx, source, compileOpts, renderOpts)
+	if err != nil {
+		return nil, err
+	}
+	return d2svg.Render(diagram, renderOpts)
+}
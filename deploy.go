@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeployConfig describes where the deploy command uploads the site
+type DeployConfig struct {
+	Target       string            `yaml:"target"`       // s3, sftp, webdav or dir
+	Path         string            `yaml:"path"`         // Directory, or key prefix within the bucket, the site is deployed to
+	Bucket       string            `yaml:"bucket"`       // S3 bucket
+	Region       string            `yaml:"region"`       // S3 region, "us-east-1" when unset
+	Endpoint     string            `yaml:"endpoint"`     // Address of an S3-compatible service, AWS when unset
+	AccessKey    string            `yaml:"accessKey"`    // With $VARIABLES expanded, $AWS_ACCESS_KEY_ID when unset
+	SecretKey    string            `yaml:"secretKey"`    // With $VARIABLES expanded, $AWS_SECRET_ACCESS_KEY when unset
+	Host         string            `yaml:"host"`         // SFTP server, with the port when it isn't 22
+	URL          string            `yaml:"url"`          // WebDAV collection the site is deployed to
+	User         string            `yaml:"user"`         // SFTP or WebDAV user, with $VARIABLES expanded
+	Password     string            `yaml:"password"`     // SFTP or WebDAV password, with $VARIABLES expanded
+	Key          string            `yaml:"key"`          // Private key file logging in to the SFTP server, with $VARIABLES expanded
+	KnownHosts   string            `yaml:"knownHosts"`   // File of the SFTP server's host key, ~/.ssh/known_hosts when unset
+	CacheControl DeployCacheConfig `yaml:"cacheControl"` // Cache-Control headers of each class of file
+}
+
+// DeployCacheConfig holds the Cache-Control header of each class of file
+type DeployCacheConfig struct {
+	Pages  string `yaml:"pages"`  // Pages and the site's other documents, such as manifests and the service worker
+	Assets string `yaml:"assets"` // Stylesheets and scripts
+	Media  string `yaml:"media"`  // Images, fonts and every other file
+}
+
+// defaultCacheControl applies to the classes of file the config leaves
+// unset. Pages are checked on every visit so a deploy shows at once; the
+// theme's files keep their names across builds, so they aren't cached for
+// long either.
+var defaultCacheControl = DeployCacheConfig{
+	Pages:  "public, max-age=0, must-revalidate",
+	Assets: "public, max-age=3600",
+	Media:  "public, max-age=86400",
+}
+
+// pageExtensions are the files deployed with the Cache-Control header of
+// pages
+var pageExtensions = setOf(".html", ".json", ".xml", ".txt", ".md", ".webmanifest")
+
+// deployContentTypes are the content types of the extensions the system's
+// MIME table may not know, or gets wrong
+var deployContentTypes = map[string]string{
+	".html":        "text/html; charset=utf-8",
+	".css":         "text/css; charset=utf-8",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".txt":         "text/plain; charset=utf-8",
+	".xml":         "application/xml",
+	".svg":         "image/svg+xml",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".woff2":       "font/woff2",
+}
+
+// deployTarget stores the files of a deployed site
+type deployTarget interface {
+	read(relPath string) ([]byte, error) // Fails with os.ErrNotExist for missing files
+	upload(relPath string, data []byte, contentType, cacheControl string) error
+	remove(relPath string) error
+	close() error
+}
+
+// deploySites builds each site with a deploy target and uploads the files
+// that changed since the last deploy, going by the build manifests, and
+// deletes the files the build no longer generates
+func deploySites(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	full := fs.Bool("full", false, "upload every file, not only the ones that changed since the last deploy")
+	dryRun := fs.Bool("dry-run", false, "report the changes without deploying them")
+	fs.Parse(args)
+
+	deployed := 0
+	for _, site := range sites {
+		if site.Deploy.Target == "" {
+			continue
+		}
+		target, err := newDeployTarget(site.Deploy)
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+
+		err = site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+
+		err = site.deploy(target, *full, *dryRun)
+		target.close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+		deployed++
+	}
+
+	if deployed == 0 {
+		return fmt.Errorf("no site has a deploy target")
+	}
+	return nil
+}
+
+// newDeployTarget returns the driver of a deploy target
+func newDeployTarget(cfg DeployConfig) (deployTarget, error) {
+	switch cfg.Target {
+	case "s3":
+		if cfg.Bucket == "" {
+			return nil, fmt.Errorf("s3 needs a bucket")
+		}
+		return newS3Target(cfg), nil
+	case "sftp":
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("sftp needs a host")
+		}
+		return newSFTPTarget(cfg)
+	case "webdav":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webdav needs a url")
+		}
+		return newWebDAVTarget(cfg), nil
+	case "dir":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("dir needs a path")
+		}
+		return dirTarget(cfg.Path), nil
+	}
+
+	return nil, fmt.Errorf("unknown deploy target %q", cfg.Target)
+}
+
+// deploy compares the manifest of the last build with the one deployed
+// before and brings the target up to date. The manifest is uploaded last,
+// so an interrupted deploy is completed by the next one.
+func (s *Site) deploy(target deployTarget, full, dryRun bool) error {
+	out := s.servedOutput()
+	var local buildManifest
+	data, err := out.ReadFile(buildManifestFile)
+	if err == nil {
+		err = json.Unmarshal(data, &local)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read build manifest: %w", err)
+	}
+
+	var remote buildManifest
+	data, err = target.read(buildManifestFile)
+	if err == nil {
+		err = json.Unmarshal(data, &remote)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read deployed manifest: %w", err)
+	}
+
+	deployedHashes := make(map[string]string, len(remote.Files))
+	for _, file := range remote.Files {
+		deployedHashes[file.Path] = file.SHA256
+	}
+
+	var changed []string
+	for _, file := range local.Files {
+		if full || deployedHashes[file.Path] != file.SHA256 {
+			changed = append(changed, file.Path)
+		}
+		delete(deployedHashes, file.Path)
+	}
+	removed := make([]string, 0, len(deployedHashes))
+	for relPath := range deployedHashes {
+		removed = append(removed, relPath)
+	}
+	sort.Strings(removed)
+
+	fmt.Printf("%s: %d file(s), %d to upload and %d to delete\n", s.label(), len(local.Files), len(changed), len(removed))
+	if dryRun {
+		return nil
+	}
+
+	for _, relPath := range append(changed, buildManifestFile) {
+		data, err := out.ReadFile(relPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+		err = target.upload(relPath, data, contentType(relPath, data), s.cacheControl(relPath))
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", relPath, err)
+		}
+	}
+	for _, relPath := range removed {
+		err := target.remove(relPath)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", relPath, err)
+		}
+	}
+
+	fmt.Printf("%s deployed successfully.\n", s.label())
+	return nil
+}
+
+// cacheControl returns the Cache-Control header a file is deployed with,
+// depending on its class
+func (s *Site) cacheControl(relPath string) string {
+	config, fallback := s.Deploy.CacheControl.Media, defaultCacheControl.Media
+	ext := strings.ToLower(path.Ext(relPath))
+	switch {
+	case pageExtensions[ext] || relPath == serviceWorkerFile:
+		config, fallback = s.Deploy.CacheControl.Pages, defaultCacheControl.Pages
+	case ext == ".css" || ext == ".js":
+		config, fallback = s.Deploy.CacheControl.Assets, defaultCacheControl.Assets
+	}
+	if config != "" {
+		return config
+	}
+	return fallback
+}
+
+// contentType returns the content type of a generated file, going by its
+// extension or else its contents
+func contentType(relPath string, data []byte) string {
+	ext := strings.ToLower(path.Ext(relPath))
+	if t, ok := deployContentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// dirTarget deploys the site into a directory, such as a share mounted
+// from the web server. Files carry no headers there, so the content types
+// and Cache-Control headers are left to the server.
+type dirTarget string
+
+func (d dirTarget) read(relPath string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(relPath)))
+}
+
+func (d dirTarget) upload(relPath string, data []byte, contentType, cacheControl string) error {
+	return dirOutput(d).WriteFile(relPath, data)
+}
+
+func (d dirTarget) remove(relPath string) error {
+	err := os.Remove(filepath.Join(string(d), filepath.FromSlash(relPath)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d dirTarget) close() error {
+	return nil
+}
+
+// s3Target deploys the site into an S3 bucket, or a bucket of a service
+// with the same API, signing the requests with AWS Signature Version 4
+type s3Target struct {
+	http         *http.Client
+	base         string // URL of the bucket
+	prefix       string // Prefix of the keys, ending in a slash unless empty
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newS3Target returns the client of an S3 bucket. Without an endpoint the
+// bucket is addressed on AWS by its host name, otherwise by path.
+func newS3Target(cfg DeployConfig) *s3Target {
+	t := &s3Target{
+		http:      &http.Client{Timeout: time.Minute},
+		region:    cfg.Region,
+		accessKey: os.ExpandEnv(cfg.AccessKey),
+		secretKey: os.ExpandEnv(cfg.SecretKey),
+	}
+	if t.region == "" {
+		t.region = "us-east-1"
+	}
+	if t.accessKey == "" {
+		t.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		t.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		t.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if cfg.Endpoint == "" {
+		t.base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, t.region)
+	} else {
+		t.base = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + awsEscape(cfg.Bucket)
+	}
+	if prefix := strings.Trim(cfg.Path, "/"); prefix != "" {
+		t.prefix = prefix + "/"
+	}
+	return t
+}
+
+func (t *s3Target) read(relPath string) ([]byte, error) {
+	data, status, err := t.send(http.MethodGet, relPath, nil, nil)
+	if status == http.StatusNotFound || status == http.StatusForbidden {
+		// Buckets that can't be listed answer 403 for missing keys
+		return nil, os.ErrNotExist
+	}
+	return data, err
+}
+
+func (t *s3Target) upload(relPath string, data []byte, contentType, cacheControl string) error {
+	headers := map[string]string{"Content-Type": contentType, "Cache-Control": cacheControl}
+	_, _, err := t.send(http.MethodPut, relPath, data, headers)
+	return err
+}
+
+func (t *s3Target) remove(relPath string) error {
+	_, _, err := t.send(http.MethodDelete, relPath, nil, nil)
+	return err
+}
+
+func (t *s3Target) close() error {
+	return nil
+}
+
+// send makes a signed request for an object and returns the response and
+// its status, failing unless the service answers with a success status
+func (t *s3Target) send(method, relPath string, body []byte, headers map[string]string) ([]byte, int, error) {
+	key := t.prefix + relPath
+	req, err := http.NewRequest(method, t.base+"/"+awsEscape(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	t.sign(req, body, time.Now().UTC())
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message := strings.TrimSpace(string(data[:min(len(data), 1024)]))
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, message)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization to a request, signing
+// the host, the payload and the x-amz headers
+func (t *s3Target) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if t.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", t.sessionToken)
+	}
+
+	signed := []string{"host"}
+	canonicalHeaders := "host:" + req.URL.Host + "\n"
+	var names []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		signed = append(signed, name)
+		canonicalHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := now.Format("20060102") + "/" + t.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + t.secretKey)
+	for _, part := range []string{now.Format("20060102"), t.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of a message
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// awsEscape escapes a slash-separated object key the way AWS signatures
+// expect, leaving only unreserved characters and the slashes as they are
+func awsEscape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSSHKeys are the private keys tried for SFTP when neither a key
+// nor a password is configured and no SSH agent is running
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sftpTarget deploys the site into a directory of an SFTP server. Files are
+// written under a temporary name and renamed into place, so readers never
+// see half-uploaded files.
+type sftpTarget struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	dir    string // Directory on the server the site is deployed to
+}
+
+// newSFTPTarget connects to an SFTP server, authenticating with the
+// configured password or key, the SSH agent or the user's default keys.
+// The server's host key must be in the known hosts file.
+func newSFTPTarget(cfg DeployConfig) (*sftpTarget, error) {
+	home, _ := os.UserHomeDir()
+	knownHostsFile := os.ExpandEnv(cfg.KnownHosts)
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts, add the server with ssh-keyscan: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if password := os.ExpandEnv(cfg.Password); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	keys := []string{os.ExpandEnv(cfg.Key)}
+	if cfg.Key == "" && cfg.Password == "" {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if conn, err := net.Dial("unix", sock); err == nil {
+				auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			}
+		}
+		keys = nil
+		for _, name := range defaultSSHKeys {
+			keys = append(keys, filepath.Join(home, ".ssh", name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, keyFile := range keys {
+		if keyFile == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil && cfg.Key == "" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			if cfg.Key != "" {
+				return nil, fmt.Errorf("failed to parse SSH key %s, use the SSH agent for keys with a passphrase: %w", keyFile, err)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no password, SSH key or SSH agent to log in with")
+	}
+
+	user := cfg.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	host := cfg.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP on %s: %w", host, err)
+	}
+	return &sftpTarget{conn: conn, client: client, dir: cfg.Path}, nil
+}
+
+func (t *sftpTarget) read(relPath string) ([]byte, error) {
+	f, err := t.client.Open(path.Join(t.dir, relPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (t *sftpTarget) upload(relPath string, data []byte, contentType, cacheControl string) error {
+	remotePath := path.Join(t.dir, relPath)
+	err := t.client.MkdirAll(path.Dir(remotePath))
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path.Join(path.Dir(remotePath), ".upload-"+path.Base(remotePath))
+	f, err := t.client.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.client.Remove(tmpPath)
+		return err
+	}
+
+	// Servers without the POSIX rename extension can't rename over a file
+	err = t.client.PosixRename(tmpPath, remotePath)
+	if err != nil {
+		t.client.Remove(remotePath)
+		err = t.client.Rename(tmpPath, remotePath)
+	}
+	return err
+}
+
+func (t *sftpTarget) remove(relPath string) error {
+	err := t.client.Remove(path.Join(t.dir, relPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *sftpTarget) close() error {
+	t.client.Close()
+	return t.conn.Close()
+}
+
+// webdavTarget deploys the site into a collection of a WebDAV server,
+// creating the collections files are put into as needed
+type webdavTarget struct {
+	http     *http.Client
+	base     string // URL of the collection the site is deployed to, ending in a slash
+	user     string
+	password string
+	dirs     map[string]bool // Collections known to exist
+}
+
+// newWebDAVTarget returns the client of a WebDAV server. Without a
+// configured user the login for the server's host is looked up in
+// ~/.netrc, like curl does.
+func newWebDAVTarget(cfg DeployConfig) *webdavTarget {
+	t := &webdavTarget{
+		http:     &http.Client{Timeout: time.Minute},
+		base:     strings.TrimSuffix(cfg.URL, "/") + "/",
+		user:     os.ExpandEnv(cfg.User),
+		password: os.ExpandEnv(cfg.Password),
+		dirs:     make(map[string]bool),
+	}
+	if t.user == "" {
+		if u, err := url.Parse(cfg.URL); err == nil {
+			t.user, t.password = netrcLogin(u.Hostname())
+		}
+	}
+	return t
+}
+
+func (t *webdavTarget) read(relPath string) ([]byte, error) {
+	data, status, err := t.send(http.MethodGet, relPath, nil, nil)
+	if status == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	return data, err
+}
+
+func (t *webdavTarget) upload(relPath string, data []byte, contentType, cacheControl string) error {
+	// Collections have to be created one level at a time, starting with
+	// the site's own
+	dir := path.Dir(relPath)
+	var missing []string
+	for !t.dirs[dir] {
+		missing = append(missing, dir)
+		if dir == "." {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		_, status, err := t.send("MKCOL", strings.TrimPrefix(missing[i]+"/", "./"), nil, nil)
+		if err != nil && status != http.StatusMethodNotAllowed {
+			return fmt.Errorf("failed to create collection: %w", err)
+		}
+		t.dirs[missing[i]] = true
+	}
+
+	_, _, err := t.send(http.MethodPut, relPath, data, map[string]string{"Content-Type": contentType})
+	return err
+}
+
+func (t *webdavTarget) remove(relPath string) error {
+	_, status, err := t.send(http.MethodDelete, relPath, nil, nil)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (t *webdavTarget) close() error {
+	return nil
+}
+
+// send makes a request for a file or collection and returns the response
+// and its status, failing unless the server answers with a success status
+func (t *webdavTarget) send(method, relPath string, body []byte, headers map[string]string) ([]byte, int, error) {
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	req, err := http.NewRequest(method, t.base+strings.Join(segments, "/"), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if t.user != "" {
+		req.SetBasicAuth(t.user, t.password)
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message := strings.TrimSpace(string(data[:min(len(data), 1024)]))
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, relPath, resp.Status, message)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// netrcLogin returns the login and password ~/.netrc has for a host, or
+// those of its default entry
+func netrcLogin(host string) (string, string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", ""
+	}
+	data, err := ioutil.ReadFile(filepath.Join(home, ".netrc"))
+	if err != nil {
+		return "", ""
+	}
+
+	var login, password string
+	matched, found := false, false
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine", "default":
+			if found {
+				return login, password
+			}
+			matched = fields[i] == "default" || i+1 < len(fields) && fields[i+1] == host
+			if fields[i] == "machine" {
+				i++
+			}
+		case "login", "password":
+			if i+1 < len(fields) && matched {
+				found = true
+				if fields[i] == "login" {
+					login = fields[i+1]
+				} else {
+					password = fields[i+1]
+				}
+			}
+			i++
+		}
+	}
+	return login, password
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+const (
+	deprecationsPath       = "deprecations.md"   // Path of the generated deprecations page, as if it were a page file
+	deprecationsLayoutFile = "deprecations.html" // Template of the deprecations page, page.html when missing
+)
+
+// renderBadges returns the version badges of a page: the version it was
+// added in, whether it is deprecated and the version it was removed in
+func (s *Site) renderBadges(page *Page) template.HTML {
+	if page.Since == "" && !page.Deprecated && page.Removed == "" {
+		return ""
+	}
+
+	esc := template.HTMLEscapeString
+	var badges []string
+	if page.Since != "" {
+		badges = append(badges, fmt.Sprintf(`<span class="badge badge-since">%s</span>`, esc(s.translate("since", page.Since))))
+	}
+	if page.Deprecated {
+		badges = append(badges, fmt.Sprintf(`<span class="badge badge-deprecated">%s</span>`, esc(s.translate("deprecated"))))
+	}
+	if page.Removed != "" {
+		badges = append(badges, fmt.Sprintf(`<span class="badge badge-removed">%s</span>`, esc(s.translate("removedIn", page.Removed))))
+	}
+	return template.HTML(`<p class="version-badges">` + strings.Join(badges, " ") + `</p>`)
+}
+
+// Deprecations returns the pages that are deprecated or removed, in
+// navigation order, as in {{ range .Site.Deprecations }}
+func (s *Site) Deprecations() Pages {
+	var pages Pages
+	for _, page := range s.pages {
+		if page.Deprecated || page.Removed != "" {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// writeDeprecationsPage generates the page listing every deprecated or
+// removed page with its badges, when there are any
+func (s *Site) writeDeprecationsPage() error {
+	pages := s.Deprecations()
+	if len(pages) == 0 {
+		return nil
+	}
+
+	page := s.generatedPage(deprecationsPath, s.translate("deprecations"), deprecationsLayoutFile)
+	data := s.newPageData(page)
+
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<ul class=\"deprecations\">\n", esc(page.Title))
+	for _, p := range pages {
+		fmt.Fprintf(&out, "<li><a href=\"%s\">%s</a> %s</li>\n", esc(p.URL), esc(p.Title), s.renderBadges(p))
+	}
+	out.WriteString("</ul>\n")
+	data.Content = template.HTML(out.String())
+
+	err := s.writeGeneratedPage(data)
+	if err != nil {
+		return fmt.Errorf("failed to write the deprecations page: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+
+	"github.com/yuin/goldmark/util"
+)
+
+// renderDetails writes a collapsible block, closed until the reader opens
+// it, with the title on its opening line as the summary
+func (s *Site) renderDetails(w util.BufWriter, node *containerNode, entering bool) error {
+	if !entering {
+		w.WriteString("</details>\n")
+		return nil
+	}
+
+	title := containerTitle(node)
+	if title == "" {
+		title = s.translate("details")
+	}
+	fmt.Fprintf(w, "<details class=\"details\">\n<summary>%s</summary>\n", template.HTMLEscapeString(title))
+	return nil
+}
+
+// printDetailsTag returns the script opening every details element while
+// the page is printed, when the site asks for it
+func (s *Site) printDetailsTag() template.HTML {
+	if !s.PrintExpandDetails {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<script src="%s" defer></script>`, template.HTMLEscapeString(s.url(cssDestDir+"/print.js"))))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// runDiagnostics checks the content tree for problems and reports them.
+// In strict mode any problem found is returned as an error.
+func (s *Site) runDiagnostics() error {
+	orphans, err := s.findOrphanPages()
+	if err != nil {
+		return fmt.Errorf("failed to detect orphan pages: %w", err)
+	}
+
+	if len(orphans) > 0 {
+		fmt.Printf("%s: found %d orphan page(s) not reachable from navigation or links:\n", s.label(), len(orphans))
+		for _, orphan := range orphans {
+			fmt.Printf("  %s\n", orphan)
+		}
+	}
+
+	s.reportStalePages()
+
+	moved, err := s.reportMovedPages()
+	if err != nil {
+		return fmt.Errorf("failed to detect moved pages: %w", err)
+	}
+
+	if *strictMode && len(s.failedPages) > 0 {
+		return fmt.Errorf("%d page(s) failed to convert", len(s.failedPages))
+	}
+	if *strictMode && len(orphans) > 0 {
+		return fmt.Errorf("%d orphan page(s) found", len(orphans))
+	}
+	if *strictMode && moved > 0 {
+		return fmt.Errorf("%d page URL(s) gone without an alias", moved)
+	}
+
+	return nil
+}
+
+// checkSites builds the sites without serving them and audits the generated
+// pages, failing when any problem is found
+func checkSites(sites []*Site) error {
+	problems := 0
+	for _, site := range sites {
+		err := site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+
+		if len(site.failedPages) > 0 {
+			fmt.Printf("%s: %d page(s) failed to convert:\n", site.label(), len(site.failedPages))
+			for _, failure := range site.failedPages {
+				fmt.Printf("  %s\n", failure)
+			}
+			problems += len(site.failedPages)
+		}
+
+		invalid, err := site.validateHTML()
+		if err != nil {
+			return fmt.Errorf("failed to validate HTML: %w", err)
+		}
+		if len(invalid) > 0 {
+			fmt.Printf("%s: found %d HTML problem(s):\n", site.label(), len(invalid))
+			for _, issue := range invalid {
+				fmt.Printf("  %s:%d: %s\n", issue.Page, issue.Line, issue.Message)
+			}
+			problems += len(invalid)
+		}
+
+		issues, err := site.checkAccessibility()
+		if err != nil {
+			return fmt.Errorf("failed to check accessibility: %w", err)
+		}
+		if len(issues) > 0 {
+			fmt.Printf("%s: found %d accessibility problem(s):\n", site.label(), len(issues))
+			for _, issue := range issues {
+				fmt.Printf("  %s: %s\n", issue.Page, issue.Message)
+			}
+			problems += len(issues)
+		}
+
+		broken, err := site.checkLinks()
+		if err != nil {
+			return fmt.Errorf("failed to check links: %w", err)
+		}
+		if len(broken) > 0 {
+			fmt.Printf("%s: found %d broken link(s):\n", site.label(), len(broken))
+			for _, issue := range broken {
+				fmt.Printf("  %s: %s\n", issue.Page, issue.Message)
+			}
+			problems += len(broken)
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+
+	fmt.Println("No problems found.")
+	return nil
+}
+
+// findOrphanPages returns the markdown pages that cannot be reached by
+// following the navigation bar and internal links starting from the index page
+func (s *Site) findOrphanPages() ([]string, error) {
+	// Collect every page and the internal links it contains
+	links := make(map[string][]string)
+	byOutput := make(map[string]string)
+	for _, page := range s.pages {
+		links[page.Path] = nil
+		byOutput[s.outputPath(page.Path)] = page.Path
+		if !s.isMarkdown(page.Path) {
+			continue
+		}
+
+		pageLinks, err := s.internalLinks(page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read links from %s: %w", page.srcPath, err)
+		}
+		links[page.Path] = pageLinks
+	}
+
+	// Start from the index page and everything in the navigation bar
+	queue := []string{"index.html"}
+	for _, entry := range s.navLinks {
+		queue = append(queue, entry.Path)
+	}
+
+	// Follow internal links until no new pages are found
+	reachable := make(map[string]bool)
+	for len(queue) > 0 {
+		page := queue[0]
+		queue = queue[1:]
+
+		// Links to generated files lead to the page they were made from
+		if source, ok := byOutput[page]; ok {
+			page = source
+		}
+
+		if reachable[page] {
+			continue
+		}
+		if _, ok := links[page]; !ok {
+			continue
+		}
+
+		reachable[page] = true
+		queue = append(queue, links[page]...)
+	}
+
+	var orphans []string
+	for page := range links {
+		if !reachable[page] {
+			orphans = append(orphans, page)
+		}
+	}
+	sort.Strings(orphans)
+
+	return orphans, nil
+}
+
+// internalLinks returns the content tree paths linked from a markdown page
+func (s *Site) internalLinks(page *Page) ([]string, error) {
+	doc := s.markdown.Parser().Parse(text.NewReader(page.body))
+
+	var pageLinks []string
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		if link, ok := n.(*ast.Link); ok {
+			target := s.resolveLink(page.Path, string(link.Destination))
+			if target != "" {
+				pageLinks = append(pageLinks, target)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return pageLinks, err
+}
+
+// linkPath returns the path within the content tree a link destination
+// without fragment or query points to, with a site-absolute destination
+// taken from under the base path
+func (s *Site) linkPath(relPath, dest string) string {
+	if strings.HasPrefix(dest, "/") {
+		return path.Clean(strings.TrimPrefix(strings.TrimPrefix(dest, s.basePath), "/"))
+	}
+	return path.Join(path.Dir(relPath), dest)
+}
+
+// resolveLink turns a link destination found in a page into the path within
+// the content tree it points to, either a page or a generated HTML file, or
+// "" when it does not point to another page
+func (s *Site) resolveLink(relPath, dest string) string {
+	// Ignore external links and pure fragments
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.Contains(dest, "://") || strings.HasPrefix(dest, "mailto:") {
+		return ""
+	}
+
+	// Drop fragments and query strings
+	if i := strings.IndexAny(dest, "#?"); i >= 0 {
+		dest = dest[:i]
+	}
+
+	target := s.linkPath(relPath, dest)
+	switch {
+	case strings.HasSuffix(dest, "/") || target == ".":
+		target = path.Join(target, "index.html")
+	case !strings.HasSuffix(target, ".html") && !s.isPage(target):
+		return ""
+	}
+
+	return target
+}
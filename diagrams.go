@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const diagramCacheDir = ".mindoc/cache/diagrams" // Directory where drawn diagrams are kept by source hash
+
+// DiagramConfig is how the fenced blocks of a diagram language are drawn
+type DiagramConfig struct {
+	Command string `yaml:"command"` // Reads the diagram source on stdin and writes SVG to stdout
+}
+
+// defaultDiagrams are the diagram languages drawn without any config, with
+// the tools installed
+var defaultDiagrams = map[string]DiagramConfig{
+	"dot":      {Command: "dot -Tsvg"},
+	"graphviz": {Command: "dot -Tsvg"},
+	"plantuml": {Command: "plantuml -tsvg -pipe"},
+}
+
+// drawDiagram draws a fenced block of a diagram language as SVG, reusing
+// the drawing from the diagram cache when the way it is drawn and its
+// source are unchanged. It reports false for blocks of other languages.
+func (s *Site) drawDiagram(language, source string) ([]byte, bool, error) {
+	cfg, configured := s.Diagrams[language]
+	if !configured {
+		cfg = defaultDiagrams[language]
+	}
+	draw, builtin := builtinDiagrams[language]
+	switch {
+	case cfg.Command != "":
+		draw, builtin = nil, false
+	case configured || !builtin:
+		return nil, false, nil
+	}
+
+	method := cfg.Command
+	if builtin {
+		method = "mindoc " + language
+	}
+	hash := sha256.Sum256([]byte(method + "\x00" + source))
+	cachePath := filepath.Join(diagramCacheDir, hex.EncodeToString(hash[:])+".svg")
+	if svg, err := ioutil.ReadFile(cachePath); err == nil {
+		return svg, true, nil
+	}
+
+	var svg []byte
+	var err error
+	if builtin {
+		svg, err = draw(source)
+	} else {
+		svg, err = runDiagramCommand(cfg.Command, source)
+	}
+	if err != nil {
+		return nil, true, err
+	}
+
+	// Only the svg element goes into the page, without an XML declaration
+	// or doctype before it
+	start := bytes.Index(svg, []byte("<svg"))
+	if start < 0 {
+		return nil, true, fmt.Errorf("no SVG was drawn")
+	}
+	svg = bytes.TrimSpace(svg[start:])
+
+	err = os.MkdirAll(diagramCacheDir, os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(cachePath, svg, 0644)
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to cache diagram: %w", err)
+	}
+	return svg, true, nil
+}
+
+// runDiagramCommand draws a diagram with a command given its source on
+// stdin, returning what it printed
+func runDiagramCommand(command, source string) ([]byte, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid config: the diagram command is empty")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(source)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if message := strings.TrimSpace(stderr.String()); err != nil && message != "" {
+		return nil, fmt.Errorf("%s failed: %w: %s", args[0], err, message)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	diffReportFile = "diff.html" // Report mindoc diff writes unless -o names another file
+	diffContext    = 12          // Unchanged words shown around each change
+	diffMaxEdits   = 2000        // Edits after which two texts are shown as replaced as a whole
+)
+
+// diffReportTemplate is the HTML report of mindoc diff
+var diffReportTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Changes since {{ .Old }}</title>
+    <style>
+        body { font-family: system-ui, sans-serif; line-height: 1.5; margin: 2rem auto; max-width: 60rem; padding: 0 1rem; }
+        .page { border-top: 1px solid #ddd; padding-top: 1rem; }
+        .status { color: #666; font-size: 0.9rem; }
+        .text { white-space: pre-wrap; }
+        del { background: #ffe0e0; color: #8a0000; }
+        ins { background: #dcf5dc; color: #005a00; text-decoration: none; }
+        .gap { color: #999; }
+    </style>
+</head>
+<body>
+    <h1>Changes since {{ .Old }}</h1>
+    {{ if .Pages }}<ul>{{ range $i, $p := .Pages }}
+        <li><a href="#page-{{ $i }}">{{ $p.Path }}</a> <span class="status">{{ $p.Status }}</span></li>{{ end }}
+    </ul>{{ range $i, $p := .Pages }}
+    <section class="page" id="page-{{ $i }}">
+        <h2>{{ $p.Path }}</h2>
+        <p class="status">{{ $p.Status }}{{ with $p.URL }} · <code>{{ . }}</code>{{ end }}</p>{{ with $p.Edits }}
+        <p class="text">{{ range . }}{{ if eq .Op "-" }}<del>{{ .Text }}</del>{{ else if eq .Op "+" }}<ins>{{ .Text }}</ins>{{ else if eq .Op "…" }}<span class="gap">{{ .Text }}</span>{{ else }}{{ .Text }}{{ end }}{{ end }}</p>{{ end }}
+    </section>{{ end }}{{ else }}
+    <p>No page changed.</p>{{ end }}
+</body>
+</html>
+`))
+
+// wordEdit is a run of words a text kept, removed or added: Op is "=", "-"
+// or "+", and "…" for unchanged words left out of the report
+type wordEdit struct {
+	Op   string
+	Text string
+}
+
+// pageDiff is a page of the build that differs from the old build
+type pageDiff struct {
+	Path   string     // Path within the output, prefixed with the site's name when there are several
+	URL    string     // URL of the page, empty when it is no longer generated
+	Status string     // changed, new or removed
+	Edits  []wordEdit // Changes to the text of a changed page
+}
+
+// diffSites builds the sites into memory and writes an HTML report of the
+// pages whose text differs from an old build of them, such as the output
+// directory before a change, with word-level differences. With several
+// sites, each one is compared with the directory of the old build named
+// after it.
+func diffSites(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	report := fs.String("o", diffReportFile, "file the HTML report is written to")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mindoc diff [-o report.html] <oldBuildDir>")
+	}
+	old := fs.Arg(0)
+
+	var pages []pageDiff
+	for _, site := range sites {
+		dir := old
+		prefix := ""
+		if len(sites) > 1 {
+			dir = filepath.Join(dir, site.Name)
+			prefix = site.Name + "/"
+		}
+
+		out, err := site.buildSnapshot()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+		diffs, err := site.diffPages(dir, out)
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+		for _, d := range diffs {
+			d.Path = prefix + d.Path
+			pages = append(pages, d)
+		}
+	}
+
+	var b bytes.Buffer
+	err := diffReportTemplate.Execute(&b, struct {
+		Old   string
+		Pages []pageDiff
+	}{old, pages})
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(*report, b.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", *report, err)
+	}
+	fmt.Printf("%d page(s) changed, report written to %s.\n", len(pages), *report)
+	return nil
+}
+
+// diffPages compares the text of the HTML pages of a build with those of
+// an old build in dir. Pages whose markup changed but not their text, such
+// as when the navigation gained a page, are left out.
+func (s *Site) diffPages(dir string, out *memoryOutput) ([]pageDiff, error) {
+	isPage := func(relPath string) bool {
+		return path.Ext(relPath) == ".html" && !strings.HasSuffix(relPath, printSuffix)
+	}
+	before, err := snapshotFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []pageDiff
+	err = out.Walk(func(relPath string) error {
+		if !isPage(relPath) {
+			return nil
+		}
+		data, _ := out.ReadFile(relPath)
+		url := s.url(relPath)
+		if !before[relPath] {
+			diffs = append(diffs, pageDiff{Path: relPath, URL: url, Status: "new"})
+			return nil
+		}
+		delete(before, relPath)
+
+		oldData, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return fmt.Errorf("failed to read the old build: %w", err)
+		}
+		if bytes.Equal(oldData, data) {
+			return nil
+		}
+		oldText, newText := pageText(oldData), pageText(data)
+		if oldText == newText {
+			return nil
+		}
+		diffs = append(diffs, pageDiff{Path: relPath, URL: url, Status: "changed", Edits: diffWords(textWords(oldText), textWords(newText))})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for relPath := range before {
+		if isPage(relPath) {
+			diffs = append(diffs, pageDiff{Path: relPath, Status: "removed"})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, nil
+}
+
+// pageText returns the text of a generated page's <main> element, or of
+// its body when it has none, leaving out the navigation around it
+func pageText(data []byte) string {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return plainText(string(data))
+	}
+	var main, body *html.Node
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "main" && main == nil {
+			main = n
+		}
+		if n.Type == html.ElementNode && n.Data == "body" && body == nil {
+			body = n
+		}
+		for c := n.FirstChild; c != nil && main == nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	if main == nil {
+		main = body
+	}
+	if main == nil {
+		return ""
+	}
+
+	var b bytes.Buffer
+	for c := main.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&b, c)
+	}
+	return plainText(b.String())
+}
+
+// textWords splits text into its words, with a "\n\n" word between
+// paragraphs so changes to the paragraphs show too
+func textWords(text string) []string {
+	var words []string
+	for i, paragraph := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			words = append(words, "\n\n")
+		}
+		words = append(words, strings.Fields(paragraph)...)
+	}
+	return words
+}
+
+// diffWords returns the shortest edit turning the words a into b, with
+// Myers' algorithm, as runs of kept, removed and added words. Long runs of
+// kept words are shortened to the words around the changes.
+func diffWords(a, b []string) []wordEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int // Furthest x of each diagonal before every step, from -d-1 to d+1
+
+search:
+	for d := 0; d <= max; d++ {
+		if d > diffMaxEdits {
+			// Too different to be worth a word by word report
+			return compactEdits(append(append([]wordEdit{}, wordRun("-", a)...), wordRun("+", b)...))
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back from the end through the furthest reaching paths
+	x, y := n, m
+	var edits []wordEdit
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[d+k] < v[d+k+2]) {
+			prevK = k + 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, wordEdit{"=", a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			edits = append(edits, wordEdit{"+", b[y-1]})
+		} else {
+			edits = append(edits, wordEdit{"-", a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, wordEdit{"=", a[x-1]})
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return compactEdits(edits)
+}
+
+// wordRun returns an edit for each of the words
+func wordRun(op string, words []string) []wordEdit {
+	edits := make([]wordEdit, len(words))
+	for i, w := range words {
+		edits[i] = wordEdit{op, w}
+	}
+	return edits
+}
+
+// compactEdits joins the edits of single words into runs, shortening runs
+// of kept words to the diffContext words next to a change
+func compactEdits(words []wordEdit) []wordEdit {
+	var runs []wordEdit
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && words[j].Op == words[i].Op {
+			j++
+		}
+		run := words[i:j]
+		if run[0].Op == "=" && j-i > 2*diffContext {
+			head, tail := run[:diffContext], run[len(run)-diffContext:]
+			if i == 0 {
+				head = nil
+			}
+			if j == len(words) {
+				tail = nil
+			}
+			if head != nil {
+				runs = append(runs, wordEdit{"=", joinWords(head)})
+			}
+			runs = append(runs, wordEdit{"…", "… "})
+			if tail != nil {
+				runs = append(runs, wordEdit{"=", joinWords(tail)})
+			}
+		} else {
+			runs = append(runs, wordEdit{run[0].Op, joinWords(run)})
+		}
+		i = j
+	}
+	return runs
+}
+
+// joinWords joins words with spaces, keeping the paragraph breaks, and
+// ends them with a space unless they end a paragraph
+func joinWords(words []wordEdit) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 && w.Text != "\n\n" && words[i-1].Text != "\n\n" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w.Text)
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "MINDOC_" // Prefix of the environment variables setting flags and config settings
+
+// envIgnored are variables with the prefix that aren't settings, such as
+// the one mindoc sets for its own hooks
+var envIgnored = setOf("MINDOC_HOOK")
+
+// applyEnvFlags sets the flags left off the command line from environment
+// variables, such as MINDOC_LISTEN for -listen and MINDOC_REBUILD_EVERY for
+// -rebuild-every
+func applyEnvFlags() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envFlagName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", envFlagName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// envFlagName returns the environment variable of a flag
+func envFlagName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// isEnvFlag reports whether an environment variable sets a flag
+func isEnvFlag(name string) bool {
+	found := false
+	flag.VisitAll(func(f *flag.Flag) {
+		if envFlagName(f.Name) == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// applyEnvSettings overrides settings of the parsed config file with the
+// environment variables naming them. Nested settings are separated by two
+// underscores and list items are given by their index, so
+// MINDOC_SEARCH__API_KEY sets search.apiKey and MINDOC_SITES__0__BASE_URL
+// the baseURL of the first site. Underscores within a name and case don't
+// matter. Values are read as YAML, so lists and maps can be given as
+// [avif, webp] or {provider: algolia}.
+func applyEnvSettings(doc *yaml.Node) {
+	var names []string
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if strings.HasPrefix(name, envPrefix) && !envIgnored[name] && !isEnvFlag(name) {
+			names = append(names, name)
+		}
+	}
+	// Parents are set before the settings within them
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := strings.Split(strings.TrimPrefix(name, envPrefix), "__")
+		err := setEnvSetting(doc, reflect.TypeOf(Config{}), path, os.Getenv(name))
+		if err != nil {
+			log.Printf("Ignoring %s: %v", name, err)
+		}
+	}
+}
+
+// setEnvSetting sets the setting at a path below a node of a value of the
+// given type, adding the mappings and list items leading to it as needed
+func setEnvSetting(node *yaml.Node, t reflect.Type, path []string, value string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(path) == 0 {
+		return setEnvValue(node, t, value)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		key, fieldType, ok := settingField(t, path[0])
+		if !ok {
+			return fmt.Errorf("no setting %s", strings.ToLower(path[0]))
+		}
+		return setEnvSetting(mappingValue(node, key), fieldType, path[1:], value)
+	case reflect.Map:
+		return setEnvSetting(mappingValue(node, strings.ToLower(path[0])), t.Elem(), path[1:], value)
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 {
+			return fmt.Errorf("%s is not a list index", path[0])
+		}
+		if node.Kind != yaml.SequenceNode {
+			*node = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		if i > len(node.Content) {
+			return fmt.Errorf("list has %d item(s)", len(node.Content))
+		}
+		if i == len(node.Content) {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+		return setEnvSetting(node.Content[i], t.Elem(), path[1:], value)
+	}
+	return fmt.Errorf("%s has no settings within it", strings.ToLower(path[0]))
+}
+
+// settingField finds the field of a config struct a name from an
+// environment variable refers to, looking into inlined structs, and
+// returns its YAML key
+func settingField(t reflect.Type, name string) (string, reflect.Type, bool) {
+	want := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			if key, fieldType, ok := settingField(field.Type, name); ok {
+				return key, fieldType, true
+			}
+			continue
+		}
+		if tag[0] != "" && tag[0] != "-" && strings.ToLower(tag[0]) == want {
+			return tag[0], field.Type, true
+		}
+	}
+	return "", nil, false
+}
+
+// mappingValue returns the value of a key of a mapping node, adding the key
+// when it is missing. A node that isn't a mapping is replaced by one.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
+
+// setEnvValue replaces a node with the value of an environment variable.
+// Text settings take the value as it is, others parse it as YAML.
+func setEnvValue(node *yaml.Node, t reflect.Type, value string) error {
+	if t.Kind() == reflect.String {
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+		return nil
+	}
+	var parsed yaml.Node
+	err := yaml.Unmarshal([]byte(value), &parsed)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Content) == 0 {
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		return nil
+	}
+	*node = *parsed.Content[0]
+	return nil
+}
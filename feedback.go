@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	feedbackPath       = "_feedback" // Path of the serve-mode endpoint below the site's base path
+	feedbackFormName   = "feedback"  // Name of the form, as Netlify Forms records it
+	maxFeedbackComment = 2000        // Characters of a comment that are kept
+)
+
+// FeedbackConfig controls the "Was this page helpful?" widget and where
+// its submissions go
+type FeedbackConfig struct {
+	Mode    string `yaml:"mode"`    // serve (mindoc's own endpoint, the default) or netlify
+	Action  string `yaml:"action"`  // URL the form posts to instead, such as a form service
+	File    string `yaml:"file"`    // JSONL file the serve-mode endpoint appends submissions to
+	Webhook string `yaml:"webhook"` // URL the serve-mode endpoint forwards submissions to as JSON
+}
+
+// feedbackSubmission is a reader's answer to the widget
+type feedbackSubmission struct {
+	Time    time.Time `json:"time"`
+	Site    string    `json:"site,omitempty"`
+	Page    string    `json:"page"`
+	Helpful bool      `json:"helpful"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+var feedbackFileMu sync.Mutex // Serialises appends to feedback files
+
+// feedbackShortcode renders the feedback widget for a page. The question
+// can be changed with question="...".
+func (s *Site) feedbackShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	pageURL := ""
+	if pagePath != "" {
+		pageURL = s.pageURL(pagePath)
+	}
+	question := args["question"]
+	if question == "" {
+		question = s.translate("wasThisHelpful")
+	}
+	return s.feedbackForm(pageURL, question), nil
+}
+
+// feedbackFunc renders the feedback widget from a template, such as
+// {{ feedback .Page }} in a layout
+func (s *Site) feedbackFunc(page *Page) template.HTML {
+	return s.feedbackForm(page.URL, s.translate("wasThisHelpful"))
+}
+
+// feedbackForm returns the markup of the feedback widget. It works as a
+// plain form, and feedback.js sends it in the background instead when
+// scripts run.
+func (s *Site) feedbackForm(pageURL, question string) template.HTML {
+	netlify := s.Feedback.Mode == "netlify"
+	action := s.Feedback.Action
+	switch {
+	case action != "":
+	case netlify:
+		// Netlify takes the submission on the page's own URL
+		action = pageURL
+	default:
+		action = s.url(feedbackPath)
+	}
+
+	esc := template.HTMLEscapeString
+	var form strings.Builder
+	fmt.Fprintf(&form, `<form class="feedback" name="%s" method="post" action="%s" data-thanks="%s"`,
+		feedbackFormName, esc(action), esc(s.translate("feedbackThanks")))
+	if netlify {
+		fmt.Fprintf(&form, ` data-netlify="true" netlify-honeypot="bot-field"><input type="hidden" name="form-name" value="%s">`, feedbackFormName)
+		form.WriteString(`<p hidden><label>Leave empty <input name="bot-field"></label></p>`)
+	} else {
+		form.WriteString(">")
+	}
+	fmt.Fprintf(&form, `<input type="hidden" name="page" value="%s">`, esc(pageURL))
+	fmt.Fprintf(&form, `<fieldset><legend>%s</legend>`, esc(question))
+	fmt.Fprintf(&form, `<label class="feedback-comment">%s <textarea name="comment" maxlength="%d" rows="2"></textarea></label>`,
+		esc(s.translate("feedbackComment")), maxFeedbackComment)
+	fmt.Fprintf(&form, `<button type="submit" name="helpful" value="yes">%s</button> `, esc(s.translate("yes")))
+	fmt.Fprintf(&form, `<button type="submit" name="helpful" value="no">%s</button>`, esc(s.translate("no")))
+	fmt.Fprintf(&form, `</fieldset></form><script src="%s" defer></script>`, esc(s.url(cssDestDir+"/feedback.js")))
+	return template.HTML(form.String())
+}
+
+// serveFeedback receives submissions of the feedback widget in serve mode,
+// appending them to the feedback file and forwarding them to the webhook
+func (s *Site) serveFeedback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 16<<10)
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		helpful := r.PostForm.Get("helpful")
+		if helpful != "yes" && helpful != "no" {
+			http.Error(w, "helpful must be yes or no", http.StatusBadRequest)
+			return
+		}
+		page := r.PostForm.Get("page")
+		if page == "" {
+			page = r.Referer()
+		}
+		comment := strings.TrimSpace(r.PostForm.Get("comment"))
+		if utf8.RuneCountInString(comment) > maxFeedbackComment {
+			comment = string([]rune(comment)[:maxFeedbackComment])
+		}
+
+		submission := feedbackSubmission{
+			Time:    time.Now().UTC(),
+			Site:    s.Name,
+			Page:    page,
+			Helpful: helpful == "yes",
+			Comment: comment,
+		}
+		err = s.recordFeedback(submission)
+		if err != nil {
+			log.Printf("Failed to record feedback: %v", err)
+			http.Error(w, "failed to record feedback", http.StatusInternalServerError)
+			return
+		}
+
+		// Scripts ask for JSON; a plain form post goes back to the page
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		// Only a page of this site, so the form can't redirect anywhere else
+		back := page
+		if !strings.HasPrefix(back, s.basePath) || strings.HasPrefix(back, "//") || strings.HasPrefix(back, "/\\") {
+			back = s.basePath
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	})
+}
+
+// recordFeedback appends a submission to the feedback file and posts it to
+// the webhook, whichever are configured
+func (s *Site) recordFeedback(submission feedbackSubmission) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+
+	if s.Feedback.File != "" {
+		err = appendLine(s.Feedback.File, data)
+		if err != nil {
+			return fmt.Errorf("failed to write to %s: %w", s.Feedback.File, err)
+		}
+	}
+
+	if s.Feedback.Webhook != "" {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(os.ExpandEnv(s.Feedback.Webhook), "application/json", bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to call webhook: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook answered %s", resp.Status)
+		}
+	}
+
+	return nil
+}
+
+// appendLine appends a line to a file, creating the file and its directory
+func appendLine(file string, line []byte) error {
+	feedbackFileMu.Lock()
+	defer feedbackFileMu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
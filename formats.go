@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/net/html"
+)
+
+const htmlFormat = "html" // The format every page is written in
+
+// outputFormat is a format pages can be written in besides HTML, from
+// their outputs front matter
+type outputFormat struct {
+	Ext    string // Extension of the generated file and of its layouts
+	Layout string // Built-in template used when the layout directory has none
+}
+
+var outputFormats = map[string]outputFormat{
+	"json": {".json", defaultJSONLayout},
+	"txt":  {".txt", defaultTextLayout},
+	"md":   {".md", defaultMarkdownLayout},
+}
+
+// Built-in templates of the output formats
+const (
+	defaultJSONLayout = `{
+  "title": {{ jsonify .Title }},
+  "url": {{ jsonify .URL }},
+  "section": {{ jsonify .Page.Section }},
+  "tags": {{ jsonify .Page.Tags }},
+  "authors": {{ jsonify .Page.Authors }},
+  "params": {{ jsonify .Page.Params }},
+  "text": {{ jsonify .Text }},
+  "content": {{ jsonify .Content }}
+}
+`
+	defaultTextLayout = `{{ .Title }}
+
+{{ .Text }}
+`
+	defaultMarkdownLayout = `{{ .Markdown }}`
+)
+
+// formatData is what the template of an output format is executed with
+type formatData struct {
+	Title    string
+	URL      string        // URL of the page's HTML
+	Content  template.HTML // Rendered body of the page
+	Text     string        // Body as plain text
+	Markdown string        // Source of the page without its front matter
+	Page     *Page         // Page being rendered
+	Site     *Site         // Site the page belongs to
+}
+
+// parseOutputs checks the formats named in a page's front matter and
+// returns those besides HTML
+func parseOutputs(names []string) ([]string, error) {
+	var outputs []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == htmlFormat {
+			continue
+		}
+		if _, ok := outputFormats[name]; !ok {
+			return nil, fmt.Errorf("unknown output format %q", name)
+		}
+		outputs = append(outputs, name)
+	}
+	return outputs, nil
+}
+
+// loadFormatLayouts parses the templates of the output formats: the
+// layout directory's files with a format's extension, and the built-in
+// page template of every format missing one. They are text templates,
+// as HTML escaping would break JSON and plain text.
+func (t *Theme) loadFormatLayouts(layoutPaths []string) error {
+	t.formats = texttemplate.New("").Funcs(texttemplate.FuncMap(t.funcs))
+
+	for _, layoutPath := range layoutPaths {
+		data, err := ioutil.ReadFile(layoutPath)
+		if err != nil {
+			return fmt.Errorf("failed to read page template: %w", err)
+		}
+		_, err = t.formats.New(filepath.Base(layoutPath)).Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse page template %s: %w", layoutPath, err)
+		}
+	}
+
+	for _, format := range outputFormats {
+		name := strings.TrimSuffix(pageLayoutFile, ".html") + format.Ext
+		if t.formats.Lookup(name) != nil {
+			continue
+		}
+		_, err := t.formats.New(name).Parse(format.Layout)
+		if err != nil {
+			return fmt.Errorf("failed to parse default %s template: %w", format.Ext, err)
+		}
+	}
+
+	return nil
+}
+
+// formatPath returns the output path of a page in a format, next to its
+// HTML file
+func formatPath(htmlFileName string, format outputFormat) string {
+	return strings.TrimSuffix(htmlFileName, path.Ext(htmlFileName)) + format.Ext
+}
+
+// writeOutputFormats writes the page in each of its extra output formats,
+// using the format's version of the page's layout when there is one
+func (s *Site) writeOutputFormats(data pageData, htmlFileName string) error {
+	page := data.Page
+	fd := formatData{
+		Title:    data.Title,
+		URL:      page.URL,
+		Content:  data.Content,
+		Text:     plainText(string(data.Content)),
+		Markdown: string(page.body),
+		Page:     page,
+		Site:     s,
+	}
+
+	layout := strings.TrimSuffix(pageLayoutFile, ".html")
+	if page.Layout != "" {
+		layout = strings.TrimSuffix(page.Layout, path.Ext(page.Layout))
+	}
+
+	for _, name := range page.Outputs {
+		format := outputFormats[name]
+		tmpl := s.formats.Lookup(layout + format.Ext)
+		if tmpl == nil {
+			tmpl = s.formats.Lookup(strings.TrimSuffix(pageLayoutFile, ".html") + format.Ext)
+		}
+
+		var out strings.Builder
+		err := tmpl.Execute(&out, fd)
+		if err != nil {
+			return fmt.Errorf("failed to execute %s template: %w", name, err)
+		}
+
+		err = s.output.WriteFile(formatPath(htmlFileName, format), []byte(out.String()))
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+var (
+	// Elements whose text is not part of the page's prose, such as the
+	// buttons of code blocks and tabs and the feedback form. Elements with
+	// the hidden attribute are left out too.
+	skippedTags = map[string]bool{"script": true, "style": true, "template": true, "button": true, "form": true}
+	// Elements ending a block of text, followed by a blank line
+	blockTags = map[string]bool{
+		"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"pre": true, "blockquote": true, "ul": true, "ol": true, "dl": true, "table": true,
+		"hr": true, "figure": true, "div": true,
+	}
+	// Elements ending a line
+	lineTags = map[string]bool{"li": true, "tr": true, "br": true, "dt": true, "dd": true}
+
+	extraBlankLines = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+)
+
+// plainText returns the text of rendered HTML, with paragraphs, headings
+// and other blocks separated by blank lines and list items on lines of
+// their own
+func plainText(content string) string {
+	var out strings.Builder
+	skipTag, skip := "", 0 // Element being left out, and how deep in elements of its name
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			text := extraBlankLines.ReplaceAllString(out.String(), "\n\n")
+			return strings.TrimSpace(text)
+		case html.TextToken:
+			if skip == 0 {
+				out.Write(z.Text())
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			switch {
+			case skip > 0:
+				if tag == skipTag && tt == html.StartTagToken {
+					skip++
+				} else if tag == skipTag && tt == html.EndTagToken {
+					skip--
+				}
+			case tt == html.StartTagToken && !voidElements[tag] && (skippedTags[tag] || hasAttr && hasHiddenAttr(z)):
+				skipTag, skip = tag, 1
+			case blockTags[tag] && (tt != html.StartTagToken || tag == "hr"):
+				out.WriteString("\n\n")
+			case lineTags[tag] && (tt != html.StartTagToken || tag == "br"):
+				out.WriteString("\n")
+			}
+		}
+	}
+}
+
+// hasHiddenAttr reports whether the tag the tokenizer is at has the hidden
+// attribute
+func hasHiddenAttr(z *html.Tokenizer) bool {
+	for {
+		key, _, more := z.TagAttr()
+		if string(key) == "hidden" {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ageUnits are the units of ages beyond those of Go durations
+var ageUnits = map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+
+// Age is a length of time in the config, written in days or weeks such as
+// 365d or 26w, or as a Go duration such as 720h
+type Age time.Duration
+
+// UnmarshalYAML parses an age such as 365d
+func (a *Age) UnmarshalYAML(value *yaml.Node) error {
+	var text string
+	err := value.Decode(&text)
+	if err != nil {
+		return err
+	}
+	d, err := parseAge(text)
+	if err != nil {
+		return err
+	}
+	*a = Age(d)
+	return nil
+}
+
+// parseAge parses an age written in days, weeks or as a Go duration
+func parseAge(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	d, err := time.ParseDuration(text)
+	for suffix, unit := range ageUnits {
+		if n, ok := strings.CutSuffix(text, suffix); ok {
+			var v float64
+			v, err = strconv.ParseFloat(n, 64)
+			d = time.Duration(v * float64(unit))
+		}
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q, use days such as 365d, weeks such as 26w, or hours such as 720h", text)
+	}
+	return d, nil
+}
+
+// String writes the age in days when it is a whole number of them
+func (a Age) String() string {
+	d := time.Duration(a)
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// markStalePages marks the pages that haven't changed for longer than the
+// warnIfOlderThan setting of their section or the site, going by their
+// lastmod or date. Pages with neither are never stale.
+func (s *Site) markStalePages(now time.Time) {
+	for _, page := range s.pages {
+		limit := s.WarnIfOlderThan
+		if page.settings.WarnIfOlderThan != nil {
+			limit = *page.settings.WarnIfOlderThan
+		}
+		updated := page.updated()
+		page.Stale = limit > 0 && !updated.IsZero() && now.Sub(updated) > time.Duration(limit)
+	}
+}
+
+// reportStalePages lists the pages that may be outdated
+func (s *Site) reportStalePages() {
+	var stale []*Page
+	for _, page := range s.pages {
+		if page.Stale {
+			stale = append(stale, page)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	fmt.Printf("%s: %d page(s) may be outdated, not updated within warnIfOlderThan:\n", s.label(), len(stale))
+	for _, page := range stale {
+		fmt.Printf("  %s (last updated %s)\n", page.Path, page.updated().Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter formats, detected from how the file starts
+const (
+	frontMatterYAML = "yaml" // Between "---" lines
+	frontMatterTOML = "toml" // Between "+++" lines
+	frontMatterJSON = "json" // A JSON object at the very start of the file
+)
+
+// parseFrontMatter reads the front matter of a page in any of the supported
+// formats and returns its values along with the remaining markdown
+func parseFrontMatter(content []byte) (map[string]interface{}, []byte, error) {
+	params := make(map[string]interface{})
+
+	format, raw, body := splitFrontMatter(content)
+
+	var err error
+	switch format {
+	case frontMatterYAML:
+		err = yaml.Unmarshal(raw, &params)
+	case frontMatterTOML:
+		err = toml.Unmarshal(raw, &params)
+	case frontMatterJSON:
+		err = json.Unmarshal(raw, &params)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", format, err)
+	}
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	return params, body, nil
+}
+
+// splitFrontMatter separates the front matter block from the markdown and
+// reports its format. Without front matter the format is empty.
+func splitFrontMatter(content []byte) (string, []byte, []byte) {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	normalized := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+
+	switch {
+	case bytes.HasPrefix(normalized, []byte("---\n")):
+		if raw, body, ok := splitDelimited(normalized, "---"); ok {
+			return frontMatterYAML, raw, body
+		}
+	case bytes.HasPrefix(normalized, []byte("+++\n")):
+		if raw, body, ok := splitDelimited(normalized, "+++"); ok {
+			return frontMatterTOML, raw, body
+		}
+	case bytes.HasPrefix(normalized, []byte("{")):
+		// The JSON object ends wherever the decoder stops reading it
+		dec := json.NewDecoder(bytes.NewReader(normalized))
+		var obj json.RawMessage
+		if dec.Decode(&obj) == nil {
+			body := normalized[dec.InputOffset():]
+			return frontMatterJSON, obj, bytes.TrimPrefix(body, []byte("\n"))
+		}
+	}
+
+	return "", nil, content
+}
+
+// splitDelimited splits a block between two delimiter lines from the rest
+func splitDelimited(content []byte, delim string) ([]byte, []byte, bool) {
+	opening := delim + "\n"
+	closing := "\n" + delim + "\n"
+
+	rest := content[len(opening):]
+	if bytes.HasPrefix(rest, []byte(opening)) {
+		return []byte{}, rest[len(opening):], true
+	}
+
+	end := bytes.Index(rest, []byte(closing))
+	if end < 0 {
+		if bytes.HasSuffix(rest, []byte("\n"+delim)) {
+			return rest[:len(rest)-len(delim)-1], nil, true
+		}
+		return nil, nil, false
+	}
+
+	return rest[:end], rest[end+len(closing):], true
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFuncs returns the functions available to the site's templates
+func (s *Site) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"markdownify": s.markdownify,
+		"dateFormat":  dateFormat,
+		"slugify":     slugify,
+		"where":       where,
+		"sort":        sortCollection,
+		"first":       first,
+		"truncate":    truncate,
+		"humanize":    humanize,
+		"jsonify":     jsonify,
+		"safeHTML":    safeHTML,
+		"T":           s.translate,
+		"feedback":    s.feedbackFunc,
+		"thumbnail":   s.thumbnail,
+	}
+}
+
+// markdownify renders a markdown string to HTML. A lone paragraph is
+// unwrapped so the result can be used inline.
+func (s *Site) markdownify(input interface{}) (template.HTML, error) {
+	var out strings.Builder
+	err := s.markdown.Convert([]byte(fmt.Sprint(input)), &out)
+	if err != nil {
+		return "", err
+	}
+
+	html := strings.TrimSpace(out.String())
+	if strings.HasPrefix(html, "<p>") && strings.HasSuffix(html, "</p>") && strings.Count(html, "<p>") == 1 {
+		html = strings.TrimSuffix(strings.TrimPrefix(html, "<p>"), "</p>")
+	}
+
+	return template.HTML(html), nil
+}
+
+// dateLayouts are the formats accepted for dates given as strings
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// toTime converts a time.Time or a date string into a time.Time
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		return *t, nil
+	case string:
+		for _, layout := range dateLayouts {
+			parsed, err := time.Parse(layout, t)
+			if err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unable to parse date %q", t)
+	}
+	return time.Time{}, fmt.Errorf("unable to use %T as a date", v)
+}
+
+// dateFormat formats a date with a Go time layout
+func dateFormat(layout string, date interface{}) (string, error) {
+	t, err := toTime(date)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+var slugInvalid = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify turns a string into a lowercase URL path segment
+func slugify(input interface{}) string {
+	slug := slugInvalid.ReplaceAllString(strings.ToLower(fmt.Sprint(input)), "-")
+	return strings.Trim(slug, "-")
+}
+
+// truncate shortens a string to at most length characters, cutting at a
+// word boundary and adding an ellipsis when anything was removed
+func truncate(length int, input interface{}) string {
+	text := fmt.Sprint(input)
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+
+	runes := []rune(text)[:length]
+	cut := strings.LastIndexFunc(string(runes), unicode.IsSpace)
+	if cut > 0 {
+		return strings.TrimSpace(string(runes)[:cut]) + "…"
+	}
+	return string(runes) + "…"
+}
+
+// humanize makes an identifier readable: "getting-started" becomes
+// "Getting started" and 3 becomes "3rd"
+func humanize(input interface{}) string {
+	text := fmt.Sprint(input)
+
+	if n, err := strconv.Atoi(text); err == nil {
+		suffix := "th"
+		switch {
+		case n%100 >= 11 && n%100 <= 13:
+		case n%10 == 1:
+			suffix = "st"
+		case n%10 == 2:
+			suffix = "nd"
+		case n%10 == 3:
+			suffix = "rd"
+		}
+		return text + suffix
+	}
+
+	text = strings.TrimSpace(strings.NewReplacer("-", " ", "_", " ").Replace(text))
+	if text == "" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(r)) + text[size:]
+}
+
+// jsonify encodes a value as JSON
+func jsonify(v interface{}) (template.HTML, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(data), nil
+}
+
+// safeHTML marks a string as trusted HTML that must not be escaped
+func safeHTML(input interface{}) template.HTML {
+	return template.HTML(fmt.Sprint(input))
+}
+
+// first returns at most the first n items of a collection
+func first(n int, collection interface{}) (interface{}, error) {
+	v := reflect.ValueOf(collection)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("first: can't iterate over %T", collection)
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("first: negative count %d", n)
+	}
+	if n > v.Len() {
+		n = v.Len()
+	}
+	return v.Slice(0, n).Interface(), nil
+}
+
+// where filters a collection to the items whose field matches a value. It
+// is called as `where .Pages "Section" "docs"` or with an operator,
+// `where .Pages "Weight" ">" 10`. Supported operators are =, !=, <, <=, >,
+// >=, "in" (field is one of a list of values) and "contains" (field is a
+// list containing the value).
+func where(collection interface{}, key string, args ...interface{}) (interface{}, error) {
+	v := reflect.ValueOf(collection)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("where: can't iterate over %T", collection)
+	}
+
+	op := "="
+	var match interface{}
+	switch len(args) {
+	case 1:
+		match = args[0]
+	case 2:
+		op, _ = args[0].(string)
+		match = args[1]
+	default:
+		return nil, fmt.Errorf("where: expected a value or an operator and a value")
+	}
+
+	result := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		field, ok := lookupField(item, key)
+		if !ok {
+			continue
+		}
+
+		matched, err := compareOp(op, field, match)
+		if err != nil {
+			return nil, fmt.Errorf("where: %w", err)
+		}
+		if matched {
+			result = reflect.Append(result, item)
+		}
+	}
+
+	return result.Interface(), nil
+}
+
+// sortCollection sorts a copy of a collection by a field, ascending unless
+// the order "desc" is given
+func sortCollection(collection interface{}, key string, order ...string) (interface{}, error) {
+	v := reflect.ValueOf(collection)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sort: can't iterate over %T", collection)
+	}
+
+	desc := len(order) > 0 && strings.EqualFold(order[0], "desc")
+
+	sorted := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+	reflect.Copy(sorted, v)
+
+	sort.SliceStable(sorted.Interface(), func(i, j int) bool {
+		a, _ := lookupField(sorted.Index(i), key)
+		b, _ := lookupField(sorted.Index(j), key)
+		if desc {
+			a, b = b, a
+		}
+		less, _ := compareOp("<", a, b)
+		return less
+	})
+
+	return sorted.Interface(), nil
+}
+
+// lookupField finds a field, method or map key on a value. Nested values
+// are reached with dots, such as "Params.category".
+func lookupField(v reflect.Value, key string) (interface{}, bool) {
+	for _, name := range strings.Split(key, ".") {
+		for v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if !v.IsValid() {
+			return nil, false
+		}
+
+		if method := v.MethodByName(name); method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() >= 1 {
+			v = method.Call(nil)[0]
+			continue
+		}
+
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			v = v.FieldByName(name)
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(name))
+		default:
+			return nil, false
+		}
+		if !v.IsValid() {
+			return nil, false
+		}
+	}
+
+	return v.Interface(), true
+}
+
+// compareOp compares two template values with an operator
+func compareOp(op string, a, b interface{}) (bool, error) {
+	switch op {
+	case "=", "==", "eq":
+		return compareValues(a, b) == 0, nil
+	case "!=", "<>", "ne":
+		return compareValues(a, b) != 0, nil
+	case "<", "lt":
+		return compareValues(a, b) < 0, nil
+	case "<=", "le":
+		return compareValues(a, b) <= 0, nil
+	case ">", "gt":
+		return compareValues(a, b) > 0, nil
+	case ">=", "ge":
+		return compareValues(a, b) >= 0, nil
+	case "in":
+		return listContains(b, a), nil
+	case "contains":
+		return listContains(a, b), nil
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+// listContains reports whether a slice holds a value equal to item
+func listContains(list, item interface{}) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if compareValues(v.Index(i).Interface(), item) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues orders two values, comparing numbers numerically, dates
+// chronologically and everything else as strings
+func compareValues(a, b interface{}) int {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		if tb, err := toTime(b); err == nil {
+			return ta.Compare(tb)
+		}
+	}
+
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloat converts any number to a float64
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
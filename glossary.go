@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	glossaryFile       = "./data/glossary.yaml" // File defining the glossary terms
+	glossaryPath       = "glossary"             // Path of the generated glossary page
+	glossaryLayoutFile = "glossary.html"        // Template of the glossary page, page.html when missing
+)
+
+// GlossaryConfig locates the glossary and decides how terms in pages are
+// marked up
+type GlossaryConfig struct {
+	File string `yaml:"file"` // YAML list of terms, ./data/glossary.yaml when unset
+	Path string `yaml:"path"` // Path of the glossary page, "glossary" when unset
+	Mode string `yaml:"mode"` // link (the default), tooltip, or none to leave pages alone
+}
+
+// GlossaryEntry is a term defined in the glossary
+type GlossaryEntry struct {
+	Term       string   `yaml:"term" json:"term"`
+	Definition string   `yaml:"definition" json:"definition"`
+	Aliases    []string `yaml:"aliases" json:"aliases,omitempty"` // Other spellings marked up as the term, such as plurals
+	URL        string   `yaml:"-" json:"url"`                     // URL of the term on the glossary page
+}
+
+// glossary is the site's loaded glossary
+type glossary struct {
+	entries []*GlossaryEntry          // Terms in alphabetical order
+	byWord  map[string]*GlossaryEntry // Entries by lowercase term and alias
+	pattern *regexp.Regexp            // Matches any term or alias, longest first
+}
+
+// loadGlossary reads the glossary. A site without the file has none.
+func (s *Site) loadGlossary() error {
+	s.glossary = nil
+	file := s.Glossary.File
+	if file == "" {
+		file = filepath.Join(s.dataDir, glossaryFile)
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) && s.Glossary.File == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read glossary: %w", err)
+	}
+
+	var entries []*GlossaryEntry
+	err = yaml.Unmarshal(data, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	g := &glossary{byWord: make(map[string]*GlossaryEntry)}
+	var words []string
+	for _, entry := range entries {
+		if entry.Term == "" {
+			return fmt.Errorf("%s: glossary entry without a term", file)
+		}
+		entry.URL = s.pageURL(s.glossaryPagePath()) + "#" + slugify(entry.Term)
+		for _, word := range append([]string{entry.Term}, entry.Aliases...) {
+			key := strings.ToLower(word)
+			if _, ok := g.byWord[key]; ok {
+				return fmt.Errorf("%s: %q is defined more than once", file, word)
+			}
+			g.byWord[key] = entry
+			words = append(words, regexp.QuoteMeta(word))
+		}
+		g.entries = append(g.entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Longer terms are tried first, so "Pod disruption budget" wins over "Pod"
+	sort.Slice(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+	g.pattern = regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+	sort.Slice(g.entries, func(i, j int) bool {
+		return strings.ToLower(g.entries[i].Term) < strings.ToLower(g.entries[j].Term)
+	})
+
+	s.glossary = g
+	return nil
+}
+
+// glossaryPagePath returns where the glossary page is in the content tree,
+// as if it were a page file
+func (s *Site) glossaryPagePath() string {
+	p := s.Glossary.Path
+	if p == "" {
+		p = glossaryPath
+	}
+	return strings.Trim(p, "/") + ".md"
+}
+
+// GlossaryEntries returns the glossary terms in alphabetical order, as in
+// {{ range .Site.GlossaryEntries }}
+func (s *Site) GlossaryEntries() []*GlossaryEntry {
+	if s.glossary == nil {
+		return nil
+	}
+	return s.glossary.entries
+}
+
+// writeGlossaryPage generates the page defining every glossary term
+func (s *Site) writeGlossaryPage() error {
+	if s.glossary == nil {
+		return nil
+	}
+
+	page := s.generatedPage(s.glossaryPagePath(), s.translate("glossary"), glossaryLayoutFile)
+	data := s.newPageData(page)
+
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<dl class=\"glossary\">\n", esc(page.Title))
+	for _, entry := range s.glossary.entries {
+		fmt.Fprintf(&out, "<dt id=\"%s\">%s</dt>\n<dd>%s</dd>\n", slugify(entry.Term), esc(entry.Term), esc(entry.Definition))
+	}
+	out.WriteString("</dl>\n")
+	data.Content = template.HTML(out.String())
+
+	err := s.writeGeneratedPage(data)
+	if err != nil {
+		return fmt.Errorf("failed to write the glossary page: %w", err)
+	}
+	return nil
+}
+
+// kindGlossaryTerm is the AST node kind of glossary terms found in pages
+var kindGlossaryTerm = ast.NewNodeKind("GlossaryTerm")
+
+// glossaryTermNode is an occurrence of a glossary term, holding the text
+// it was written as
+type glossaryTermNode struct {
+	ast.BaseInline
+	Entry *GlossaryEntry
+}
+
+// Kind returns the node kind of glossary terms
+func (n *glossaryTermNode) Kind() ast.NodeKind {
+	return kindGlossaryTerm
+}
+
+// Dump prints the glossary term for debugging
+func (n *glossaryTermNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Term": n.Entry.Term}, nil)
+}
+
+// glossaryMarker marks up the first occurrence of each glossary term on a
+// page, leaving out headings, links and code
+type glossaryMarker struct {
+	site *Site
+}
+
+// Transform marks up the glossary terms of a parsed page
+func (gm glossaryMarker) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	g := gm.site.glossary
+	if g == nil || gm.site.Glossary.Mode == "none" {
+		return
+	}
+	if relPath, ok := pc.Get(pagePathKey).(string); ok && relPath == gm.site.glossaryPagePath() {
+		return
+	}
+
+	var texts []*ast.Text
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading, *ast.Link, *ast.AutoLink, *ast.Image, *ast.CodeSpan,
+			*ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			texts = append(texts, n)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Only the first occurrence of each term is marked up
+	seen := make(map[*GlossaryEntry]bool)
+	for _, node := range texts {
+		wrapWords(node, reader.Source(), g.pattern, func(word string) ast.Node {
+			entry := g.byWord[strings.ToLower(word)]
+			if entry == nil || seen[entry] {
+				return nil
+			}
+			seen[entry] = true
+			return &glossaryTermNode{Entry: entry}
+		})
+	}
+}
+
+// wrapWords gives whole-word matches of the pattern in a text node nodes of
+// their own, holding the matched text. wrap returns the node for a match,
+// or nil to leave the match as it is.
+func wrapWords(node *ast.Text, source []byte, pattern *regexp.Regexp, wrap func(word string) ast.Node) {
+	parent := node.Parent()
+	segment := node.Segment
+	for {
+		var wrapper ast.Node
+		var start, stop int
+		value := segment.Value(source)
+		offset := 0
+		for offset < len(value) {
+			m := pattern.FindIndex(value[offset:])
+			if m == nil {
+				break
+			}
+			if wholeWord(value, offset+m[0], offset+m[1]) {
+				wrapper = wrap(string(value[offset+m[0] : offset+m[1]]))
+				if wrapper != nil {
+					start, stop = offset+m[0], offset+m[1]
+					break
+				}
+			}
+			_, size := utf8.DecodeRune(value[offset+m[0]:])
+			offset += m[0] + size
+		}
+		if wrapper == nil {
+			return
+		}
+
+		// The match goes between the text around it
+		if start > 0 {
+			parent.InsertBefore(parent, node, ast.NewTextSegment(text.NewSegment(segment.Start, segment.Start+start)))
+		}
+		wrapper.AppendChild(wrapper, ast.NewTextSegment(text.NewSegment(segment.Start+start, segment.Start+stop)))
+		after := ast.NewTextSegment(text.NewSegment(segment.Start+stop, segment.Stop))
+		after.SetSoftLineBreak(node.SoftLineBreak())
+		after.SetHardLineBreak(node.HardLineBreak())
+		after.SetRaw(node.IsRaw())
+
+		parent.InsertBefore(parent, node, wrapper)
+		parent.ReplaceChild(parent, node, after)
+		node, segment = after, after.Segment
+	}
+}
+
+// wholeWord reports whether value[start:stop] isn't part of a longer word
+func wholeWord(value []byte, start, stop int) bool {
+	if before, _ := utf8.DecodeLastRune(value[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+	if after, _ := utf8.DecodeRune(value[stop:]); stop < len(value) && isWordRune(after) {
+		return false
+	}
+	return true
+}
+
+// isWordRune reports whether a rune can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// glossaryRenderer writes the HTML of glossary terms
+type glossaryRenderer struct {
+	site *Site
+}
+
+// RegisterFuncs registers the glossary term renderer with goldmark
+func (r glossaryRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindGlossaryTerm, r.render)
+}
+
+func (r glossaryRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	entry := n.(*glossaryTermNode).Entry
+	tooltip := r.site.Glossary.Mode == "tooltip"
+	if !entering {
+		if tooltip {
+			w.WriteString("</span>")
+		} else {
+			w.WriteString("</a>")
+		}
+		return ast.WalkContinue, nil
+	}
+
+	esc := template.HTMLEscapeString
+	if tooltip {
+		fmt.Fprintf(w, `<span class="glossary-term" title="%s" tabindex="0">`, esc(entry.Definition))
+	} else {
+		fmt.Fprintf(w, `<a class="glossary-term" href="%s" title="%s">`, esc(entry.URL), esc(entry.Definition))
+	}
+	return ast.WalkContinue, nil
+}
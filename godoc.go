@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/doc/comment"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	godocCacheDir = ".mindoc/cache/godoc" // Directory the API reference pages are generated into
+	godocTarget   = "api"                 // Where the API reference is placed in the content tree by default
+	godocLinksURL = "https://pkg.go.dev"  // Where links to packages outside the reference point
+)
+
+// GoDocConfig names the Go packages whose doc comments are rendered as
+// pages of the site, one page per package
+type GoDocConfig struct {
+	Dir      string   `yaml:"dir"`      // Directory of the Go module, the current directory when unset
+	Packages []string `yaml:"packages"` // Packages within the module, such as ./client, or ./... for all of them
+	Target   string   `yaml:"target"`   // Where the pages are placed in the content tree, api when unset
+}
+
+// goPackage is a package of the API reference
+type goPackage struct {
+	Dir        string // Directory on disk
+	RelPath    string // Slash-separated path within the module, "." for its root
+	ImportPath string
+	Doc        *doc.Package
+	fset       *token.FileSet
+	comments   []*ast.CommentGroup // Comments of every file, for the fields of printed declarations
+}
+
+// pagePath returns the path of the package's page within the reference
+func (p *goPackage) pagePath() string {
+	return path.Join(p.RelPath, "_index.md")
+}
+
+// generateGoDoc renders the API reference of the configured Go packages
+// as markdown pages and mounts them into the content tree. The pages are
+// written anew on every build, so they follow the code.
+func (s *Site) generateGoDoc() error {
+	s.godocMounts = nil
+	if len(s.GoDoc.Packages) == 0 {
+		return nil
+	}
+
+	dir := s.GoDoc.Dir
+	if dir == "" {
+		dir = "."
+	}
+	target := s.GoDoc.Target
+	if target == "" {
+		target = godocTarget
+	}
+	packages, err := loadGoPackages(dir, s.GoDoc.Packages)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(s.Name + "\x00" + dir + "\x00" + target))
+	out := filepath.Join(godocCacheDir, hex.EncodeToString(sum[:8]))
+	err = os.RemoveAll(out)
+	if err != nil {
+		return fmt.Errorf("failed to clear %s: %w", out, err)
+	}
+	err = writeGoDocPages(packages, out)
+	if err != nil {
+		return err
+	}
+
+	s.godocMounts = []Mount{{Source: out, Target: target}}
+	return nil
+}
+
+// goDocPages writes the API reference of Go packages into a directory, for
+// mindoc godoc, so the pages can be committed instead of generated on
+// every build
+func goDocPages(args []string) error {
+	fs := flag.NewFlagSet("godoc", flag.ExitOnError)
+	out := fs.String("o", godocTarget, "directory the pages are written to")
+	dir := fs.String("dir", ".", "directory of the Go module")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: mindoc godoc [-o dir] [-dir module] <packages>")
+	}
+
+	packages, err := loadGoPackages(*dir, fs.Args())
+	if err != nil {
+		return err
+	}
+	err = writeGoDocPages(packages, *out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reference of %d package(s) written to %s.\n", len(packages), *out)
+	return nil
+}
+
+// writeGoDocPages writes the page of each package into dir, at the path of
+// the package within the module
+func writeGoDocPages(packages []*goPackage, dir string) error {
+	byImportPath := make(map[string]*goPackage, len(packages))
+	for _, pkg := range packages {
+		byImportPath[pkg.ImportPath] = pkg
+	}
+	for _, pkg := range packages {
+		page, err := pkg.markdown(byImportPath)
+		if err != nil {
+			return fmt.Errorf("failed to render the reference of %s: %w", pkg.ImportPath, err)
+		}
+		pagePath := filepath.Join(dir, filepath.FromSlash(pkg.pagePath()))
+		err = os.MkdirAll(filepath.Dir(pagePath), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(pagePath, page, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write the reference of %s: %w", pkg.ImportPath, err)
+		}
+	}
+	return nil
+}
+
+// loadGoPackages reads the packages of the module in dir that match the
+// patterns: a directory relative to the module such as ./client, or one
+// ending in /... for it and every package below it. Packages named by a
+// pattern with /... leave out commands, test data and vendored code.
+func loadGoPackages(dir string, patterns []string) ([]*goPackage, error) {
+	modulePath, err := goModulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []*goPackage
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		rel, all := strings.CutSuffix(pattern, "/...")
+		if pattern == "..." {
+			rel, all = ".", true
+		}
+		if rel != "." && !strings.HasPrefix(rel, "./") {
+			return nil, fmt.Errorf("go package %q is not within the module, start it with ./", pattern)
+		}
+		root := filepath.Join(dir, filepath.FromSlash(rel))
+
+		found := 0
+		err := filepath.Walk(root, func(pkgDir string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			name := info.Name()
+			if pkgDir != root && (!all || name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+
+			relPath, err := filepath.Rel(dir, pkgDir)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if seen[relPath] {
+				found++
+				return nil
+			}
+			pkg, err := loadGoPackage(pkgDir, relPath, modulePath)
+			if err != nil || pkg == nil || (all && pkg.Doc.Name == "main") {
+				return err
+			}
+			seen[relPath] = true
+			packages = append(packages, pkg)
+			found++
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read go package %s: %w", pattern, err)
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("no go packages match %s", pattern)
+		}
+	}
+	return packages, nil
+}
+
+// goModulePath returns the module path declared by the go.mod file in dir
+func goModulePath(dir string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the go module: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no module line", filepath.Join(dir, "go.mod"))
+}
+
+// loadGoPackage parses the Go files of a package that are built on this
+// platform, leaving out tests. It returns nil when dir has no Go files.
+func loadGoPackage(dir, relPath, modulePath string) (*goPackage, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if _, ok := err.(*build.NoGoError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &goPackage{
+		Dir:        dir,
+		RelPath:    relPath,
+		ImportPath: path.Join(modulePath, relPath),
+		fset:       token.NewFileSet(),
+	}
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(pkg.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		pkg.comments = append(pkg.comments, file.Comments...)
+	}
+	pkg.Doc, err = doc.NewFromFiles(pkg.fset, files, pkg.ImportPath)
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// godocFrontMatter is the front matter of a package's page
+type godocFrontMatter struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description,omitempty"`
+	TOC         bool   `yaml:"toc"`
+}
+
+// markdown renders the reference of the package: its doc comment, then its
+// constants, variables, functions and types with their methods, each with
+// its declaration. Doc links point at the headings of the page, at the
+// pages of the other packages of the reference, and otherwise at
+// pkg.go.dev. The page has a table of contents, which also gives its
+// headings the IDs the links point at.
+func (p *goPackage) markdown(packages map[string]*goPackage) ([]byte, error) {
+	pkg := p.Doc
+	title := pkg.Name
+	if p.RelPath != "." {
+		title = p.RelPath
+	}
+	fm, err := yaml.Marshal(godocFrontMatter{Title: title, Description: pkg.Synopsis(pkg.Doc), TOC: true})
+	if err != nil {
+		return nil, err
+	}
+
+	anchors := p.anchors()
+	cp := pkg.Printer()
+	cp.DocLinkURL = func(link *comment.DocLink) string {
+		name := link.Name
+		if link.Recv != "" {
+			name = link.Recv + "." + name
+		}
+		if link.ImportPath == "" || link.ImportPath == p.ImportPath {
+			return anchorURL(anchors, name)
+		}
+		if other := packages[link.ImportPath]; other != nil {
+			rel, err := filepath.Rel(path.Dir(p.pagePath()), other.pagePath())
+			if err == nil {
+				return filepath.ToSlash(rel) + anchorURL(other.anchors(), name)
+			}
+		}
+		return link.DefaultURL(godocLinksURL)
+	}
+	// Headings of the doc comments get the IDs goldmark gives them
+	cp.HeadingID = func(*comment.Heading) string { return "" }
+
+	// Doc links may name the other packages of the reference without
+	// importing them, such as [client.New]
+	cparser := pkg.Parser()
+	imported := cparser.LookupPackage
+	cparser.LookupPackage = func(name string) (string, bool) {
+		if importPath, ok := imported(name); ok {
+			return importPath, true
+		}
+		for importPath, other := range packages {
+			if other.Doc.Name == name {
+				return importPath, true
+			}
+		}
+		return "", false
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "---\n%s---\n\n# Package %s\n\n```go\nimport %q\n```\n\n", fm, pkg.Name, p.ImportPath)
+	docText := func(text string, level int) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		cp.HeadingLevel = level
+		b.Write(cp.Markdown(cparser.Parse(text)))
+		b.WriteString("\n")
+	}
+	code := func(node ast.Node) error {
+		var decl bytes.Buffer
+		cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+		err := cfg.Fprint(&decl, p.fset, &printer.CommentedNode{Node: node, Comments: p.comments})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "```go\n%s\n```\n\n", decl.String())
+		return nil
+	}
+	values := func(values []*doc.Value, level int) error {
+		for _, v := range values {
+			v.Decl.Doc = nil
+			err := code(v.Decl)
+			if err != nil {
+				return err
+			}
+			docText(v.Doc, level)
+		}
+		return nil
+	}
+	funcs := func(funcs []*doc.Func, heading func(*doc.Func) string, level int) error {
+		for _, f := range funcs {
+			fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", level), heading(f))
+			f.Decl.Doc = nil
+			f.Decl.Body = nil
+			err := code(f.Decl)
+			if err != nil {
+				return err
+			}
+			docText(f.Doc, level+1)
+		}
+		return nil
+	}
+	funcHeading := func(f *doc.Func) string { return "func " + f.Name }
+
+	docText(pkg.Doc, 2)
+	if len(pkg.Consts) > 0 {
+		b.WriteString("## Constants\n\n")
+		err = values(pkg.Consts, 3)
+	}
+	if err == nil && len(pkg.Vars) > 0 {
+		b.WriteString("## Variables\n\n")
+		err = values(pkg.Vars, 3)
+	}
+	if err == nil && len(pkg.Funcs) > 0 {
+		b.WriteString("## Functions\n\n")
+		err = funcs(pkg.Funcs, funcHeading, 3)
+	}
+	if err == nil && len(pkg.Types) > 0 {
+		b.WriteString("## Types\n\n")
+	}
+	for _, t := range pkg.Types {
+		if err != nil {
+			break
+		}
+		fmt.Fprintf(&b, "### type %s\n\n", t.Name)
+		t.Decl.Doc = nil
+		err = code(t.Decl)
+		if err != nil {
+			break
+		}
+		docText(t.Doc, 4)
+		err = values(append(t.Consts, t.Vars...), 4)
+		if err == nil {
+			err = funcs(t.Funcs, funcHeading, 4)
+		}
+		if err == nil {
+			err = funcs(t.Methods, methodHeading, 4)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// methodHeading returns the heading of a method, such as func (*Client) Do
+func methodHeading(m *doc.Func) string {
+	return fmt.Sprintf("func (%s) %s", m.Recv, m.Name)
+}
+
+// anchors returns the IDs of the headings of the package's page, as
+// goldmark derives them, by the names of its symbols. Methods are named
+// Type.Method, and constants and variables go to the heading above them.
+func (p *goPackage) anchors() map[string]string {
+	anchors := make(map[string]string)
+	for _, v := range p.Doc.Consts {
+		for _, name := range v.Names {
+			anchors[name] = "constants"
+		}
+	}
+	for _, v := range p.Doc.Vars {
+		for _, name := range v.Names {
+			anchors[name] = "variables"
+		}
+	}
+	for _, f := range p.Doc.Funcs {
+		anchors[f.Name] = headingID("func " + f.Name)
+	}
+	for _, t := range p.Doc.Types {
+		anchors[t.Name] = headingID("type " + t.Name)
+		for _, v := range append(t.Consts, t.Vars...) {
+			for _, name := range v.Names {
+				anchors[name] = anchors[t.Name]
+			}
+		}
+		for _, f := range t.Funcs {
+			anchors[f.Name] = headingID("func " + f.Name)
+		}
+		for _, m := range t.Methods {
+			anchors[t.Name+"."+m.Name] = headingID(methodHeading(m))
+		}
+	}
+
+	return anchors
+}
+
+// anchorURL returns the fragment linking to a symbol, empty for the page
+// itself
+func anchorURL(anchors map[string]string, name string) string {
+	if anchors[name] == "" {
+		return ""
+	}
+	return "#" + anchors[name]
+}
+
+// headingID returns the ID goldmark gives a heading: its ASCII letters and
+// digits in lower case, with dashes for spaces, dashes and underscores
+func headingID(heading string) string {
+	var b strings.Builder
+	for i := 0; i < len(heading); i++ {
+		c := heading[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			b.WriteByte(c)
+		case c >= 'A' && c <= 'Z':
+			b.WriteByte(c + 'a' - 'A')
+		case c == ' ' || c == '-' || c == '_':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,1068 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+const graphqlCacheDir = ".mindoc/cache/graphql" // Directory the GraphQL reference pages are generated into
+
+// gqlKinds are the kinds of named types, with what a type of the kind is
+// called and the heading listing them on the schema's page, in the order
+// they are listed
+var gqlKinds = []struct{ Kind, Name, Heading string }{
+	{"type", "Object", "Objects"},
+	{"interface", "Interface", "Interfaces"},
+	{"union", "Union", "Unions"},
+	{"enum", "Enum", "Enums"},
+	{"input", "Input type", "Input types"},
+	{"scalar", "Scalar", "Scalars"},
+}
+
+// gqlSchema is a GraphQL schema read from its SDL
+type gqlSchema struct {
+	Description string
+	Roots       map[string]string // Root type names by operation: query, mutation and subscription
+	Types       map[string]*gqlType
+	Directives  []*gqlDirective
+}
+
+// gqlType is a named type of a schema
+type gqlType struct {
+	Kind        string // type, interface, union, enum, input or scalar
+	Name        string
+	Description string
+	Interfaces  []string    // Interfaces an object or interface implements
+	Fields      []*gqlField // Fields of an object or interface, or of an input type
+	Members     []string    // Types of a union
+	Values      []*gqlField // Values of an enum
+}
+
+// gqlField is a field, argument, input field or enum value
+type gqlField struct {
+	Name        string
+	Description string
+	Args        []*gqlField
+	Type        string // Type as written, such as [User!]!
+	Default     string // Default value as written
+	Deprecated  string // Reason the field is deprecated, empty when it isn't
+}
+
+// gqlDirective is a directive a schema defines
+type gqlDirective struct {
+	Name        string
+	Description string
+	Args        []*gqlField
+	Locations   []string
+	Repeatable  bool
+}
+
+// generateGraphQLReference renders every schema of the content tree with
+// an extension mapped to the graphql renderer as reference pages: a page
+// for the schema, one for each of its root operation types and one for
+// every other named type. The pages of api/schema.graphql are mounted at
+// api/schema/, and the schema file itself is copied like other files.
+func (s *Site) generateGraphQLReference() error {
+	s.graphqlMounts = nil
+	if len(s.graphqlExts) == 0 {
+		return nil
+	}
+
+	var mounts []Mount
+	err := s.walkContent(func(srcPath, relPath string, info os.FileInfo) error {
+		if !s.graphqlExts[strings.ToLower(path.Ext(relPath))] {
+			return nil
+		}
+		data, err := ioutil.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		schema, err := parseGraphQL(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", relPath, err)
+		}
+
+		// Keyed by the file on disk too, so a branch preview of the same site
+		// gets pages of its own
+		sum := sha256.Sum256([]byte(s.Name + "\x00" + relPath + "\x00" + srcPath))
+		out := filepath.Join(graphqlCacheDir, hex.EncodeToString(sum[:8]))
+		err = os.RemoveAll(out)
+		if err != nil {
+			return fmt.Errorf("failed to clear %s: %w", out, err)
+		}
+		name := strings.TrimSuffix(path.Base(relPath), path.Ext(relPath))
+		err = schema.writePages(out, humanize(name))
+		if err != nil {
+			return fmt.Errorf("failed to write the reference of %s: %w", relPath, err)
+		}
+		mounts = append(mounts, Mount{Source: out, Target: strings.TrimSuffix(relPath, path.Ext(relPath))})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.graphqlMounts = mounts
+	return nil
+}
+
+// gqlRootTitles are the titles of the pages of the root operation types
+var gqlRootTitles = map[string]string{"query": "Queries", "mutation": "Mutations", "subscription": "Subscriptions"}
+
+// pagePath returns the path of the page documenting a named type within
+// the reference, empty for types the schema doesn't define, such as the
+// built-in scalars
+func (schema *gqlSchema) pagePath(name string) string {
+	for _, op := range []string{"query", "mutation", "subscription"} {
+		if schema.Roots[op] == name {
+			return strings.ToLower(gqlRootTitles[op]) + ".md"
+		}
+	}
+	if schema.Types[name] == nil {
+		return ""
+	}
+	return path.Join("types", name+".md")
+}
+
+// writePages writes the markdown pages of the schema into dir
+func (schema *gqlSchema) writePages(dir, title string) error {
+	pages := map[string][]byte{"_index.md": schema.indexPage(title)}
+	for op, name := range schema.Roots {
+		if t := schema.Types[name]; t != nil {
+			pages[schema.pagePath(name)] = schema.typePage(t, gqlRootTitles[op])
+		}
+	}
+	for name, t := range schema.Types {
+		if relPath := schema.pagePath(name); strings.HasPrefix(relPath, "types/") {
+			pages[relPath] = schema.typePage(t, name)
+		}
+	}
+
+	for relPath, data := range pages {
+		pagePath := filepath.Join(dir, filepath.FromSlash(relPath))
+		err := os.MkdirAll(filepath.Dir(pagePath), os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(pagePath, data, 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gqlFrontMatter writes the front matter and title of a page of the
+// reference, with a table of contents giving its headings the IDs links point at
+func gqlFrontMatter(b *bytes.Buffer, title, description string) {
+	meta := map[string]interface{}{"title": title, "toc": true}
+	if description != "" {
+		meta["description"] = firstSentence(description)
+	}
+	fm, _ := yaml.Marshal(meta)
+	fmt.Fprintf(b, "---\n%s---\n\n# %s\n\n", fm, title)
+}
+
+// firstSentence returns the first sentence of a description, on one line
+func firstSentence(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if i := strings.Index(text, ". "); i >= 0 {
+		return text[:i+1]
+	}
+	return text
+}
+
+// indexPage renders the page of the schema, linking to the pages of its
+// operations and types, and describing its directives
+func (schema *gqlSchema) indexPage(title string) []byte {
+	var b bytes.Buffer
+	gqlFrontMatter(&b, title, schema.Description)
+	if schema.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", schema.Description)
+	}
+
+	var ops []string
+	for _, op := range []string{"query", "mutation", "subscription"} {
+		if t := schema.Types[schema.Roots[op]]; t != nil {
+			ops = append(ops, fmt.Sprintf("- [%s](%s): %d field(s) of `%s`\n", gqlRootTitles[op], schema.pagePath(t.Name), len(t.Fields), t.Name))
+		}
+	}
+	if len(ops) > 0 {
+		fmt.Fprintf(&b, "## Operations\n\n%s\n", strings.Join(ops, ""))
+	}
+
+	names := make([]string, 0, len(schema.Types))
+	for name := range schema.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, kind := range gqlKinds {
+		var entries []string
+		for _, name := range names {
+			t := schema.Types[name]
+			if t.Kind != kind.Kind || !strings.HasPrefix(schema.pagePath(name), "types/") {
+				continue
+			}
+			entry := fmt.Sprintf("- [%s](%s)", name, schema.pagePath(name))
+			if t.Description != "" {
+				entry += ": " + firstSentence(t.Description)
+			}
+			entries = append(entries, entry+"\n")
+		}
+		if len(entries) > 0 {
+			fmt.Fprintf(&b, "## %s\n\n%s\n", kind.Heading, strings.Join(entries, ""))
+		}
+	}
+
+	if len(schema.Directives) > 0 {
+		b.WriteString("## Directives\n\n")
+		for _, d := range schema.Directives {
+			fmt.Fprintf(&b, "### @%s\n\n", d.Name)
+			if d.Description != "" {
+				fmt.Fprintf(&b, "%s\n\n", d.Description)
+			}
+			repeatable := ""
+			if d.Repeatable {
+				repeatable = ", repeatable"
+			}
+			fmt.Fprintf(&b, "On `%s`%s.\n\n", strings.Join(d.Locations, "`, `"), repeatable)
+			schema.writeArgs(&b, ".", "Arguments", d.Args)
+		}
+	}
+	return b.Bytes()
+}
+
+// typePage renders the page of a named type: its fields, values or member
+// types, the interfaces it implements or that implement it, and the
+// fields and arguments using it
+func (schema *gqlSchema) typePage(t *gqlType, title string) []byte {
+	dir := path.Dir(schema.pagePath(t.Name))
+	var b bytes.Buffer
+	gqlFrontMatter(&b, title, t.Description)
+	for _, kind := range gqlKinds {
+		if kind.Kind == t.Kind && title == t.Name {
+			fmt.Fprintf(&b, "*%s*\n\n", kind.Name)
+		}
+	}
+	if t.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", t.Description)
+	}
+	if len(t.Interfaces) > 0 {
+		fmt.Fprintf(&b, "Implements %s.\n\n", schema.typeLinks(dir, t.Interfaces))
+	}
+
+	switch t.Kind {
+	case "union":
+		if len(t.Members) > 0 {
+			fmt.Fprintf(&b, "## Possible types\n\n")
+			for _, member := range t.Members {
+				fmt.Fprintf(&b, "- %s\n", schema.typeRef(dir, member))
+			}
+			b.WriteString("\n")
+		}
+	case "enum":
+		if len(t.Values) > 0 {
+			b.WriteString("## Values\n\n")
+			for _, v := range t.Values {
+				schema.writeField(&b, dir, v, false)
+			}
+		}
+	default:
+		if len(t.Fields) > 0 {
+			b.WriteString("## Fields\n\n")
+			for _, f := range t.Fields {
+				schema.writeField(&b, dir, f, true)
+			}
+		}
+	}
+
+	if t.Kind == "interface" {
+		var implementations []string
+		for _, other := range schema.sortedTypes() {
+			for _, name := range other.Interfaces {
+				if name == t.Name {
+					implementations = append(implementations, other.Name)
+				}
+			}
+		}
+		if len(implementations) > 0 {
+			fmt.Fprintf(&b, "## Implemented by\n\n")
+			for _, name := range implementations {
+				fmt.Fprintf(&b, "- %s\n", schema.typeRef(dir, name))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if users := schema.usesOf(t.Name); len(users) > 0 {
+		b.WriteString("## Used by\n\n")
+		for _, use := range users {
+			fmt.Fprintf(&b, "- [%s](%s#%s)\n", use.label, schema.relLink(dir, schema.pagePath(use.owner)), headingID(use.field))
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// writeField writes a field or enum value under a heading linked to by
+// the fields using its type, with its type, arguments and deprecation
+func (schema *gqlSchema) writeField(b *bytes.Buffer, dir string, f *gqlField, typed bool) {
+	fmt.Fprintf(b, "### %s\n\n", f.Name)
+	if typed {
+		fmt.Fprintf(b, "Type: %s\n\n", schema.typeRef(dir, f.Type))
+	}
+	if f.Deprecated != "" {
+		fmt.Fprintf(b, "**Deprecated:** %s\n\n", f.Deprecated)
+	}
+	if f.Description != "" {
+		fmt.Fprintf(b, "%s\n\n", f.Description)
+	}
+	if f.Default != "" {
+		fmt.Fprintf(b, "Default: `%s`\n\n", f.Default)
+	}
+	schema.writeArgs(b, dir, "Arguments:", f.Args)
+}
+
+// writeArgs writes a list of arguments after a label, or under a heading
+// for a label without a colon
+func (schema *gqlSchema) writeArgs(b *bytes.Buffer, dir, label string, args []*gqlField) {
+	if len(args) == 0 {
+		return
+	}
+	if strings.HasSuffix(label, ":") {
+		fmt.Fprintf(b, "%s\n\n", label)
+	} else {
+		fmt.Fprintf(b, "#### %s\n\n", label)
+	}
+	for _, arg := range args {
+		fmt.Fprintf(b, "- `%s` (%s)", arg.Name, schema.typeRef(dir, arg.Type))
+		if arg.Description != "" {
+			fmt.Fprintf(b, ": %s", strings.Join(strings.Fields(arg.Description), " "))
+		}
+		if arg.Default != "" {
+			fmt.Fprintf(b, " (default `%s`)", arg.Default)
+		}
+		if arg.Deprecated != "" {
+			fmt.Fprintf(b, " **Deprecated:** %s", arg.Deprecated)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+// typeRef writes a type such as [User!]! in markdown, linking the named
+// type to its page when the schema defines it
+func (schema *gqlSchema) typeRef(dir, ref string) string {
+	name := strings.Trim(ref, "[]!")
+	i := strings.Index(ref, name)
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`)
+	link := name
+	if target := schema.pagePath(name); target != "" {
+		link = fmt.Sprintf("[%s](%s)", name, schema.relLink(dir, target))
+	}
+	return escape.Replace(ref[:i]) + link + escape.Replace(ref[i+len(name):])
+}
+
+// typeLinks links a list of types, separated by commas
+func (schema *gqlSchema) typeLinks(dir string, names []string) string {
+	links := make([]string, len(names))
+	for i, name := range names {
+		links[i] = schema.typeRef(dir, name)
+	}
+	return strings.Join(links, ", ")
+}
+
+// relLink returns the link from a page in dir to another page of the
+// reference
+func (schema *gqlSchema) relLink(dir, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
+
+// gqlUse is a field or argument whose type is a named type
+type gqlUse struct {
+	label string // Such as User.friends or Query.user(id)
+	owner string // Type the field belongs to
+	field string // Field, the heading linked to
+}
+
+// usesOf returns the fields and arguments of the schema's types whose type
+// is the named type
+func (schema *gqlSchema) usesOf(name string) []gqlUse {
+	var uses []gqlUse
+	for _, t := range schema.sortedTypes() {
+		for _, f := range t.Fields {
+			if strings.Trim(f.Type, "[]!") == name {
+				uses = append(uses, gqlUse{t.Name + "." + f.Name, t.Name, f.Name})
+			}
+			for _, arg := range f.Args {
+				if strings.Trim(arg.Type, "[]!") == name {
+					uses = append(uses, gqlUse{t.Name + "." + f.Name + "(" + arg.Name + ")", t.Name, f.Name})
+				}
+			}
+		}
+	}
+	return uses
+}
+
+// sortedTypes returns the types of the schema by name
+func (schema *gqlSchema) sortedTypes() []*gqlType {
+	types := make([]*gqlType, 0, len(schema.Types))
+	for _, t := range schema.Types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// gqlToken is a token of GraphQL SDL
+type gqlToken struct {
+	kind  byte // 'n' for names, 's' for strings, '0' for numbers, the character of a punctuator, 0 at the end
+	value string
+	line  int
+}
+
+// gqlParser reads a schema from the tokens of its SDL
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+	schema *gqlSchema
+}
+
+// parseGraphQL reads a schema from its SDL. Extensions of types and of the
+// schema are merged into what they extend, and without a schema
+// definition the types named Query, Mutation and Subscription are the
+// root operation types.
+func parseGraphQL(sdl string) (*gqlSchema, error) {
+	tokens, err := lexGraphQL(sdl)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens, schema: &gqlSchema{Roots: make(map[string]string), Types: make(map[string]*gqlType)}}
+	for p.peek().kind != 0 {
+		err := p.definition()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(p.schema.Roots) == 0 {
+		for op, name := range map[string]string{"query": "Query", "mutation": "Mutation", "subscription": "Subscription"} {
+			if p.schema.Types[name] != nil {
+				p.schema.Roots[op] = name
+			}
+		}
+	}
+	for op, name := range p.schema.Roots {
+		if p.schema.Types[name] == nil {
+			return nil, fmt.Errorf("the %s type %s is not defined", op, name)
+		}
+	}
+	return p.schema, nil
+}
+
+// peek returns the next token without reading it
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+// next reads the next token
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// errorf returns an error at the line of the next token
+func (p *gqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+// expect reads a punctuator
+func (p *gqlParser) expect(kind byte) error {
+	if t := p.peek(); t.kind != kind {
+		return p.errorf("expected %q, found %s", kind, t.describe())
+	}
+	p.next()
+	return nil
+}
+
+// skip reads a punctuator when it is the next token
+func (p *gqlParser) skip(kind byte) bool {
+	if p.peek().kind == kind {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// name reads a name
+func (p *gqlParser) name() (string, error) {
+	t := p.peek()
+	if t.kind != 'n' {
+		return "", p.errorf("expected a name, found %s", t.describe())
+	}
+	p.next()
+	return t.value, nil
+}
+
+// keyword reads a name when it is the given one
+func (p *gqlParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == 'n' && t.value == word {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// describe names a token in errors
+func (t gqlToken) describe() string {
+	switch t.kind {
+	case 0:
+		return "the end of the schema"
+	case 'n':
+		return strconv.Quote(t.value)
+	case 's':
+		return "a string"
+	case '0':
+		return "a number"
+	}
+	return strconv.Quote(string(t.kind))
+}
+
+// description reads the description before a definition, if any
+func (p *gqlParser) description() string {
+	if t := p.peek(); t.kind == 's' {
+		p.next()
+		return t.value
+	}
+	return ""
+}
+
+// definition reads a definition, or an extension, of the type system
+func (p *gqlParser) definition() error {
+	desc := p.description()
+	extend := p.keyword("extend")
+	kind, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	if kind == "schema" {
+		return p.schemaDefinition(desc)
+	}
+	if kind == "directive" {
+		return p.directiveDefinition(desc)
+	}
+	known := false
+	for _, k := range gqlKinds {
+		known = known || k.Kind == kind
+	}
+	if !known {
+		return fmt.Errorf("line %d: unexpected %q, only type system definitions are documented", p.tokens[p.pos-1].line, kind)
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	t := p.schema.Types[name]
+	switch {
+	case t == nil && extend:
+		return p.errorf("extend %s %s of a type that isn't defined", kind, name)
+	case t != nil && !extend:
+		return p.errorf("%s is defined twice", name)
+	case t != nil && t.Kind != kind:
+		return p.errorf("extend %s %s of a %s", kind, name, t.Kind)
+	case t == nil:
+		t = &gqlType{Kind: kind, Name: name, Description: desc}
+		p.schema.Types[name] = t
+	}
+
+	if (kind == "type" || kind == "interface") && p.keyword("implements") {
+		p.skip('&')
+		for {
+			iface, err := p.name()
+			if err != nil {
+				return err
+			}
+			t.Interfaces = append(t.Interfaces, iface)
+			if !p.skip('&') {
+				break
+			}
+		}
+	}
+	_, err = p.directives()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "type", "interface", "input":
+		if p.peek().kind != '{' {
+			return nil
+		}
+		fields, err := p.fields(kind != "input")
+		t.Fields = append(t.Fields, fields...)
+		return err
+	case "union":
+		if !p.skip('=') {
+			return nil
+		}
+		p.skip('|')
+		for {
+			member, err := p.name()
+			if err != nil {
+				return err
+			}
+			t.Members = append(t.Members, member)
+			if !p.skip('|') {
+				return nil
+			}
+		}
+	case "enum":
+		if !p.skip('{') {
+			return nil
+		}
+		for !p.skip('}') {
+			v := &gqlField{Description: p.description()}
+			v.Name, err = p.name()
+			if err != nil {
+				return err
+			}
+			v.Deprecated, err = p.directives()
+			if err != nil {
+				return err
+			}
+			t.Values = append(t.Values, v)
+		}
+	}
+	return nil
+}
+
+// schemaDefinition reads the root operation types of a schema definition
+// or extension
+func (p *gqlParser) schemaDefinition(desc string) error {
+	if desc != "" {
+		p.schema.Description = desc
+	}
+	_, err := p.directives()
+	if err != nil {
+		return err
+	}
+	if !p.skip('{') {
+		return nil
+	}
+	for !p.skip('}') {
+		op, err := p.name()
+		if err != nil {
+			return err
+		}
+		if gqlRootTitles[op] == "" {
+			return p.errorf("unknown operation %q", op)
+		}
+		err = p.expect(':')
+		if err != nil {
+			return err
+		}
+		p.schema.Roots[op], err = p.name()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// directiveDefinition reads the definition of a directive
+func (p *gqlParser) directiveDefinition(desc string) error {
+	err := p.expect('@')
+	if err != nil {
+		return err
+	}
+	d := &gqlDirective{Description: desc}
+	d.Name, err = p.name()
+	if err != nil {
+		return err
+	}
+	if p.peek().kind == '(' {
+		d.Args, err = p.arguments()
+		if err != nil {
+			return err
+		}
+	}
+	d.Repeatable = p.keyword("repeatable")
+	if !p.keyword("on") {
+		return p.errorf("expected the locations of @%s", d.Name)
+	}
+	p.skip('|')
+	for {
+		location, err := p.name()
+		if err != nil {
+			return err
+		}
+		d.Locations = append(d.Locations, location)
+		if !p.skip('|') {
+			break
+		}
+	}
+	p.schema.Directives = append(p.schema.Directives, d)
+	return nil
+}
+
+// fields reads the fields of an object or interface, which may take
+// arguments, or of an input type, which may have defaults
+func (p *gqlParser) fields(withArgs bool) ([]*gqlField, error) {
+	err := p.expect('{')
+	if err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for !p.skip('}') {
+		var f *gqlField
+		if withArgs {
+			f, err = p.field()
+		} else {
+			f, err = p.inputValue()
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// field reads a field of an object or interface
+func (p *gqlParser) field() (*gqlField, error) {
+	f := &gqlField{Description: p.description()}
+	var err error
+	f.Name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind == '(' {
+		f.Args, err = p.arguments()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = p.expect(':')
+	if err != nil {
+		return nil, err
+	}
+	f.Type, err = p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	f.Deprecated, err = p.directives()
+	return f, err
+}
+
+// arguments reads the arguments a field or directive takes
+func (p *gqlParser) arguments() ([]*gqlField, error) {
+	err := p.expect('(')
+	if err != nil {
+		return nil, err
+	}
+	var args []*gqlField
+	for !p.skip(')') {
+		arg, err := p.inputValue()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// inputValue reads an argument or a field of an input type
+func (p *gqlParser) inputValue() (*gqlField, error) {
+	f := &gqlField{Description: p.description()}
+	var err error
+	f.Name, err = p.name()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect(':')
+	if err != nil {
+		return nil, err
+	}
+	f.Type, err = p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip('=') {
+		f.Default, err = p.value()
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.Deprecated, err = p.directives()
+	return f, err
+}
+
+// typeRef reads a type such as [User!]!
+func (p *gqlParser) typeRef() (string, error) {
+	var ref string
+	if p.skip('[') {
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		err = p.expect(']')
+		if err != nil {
+			return "", err
+		}
+		ref = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		ref = name
+	}
+	if p.skip('!') {
+		ref += "!"
+	}
+	return ref, nil
+}
+
+// directives reads the directives applied to a definition, returning the
+// reason given by @deprecated when it is one of them
+func (p *gqlParser) directives() (string, error) {
+	deprecated := ""
+	for p.skip('@') {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		reason := "No longer supported"
+		if p.skip('(') {
+			for !p.skip(')') {
+				arg, err := p.name()
+				if err != nil {
+					return "", err
+				}
+				err = p.expect(':')
+				if err != nil {
+					return "", err
+				}
+				t := p.peek()
+				_, err = p.value()
+				if err != nil {
+					return "", err
+				}
+				if arg == "reason" && t.kind == 's' {
+					reason = t.value
+				}
+			}
+		}
+		if name == "deprecated" {
+			deprecated = reason
+		}
+	}
+	return deprecated, nil
+}
+
+// value reads a constant value, returning it as written in GraphQL
+func (p *gqlParser) value() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case 'n', '0':
+		return t.value, nil
+	case 's':
+		return strconv.Quote(t.value), nil
+	case '$':
+		name, err := p.name()
+		return "$" + name, err
+	case '[':
+		var items []string
+		for !p.skip(']') {
+			item, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case '{':
+		var fields []string
+		for !p.skip('}') {
+			name, err := p.name()
+			if err != nil {
+				return "", err
+			}
+			err = p.expect(':')
+			if err != nil {
+				return "", err
+			}
+			value, err := p.value()
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, name+": "+value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}", nil
+	}
+	p.pos--
+	return "", p.errorf("expected a value, found %s", t.describe())
+}
+
+// lexGraphQL splits SDL into its tokens, leaving out white space, commas
+// and comments, and reading the value of strings and block strings
+func lexGraphQL(sdl string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	line := 1
+	for i := 0; i < len(sdl); {
+		c := sdl[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(sdl[i:], "\ufeff"):
+			i += len("\ufeff")
+		case c == '#':
+			for i < len(sdl) && sdl[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sdl[i:], `"""`):
+			end := i + 3
+			for end < len(sdl) && !strings.HasPrefix(sdl[end:], `"""`) {
+				if strings.HasPrefix(sdl[end:], `\"""`) {
+					end += 4
+				} else {
+					end++
+				}
+			}
+			if end >= len(sdl) {
+				return nil, fmt.Errorf("line %d: unterminated block string", line)
+			}
+			raw := sdl[i+3 : end]
+			tokens = append(tokens, gqlToken{'s', blockStringValue(strings.ReplaceAll(raw, `\"""`, `"""`)), line})
+			line += strings.Count(raw, "\n")
+			i = end + 3
+		case c == '"':
+			value, n, err := stringValue(sdl[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			tokens = append(tokens, gqlToken{'s', value, line})
+			i += n
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(sdl) && (sdl[j] == '_' || sdl[j] >= 'a' && sdl[j] <= 'z' || sdl[j] >= 'A' && sdl[j] <= 'Z' || sdl[j] >= '0' && sdl[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, gqlToken{'n', sdl[i:j], line})
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(sdl) && strings.IndexByte("0123456789.eE+-", sdl[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, gqlToken{'0', sdl[i:j], line})
+			i = j
+		case strings.HasPrefix(sdl[i:], "..."):
+			return nil, fmt.Errorf("line %d: unexpected \"...\", only type system definitions are documented", line)
+		case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+			tokens = append(tokens, gqlToken{c, string(c), line})
+			i++
+		default:
+			r, _ := utf8.DecodeRuneInString(sdl[i:])
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+		}
+	}
+	return append(tokens, gqlToken{line: line}), nil
+}
+
+// stringValue reads the string at the start of s, returning its value and
+// its length in s
+func stringValue(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(s) {
+					return "", 0, fmt.Errorf("invalid escape in string")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape in string")
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// blockStringValue returns the value of a block string: its lines without
+// the indentation they share and without blank lines around them
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = strings.TrimLeft(lines[i], " \t")
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	healthPath = "/healthz" // Endpoint answering as long as the server is running
+	readyPath  = "/readyz"  // Endpoint answering once every site has output to serve
+)
+
+// serveHealth tells container runtimes the server is alive
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReady tells load balancers whether the sites can be served, which
+// they can't until their first build has finished
+func serveReady(sites []*Site) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var waiting []string
+		for _, site := range sites {
+			if !site.built.Load() {
+				waiting = append(waiting, site.label())
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(waiting) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "not ready: %s\n", strings.Join(waiting, ", "))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// requireBuilt answers requests for a site that hasn't been built yet with
+// a temporary error instead of a missing page
+func (s *Site) requireBuilt(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.built.Load() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, s.label()+" has not been built yet", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// useExistingOutput serves the site from whatever is in its output
+// directory, when the sites aren't built on start
+func (s *Site) useExistingOutput() {
+	if _, err := os.Stat(s.OutputDir); err != nil {
+		fmt.Printf("%s has no output to serve until it is rebuilt: %v\n", s.label(), err)
+		return
+	}
+	if s.Search.Bleve {
+		if err := s.openBleveIndex(); err != nil {
+			fmt.Printf("%s has no search index until it is rebuilt: %v\n", s.label(), err)
+		}
+	}
+	s.built.Store(true)
+}
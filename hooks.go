@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"plugin"
+	"strings"
+)
+
+// Hooks lists the commands run at each stage of the build. An entry ending
+// in ".so" is loaded as a Go plugin, anything else is run as an executable.
+// Every hook receives metadata as JSON on stdin (or as its argument for
+// plugins).
+type Hooks struct {
+	PreBuild   []string `yaml:"preBuild"`   // Run before any page is rendered
+	PostRender []string `yaml:"postRender"` // Run for each rendered page, may replace its HTML
+	PostBuild  []string `yaml:"postBuild"`  // Run after all pages are written
+}
+
+// Go plugins export these symbols to take part in the build
+const (
+	pluginPreBuild   = "PreBuild"   // func(meta []byte) error
+	pluginPostRender = "PostRender" // func(meta []byte) ([]byte, error)
+	pluginPostBuild  = "PostBuild"  // func(meta []byte) error
+)
+
+// siteMeta is the metadata passed to the pre-build and post-build hooks
+type siteMeta struct {
+	Site      string     `json:"site"`
+	OutputDir string     `json:"outputDir"`
+	BaseURL   string     `json:"baseURL"`
+	Pages     []pageMeta `json:"pages,omitempty"`
+}
+
+// pageMeta is the metadata of a rendered page passed to hooks
+type pageMeta struct {
+	Site   string `json:"site"`
+	Source string `json:"source"` // Path within the content tree
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Output string `json:"output"` // File the page is written to
+	HTML   string `json:"html,omitempty"`
+}
+
+// siteMeta returns the metadata describing the site for hooks
+func (s *Site) siteMeta() siteMeta {
+	meta := siteMeta{
+		Site:      s.Name,
+		OutputDir: s.OutputDir,
+		BaseURL:   s.BaseURL,
+		Pages:     s.renderedPages,
+	}
+	// Nothing is written to disk in memory mode
+	if _, ok := s.output.(*memoryOutput); ok {
+		meta.OutputDir = ""
+	}
+	return meta
+}
+
+// runBuildHooks runs the pre-build or post-build hooks
+func (s *Site) runBuildHooks(stage string, hooks []string) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	meta, err := json.Marshal(s.siteMeta())
+	if err != nil {
+		return fmt.Errorf("failed to encode site metadata: %w", err)
+	}
+
+	for _, hook := range hooks {
+		if isPluginHook(hook) {
+			err = runPluginBuildHook(hook, stage, meta)
+		} else {
+			_, err = runCommandHook(hook, stage, meta)
+		}
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, hook, err)
+		}
+	}
+
+	return nil
+}
+
+// runPostRenderHooks passes a rendered page through the post-render hooks.
+// A hook that produces output replaces the page's HTML with it.
+func (s *Site) runPostRenderHooks(meta pageMeta) (string, error) {
+	for _, hook := range s.Hooks.PostRender {
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode page metadata: %w", err)
+		}
+
+		var output []byte
+		if isPluginHook(hook) {
+			output, err = runPluginPostRenderHook(hook, data)
+		} else {
+			output, err = runCommandHook(hook, "postRender", data)
+		}
+		if err != nil {
+			return "", fmt.Errorf("postRender hook %q failed: %w", hook, err)
+		}
+
+		if len(bytes.TrimSpace(output)) > 0 {
+			meta.HTML = string(output)
+		}
+	}
+
+	return meta.HTML, nil
+}
+
+// isPluginHook reports whether a hook is a Go plugin rather than a command
+func isPluginHook(hook string) bool {
+	return strings.HasSuffix(hook, ".so")
+}
+
+// runCommandHook runs an external command with the metadata on stdin and
+// returns what it writes to stdout
+func runCommandHook(hook, stage string, meta []byte) ([]byte, error) {
+	args := strings.Fields(hook)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty hook command")
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(meta)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "MINDOC_HOOK="+stage)
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// lookupPluginHook loads a Go plugin and finds the symbol for a stage.
+// A plugin without the symbol does not take part in that stage.
+func lookupPluginHook(hook, symbol string) (plugin.Symbol, error) {
+	p, err := plugin.Open(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, nil
+	}
+
+	return sym, nil
+}
+
+// runPluginBuildHook calls a plugin's PreBuild or PostBuild function
+func runPluginBuildHook(hook, stage string, meta []byte) error {
+	symbol := pluginPreBuild
+	if stage == "postBuild" {
+		symbol = pluginPostBuild
+	}
+
+	sym, err := lookupPluginHook(hook, symbol)
+	if err != nil || sym == nil {
+		return err
+	}
+
+	fn, ok := sym.(func([]byte) error)
+	if !ok {
+		return fmt.Errorf("%s has type %T, want func([]byte) error", symbol, sym)
+	}
+
+	return fn(meta)
+}
+
+// runPluginPostRenderHook calls a plugin's PostRender function
+func runPluginPostRenderHook(hook string, meta []byte) ([]byte, error) {
+	sym, err := lookupPluginHook(hook, pluginPostRender)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+
+	fn, ok := sym.(func([]byte) ([]byte, error))
+	if !ok {
+		return nil, fmt.Errorf("%s has type %T, want func([]byte) ([]byte, error)", pluginPostRender, sym)
+	}
+
+	return fn(meta)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// Translation is a page in one of the languages of a site's translations
+type Translation struct {
+	Lang    string    // Language code of the site the page is in
+	URL     string    // Absolute URL of the page when the site's baseURL has a host
+	Updated time.Time // When the page last changed, only known for the page an outdated translation translates
+}
+
+// linkTranslations links the sites with the same translations setting, so
+// their pages link to each other in the other languages. Sites of the same
+// translations can't share a language.
+func linkTranslations(sites []*Site) error {
+	groups := make(map[string][]*Site)
+	for _, site := range sites {
+		if site.Translations != "" {
+			groups[site.Translations] = append(groups[site.Translations], site)
+		}
+	}
+	for name, group := range groups {
+		languages := make(map[string]string)
+		for _, site := range group {
+			if other, ok := languages[site.Language]; ok {
+				return fmt.Errorf("sites %q and %q of translations %q both have the language %q", other, site.Name, name, site.Language)
+			}
+			languages[site.Language] = site.Name
+		}
+		for _, site := range group {
+			site.translations = group
+		}
+	}
+	return nil
+}
+
+// findTranslations sets the translations of every page: the pages at the
+// same path in the content trees of the other sites of its translations.
+// Their content is looked up on disk rather than in their latest build, so
+// the sites can be built in any order. The first site listed is the source
+// language: pages it has that this site lacks are missing translations,
+// and a page is outdated when the source page changed after it, by the
+// lastmod or date of both.
+func (s *Site) findTranslations() error {
+	for _, page := range s.pages {
+		page.Translations = nil
+		page.Outdated = nil
+	}
+	s.missingTranslations = nil
+	if len(s.translations) < 2 {
+		return nil
+	}
+
+	// Pages taken from the source language aren't translations of it
+	byPath := make(map[string]*Page, len(s.pages))
+	for _, page := range s.pages {
+		if page.Fallback == nil {
+			byPath[page.Path] = page
+		}
+	}
+	source := s.translations[0]
+	for _, site := range s.translations {
+		found := make(map[string]bool)
+		if site != s {
+			err := walkMounts(site.localMounts(), func(srcPath, relPath string, info os.FileInfo) error {
+				if !site.isPage(relPath) {
+					return nil
+				}
+				if _, ok := s.filesByPath[relPath]; !ok && site == source {
+					s.missingTranslations = append(s.missingTranslations, relPath)
+				}
+				page := byPath[relPath]
+				if page == nil {
+					return nil
+				}
+				found[relPath] = true
+				if site == source {
+					return s.compareWithSource(page, srcPath)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read the content of %s: %w", strings.ToLower(site.label()), err)
+			}
+		}
+		for _, page := range s.pages {
+			if (site == s && page.Fallback == nil) || found[page.Path] {
+				page.Translations = append(page.Translations, Translation{Lang: site.Language, URL: site.absURL(site.pageURL(page.Path))})
+			}
+		}
+	}
+
+	// A page only in this site's language has no translations
+	for _, page := range s.pages {
+		if len(page.Translations) < 2 {
+			page.Translations = nil
+		}
+	}
+	return nil
+}
+
+// hreflangTags returns the alternate links of a page to its translations,
+// itself included, and an x-default link to the first of them. A page taken
+// from the source language names that page as canonical instead.
+func (s *Site) hreflangTags(page *Page) template.HTML {
+	esc := template.HTMLEscapeString
+	if page.Fallback != nil {
+		return template.HTML(fmt.Sprintf(`<link rel="canonical" href="%s">`, esc(page.Fallback.URL)))
+	}
+	if len(page.Translations) == 0 {
+		return ""
+	}
+	var tags []string
+	for _, t := range page.Translations {
+		tags = append(tags, fmt.Sprintf(`<link rel="alternate" hreflang="%s" href="%s">`, esc(t.Lang), esc(t.URL)))
+	}
+	tags = append(tags, fmt.Sprintf(`<link rel="alternate" hreflang="x-default" href="%s">`, esc(page.Translations[0].URL)))
+	return template.HTML(strings.Join(tags, "\n    "))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/net/html"
+)
+
+// htmlIssue is a structural problem in the HTML of a generated page, such as
+// an element left open by raw HTML in the content or a broken template
+type htmlIssue struct {
+	Page    string // Source path of the page within the content tree
+	Line    int    // Line of the generated file the problem is on
+	Message string
+}
+
+var (
+	// voidElements never have content or an end tag
+	voidElements = setOf("area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr")
+
+	// optionalEndElements may be left open, closed by what follows them
+	optionalEndElements = setOf("html", "head", "body", "p", "li", "dt", "dd", "rt", "rp", "optgroup", "option",
+		"colgroup", "caption", "thead", "tbody", "tfoot", "tr", "td", "th")
+
+	// paragraphClosers close an open paragraph when they start
+	paragraphClosers = setOf("address", "article", "aside", "blockquote", "details", "dialog", "div", "dl", "fieldset",
+		"figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hgroup", "hr",
+		"main", "menu", "nav", "ol", "p", "pre", "section", "summary", "table", "ul")
+
+	// impliedEnds are the elements a start tag closes when they are the
+	// innermost open element
+	impliedEnds = map[string]map[string]bool{
+		"li":       setOf("li"),
+		"dt":       setOf("dt", "dd"),
+		"dd":       setOf("dt", "dd"),
+		"tr":       setOf("tr", "td", "th"),
+		"td":       setOf("td", "th"),
+		"th":       setOf("td", "th"),
+		"thead":    setOf("thead", "tbody", "tfoot", "tr", "td", "th", "caption", "colgroup"),
+		"tbody":    setOf("thead", "tbody", "tfoot", "tr", "td", "th", "caption", "colgroup"),
+		"tfoot":    setOf("thead", "tbody", "tfoot", "tr", "td", "th", "caption", "colgroup"),
+		"option":   setOf("option"),
+		"optgroup": setOf("option", "optgroup"),
+		"rt":       setOf("rt", "rp"),
+		"rp":       setOf("rt", "rp"),
+		"body":     setOf("head"),
+	}
+
+	// obsoleteElements are no longer part of HTML
+	obsoleteElements = setOf("acronym", "applet", "basefont", "big", "blink", "center", "dir", "font", "frame",
+		"frameset", "isindex", "marquee", "nobr", "noframes", "strike", "tt", "xmp")
+)
+
+// setOf returns a set of strings
+func setOf(items ...string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+// validateHTML checks the pages written by the last build for HTML that
+// doesn't conform: elements left open or closed twice, end tags without a
+// start tag, duplicate attributes, obsolete elements and a missing doctype
+func (s *Site) validateHTML() ([]htmlIssue, error) {
+	var issues []htmlIssue
+	for _, meta := range s.renderedPages {
+		data, err := ioutil.ReadFile(meta.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", meta.Output, err)
+		}
+		for _, issue := range htmlProblems(data) {
+			issue.Page = s.checkedPage(meta)
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// checkedPage names a page in the problems the checks report: its source,
+// or its path within the output for generated pages, which have none
+func (s *Site) checkedPage(meta pageMeta) string {
+	if meta.Source != "" {
+		return meta.Source
+	}
+	rel, err := filepath.Rel(s.OutputDir, meta.Output)
+	if err != nil {
+		return meta.Output
+	}
+	return filepath.ToSlash(rel)
+}
+
+// openElement is an element whose end tag hasn't been seen yet
+type openElement struct {
+	name string
+	line int
+}
+
+// htmlProblems returns the structural problems of an HTML page
+func htmlProblems(data []byte) []htmlIssue {
+	var issues []htmlIssue
+	var stack []openElement
+	line := 1
+	foreign := 0 // Depth inside svg and math, where any element may close itself
+	seenDoctype, seenElement := false, false
+
+	report := func(line int, format string, args ...interface{}) {
+		issues = append(issues, htmlIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	// unwind closes the open elements from index i up, reporting those that
+	// needed an end tag
+	unwind := func(i int) {
+		for j := len(stack) - 1; j >= i; j-- {
+			if !optionalEndElements[stack[j].name] {
+				report(stack[j].line, "<%s> is never closed", stack[j].name)
+			}
+		}
+		stack = stack[:i]
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				report(line, "%v", z.Err())
+			}
+			break
+		}
+		tokenLine := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+
+		switch tt {
+		case html.DoctypeToken:
+			seenDoctype = true
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			name := tok.Data
+			if !seenElement && !seenDoctype {
+				report(tokenLine, "page has no doctype")
+			}
+			seenElement = true
+
+			seen := make(map[string]bool, len(tok.Attr))
+			for _, a := range tok.Attr {
+				key := a.Key
+				if a.Namespace != "" {
+					key = a.Namespace + ":" + key
+				}
+				if seen[key] {
+					report(tokenLine, "<%s> has the %s attribute more than once", name, key)
+				}
+				seen[key] = true
+			}
+			if obsoleteElements[name] && foreign == 0 {
+				report(tokenLine, "<%s> is obsolete", name)
+			}
+
+			if foreign > 0 || name == "svg" || name == "math" {
+				if tt == html.StartTagToken {
+					foreign++
+					stack = append(stack, openElement{name, tokenLine})
+				}
+				continue
+			}
+			if voidElements[name] {
+				continue
+			}
+			if tt == html.SelfClosingTagToken {
+				report(tokenLine, "<%s/> can't close itself in HTML", name)
+			}
+
+			// Some start tags end the innermost open element
+			if n := len(stack); n > 0 {
+				top := stack[n-1].name
+				if (top == "p" && paragraphClosers[name]) || impliedEnds[name][top] {
+					stack = stack[:n-1]
+					if n := len(stack); name == "tr" && n > 0 && stack[n-1].name == "tr" {
+						stack = stack[:n-1]
+					}
+				}
+			}
+			stack = append(stack, openElement{name, tokenLine})
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if voidElements[tag] {
+				report(tokenLine, "</%s> ends an element that has no end tag", tag)
+				continue
+			}
+
+			i := len(stack) - 1
+			for i >= 0 && stack[i].name != tag {
+				i--
+			}
+			if i < 0 {
+				report(tokenLine, "</%s> has no matching start tag", tag)
+				continue
+			}
+			if foreign > 0 {
+				foreign -= len(stack) - i
+				if foreign < 0 {
+					foreign = 0
+				}
+			}
+			unwind(i + 1)
+			stack = stack[:i]
+		}
+	}
+
+	unwind(0)
+	return issues
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const i18nDir = "./i18n" // Directory containing the translations of theme strings
+
+// defaultStrings are the English theme strings used when no translation
+// file provides them
+var defaultStrings = map[string]string{
+	"skipToContent":     "Skip to content",
+	"mainNavigation":    "Main",
+	"sectionNavigation": "Section navigation",
+	"onThisPage":        "On this page",
+	"toggleSection":     "Toggle %s",
+	"editThisPage":      "Edit this page",
+	"readingTime":       "%d min read",
+	"comments":          "Comments",
+	"wasThisHelpful":    "Was this page helpful?",
+	"feedbackComment":   "Anything to add? (optional)",
+	"feedbackThanks":    "Thanks for your feedback!",
+	"yes":               "Yes",
+	"no":                "No",
+	"writtenBy":         "Written by",
+	"pagesByAuthor":     "Pages by %s",
+	"series":            "Series",
+	"seriesPart":        "Part %d of %d",
+	"previousPart":      "Previous",
+	"nextPart":          "Next",
+	"glossary":          "Glossary",
+	"references":        "References",
+	"details":           "Details",
+	"copy":              "Copy",
+	"copied":            "Copied",
+	"watchRecording":    "Watch the recording",
+	"watchVideo":        "Watch the video",
+	"video":             "Video",
+	"captions":          "Captions",
+	"downloadVideo":     "Download the video",
+	"downloadAudio":     "Download the audio",
+	"outdated":          "This translation is older than the page it translates.",
+	"readOriginal":      "Read the original",
+	"notTranslated":     "This page hasn't been translated yet, so it is shown in its original language.",
+	"mayBeOutdated":     "This page hasn't been updated in a while and may be outdated.",
+	"since":             "Since %s",
+	"deprecated":        "Deprecated",
+	"removedIn":         "Removed in %s",
+	"deprecations":      "Deprecations",
+}
+
+// rtlLanguages are the languages written from right to left
+var rtlLanguages = map[string]bool{
+	"ar": true, "arc": true, "ckb": true, "dv": true, "fa": true, "he": true,
+	"ku": true, "ps": true, "sd": true, "ug": true, "ur": true, "yi": true,
+}
+
+// TextDirection returns the direction the site's language is written in,
+// "rtl" or "ltr", unless the config sets one
+func (s *Site) TextDirection() string {
+	if s.Direction != "" {
+		return s.Direction
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(s.Language), "-")
+	if rtlLanguages[lang] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// loadTranslations reads every <language>.yaml file of the i18n directory,
+// each a mapping of string keys to translated text
+func loadTranslations(dir string) (map[string]map[string]string, error) {
+	translations := make(map[string]map[string]string)
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list translations: %w", err)
+	}
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read translations: %w", err)
+		}
+
+		var strs map[string]string
+		err = yaml.Unmarshal(data, &strs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse translations %s: %w", p, err)
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)))
+		translations[lang] = strs
+	}
+
+	return translations, nil
+}
+
+// translate returns a theme string in the site's language, falling back to
+// the base language ("de" for "de-CH"), then English. Arguments fill in the
+// string's fmt verbs, as in {{ T "readingTime" 5 }}.
+func (s *Site) translate(key string, args ...interface{}) string {
+	text, ok := s.lookupString(key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// lookupString finds the text of a theme string for the site's language
+func (s *Site) lookupString(key string) (string, bool) {
+	lang := strings.ToLower(s.Language)
+	candidates := []string{lang}
+	if base, _, ok := strings.Cut(lang, "-"); ok {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, "en")
+
+	if s.theme != nil {
+		for _, candidate := range candidates {
+			if text, ok := s.theme.translations[candidate][key]; ok {
+				return text, true
+			}
+		}
+	}
+
+	text, ok := defaultStrings[key]
+	return text, ok
+}
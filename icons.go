@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/jpeg" // Logos may be JPEG images
+	"image/png"
+	"os"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const manifestFile = "site.webmanifest" // Web app manifest written to the output root
+
+// IconsConfig describes the logo the favicons and web manifest are made from
+type IconsConfig struct {
+	Logo            string `yaml:"logo"`            // Source image, PNG or JPEG, ideally square and at least 512px
+	Name            string `yaml:"name"`            // Name of the site as an installed app, the site name when unset
+	ThemeColor      string `yaml:"themeColor"`      // Browser UI color, such as "#1e6bb8"
+	BackgroundColor string `yaml:"backgroundColor"` // Splash screen color of the installed app
+}
+
+// iconFile is an image generated from the logo
+type iconFile struct {
+	Name string
+	Size int
+}
+
+var (
+	faviconSizes = []int{16, 32, 48} // Images inside favicon.ico
+	iconFiles    = []iconFile{
+		{"apple-touch-icon.png", 180},
+		{"icon-192.png", 192},
+		{"icon-512.png", 512},
+	}
+)
+
+// generateIcons writes favicon.ico, the app icons and the web manifest from
+// the configured logo
+func (s *Site) generateIcons() error {
+	if s.Icons.Logo == "" {
+		return nil
+	}
+
+	f, err := os.Open(s.Icons.Logo)
+	if err != nil {
+		return fmt.Errorf("failed to open logo: %w", err)
+	}
+	logo, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode logo %s: %w", s.Icons.Logo, err)
+	}
+
+	for _, icon := range iconFiles {
+		data, err := encodeIcon(logo, icon.Size)
+		if err != nil {
+			return err
+		}
+		err = s.output.WriteFile(icon.Name, data)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", icon.Name, err)
+		}
+	}
+
+	ico, err := encodeFavicon(logo)
+	if err != nil {
+		return err
+	}
+	err = s.output.WriteFile("favicon.ico", ico)
+	if err != nil {
+		return fmt.Errorf("failed to write favicon.ico: %w", err)
+	}
+
+	manifest, err := json.MarshalIndent(s.webManifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = s.output.WriteFile(manifestFile, manifest)
+	if err != nil {
+		return fmt.Errorf("failed to write web manifest: %w", err)
+	}
+
+	return nil
+}
+
+// webManifest describes the site for browsers installing it as an app
+func (s *Site) webManifest() map[string]interface{} {
+	name := s.Icons.Name
+	if name == "" {
+		name = s.Name
+	}
+
+	var icons []map[string]string
+	for _, icon := range iconFiles[1:] {
+		icons = append(icons, map[string]string{
+			"src":   s.url(icon.Name),
+			"sizes": fmt.Sprintf("%dx%d", icon.Size, icon.Size),
+			"type":  "image/png",
+		})
+	}
+
+	manifest := map[string]interface{}{
+		"name":       name,
+		"short_name": name,
+		"start_url":  s.basePath,
+		"display":    "standalone",
+		"icons":      icons,
+	}
+	if s.Icons.ThemeColor != "" {
+		manifest["theme_color"] = s.Icons.ThemeColor
+	}
+	if s.Icons.BackgroundColor != "" {
+		manifest["background_color"] = s.Icons.BackgroundColor
+	}
+	return manifest
+}
+
+// iconTags returns the head tags linking the generated icons and manifest
+func (s *Site) iconTags() template.HTML {
+	if s.Icons.Logo == "" {
+		return ""
+	}
+
+	var tags strings.Builder
+	fmt.Fprintf(&tags, `<link rel="icon" href="%s" sizes="any">`, s.url("favicon.ico"))
+	fmt.Fprintf(&tags, "\n    "+`<link rel="apple-touch-icon" href="%s">`, s.url("apple-touch-icon.png"))
+	fmt.Fprintf(&tags, "\n    "+`<link rel="manifest" href="%s">`, s.url(manifestFile))
+	if s.Icons.ThemeColor != "" {
+		fmt.Fprintf(&tags, "\n    "+`<meta name="theme-color" content="%s">`, template.HTMLEscapeString(s.Icons.ThemeColor))
+	}
+	return template.HTML(tags.String())
+}
+
+// resizeIcon scales an image to a square of the given size
+func resizeIcon(src image.Image, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// encodeIcon returns the logo scaled to a size as PNG
+func encodeIcon(logo image.Image, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, resizeIcon(logo, size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %dpx icon: %w", size, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeFavicon returns an ICO file holding the logo at the favicon sizes.
+// The images are stored as PNG, which every current browser accepts.
+func encodeFavicon(logo image.Image) ([]byte, error) {
+	images := make([][]byte, len(faviconSizes))
+	for i, size := range faviconSizes {
+		data, err := encodeIcon(logo, size)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = data
+	}
+
+	var buf bytes.Buffer
+	// ICONDIR header: reserved, type 1 (icon), image count
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(images))})
+
+	offset := 6 + 16*len(images)
+	for i, size := range faviconSizes {
+		// ICONDIRENTRY: width, height, colors, reserved, planes, bits per
+		// pixel, data size and offset
+		buf.Write([]byte{byte(size), byte(size), 0, 0})
+		binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+		binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(len(images[i])), uint32(offset)})
+		offset += len(images[i])
+	}
+	for _, data := range images {
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
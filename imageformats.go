@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/webp"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	imageCacheDir       = ".mindoc/cache/images" // Directory where converted images are kept by source hash
+	defaultImageQuality = 75
+)
+
+// imageFormat is a format images can be converted to
+type imageFormat struct {
+	Type   string // Media type of the format
+	encode func(w io.Writer, img image.Image, quality int) error
+}
+
+// imageFormats are the formats images.formats may list, offered to
+// browsers in the order given there
+var imageFormats = map[string]imageFormat{
+	"avif": {Type: "image/avif", encode: func(w io.Writer, img image.Image, quality int) error {
+		return avif.Encode(w, img, avif.Options{Quality: quality, QualityAlpha: quality, Speed: 8})
+	}},
+	"webp": {Type: "image/webp", encode: func(w io.Writer, img image.Image, quality int) error {
+		return webp.Encode(w, img, webp.Options{Quality: quality, Method: 4})
+	}},
+}
+
+// convertedExts are the extensions of the images converted to the
+// configured formats
+var convertedExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// convertsImage reports whether a file of the content tree gets copies in
+// the configured formats. Animated GIFs and images matching a skip
+// pattern are left as they are.
+func (s *Site) convertsImage(file contentFile) bool {
+	if len(s.Images.Formats) == 0 || !convertedExts[strings.ToLower(path.Ext(file.RelPath))] || !s.isPassthrough(file.RelPath) {
+		return false
+	}
+	for _, pattern := range s.Images.Skip {
+		if ok, _ := path.Match(pattern, file.RelPath); ok {
+			return false
+		}
+		if ok, _ := path.Match(pattern, path.Base(file.RelPath)); ok {
+			return false
+		}
+	}
+	if strings.EqualFold(path.Ext(file.RelPath), ".gif") {
+		f, err := os.Open(file.SrcPath)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+		g, err := gif.DecodeAll(f)
+		if err != nil || len(g.Image) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// convertedPath returns where the copy of an image in a format is written,
+// next to the image with the format's extension added
+func convertedPath(relPath, format string) string {
+	return relPath + "." + format
+}
+
+// writeConvertedImages writes the copies of an image in the configured
+// formats, reusing them from the image cache while the image and the
+// quality are unchanged
+func (s *Site) writeConvertedImages(file contentFile) error {
+	quality := s.Images.Quality
+	if quality == 0 {
+		quality = defaultImageQuality
+	}
+	data, err := ioutil.ReadFile(file.SrcPath)
+	if err != nil {
+		return err
+	}
+
+	var img image.Image
+	for _, name := range s.Images.Formats {
+		format, ok := imageFormats[name]
+		if !ok {
+			return fmt.Errorf("unknown image format %q", name)
+		}
+
+		hash := sha256.Sum256(append(data, fmt.Sprintf("\x00%s\x00%d", name, quality)...))
+		cachePath := filepath.Join(imageCacheDir, hex.EncodeToString(hash[:])+"."+name)
+		converted, err := ioutil.ReadFile(cachePath)
+		if err != nil {
+			if img == nil {
+				img, _, err = image.Decode(bytes.NewReader(data))
+				if err != nil {
+					return fmt.Errorf("failed to decode: %w", err)
+				}
+			}
+			var buf bytes.Buffer
+			err = format.encode(&buf, img, quality)
+			if err != nil {
+				return fmt.Errorf("failed to encode as %s: %w", name, err)
+			}
+			converted = buf.Bytes()
+
+			err = os.MkdirAll(imageCacheDir, os.ModePerm)
+			if err == nil {
+				err = ioutil.WriteFile(cachePath, converted, 0644)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to cache converted image: %w", err)
+			}
+		}
+
+		err = s.output.WriteFile(convertedPath(file.RelPath, name), converted)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pictureSource is a converted copy of an image offered by a picture element
+type pictureSource struct {
+	URL  string
+	Type string
+}
+
+// pictureSources returns the converted copies of an image a page shows, or
+// nil when the image isn't converted
+func (s *Site) pictureSources(relPath, dest string) []pictureSource {
+	if strings.ContainsAny(dest, "#?") {
+		return nil
+	}
+	file, ok := s.imageFile(relPath, dest)
+	if !ok || !s.convertsImage(file) {
+		return nil
+	}
+	var sources []pictureSource
+	for _, name := range s.Images.Formats {
+		if format, ok := imageFormats[name]; ok {
+			sources = append(sources, pictureSource{URL: convertedPath(dest, name), Type: format.Type})
+		}
+	}
+	return sources
+}
+
+// kindPicture is the AST node kind of images offered in other formats too
+var kindPicture = ast.NewNodeKind("Picture")
+
+// pictureNode wraps an image in a picture element listing its converted
+// copies, which browsers pick before the image when they support them
+type pictureNode struct {
+	ast.BaseInline
+	Sources []pictureSource
+}
+
+// Kind returns the node kind of pictures
+func (n *pictureNode) Kind() ast.NodeKind {
+	return kindPicture
+}
+
+// Dump prints the picture for debugging
+func (n *pictureNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// pictureRenderer writes the HTML of pictures
+type pictureRenderer struct{}
+
+// RegisterFuncs registers the picture renderer with goldmark
+func (r pictureRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindPicture, r.render)
+}
+
+func (r pictureRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</picture>")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString("<picture>")
+	for _, src := range n.(*pictureNode).Sources {
+		fmt.Fprintf(w, `<source srcset="%s" type="%s">`, util.EscapeHTML(util.URLEscape([]byte(src.URL), false)), src.Type)
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif" // Pages may show GIF images
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	_ "golang.org/x/image/webp" // Pages may show WebP images
+)
+
+// markdownImage matches the destination of an image in a page source
+var markdownImage = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)`)
+
+// ImagesConfig decides how the images of pages are shown
+type ImagesConfig struct {
+	Lightbox  bool     `yaml:"lightbox"`  // Show images enlarged over the page when clicked
+	Eager     bool     `yaml:"eager"`     // Load images with the page instead of as they are scrolled to
+	Formats   []string `yaml:"formats"`   // Formats PNG, JPEG and GIF images are also written in and offered first, avif or webp
+	Quality   int      `yaml:"quality"`   // Quality of the converted images from 1 to 100, 75 when unset
+	Skip      []string `yaml:"skip"`      // Patterns of images left unconverted, such as "diagrams/*"; animated GIFs always are
+	InlineSVG int      `yaml:"inlineSVG"` // SVG images up to this many bytes are put into the page, sanitized, so CSS can style them
+}
+
+// kindFigure is the AST node kind of images shown as figures
+var kindFigure = ast.NewNodeKind("Figure")
+
+// figureNode is an image on a paragraph of its own with a title, shown as a
+// figure captioned with the title
+type figureNode struct {
+	ast.BaseBlock
+	Caption []byte
+}
+
+// Kind returns the node kind of figures
+func (n *figureNode) Kind() ast.NodeKind {
+	return kindFigure
+}
+
+// Dump prints the figure for debugging
+func (n *figureNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Caption": string(n.Caption)}, nil)
+}
+
+// imageTransformer turns titled images on a paragraph of their own into
+// figures, and gives images the attributes letting browsers lay out the
+// page before they load
+type imageTransformer struct {
+	site *Site
+}
+
+// Transform rewrites the images of a parsed page
+func (it imageTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	relPath, _ := pc.Get(pagePathKey).(string)
+
+	var images []*ast.Image
+	linked := make(map[*ast.Image]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			images = append(images, img)
+			_, linked[img] = img.Parent().(*ast.Link)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, img := range images {
+		if !it.site.Images.Eager {
+			img.SetAttributeString("loading", "lazy")
+			img.SetAttributeString("decoding", "async")
+		}
+		if width, height, ok := it.site.imageSize(relPath, string(img.Destination)); ok {
+			img.SetAttributeString("width", strconv.Itoa(width))
+			img.SetAttributeString("height", strconv.Itoa(height))
+		}
+		// Clicking a linked image follows the link
+		if it.site.Images.Lightbox && !linked[img] {
+			img.SetAttributeString("data-lightbox", "")
+		}
+
+		// Small SVG images go into the page, and converted copies are offered
+		// before other images
+		var node ast.Node = img
+		if svg, ok := it.site.inlineSVG(relPath, string(img.Destination), string(img.Text(reader.Source()))); ok {
+			node = &inlineSVGNode{SVG: svg}
+			img.Parent().ReplaceChild(img.Parent(), img, node)
+		} else if sources := it.site.pictureSources(relPath, string(img.Destination)); sources != nil {
+			picture := &pictureNode{Sources: sources}
+			img.Parent().ReplaceChild(img.Parent(), img, picture)
+			picture.AppendChild(picture, img)
+			node = picture
+		}
+
+		// The files were found from the destinations as written; the page
+		// links them from where it is written to
+		img.Destination = []byte(it.site.fileURL(relPath, string(img.Destination)))
+		if picture, ok := node.(*pictureNode); ok {
+			for i := range picture.Sources {
+				picture.Sources[i].URL = it.site.fileURL(relPath, picture.Sources[i].URL)
+			}
+		}
+
+		para, ok := node.Parent().(*ast.Paragraph)
+		if !ok || len(img.Title) == 0 || para.ChildCount() != 1 {
+			continue
+		}
+		figure := &figureNode{Caption: img.Title}
+		img.Title = nil
+		para.Parent().ReplaceChild(para.Parent(), para, figure)
+		figure.AppendChild(figure, node)
+	}
+}
+
+// imageSize returns the width and height of an image in the content tree,
+// given as a page links to it
+func (s *Site) imageSize(relPath, dest string) (int, int, bool) {
+	file, ok := s.imageFile(relPath, dest)
+	if !ok {
+		return 0, 0, false
+	}
+	f, err := os.Open(file.SrcPath)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// imageFile finds the file of the content tree an image of a page shows
+func (s *Site) imageFile(relPath, dest string) (contentFile, bool) {
+	if dest == "" || strings.Contains(dest, "://") || strings.HasPrefix(dest, "data:") {
+		return contentFile{}, false
+	}
+	if i := strings.IndexAny(dest, "#?"); i >= 0 {
+		dest = dest[:i]
+	}
+	target := path.Join(path.Dir(relPath), dest)
+	if strings.HasPrefix(dest, "/") {
+		target = strings.TrimPrefix(dest, strings.TrimSuffix(s.basePath, "/"))
+	}
+	target = strings.TrimPrefix(path.Clean(target), "/")
+
+	file, ok := s.filesByPath[target]
+	return file, ok
+}
+
+// imageStamps returns the size and modification time of the images a page
+// shows, whose dimensions end up in its HTML, so cached renderings are
+// redone when the images change
+func (s *Site) imageStamps(page *Page) map[string]string {
+	stamps := make(map[string]string)
+	for _, m := range markdownImage.FindAllSubmatch(page.body, -1) {
+		if file, ok := s.imageFile(page.Path, string(m[1])); ok {
+			stamps[file.RelPath] = fmt.Sprintf("%d %d", file.Info.Size(), file.Info.ModTime().UnixNano())
+		}
+	}
+	return stamps
+}
+
+// figureRenderer writes the HTML of figures
+type figureRenderer struct{}
+
+// RegisterFuncs registers the figure renderer with goldmark
+func (r figureRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindFigure, r.render)
+}
+
+func (r figureRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<figure>\n")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString("\n<figcaption>")
+	html.DefaultWriter.Write(w, n.(*figureNode).Caption)
+	w.WriteString("</figcaption>\n</figure>\n")
+	return ast.WalkContinue, nil
+}
+
+// lightboxTag returns the script showing images enlarged when the site has
+// the lightbox on
+func (s *Site) lightboxTag() template.HTML {
+	if !s.Images.Lightbox {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<script src="%s" defer></script>`, template.HTMLEscapeString(s.url(cssDestDir+"/lightbox.js"))))
+}
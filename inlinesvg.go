@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// svgDroppedElements are the SVG elements left out of inlined images, with
+// everything inside them, since they can run scripts or embed HTML
+var svgDroppedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// svgURLAttributes are the attributes whose values are dropped when they
+// hold a script URL, including those animations set other attributes to
+var svgURLAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"to":     true,
+	"from":   true,
+	"values": true,
+	"by":     true,
+}
+
+// inlineSVG returns the SVG an image of a page shows, sanitized to be put
+// into the page, when it is a file of the content tree small enough to be
+// inlined
+func (s *Site) inlineSVG(relPath, dest, alt string) ([]byte, bool) {
+	if s.Images.InlineSVG <= 0 || !strings.EqualFold(path.Ext(strings.SplitN(dest, "?", 2)[0]), ".svg") {
+		return nil, false
+	}
+	file, ok := s.imageFile(relPath, dest)
+	if !ok || file.Info.Size() > int64(s.Images.InlineSVG) {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(file.SrcPath)
+	if err != nil {
+		return nil, false
+	}
+	svg, err := sanitizeSVG(data, alt)
+	if err != nil {
+		return nil, false
+	}
+	return svg, true
+}
+
+// sanitizeSVG rewrites an SVG document as an svg element that is safe to
+// put into a page: scripts, embedded HTML, event handlers and script URLs
+// are left out, as are the XML declaration, doctype and comments. The
+// image is labelled with its alt text, or hidden from screen readers
+// without one.
+func sanitizeSVG(data []byte, alt string) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	depth, skip := 0, 0
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || svgDroppedElements[strings.ToLower(t.Name.Local)] {
+				skip++
+				continue
+			}
+			if depth == 0 && t.Name.Local != "svg" {
+				return nil, fmt.Errorf("not an SVG image")
+			}
+			out.WriteString("<" + xmlName(t.Name))
+			for _, attr := range t.Attr {
+				name := strings.ToLower(attr.Name.Local)
+				if strings.HasPrefix(name, "on") || svgURLAttributes[name] && isScriptURL(attr.Value) {
+					continue
+				}
+				if depth == 0 && (name == "role" || strings.HasPrefix(name, "aria-")) {
+					continue
+				}
+				fmt.Fprintf(&out, ` %s="%s"`, xmlName(attr.Name), template.HTMLEscapeString(attr.Value))
+			}
+			if depth == 0 {
+				if alt == "" {
+					out.WriteString(` aria-hidden="true"`)
+				} else {
+					fmt.Fprintf(&out, ` role="img" aria-label="%s"`, template.HTMLEscapeString(alt))
+				}
+			}
+			out.WriteString(">")
+			depth++
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			depth--
+			out.WriteString("</" + xmlName(t.Name) + ">")
+		case xml.CharData:
+			if skip == 0 && depth > 0 {
+				out.WriteString(template.HTMLEscapeString(string(t)))
+			}
+		}
+	}
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("not an SVG image")
+	}
+	return out.Bytes(), nil
+}
+
+// xmlName writes an element or attribute name with its prefix
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// isScriptURL reports whether a URL runs a script when followed, ignoring
+// the whitespace and control characters browsers skip in the scheme
+func isScriptURL(value string) bool {
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+	return strings.Contains(scheme, "javascript:") || strings.Contains(scheme, "vbscript:") || strings.HasPrefix(scheme, "data:text/html")
+}
+
+// kindInlineSVG is the AST node kind of SVG images put into the page
+var kindInlineSVG = ast.NewNodeKind("InlineSVG")
+
+// inlineSVGNode is an SVG image of the content tree written into the page
+// instead of being linked, so the page's CSS can style it
+type inlineSVGNode struct {
+	ast.BaseInline
+	SVG []byte // Sanitized svg element
+}
+
+// Kind returns the node kind of inlined SVG images
+func (n *inlineSVGNode) Kind() ast.NodeKind {
+	return kindInlineSVG
+}
+
+// Dump prints the inlined SVG image for debugging
+func (n *inlineSVGNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// inlineSVGRenderer writes inlined SVG images
+type inlineSVGRenderer struct{}
+
+// RegisterFuncs registers the inlined SVG renderer with goldmark
+func (r inlineSVGRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindInlineSVG, r.render)
+}
+
+func (r inlineSVGRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.Write(n.(*inlineSVGNode).SVG)
+	}
+	return ast.WalkSkipChildren, nil
+}
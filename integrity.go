@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	assetCacheDir = ".mindoc/cache/assets" // Directory where external scripts and stylesheets are kept by URL
+	vendorDir     = "vendor"               // Output directory of vendored scripts and stylesheets
+)
+
+// IntegrityConfig decides what happens to the external scripts and
+// stylesheets pages load
+type IntegrityConfig struct {
+	Mode string   `yaml:"mode"` // hash to add integrity attributes, vendor to copy the files into the site, or empty to leave them
+	Skip []string `yaml:"skip"` // URL prefixes left alone, for files that change under the same URL
+}
+
+var (
+	externalAssetTag = regexp.MustCompile(`(?is)<(script|link)\b[^>]*>`)
+	tagAttribute     = regexp.MustCompile(`(?is)\s([a-z][\w:-]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+)
+
+// externalAsset is a script or stylesheet of another site, fetched once per
+// build
+type externalAsset struct {
+	data []byte
+	err  error
+}
+
+// secureExternalAssets gives the external scripts and stylesheets of a
+// rendered page integrity attributes, or points them at copies in the
+// site, depending on the integrity mode. Tags that already have an
+// integrity attribute are left alone.
+func (s *Site) secureExternalAssets(page string) string {
+	if s.Integrity.Mode == "" {
+		return page
+	}
+	return externalAssetTag.ReplaceAllStringFunc(page, func(tag string) string {
+		attrs := make(map[string]string)
+		for _, m := range tagAttribute.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		if _, ok := attrs["integrity"]; ok {
+			return tag
+		}
+		attr := "src"
+		if strings.HasPrefix(strings.ToLower(tag), "<link") {
+			if !strings.EqualFold(strings.TrimSpace(attrs["rel"]), "stylesheet") {
+				return tag
+			}
+			attr = "href"
+		}
+		assetURL, ok := s.externalAssetURL(attrs[attr])
+		if !ok {
+			return tag
+		}
+
+		asset := s.fetchExternalAsset(assetURL)
+		if asset.err != nil {
+			return tag
+		}
+		if s.Integrity.Mode == "vendor" {
+			return replaceAttribute(tag, attr, s.url(vendorPath(assetURL)))
+		}
+		sum := sha512.Sum384(asset.data)
+		extra := fmt.Sprintf(` integrity="sha384-%s"`, base64.StdEncoding.EncodeToString(sum[:]))
+		if _, ok := attrs["crossorigin"]; !ok {
+			extra += ` crossorigin="anonymous"`
+		}
+		end := len(tag) - 1
+		if strings.HasSuffix(tag, "/>") {
+			end--
+		}
+		return tag[:end] + extra + tag[end:]
+	})
+}
+
+// externalAssetURL returns the absolute URL of a script or stylesheet of
+// another site, reporting false for the site's own files and skipped URLs
+func (s *Site) externalAssetURL(ref string) (*url.URL, bool) {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "//") {
+		ref = "https:" + ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false
+	}
+	if base, err := url.Parse(s.BaseURL); err == nil && strings.EqualFold(base.Host, u.Host) {
+		return nil, false
+	}
+	for _, prefix := range s.Integrity.Skip {
+		if strings.HasPrefix(ref, prefix) {
+			return nil, false
+		}
+	}
+	return u, true
+}
+
+// fetchExternalAsset returns an external script or stylesheet, from the
+// asset cache when it was fetched by an earlier build. In vendor mode the
+// file is also written to the output.
+func (s *Site) fetchExternalAsset(u *url.URL) *externalAsset {
+	if asset, ok := s.externalAssets[u.String()]; ok {
+		return asset
+	}
+	asset := &externalAsset{}
+	s.externalAssets[u.String()] = asset
+
+	hash := sha256.Sum256([]byte(u.String()))
+	cachePath := filepath.Join(assetCacheDir, hex.EncodeToString(hash[:]))
+	asset.data, asset.err = ioutil.ReadFile(cachePath)
+	if asset.err != nil {
+		asset.data, asset.err = downloadAsset(u.String())
+		if asset.err == nil {
+			asset.err = os.MkdirAll(assetCacheDir, os.ModePerm)
+		}
+		if asset.err == nil {
+			asset.err = ioutil.WriteFile(cachePath, asset.data, 0644)
+		}
+	}
+	if asset.err == nil && s.Integrity.Mode == "vendor" {
+		asset.err = s.output.WriteFile(vendorPath(u), asset.data)
+	}
+	if asset.err != nil {
+		log.Printf("Failed to fetch %s, leaving it as it is: %v", u, asset.err)
+	}
+	return asset
+}
+
+// downloadAsset fetches a file of another site
+func downloadAsset(assetURL string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(assetURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// vendorPath returns where the copy of an external file is written in the
+// output, below the vendor directory by host and path. A query string
+// becomes part of the name.
+func vendorPath(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if p == "/" || strings.HasSuffix(u.Path, "/") {
+		p = path.Join(p, "index")
+	}
+	if u.RawQuery != "" {
+		hash := sha256.Sum256([]byte(u.RawQuery))
+		ext := path.Ext(p)
+		p = strings.TrimSuffix(p, ext) + "-" + hex.EncodeToString(hash[:4]) + ext
+	}
+	return vendorDir + "/" + strings.ToLower(strings.ReplaceAll(u.Host, ":", "-")) + p
+}
+
+// replaceAttribute sets an attribute of an HTML tag to a new value
+func replaceAttribute(tag, name, value string) string {
+	done := false
+	return tagAttribute.ReplaceAllStringFunc(tag, func(attr string) string {
+		m := tagAttribute.FindStringSubmatch(attr)
+		if done || !strings.EqualFold(m[1], name) {
+			return attr
+		}
+		done = true
+		return fmt.Sprintf(` %s="%s"`, m[1], strings.ReplaceAll(value, `"`, "&#34;"))
+	})
+}
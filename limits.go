@@ -0,0 +1,180 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/netutil"
+)
+
+const defaultReadHeaderTimeout = 10 * time.Second // Time clients get to send request headers when unset
+
+// ServerConfig protects the built-in server when it is served publicly
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration   `yaml:"readHeaderTimeout"` // Time clients get to send the request headers, 10s when unset
+	ReadTimeout       time.Duration   `yaml:"readTimeout"`       // Time clients get to send the whole request, unlimited when unset
+	WriteTimeout      time.Duration   `yaml:"writeTimeout"`      // Time a response may take to be sent, unlimited when unset
+	IdleTimeout       time.Duration   `yaml:"idleTimeout"`       // Time idle keep-alive connections are kept open, the read timeout when unset
+	MaxHeaderBytes    int             `yaml:"maxHeaderBytes"`    // Largest request headers accepted, 1MB when unset
+	MaxBodyBytes      int64           `yaml:"maxBodyBytes"`      // Largest request body accepted, unlimited when unset
+	MaxConnections    int             `yaml:"maxConnections"`    // Connections served at once on each socket, unlimited when unset
+	RateLimit         RateLimitConfig `yaml:"rateLimit"`         // Requests each client may make
+}
+
+// RateLimitConfig limits how often each client may make requests, by IP
+// address. Clients going over it get 429 Too Many Requests.
+type RateLimitConfig struct {
+	Requests          float64 `yaml:"requests"`          // Requests per second each client may make on average, unlimited when unset
+	Burst             int     `yaml:"burst"`             // Requests a client may make at once, twice the rate when unset
+	TrustForwardedFor bool    `yaml:"trustForwardedFor"` // Tell clients apart by the address the proxy in front adds to X-Forwarded-For
+}
+
+// newServer returns the server of the sites with the configured timeouts
+// and header size limit
+func newServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// limitRequests applies the configured rate and request body limits
+func limitRequests(cfg ServerConfig, handler http.Handler) http.Handler {
+	if cfg.MaxBodyBytes > 0 {
+		handler = limitBodies(handler, cfg.MaxBodyBytes)
+	}
+	if cfg.RateLimit.Requests > 0 {
+		handler = newRateLimiter(cfg.RateLimit).limit(handler)
+	}
+	return handler
+}
+
+// limitListener caps the connections served at once, when configured to.
+// Connections over the limit wait to be accepted.
+func limitListener(cfg ServerConfig, ln net.Listener) net.Listener {
+	if cfg.MaxConnections <= 0 {
+		return ln
+	}
+	return netutil.LimitListener(ln, cfg.MaxConnections)
+}
+
+// limitBodies refuses request bodies larger than the limit
+func limitBodies(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter gives every client a bucket of tokens that refills at the
+// configured rate, with each request taking one
+type rateLimiter struct {
+	rate              float64 // Tokens added per second
+	burst             float64 // Tokens a bucket holds at most
+	trustForwardedFor bool
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket // Buckets of the clients seen lately
+	lastSweep time.Time               // When full buckets were last removed
+}
+
+// tokenBucket is a client's tokens as of the time they were last counted
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns the rate limiter of a configuration
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(2*cfg.Requests))
+	}
+	return &rateLimiter{
+		rate:              cfg.Requests,
+		burst:             burst,
+		trustForwardedFor: cfg.TrustForwardedFor,
+		buckets:           make(map[string]*tokenBucket),
+		lastSweep:         time.Now(),
+	}
+}
+
+// limit answers requests of clients over the limit with 429 Too Many
+// Requests. Health checks are never limited, so probes keep working while
+// the server is busy.
+func (rl *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != healthPath && r.URL.Path != readyPath && !rl.allow(rl.client(r)) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from a client's bucket, reporting whether it had one
+func (rl *rateLimiter) allow(client string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	// Buckets that have refilled are the same as new ones
+	refill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for client, b := range rl.buckets {
+			if now.Sub(b.last) > refill {
+				delete(rl.buckets, client)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b := rl.buckets[client]
+	if b == nil {
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// client returns the address a request is limited by. Behind a trusted
+// proxy that's the last address of X-Forwarded-For, which the proxy added.
+func (rl *rateLimiter) client(r *http.Request) string {
+	if rl.trustForwardedFor {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+			if addr := strings.TrimSpace(addrs[len(addrs)-1]); addr != "" {
+				return addr
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// linkIssue is a link of a generated page to a file or anchor that doesn't
+// exist
+type linkIssue struct {
+	Page    string // Source path of the page within the content tree
+	Message string
+}
+
+// linkTargets reads the anchors of the generated pages links point to,
+// reading each page once
+type linkTargets struct {
+	dir     string
+	anchors map[string]map[string]bool // IDs and names of each page, nil for files that aren't HTML
+	missing map[string]bool
+}
+
+// checkLinks checks that every link of the pages written by the last build
+// to another file of the site leads to one, and that links with a fragment,
+// such as install.html#configuration, lead to an element with that ID. The
+// links are read from the generated HTML, so they are checked against the
+// heading IDs the pages actually got.
+func (s *Site) checkLinks() ([]linkIssue, error) {
+	targets := &linkTargets{dir: s.OutputDir, anchors: make(map[string]map[string]bool), missing: make(map[string]bool)}
+	var issues []linkIssue
+
+	for _, meta := range s.renderedPages {
+		f, err := os.Open(meta.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", meta.Output, err)
+		}
+		doc, err := html.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", meta.Output, err)
+		}
+		// Generated pages have no source, so the page is known by its output
+		rel, err := filepath.Rel(s.OutputDir, meta.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate %s: %w", meta.Output, err)
+		}
+		self := filepath.ToSlash(rel)
+		targets.anchors[self] = documentAnchors(doc)
+		page := s.checkedPage(meta)
+
+		for _, href := range documentLinks(doc) {
+			target, fragment, ok := s.linkTarget(meta.URL, href)
+			if !ok {
+				continue
+			}
+			if target == "" {
+				target = self
+			}
+
+			anchors, exists := targets.lookup(target)
+			switch {
+			case !exists:
+				issues = append(issues, linkIssue{Page: page, Message: fmt.Sprintf("link to %s: no such file", href)})
+			case fragment != "" && fragment != "top" && anchors != nil && !anchors[fragment]:
+				issues = append(issues, linkIssue{Page: page, Message: fmt.Sprintf("link to %s: %s has no anchor #%s", href, target, fragment)})
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// linkTarget returns the path within the output a link of the page at
+// pageURL leads to, "" for the page itself, and its fragment. ok is false
+// for links outside the site, such as to other sites or mailto: links.
+func (s *Site) linkTarget(pageURL, href string) (target, fragment string, ok bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", "", false
+	}
+	fragment = ref.Fragment
+	if ref.Scheme == "" && ref.Host == "" && ref.Path == "" {
+		return "", fragment, ref.RawQuery == ""
+	}
+
+	// Absolute links to the site's own host are checked too
+	if ref.Scheme != "" || ref.Host != "" {
+		base, err := url.Parse(s.BaseURL)
+		if err != nil || base.Host == "" || !strings.EqualFold(ref.Host, base.Host) || (ref.Scheme != "http" && ref.Scheme != "https") {
+			return "", "", false
+		}
+	}
+
+	resolved := (&url.URL{Path: pageURL}).ResolveReference(&url.URL{Path: ref.Path})
+	if !strings.HasPrefix(resolved.Path, s.basePath) {
+		return "", "", false
+	}
+	target = strings.TrimPrefix(resolved.Path, s.basePath)
+	if target == "" || strings.HasSuffix(target, "/") {
+		target += "index.html"
+	}
+	return target, fragment, true
+}
+
+// lookup reports whether a file exists within the output, with the anchors
+// it has when it is an HTML page. A link to a directory leads to its
+// index.html.
+func (t *linkTargets) lookup(target string) (map[string]bool, bool) {
+	if anchors, ok := t.anchors[target]; ok {
+		return anchors, true
+	}
+	if t.missing[target] {
+		return nil, false
+	}
+
+	filePath := filepath.Join(t.dir, filepath.FromSlash(target))
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		return t.lookup(path.Join(target, "index.html"))
+	}
+	if err != nil {
+		t.missing[target] = true
+		return nil, false
+	}
+
+	var anchors map[string]bool
+	if ext := strings.ToLower(path.Ext(target)); ext == ".html" || ext == ".htm" {
+		f, err := os.Open(filePath)
+		if err == nil {
+			doc, parseErr := html.Parse(f)
+			f.Close()
+			if parseErr == nil {
+				anchors = documentAnchors(doc)
+			}
+		}
+	}
+	t.anchors[target] = anchors
+	return anchors, true
+}
+
+// documentAnchors returns the IDs of the elements of a parsed page, and the
+// names of its <a name> anchors
+func documentAnchors(doc *html.Node) map[string]bool {
+	anchors := make(map[string]bool)
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id := attr(n, "id"); id != "" {
+				anchors[id] = true
+			}
+			if name := attr(n, "name"); name != "" && n.Data == "a" {
+				anchors[name] = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return anchors
+}
+
+// documentLinks returns the href of every link and the src of every image
+// of a parsed page
+func documentLinks(doc *html.Node) []string {
+	var links []string
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "area") {
+			if href, ok := attrValue(n, "href"); ok {
+				links = append(links, href)
+			}
+		}
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if src, ok := attrValue(n, "src"); ok {
+				links = append(links, src)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return links
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixPrefix     = "unix:" // Prefix of listen addresses that are unix socket paths
+	systemdFirstFD = 3       // First file descriptor of the sockets systemd passes on
+	socketPermBits = 0777    // Permission bits a socket mode may set
+)
+
+// listen opens the sockets the server is reached through. Sockets passed
+// on by systemd socket activation are used when there are any, otherwise
+// the -listen address, which is a unix socket path when it starts with
+// "unix:". With -acme the HTTPS port is the default.
+func listen() ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil || len(listeners) > 0 {
+		return listeners, err
+	}
+
+	addr := *listenAddr
+	if *acmeMode && !flagGiven("listen") {
+		addr = defaultACMEListen
+	}
+	if !strings.HasPrefix(addr, unixPrefix) {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+
+	socketPath := strings.TrimPrefix(addr, unixPrefix)
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil || mode&^socketPermBits != 0 {
+		return nil, fmt.Errorf("invalid socket mode %q", *socketMode)
+	}
+	// A socket left behind by a server that didn't shut down cleanly would
+	// stop a new one from being made
+	if info, err := os.Lstat(socketPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(socketPath)
+	}
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(socketPath, os.FileMode(mode))
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket mode: %w", err)
+	}
+	return []net.Listener{ln}, nil
+}
+
+// systemdListeners returns the sockets systemd passed on to this process,
+// following the sd_listen_fds protocol. The variables describing them are
+// unset, so hooks and other commands run by the build don't take them for
+// their own.
+func systemdListeners() ([]net.Listener, error) {
+	pid, pidErr := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, countErr := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pidErr != nil || countErr != nil || pid != os.Getpid() || count <= 0 {
+		return nil, nil
+	}
+
+	var listeners []net.Listener
+	for fd := systemdFirstFD; fd < systemdFirstFD+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("failed to use socket %d passed on by systemd, it must be a stream socket: %w", fd, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// listenURL returns the URL the server can be reached at from this
+// machine, for the messages saying where the sites are served. Unix
+// sockets are given the way nginx's proxy_pass takes them, and with -acme
+// it is the URL of the first domain.
+func listenURL(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return "http://" + unixPrefix + addr.String() + ":"
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "http://" + addr.String()
+	}
+	if domains := acmeDomains(); *acmeMode && len(domains) > 0 {
+		if port == "443" {
+			return "https://" + domains[0]
+		}
+		return "https://" + net.JoinHostPort(domains[0], port)
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// flagGiven reports whether a flag was set, on the command line or from
+// the environment
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
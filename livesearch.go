@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	searchPath         = "__search" // Path of the serve-mode search endpoint below the site's base path
+	searchResultLimit  = 10         // Results returned when the request doesn't ask for a number
+	searchResultMax    = 50         // Results returned at most
+	searchExcerptRunes = 160        // Length of the text excerpt of each result
+)
+
+// liveSearch searches the records of a site's latest build, for the search
+// endpoint of the built-in server
+type liveSearch struct {
+	records []searchRecord
+	words   []map[string]int  // Words of each record's text, with how often they occur
+	titles  []map[string]bool // Words of each record's page title and headings
+}
+
+// searchResult is a record matching a query, as the search endpoint
+// returns it
+type searchResult struct {
+	URL      string   `json:"url"`
+	Page     string   `json:"page"`
+	Title    string   `json:"title"`
+	Section  string   `json:"section,omitempty"`
+	Headings []string `json:"headings"`
+	Excerpt  string   `json:"excerpt"`
+	Score    float64  `json:"score"`
+}
+
+// newLiveSearch indexes the records of a build
+func newLiveSearch(records []searchRecord) *liveSearch {
+	ls := &liveSearch{
+		records: records,
+		words:   make([]map[string]int, len(records)),
+		titles:  make([]map[string]bool, len(records)),
+	}
+	for i, record := range records {
+		ls.words[i] = make(map[string]int)
+		for _, word := range searchWords(record.Text) {
+			ls.words[i][word]++
+		}
+		ls.titles[i] = make(map[string]bool)
+		for _, text := range append([]string{record.Title}, record.Headings...) {
+			for _, word := range searchWords(text) {
+				ls.titles[i][word] = true
+			}
+		}
+	}
+	return ls
+}
+
+// search returns the records containing every word of a query, best
+// matches first. The last word also matches the words it starts, so
+// results show up while the query is being typed.
+func (ls *liveSearch) search(query string, limit int) []searchResult {
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		return []searchResult{}
+	}
+
+	results := []searchResult{}
+	for i, record := range ls.records {
+		score := 0.0
+		for j, term := range terms {
+			termScore := ls.termScore(i, term, j == len(terms)-1)
+			if termScore == 0 {
+				score = 0
+				break
+			}
+			score += termScore
+		}
+		if score == 0 {
+			continue
+		}
+		results = append(results, searchResult{
+			URL:      record.URL,
+			Page:     record.Page,
+			Title:    record.Title,
+			Section:  record.Section,
+			Headings: record.Headings,
+			Excerpt:  searchExcerpt(record.Text, terms),
+			Score:    math.Round(score*1000) / 1000,
+		})
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// termScore rates how well a record matches a word of a query, 0 when it
+// doesn't. Words in the title and headings count for more than ones in the
+// text, and whole words for more than ones only started.
+func (ls *liveSearch) termScore(i int, term string, prefix bool) float64 {
+	score := 0.0
+	if ls.titles[i][term] {
+		score += 5
+	}
+	if n := ls.words[i][term]; n > 0 {
+		score += 1 + math.Log(float64(n))
+	}
+	if score > 0 || !prefix {
+		return score
+	}
+
+	for word := range ls.titles[i] {
+		if strings.HasPrefix(word, term) {
+			score = 2.5
+			break
+		}
+	}
+	for word, n := range ls.words[i] {
+		if strings.HasPrefix(word, term) {
+			score += 0.5 + math.Log(float64(n))/2
+			break
+		}
+	}
+	return score
+}
+
+// searchWords splits text into lower case words
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchExcerpt returns the part of a record's text around the first word
+// of the query it contains, or its start
+func searchExcerpt(text string, terms []string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	lowerText := string(lower)
+	start := 0
+	for _, term := range terms {
+		if at := strings.Index(lowerText, term); at >= 0 {
+			start = utf8.RuneCountInString(lowerText[:at])
+			break
+		}
+	}
+
+	// Start a little before the match, at a word boundary
+	start = max(0, start-searchExcerptRunes/4)
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	end := min(len(runes), start+searchExcerptRunes)
+	for end < len(runes) && !unicode.IsSpace(runes[end]) {
+		end++
+	}
+
+	excerpt := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+// updateLiveSearch indexes the latest build for the search endpoint, when
+// the site is being served
+func (s *Site) updateLiveSearch() {
+	if s.indexing {
+		s.liveSearch.Store(newLiveSearch(s.searchRecords()))
+	}
+}
+
+// serveSearch answers search queries from the index of the site's latest
+// build, for themes searching as the reader types. The q parameter is the
+// query and limit the number of results.
+func (s *Site) serveSearch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ls := s.liveSearch.Load()
+		if ls == nil {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, s.label()+" has no search index until it is built", http.StatusServiceUnavailable)
+			return
+		}
+
+		limit := searchResultLimit
+		if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+			limit = min(n, searchResultMax)
+		}
+		query := r.URL.Query().Get("q")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Query   string         `json:"query"`
+			Results []searchResult `json:"results"`
+		}{query, ls.search(query, limit)})
+	})
+}
+
+// writeSearchIndex writes the site's search records as a JSON file, for
+// themes to search in the browser where there is no search endpoint
+func (s *Site) writeSearchIndex() error {
+	if s.Search.Static == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.searchRecords())
+	if err != nil {
+		return err
+	}
+	return s.output.WriteFile(s.Search.Static, data)
+}
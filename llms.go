@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	llmsFile     = "llms.txt"      // Index of the site for language models
+	llmsFullFile = "llms-full.txt" // Every page of the site in one file
+)
+
+// LLMsConfig controls the llms.txt files that let AI tools read the site
+type LLMsConfig struct {
+	Enabled     bool     `yaml:"enabled"`     // Write llms.txt, llms-full.txt and the page mirrors
+	Description string   `yaml:"description"` // Summary of the site quoted at the top of llms.txt
+	Mirrors     []string `yaml:"mirrors"`     // Formats every page is also written in, md when unset
+}
+
+// llmsMirrors returns the formats every page is mirrored in
+func (s *Site) llmsMirrors() ([]string, error) {
+	if s.LLMs.Mirrors == nil {
+		return []string{"md"}, nil
+	}
+	return parseOutputs(s.LLMs.Mirrors)
+}
+
+// addLLMsMirrors adds the mirror formats to the outputs of every visible
+// page, so a plain copy is written next to its HTML
+func (s *Site) addLLMsMirrors() error {
+	if !s.LLMs.Enabled {
+		return nil
+	}
+
+	mirrors, err := s.llmsMirrors()
+	if err != nil {
+		return fmt.Errorf("invalid llms mirrors: %w", err)
+	}
+
+	for _, page := range s.pages {
+		if page.Hidden || page.protected() {
+			continue
+		}
+		for _, format := range mirrors {
+			if !slices.Contains(page.Outputs, format) {
+				page.Outputs = append(page.Outputs, format)
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeLLMs writes llms.txt, listing the pages by section with links to
+// their plain mirrors, and llms-full.txt with the source of every page
+func (s *Site) writeLLMs() error {
+	if !s.LLMs.Enabled {
+		return nil
+	}
+
+	mirrors, err := s.llmsMirrors()
+	if err != nil {
+		return fmt.Errorf("invalid llms mirrors: %w", err)
+	}
+
+	name := s.Name
+	if name == "" {
+		name = "Documentation"
+	}
+	var index, full strings.Builder
+	for _, out := range []*strings.Builder{&index, &full} {
+		fmt.Fprintf(out, "# %s\n\n", name)
+		if s.LLMs.Description != "" {
+			fmt.Fprintf(out, "> %s\n\n", s.LLMs.Description)
+		}
+	}
+
+	// Index pages give their sections a title
+	sectionTitles := make(map[string]string)
+	for _, page := range s.pages {
+		if path.Base(page.Path) == sectionIndexFile && page.Section != "" && path.Dir(page.Path) == page.Section {
+			sectionTitles[page.Section] = page.navTitle()
+		}
+	}
+
+	// Pages at the root come first, then each section in page order
+	sections := []string{""}
+	links := make(map[string][]string)
+	for _, page := range s.pages {
+		if page.Hidden || page.protected() {
+			continue
+		}
+
+		link := page.URL
+		if len(mirrors) > 0 {
+			link = s.url(formatPath(s.outputPath(page.Path), outputFormats[mirrors[0]]))
+		}
+		line := fmt.Sprintf("- [%s](%s)", page.navTitle(), s.absURL(link))
+		if description, ok := page.Params["description"].(string); ok && description != "" {
+			line += ": " + description
+		}
+		if _, ok := links[page.Section]; !ok && page.Section != "" {
+			sections = append(sections, page.Section)
+		}
+		links[page.Section] = append(links[page.Section], line)
+
+		if s.isMarkdown(page.Path) {
+			fmt.Fprintf(&full, "---\n\nURL: %s\n\n%s\n\n", s.absURL(page.URL), strings.TrimSpace(string(page.body)))
+		}
+	}
+
+	for _, section := range sections {
+		if len(links[section]) == 0 {
+			continue
+		}
+		if section != "" {
+			title, ok := sectionTitles[section]
+			if !ok {
+				title = humanize(section)
+			}
+			fmt.Fprintf(&index, "## %s\n\n", title)
+		}
+		index.WriteString(strings.Join(links[section], "\n") + "\n\n")
+	}
+
+	err = s.output.WriteFile(llmsFile, []byte(index.String()))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", llmsFile, err)
+	}
+	err = s.output.WriteFile(llmsFullFile, []byte(full.String()))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", llmsFullFile, err)
+	}
+
+	return nil
+}
+
+// absURL returns a URL path of the site with the scheme and host of the
+// base URL, or the path alone when the base URL has no host
+func (s *Site) absURL(urlPath string) string {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil || u.Host == "" {
+		return urlPath
+	}
+	return u.Scheme + "://" + u.Host + urlPath
+}
@@ -1,15 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
 	"io"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
 
+	"github.com/blevesearch/bleve/v2"
 	"github.com/yuin/goldmark"
 )
 
@@ -21,193 +34,1030 @@ const (
 	cssDestDir   = "css"       // Destination directory within the output directory
 )
 
+var (
+	// configPath is the config file describing the site(s) to build
+	configPath = flag.String("config", defaultConfigFile, "path to the config file")
+
+	// strictMode makes build diagnostics fatal instead of just reported
+	strictMode = flag.Bool("strict", false, "fail the build when diagnostics find problems")
+
+	// memoryMode keeps the generated sites in memory instead of writing them
+	memoryMode = flag.Bool("memory", false, "serve the sites from memory without writing the output directories")
+
+	// rebuildEvery regenerates the served sites periodically
+	rebuildEvery = flag.Duration("rebuild-every", 0, "rebuild the served sites at this interval, such as 1h")
+
+	// listenAddr is the address the sites are served on
+	listenAddr = flag.String("listen", ":8080", "address to serve the sites on, all interfaces unless a host is given, or unix:path for a unix socket")
+
+	// socketMode is the permissions of the unix socket the server listens on
+	socketMode = flag.String("socket-mode", "0660", "permissions of the unix socket, in octal")
+
+	// buildOnStart generates the sites before they are served, instead of
+	// serving the output directories as they are, such as ones built into
+	// a container image
+	buildOnStart = flag.Bool("build-on-start", true, "generate the sites before serving them")
+
+	// accessLogFormat writes a line about every request the server answers
+	accessLogFormat = flag.String("access-log", "", "log every request to stdout, as text or json")
+
+	// acmeMode serves the sites over HTTPS with certificates from Let's Encrypt
+	acmeMode = flag.Bool("acme", false, "serve over HTTPS with certificates obtained and renewed from Let's Encrypt")
+
+	// acmeDomain names the domains certificates are obtained for
+	acmeDomain = flag.String("domain", "", "comma-separated domain names to get certificates for with -acme")
+
+	// acmeEmail is the contact address of the Let's Encrypt account
+	acmeEmail = flag.String("acme-email", "", "address Let's Encrypt sends notices about the certificates to")
+
+	// acmeCache is where certificates are kept between runs
+	acmeCache = flag.String("acme-cache", "", "directory the certificates are kept in, in the user cache directory when unset")
+
+	// acmeHTTP is the address answering HTTP challenges and redirecting to HTTPS
+	acmeHTTP = flag.String("acme-http", ":80", "address answering HTTP challenges and redirecting to HTTPS with -acme, none when empty")
+
+	// serveMetrics adds the Prometheus metrics endpoint to the server
+	serveMetrics = flag.Bool("metrics", false, "serve request and build metrics for Prometheus at /metrics")
+)
+
+// Site is a single documentation site being built
+type Site struct {
+	SiteConfig
+
+	theme   *Theme                 // Look of the generated pages
+	page    *template.Template     // Page template bound to this site
+	formats *texttemplate.Template // Output format templates bound to this site
+
+	goldmarkOptions []goldmark.Option // Options the markdown converter is created with
+	markdown        goldmark.Markdown // Converts the site's markdown to HTML
+
+	renderers       map[string]contentRenderer            // Renderer for each non-markdown page file extension
+	markdownConfigs map[string]RendererConfig             // Settings for each markdown page file extension
+	converters      map[markdownFlavour]goldmark.Markdown // Markdown converters made so far
+	graphqlExts     map[string]bool                       // Extensions of the GraphQL schemas rendered as reference pages
+	sections        map[string]SectionConfig              // Section settings by content tree directory
+	replacers       []replacer                            // Compiled replacement rules
+	cache           *renderCache                          // Cache of rendered page bodies, nil when disabled
+	basePath        string                                // URL path the site is served under, always ending in "/"
+
+	files               []contentFile              // Files of the content tree, listed once per build
+	filesByPath         map[string]contentFile     // Files of the content tree by path, the first one when mounts overlap
+	pages               Pages                      // Pages of the content tree
+	upcoming            Pages                      // Pages left out of the current build until their publishDate
+	expired             Pages                      // Pages left out of the current build since their expiryDate
+	authors             []*Author                  // Authors of the published pages, by name
+	series              []*Series                  // Series of the published pages, by name
+	glossary            *glossary                  // Glossary terms marked up in pages, nil when there is none
+	bibliography        map[string]*bibEntry       // Works pages can cite, by key
+	abbreviations       map[string]string          // Abbreviations every page gets, with what they stand for
+	abbreviationPattern *regexp.Regexp             // Matches the site's abbreviations, nil when there are none
+	navLinks            []navEntry                 // Links of the navigation bar, collected once the pages are loaded
+	navTree             []*NavItem                 // Navigation tree with no page marked active
+	remoteMounts        []Mount                    // Mounts of the fetched remote content
+	godocMounts         []Mount                    // Mounts of the generated API reference of Go packages
+	cliMounts           []Mount                    // Mounts of the generated reference of command-line programs
+	graphqlMounts       []Mount                    // Mounts of the generated reference of GraphQL schemas
+	renderedPages       []pageMeta                 // Pages written by the current build
+	failedPages         []string                   // Pages the current build failed to convert, with why
+	chunks              []textChunk                // Chunks of the pages written by the current build
+	thumbnails          map[string]*Thumbnail      // Thumbnails made by the current build, by cover and width
+	externalAssets      map[string]*externalAsset  // External scripts and stylesheets fetched by the current build, by URL
+	indexing            bool                       // Collect the chunks for a search index
+	liveSearch          atomic.Pointer[liveSearch] // Search index of the latest build, in serve mode
+	bleve               bleve.Index                // Bleve index of the latest build, in serve mode with search.bleve on
+
+	output buildOutput   // Where the current build writes the generated files
+	memory *memoryOutput // Generated files served from memory, in memory mode
+
+	previousOutput      buildOutput // Output of the previous build while a build runs, nil when there is none
+	translations        []*Site     // Sites with translations of this one's pages, set by newSites
+	missingTranslations []string    // Pages of the source language this site has no translation of
+
+	buildMu sync.Mutex   // Held while the site is being built
+	serveMu sync.RWMutex // Held for reading while serving a request, and for writing while the output is replaced
+	built   atomic.Bool  // A build has succeeded, so there is output to serve
+}
+
 func main() {
-	// Generate the site
-	generateSite()
+	// The slog test logger D2 depends on sends the standard logger through
+	// slog when it is loaded; mindoc's messages go to stderr as they are
+	log.SetOutput(os.Stderr)
+	flag.Parse()
+	// "serve" is the same as no command, and takes the same flags after it
+	if flag.Arg(0) == "serve" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	err := applyEnvFlags()
+	if err != nil {
+		log.Fatalf("Invalid environment: %v", err)
+	}
+
+	// The benchmarks build a synthetic site of their own
+	if flag.Arg(0) == "bench" {
+		err = runBenchmarks(flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	sites, err := newSites(cfg)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "":
+		if !*buildOnStart && *memoryMode {
+			log.Fatalf("Sites served from memory have to be built on start")
+		}
+
+		// Listen first, so health checks are answered while the sites are
+		// being generated
+		listeners, err := listen()
+		if err == nil && *acmeMode {
+			listeners, err = serveACME(listeners, cfg.Server)
+		}
+		if err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
 
-	// Serve the generated site
-	serveSite()
+		// Generate the sites, indexed for the search endpoint, then rebuild
+		// them on schedule
+		for _, site := range sites {
+			site.indexing = true
+		}
+		rb := newRebuilder(cfg, sites)
+		if cfg.Previews.Enabled {
+			rb.previews, err = newPreviewer(cfg, sites)
+			if err != nil {
+				log.Fatalf("Failed to set up branch previews: %v", err)
+			}
+		}
+		go func() {
+			for _, site := range sites {
+				if !*buildOnStart {
+					site.useExistingOutput()
+					continue
+				}
+				err := site.generate()
+				if err != nil {
+					log.Fatalf("Failed to generate %s: %v", site.label(), err)
+				}
+			}
+			if rb.previews != nil {
+				rb.previews.refresh()
+			}
+			if *rebuildEvery > 0 {
+				rb.every(*rebuildEvery)
+			}
+		}()
+		serveSites(listeners, sites, rb, cfg.Server)
+	case "check":
+		err = checkSites(sites)
+		if err != nil {
+			log.Fatalf("Check failed: %v", err)
+		}
+	case "audit":
+		err = auditSites(sites)
+		if err != nil {
+			log.Fatalf("Audit failed: %v", err)
+		}
+	case "translations":
+		err = translationSites(sites)
+		if err != nil {
+			log.Fatalf("Translation check failed: %v", err)
+		}
+	case "index":
+		err = indexSites(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Indexing failed: %v", err)
+		}
+	case "test":
+		err = testSites(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Test failed: %v", err)
+		}
+	case "template":
+		if flag.Arg(1) != "test" {
+			log.Fatalf("Unknown template command %q", flag.Arg(1))
+		}
+		err = testTemplates(sites, flag.Args()[2:])
+		if err != nil {
+			log.Fatalf("Template test failed: %v", err)
+		}
+	case "verify":
+		err = verifySites(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Verify failed: %v", err)
+		}
+	case "diff":
+		err = diffSites(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Diff failed: %v", err)
+		}
+	case "cli":
+		err = cliPages(flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Generating the CLI reference failed: %v", err)
+		}
+	case "godoc":
+		err = goDocPages(flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Generating the API reference failed: %v", err)
+		}
+	case "deploy":
+		err = deploySites(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Deploy failed: %v", err)
+		}
+	case "publish":
+		err = publishBranch(sites, flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("Publish failed: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown command %q", command)
+	}
 }
 
-func generateSite() {
-	// Create the output directory if it doesn't exist
-	err := os.MkdirAll(outputDir, os.ModePerm)
+// newSites creates a Site for every site described by the config, applying
+// the options to each of them
+func newSites(cfg *Config, opts ...SiteOption) ([]*Site, error) {
+	siteConfigs, err := cfg.siteConfigs()
 	if err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
+		return nil, err
 	}
 
-	// Copy the CSS file to the output directory
-	err = copyCSSFile()
+	theme, err := loadTheme(cfg)
 	if err != nil {
-		log.Fatalf("Failed to copy CSS file: %v", err)
+		return nil, err
 	}
 
-	// Generate the site with navigation
-	err = filepath.Walk(inputDir, processFile)
+	var sites []*Site
+	for _, siteConfig := range siteConfigs {
+		site, err := newSite(siteConfig, theme, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+	err = linkTranslations(sites)
+	if err != nil {
+		return nil, err
+	}
+
+	return sites, nil
+}
+
+// newSite creates a Site from its settings
+func newSite(cfg SiteConfig, theme *Theme, opts ...SiteOption) (*Site, error) {
+	site := &Site{SiteConfig: cfg, theme: theme, basePath: "/"}
+	for _, opt := range opts {
+		opt(site)
+	}
+	site.markdown = site.newMarkdown()
+	err := site.setupRenderers()
 	if err != nil {
-		log.Fatalf("Error walking the path %q: %v", inputDir, err)
+		return nil, err
 	}
+	err = site.compileReplacements()
+	if err != nil {
+		return nil, err
+	}
+	site.cache = newRenderCache(cfg.Cache)
+	err = cfg.Comments.check()
+	if err != nil {
+		return nil, err
+	}
+
+	page, formats, err := theme.templates(site)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare templates: %w", err)
+	}
+	site.page, site.formats = page, formats
+
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid baseURL %q: %w", cfg.BaseURL, err)
+		}
+		site.basePath = strings.TrimSuffix(path.Clean("/"+u.Path), "/") + "/"
+	}
+	if mode := cfg.Integrity.Mode; mode != "" && mode != "hash" && mode != "vendor" {
+		return nil, fmt.Errorf("invalid integrity mode %q", mode)
+	}
+
+	return site, nil
+}
 
-	fmt.Println("Site generated successfully.")
+// url returns the URL of a path within the site
+func (s *Site) url(p string) string {
+	return s.basePath + strings.TrimPrefix(p, "/")
+}
+
+// label names the site in log output
+func (s *Site) label() string {
+	if s.Name == "" {
+		return "Site"
+	}
+	return fmt.Sprintf("Site %q", s.Name)
 }
 
-func serveSite() {
-	// Serve files from the outputDir
-	fs := http.FileServer(http.Dir(outputDir))
-	http.Handle("/", fs)
+// generate builds the site into a temporary directory next to the output
+// directory and swaps it into place once the build has succeeded, so a
+// failed build leaves the previous output untouched
+func (s *Site) generate() (err error) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
 
-	// Start the server on port 8080
-	fmt.Println("Serving at http://localhost:8080...")
-	err := http.ListenAndServe(":8080", nil)
+	start := time.Now()
+	defer func() {
+		metrics.recordBuild(s.Name, time.Since(start), err == nil)
+	}()
+
+	if *memoryMode {
+		return s.generateInMemory()
+	}
+
+	outputDir := s.OutputDir
+
+	err = os.MkdirAll(filepath.Dir(outputDir), os.ModePerm)
 	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
+	buildDir, err := os.MkdirTemp(filepath.Dir(outputDir), "."+filepath.Base(outputDir)+"-build-")
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
+	err = os.Chmod(buildDir, 0755)
+	if err != nil {
+		os.RemoveAll(buildDir)
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
+
+	s.OutputDir = buildDir
+	s.output = dirOutput(buildDir)
+	s.previousOutput = dirOutput(outputDir)
+	err = s.build()
+	s.previousOutput = nil
+	s.OutputDir = outputDir
+	s.output = dirOutput(outputDir)
+	if err != nil {
+		os.RemoveAll(buildDir)
+		return err
+	}
+
+	// Requests being served finish before the output is replaced, and new
+	// ones wait until the new output is in place
+	s.serveMu.Lock()
+	err = replaceDir(buildDir, outputDir)
+	s.serveMu.Unlock()
+	if err != nil {
+		os.RemoveAll(buildDir)
+		return fmt.Errorf("failed to replace output directory: %w", err)
+	}
+
+	// The pages now live in the output directory
+	for i, meta := range s.renderedPages {
+		relPath, err := filepath.Rel(buildDir, meta.Output)
+		if err == nil {
+			s.renderedPages[i].Output = filepath.Join(outputDir, relPath)
+		}
+	}
+
+	s.updateLiveSearch()
+	if err := s.updateBleveIndex(); err != nil {
+		log.Printf("Failed to index %s with bleve: %v", s.label(), err)
+	}
+	s.built.Store(true)
+	fmt.Printf("%s generated successfully.\n", s.label())
+	return nil
 }
 
-// processFile is called for each file found by filepath.Walk
-func processFile(path string, info os.FileInfo, err error) error {
+// generateInMemory builds the site into memory and serves the result from
+// there, leaving the output directory alone
+func (s *Site) generateInMemory() error {
+	out := newMemoryOutput()
+	s.output = out
+	if s.memory != nil {
+		s.previousOutput = s.memory
+	}
+	err := s.build()
+	s.previousOutput = nil
 	if err != nil {
 		return err
 	}
 
-	// Skip directories
-	if info.IsDir() {
-		return nil
+	s.serveMu.Lock()
+	s.memory = out
+	s.serveMu.Unlock()
+	s.updateLiveSearch()
+	if err := s.updateBleveIndex(); err != nil {
+		log.Printf("Failed to index %s with bleve: %v", s.label(), err)
+	}
+	s.built.Store(true)
+
+	fmt.Printf("%s generated in memory.\n", s.label())
+	return nil
+}
+
+// build generates the site into its output
+func (s *Site) build() error {
+	// Copy the stylesheets and scripts to the output directory
+	err := s.copyThemeAssets()
+	if err != nil {
+		return fmt.Errorf("failed to copy theme files: %w", err)
+	}
+
+	// Make the favicons and web manifest from the logo
+	err = s.generateIcons()
+	if err != nil {
+		return fmt.Errorf("failed to generate icons: %w", err)
+	}
+
+	// Pull in remote content
+	err = s.fetchRemotes()
+	if err != nil {
+		return fmt.Errorf("failed to fetch remote content: %w", err)
+	}
+	err = s.generateGoDoc()
+	if err != nil {
+		return fmt.Errorf("failed to generate the API reference: %w", err)
+	}
+	err = s.generateCLIReference()
+	if err != nil {
+		return fmt.Errorf("failed to generate the CLI reference: %w", err)
+	}
+	err = s.generateGraphQLReference()
+	if err != nil {
+		return fmt.Errorf("failed to generate the GraphQL reference: %w", err)
+	}
+
+	err = s.runBuildHooks("preBuild", s.Hooks.PreBuild)
+	if err != nil {
+		return fmt.Errorf("build hook failed: %w", err)
 	}
 
-	// Process only markdown files
-	if strings.HasSuffix(info.Name(), ".md") {
-		err = convertMarkdownToHTML(path)
+	// Read the pages and their front matter
+	err = s.loadPages()
+	if err != nil {
+		return fmt.Errorf("failed to load the content: %w", err)
+	}
+	s.reportSchedule()
+	err = s.findTranslations()
+	if err != nil {
+		return fmt.Errorf("failed to find translations: %w", err)
+	}
+	err = s.addLLMsMirrors()
+	if err != nil {
+		return err
+	}
+
+	// Generate the site with navigation
+	s.renderedPages = nil
+	s.failedPages = nil
+	s.chunks = nil
+	s.thumbnails = make(map[string]*Thumbnail)
+	s.externalAssets = make(map[string]*externalAsset)
+	for _, page := range s.pages {
+		err = s.convertMarkdownToHTML(page)
+		if errors.Is(err, errMissingSnippet) {
+			return fmt.Errorf("failed to convert %s: %w", page.srcPath, err)
+		}
 		if err != nil {
-			log.Printf("Failed to convert %s: %v", path, err)
+			log.Printf("Failed to convert %s: %v", page.srcPath, err)
+			s.failedPages = append(s.failedPages, fmt.Sprintf("%s: %v", page.Path, err))
 		}
 	}
 
+	// List the pages of each author and the parts of each series, define
+	// the glossary terms and list the deprecated pages
+	err = s.writeAuthorPages()
+	if err != nil {
+		return fmt.Errorf("failed to write author pages: %w", err)
+	}
+	err = s.writeSeriesPages()
+	if err != nil {
+		return fmt.Errorf("failed to write series pages: %w", err)
+	}
+	err = s.writeGlossaryPage()
+	if err != nil {
+		return err
+	}
+	err = s.writeDeprecationsPage()
+	if err != nil {
+		return err
+	}
+
+	err = s.writeChunks()
+	if err != nil {
+		return fmt.Errorf("failed to write the chunks export: %w", err)
+	}
+	err = s.writeSearchIndex()
+	if err != nil {
+		return fmt.Errorf("failed to write the search index: %w", err)
+	}
+
+	if s.cache != nil {
+		fmt.Printf("%s: %d page(s) from the render cache, %d rendered\n", s.label(), s.cache.hits, s.cache.misses)
+		s.cache.hits, s.cache.misses = 0, 0
+	}
+
+	// Copy everything else in the content tree as it is
+	err = s.copyStaticFiles()
+	if err != nil {
+		return fmt.Errorf("failed to copy content files: %w", err)
+	}
+
+	// Redirect the URLs pages had before they moved, and list the pages
+	// for search engines
+	err = s.writeAliases()
+	if err != nil {
+		return err
+	}
+	err = s.writeSitemap()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", sitemapFile, err)
+	}
+
+	// Describe the site for AI tools
+	err = s.writeLLMs()
+	if err != nil {
+		return fmt.Errorf("failed to write llms.txt: %w", err)
+	}
+
+	// Describe the navigation and the pages' headings for client-side apps
+	err = s.writeNavJSON()
+	if err != nil {
+		return fmt.Errorf("failed to write nav.json: %w", err)
+	}
+	err = s.writeOutlines()
+	if err != nil {
+		return fmt.Errorf("failed to write outlines: %w", err)
+	}
+
+	// Let the site be read offline
+	err = s.writeServiceWorker()
+	if err != nil {
+		return fmt.Errorf("failed to write service worker: %w", err)
+	}
+
+	// Tell the host which pages need a login
+	err = s.writeAccessHeaders()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", headersFile, err)
+	}
+
+	// List the generated files for deploy tools
+	err = s.writeBuildManifest()
+	if err != nil {
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+
+	err = s.runBuildHooks("postBuild", s.Hooks.PostBuild)
+	if err != nil {
+		return fmt.Errorf("build hook failed: %w", err)
+	}
+
+	// Report build diagnostics
+	err = s.runDiagnostics()
+	if err != nil {
+		return fmt.Errorf("build diagnostics failed: %w", err)
+	}
+
 	return nil
 }
 
-// convertMarkdownToHTML converts a markdown file to HTML and saves it
-func convertMarkdownToHTML(mdPath string) error {
-	// Read the markdown file
-	mdContent, err := ioutil.ReadFile(mdPath)
+// replaceDir moves a directory into the place of another one, removing the
+// old directory only once the new one is in place
+func replaceDir(src, dest string) error {
+	_, err := os.Stat(dest)
+	if os.IsNotExist(err) {
+		return os.Rename(src, dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	old := src + "-old"
+	err = os.Rename(dest, old)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(src, dest)
+	if err != nil {
+		// Put the previous output back
+		os.Rename(old, dest)
+		return err
+	}
+
+	return os.RemoveAll(old)
+}
+
+// serveSites serves every site under its base path, along with the health
+// checks, the rebuild webhook when it has a secret and the branch previews
+func serveSites(listeners []net.Listener, sites []*Site, rb *rebuilder, cfg ServerConfig) {
+	base := listenURL(listeners[0].Addr())
+	accessLog, err := newAccessLog(*accessLogFormat)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		log.Fatalf("Invalid access log: %v", err)
+	}
+
+	// Serve files from each site's output directory under its base path
+	mux := http.NewServeMux()
+	served := make(map[string]string)
+	for _, site := range sites {
+		if other, ok := served[site.basePath]; ok {
+			log.Printf("Not serving %s: %s is already served at %s", site.label(), other, site.basePath)
+			continue
+		}
+		served[site.basePath] = site.label()
+
+		var fs http.Handler = hideHostFiles(http.FileServer(http.Dir(site.OutputDir)))
+		if *memoryMode {
+			fs = site.serveMemory()
+		}
+		fs = site.requireBuilt(site.guardOutput(site.servePrintVariants(fs)))
+		mux.Handle(site.basePath, http.StripPrefix(strings.TrimSuffix(site.basePath, "/"), fs))
+		mux.Handle(site.url(feedbackPath), site.serveFeedback())
+		mux.Handle(site.url(searchPath), site.serveSearch())
+		if site.Search.Bleve {
+			mux.Handle(site.url(bleveAPIPath), site.guardOutput(site.serveBleveSearch()))
+		}
+		fmt.Printf("Serving %s at %s%s\n", site.label(), base, site.basePath)
+	}
+	mux.HandleFunc(healthPath, serveHealth)
+	mux.Handle(readyPath, serveReady(sites))
+
+	if rb.secret != "" {
+		mux.Handle(rebuildHookPath, rb.serveHook())
+		fmt.Printf("Rebuild webhook at %s%s\n", base, rebuildHookPath)
+	}
+	if rb.previews != nil {
+		mux.Handle(previewPath, rb.previews)
+		fmt.Printf("Branch previews at %s%s\n", base, previewPath)
+	}
+	if *serveMetrics {
+		mux.Handle(metricsPath, metrics)
+		fmt.Printf("Metrics at %s%s\n", base, metricsPath)
 	}
 
-	// Convert markdown to HTML using goldmark
-	var htmlContent strings.Builder
-	md := goldmark.New()
-	err = md.Convert(mdContent, &htmlContent)
+	// Every socket is served until one of them fails
+	server := newServer(cfg, observeRequests(mux, limitRequests(cfg, mux), accessLog))
+	errs := make(chan error)
+	for _, ln := range listeners {
+		fmt.Printf("Serving at %s...\n", listenURL(ln.Addr()))
+		go func() {
+			errs <- server.Serve(limitListener(cfg, ln))
+		}()
+	}
+	err = <-errs
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
+
+// guardOutput serves requests while holding the site's serve lock, so a
+// rebuild never replaces the output in the middle of a response
+func (s *Site) guardOutput(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveMu.RLock()
+		defer s.serveMu.RUnlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveMemory serves the site's latest in-memory build
+func (s *Site) serveMemory() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.memory == nil || isHostFile(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		s.memory.ServeHTTP(w, r)
+	})
+}
+
+// servedOutput returns the output the server is serving the site from
+func (s *Site) servedOutput() buildOutput {
+	if s.memory != nil {
+		return s.memory
+	}
+	return dirOutput(s.OutputDir)
+}
+
+// convertMarkdownToHTML converts a page to HTML and saves it
+func (s *Site) convertMarkdownToHTML(page *Page) error {
+	// Parse the page; its HTML is produced while the page is written
+	writeBody, toc, err := s.prepareBody(page)
 	if err != nil {
 		return fmt.Errorf("failed to convert markdown to HTML: %w", err)
 	}
 
-	// Generate navigation bar
-	navBar := generateNavBar()
-
-	// Wrap content with <div class="medium-container">
-	finalHTML := fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s</title>
-    <link rel="stylesheet" href="/%s/%s">
-</head>
-<body>
-    %s
-    <div class="medium-container">
-        %s
-    </div>
-</body>
-</html>
-`, filepath.Base(mdPath), cssDestDir, cssFile, navBar, htmlContent.String())
+	// Wrap content in the page template with the navigation bar and menus
+	data := s.newPageData(page)
+	data.TOC = toc
+	data.OnThisPage = s.renderOnThisPage(page)
+	data.Comments = s.pageComments(page)
 
 	// Determine output path
-	relPath, err := filepath.Rel(inputDir, mdPath)
+	htmlFileName := s.outputPath(page.Path)
+	htmlPath := filepath.Join(s.OutputDir, filepath.FromSlash(htmlFileName))
+
+	// Without hooks or a print variant needing the whole page, the page is
+	// streamed to the output instead of being held in memory
+	meta := pageMeta{
+		Site:   s.Name,
+		Source: page.Path,
+		Title:  page.Title,
+		URL:    page.URL,
+		Output: htmlPath,
+	}
+	if !s.needsWholePage(page) {
+		streamed, err := s.streamPage(data, writeBody, htmlFileName)
+		if err != nil {
+			return err
+		}
+		if streamed {
+			s.renderedPages = append(s.renderedPages, meta)
+			return nil
+		}
+	}
+
+	var content bytes.Buffer
+	err = writeBody(&content)
 	if err != nil {
-		return fmt.Errorf("failed to determine relative path: %w", err)
+		return fmt.Errorf("failed to convert markdown to HTML: %w", err)
 	}
+	data.Content = template.HTML(content.String())
+	s.collectChunks(page, content.String())
 
-	htmlPath := filepath.Join(outputDir, strings.Replace(relPath, ".md", ".html", 1))
+	finalHTML, err := s.renderPage(data)
+	if err != nil {
+		return err
+	}
 
-	// Ensure output directory exists
-	err = os.MkdirAll(filepath.Dir(htmlPath), os.ModePerm)
+	// Let post-render hooks inspect or rewrite the page
+	meta.HTML = finalHTML
+	finalHTML, err = s.runPostRenderHooks(meta)
 	if err != nil {
-		return fmt.Errorf("failed to create directories: %w", err)
+		return err
 	}
 
 	// Write the final HTML content to the output file
-	err = ioutil.WriteFile(htmlPath, []byte(finalHTML), 0644)
+	err = s.output.WriteFile(htmlFileName, []byte(finalHTML))
 	if err != nil {
 		return fmt.Errorf("failed to write HTML file: %w", err)
 	}
 
+	if s.PrintPages {
+		err = s.writePrintPage(data, htmlFileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.writeOutputFormats(data, htmlFileName)
+	if err != nil {
+		return err
+	}
+
+	meta.HTML = ""
+	s.renderedPages = append(s.renderedPages, meta)
+
 	return nil
 }
 
-// copyCSSFile copies the CSS file from the source directory to the output directory
-func copyCSSFile() error {
-	srcPath := filepath.Join(cssSourceDir, cssFile)
-	destPath := filepath.Join(outputDir, cssDestDir, cssFile)
+// newPageData returns what the layout is executed with for a page, with
+// the navigation showing the page as the current one
+func (s *Site) newPageData(page *Page) pageData {
+	navBar := s.generateNavBar(page.Path)
+	navTree := markActive(s.navTree, page.Path)
+	sidebarTree := sidebar(navTree)
+	return pageData{
+		Title:       page.Title,
+		Lang:        s.Language,
+		Dir:         s.TextDirection(),
+		CSS:         s.url(cssDestDir + "/" + cssFile),
+		Assets:      s.url(cssDestDir + "/"),
+		Head:        s.pageHeadTags(page),
+		Badges:      s.renderBadges(page),
+		NavBar:      template.HTML(navBar),
+		Menu:        topMenu(navTree),
+		Sidebar:     sidebarTree,
+		SidebarHTML: s.renderSidebar(sidebarTree),
+		Page:        page,
+		Site:        s,
+	}
+}
 
+// generatedPage returns a page made by mindoc rather than read from the
+// content tree, rendered with the layout when the theme has it
+func (s *Site) generatedPage(relPath, title, layout string) *Page {
+	if s.page.Lookup(layout) == nil {
+		layout = ""
+	}
+	return &Page{
+		Path:   relPath,
+		Title:  title,
+		Layout: layout,
+		Params: map[string]interface{}{},
+		URL:    s.pageURL(relPath),
+	}
+}
+
+// writeGeneratedPage renders a generated page and writes it to the output.
+// A content page at the same place wins over the generated one.
+func (s *Site) writeGeneratedPage(data pageData) error {
+	htmlFileName := s.outputPath(data.Page.Path)
+	for _, page := range s.pages {
+		if s.outputPath(page.Path) == htmlFileName {
+			return nil
+		}
+	}
+
+	finalHTML, err := s.renderPage(data)
+	if err != nil {
+		return err
+	}
+	err = s.output.WriteFile(htmlFileName, []byte(finalHTML))
+	if err != nil {
+		return fmt.Errorf("failed to write HTML file: %w", err)
+	}
+
+	s.renderedPages = append(s.renderedPages, pageMeta{
+		Site:   s.Name,
+		Title:  data.Title,
+		URL:    data.Page.URL,
+		Output: filepath.Join(s.OutputDir, filepath.FromSlash(htmlFileName)),
+	})
+	return nil
+}
+
+// needsWholePage reports whether anything besides the page's own file uses
+// its rendered HTML, or the HTML is rewritten once rendered, so the page
+// can't be streamed
+func (s *Site) needsWholePage(page *Page) bool {
+	return len(s.Hooks.PostRender) > 0 || s.PrintPages || len(page.Outputs) > 0 || s.collectsChunks() || s.Integrity.Mode != ""
+}
+
+// contentMarker stands in for the page content when the layout is executed
+// ahead of streaming the content into it
+const contentMarker = "<!--mindoc:content-->"
+
+// streamPage writes a page to the output with its body rendered straight
+// into the file between the parts of the layout around it. It reports false
+// without writing anything when the layout doesn't show the content exactly
+// once, leaving the page to be rendered in memory.
+func (s *Site) streamPage(data pageData, writeBody bodyWriter, htmlFileName string) (bool, error) {
+	data.Content = contentMarker
+	layout, err := s.renderPage(data)
+	if err != nil {
+		return false, err
+	}
+	before, after, ok := strings.Cut(layout, contentMarker)
+	if !ok || strings.Contains(after, contentMarker) {
+		return false, nil
+	}
+
+	f, err := s.output.Create(htmlFileName)
+	if err != nil {
+		return false, fmt.Errorf("failed to write HTML file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+
+	_, err = io.WriteString(w, before)
+	if err == nil {
+		err = writeBody(w)
+	}
+	if err == nil {
+		_, err = io.WriteString(w, after)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A page that failed part way through is not left in the output
+		s.output.Remove(htmlFileName)
+		return false, fmt.Errorf("failed to write HTML file: %w", err)
+	}
+
+	return true, nil
+}
+
+// copyThemeAssets copies the CSS and JavaScript files from the theme
+// directory to the output directory
+func (s *Site) copyThemeAssets() error {
+	err := s.output.CopyFile(cssDestDir+"/"+cssFile, filepath.Join(s.theme.CSSDir, cssFile))
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.theme.CSSDir)
+	if err != nil {
+		return fmt.Errorf("failed to list theme files: %w", err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || entry.Name() == cssFile || (ext != ".css" && ext != ".js") {
+			continue
+		}
+		err = s.output.CopyFile(cssDestDir+"/"+entry.Name(), filepath.Join(s.theme.CSSDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies a file, creating the destination directory if needed
+func copyFile(srcPath, destPath string) error {
 	// Ensure the destination directory exists
 	err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("failed to create CSS destination directory: %w", err)
+		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
 	// Copy the file
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to open CSS source file: %w", err)
+		return fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer srcFile.Close()
 
 	destFile, err := os.Create(destPath)
 	if err != nil {
-		return fmt.Errorf("failed to create CSS destination file: %w", err)
+		return fmt.Errorf("failed to create destination file: %w", err)
 	}
 	defer destFile.Close()
 
 	_, err = io.Copy(destFile, srcFile)
 	if err != nil {
-		return fmt.Errorf("failed to copy CSS file: %w", err)
+		return fmt.Errorf("failed to copy file: %w", err)
 	}
 
 	return nil
 }
 
-// generateNavBar generates a navigation bar based on the markdown files and directories
-func generateNavBar() string {
-	var navBar strings.Builder
+// navEntry is a single link in the generated navigation bar
+type navEntry struct {
+	Title string
+	Path  string // Page path within the content tree
+	URL   string
+}
 
-	navBar.WriteString(`<div class="medium-container"><ul style="list-style: none; display: flex; gap: 10px;">`)
+// navEntries collects the navigation links for the pages that aren't
+// excluded from navigation
+func (s *Site) navEntries() []navEntry {
+	var entries []navEntry
 
-	// Walk through the directory and create navigation links
-	filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, page := range s.pages {
+		if !page.InNav() || !s.inNav(page.Path) {
+			continue
 		}
 
-		if info.IsDir() && path != inputDir {
-			return nil
-		}
+		name := path.Base(page.Path)
+		entries = append(entries, navEntry{
+			Title: strings.TrimSuffix(name, path.Ext(name)),
+			Path:  page.Path,
+			URL:   page.URL,
+		})
+	}
 
-		if strings.HasSuffix(info.Name(), ".md") {
-			relPath, err := filepath.Rel(inputDir, path)
-			if err != nil {
-				return err
-			}
-			htmlFileName := strings.Replace(relPath, ".md", ".html", 1)
-			link := fmt.Sprintf(`<li><a href="/%s">%s</a></li>`, htmlFileName, strings.TrimSuffix(filepath.Base(info.Name()), ".md"))
-			navBar.WriteString(link)
-		}
+	return entries
+}
 
-		return nil
-	})
+// generateNavBar generates a navigation bar based on the markdown files and
+// directories, marking the link to the current page
+func (s *Site) generateNavBar(current string) string {
+	var navBar strings.Builder
+
+	fmt.Fprintf(&navBar, `<header class="site-header"><div class="medium-container"><nav class="site-nav" aria-label="%s"><ul>`,
+		template.HTMLEscapeString(s.translate("mainNavigation")))
+
+	for _, entry := range s.navLinks {
+		navBar.WriteString(`<li><a href="`)
+		navBar.WriteString(entry.URL)
+		navBar.WriteString(`"`)
+		if entry.Path == current {
+			navBar.WriteString(` aria-current="page"`)
+		}
+		navBar.WriteString(">")
+		navBar.WriteString(entry.Title)
+		navBar.WriteString("</a></li>")
+	}
 
-	navBar.WriteString(`</ul></div>`)
+	navBar.WriteString(`</ul></nav></div></header>`)
 	return navBar.String()
 }
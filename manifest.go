@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const buildManifestFile = "manifest.json" // List of the generated files written to the output root
+
+// buildManifest lists the files of a build, for deploy tools that upload
+// only what changed and check what they uploaded
+type buildManifest struct {
+	Site  string          `json:"site"`
+	Files []manifestEntry `json:"files"`
+}
+
+// manifestEntry is a generated file of the build manifest
+type manifestEntry struct {
+	Path    string    `json:"path"`             // Slash-separated path within the output
+	Source  string    `json:"source,omitempty"` // Content tree path of the page or file it was made from, or the theme file it was copied from
+	SHA256  string    `json:"sha256"`
+	Size    int       `json:"size"`
+	ModTime time.Time `json:"modTime"`
+
+	Audience   []string `json:"audience,omitempty"`   // Audiences the page it was made from is written for
+	Visibility string   `json:"visibility,omitempty"` // Visibility of the page it was made from, public or protected
+}
+
+// writeBuildManifest writes the manifest of every file the build has put
+// into the output so far
+func (s *Site) writeBuildManifest() error {
+	sources := s.outputSources()
+	pages := make(map[string]*Page)
+	for _, page := range s.pages {
+		for _, out := range s.pageOutputs(page) {
+			pages[out] = page
+		}
+	}
+	last, err := s.previousManifest()
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]manifestEntry)
+	if last != nil {
+		for _, entry := range last.Files {
+			previous[entry.Path] = entry
+		}
+	}
+	manifest := buildManifest{Site: s.Name, Files: []manifestEntry{}}
+	err = s.output.Walk(func(relPath string) error {
+		if relPath == buildManifestFile {
+			return nil
+		}
+		data, err := s.output.ReadFile(relPath)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		entry := manifestEntry{
+			Path:   relPath,
+			Source: sources[relPath],
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   len(data),
+		}
+		// A file keeps its time while its contents stay the same; one that
+		// changed was modified by this build
+		prev, ok := previous[relPath]
+		switch {
+		case ok && prev.SHA256 == entry.SHA256:
+			entry.ModTime = prev.ModTime
+		case ok:
+			entry.ModTime = s.outputModTime(relPath, "")
+		default:
+			entry.ModTime = s.outputModTime(relPath, entry.Source)
+		}
+		if page, ok := pages[relPath]; ok {
+			entry.Audience = page.Audience
+			entry.Visibility = page.Visibility
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list generated files: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.output.WriteFile(buildManifestFile, data)
+}
+
+// outputSources maps the generated files made from a page, a file of the
+// content tree or a theme file to where they came from. Files generated
+// for the whole site, such as the sitemap and icons, have no source.
+func (s *Site) outputSources() map[string]string {
+	sources := make(map[string]string)
+	for _, page := range s.pages {
+		for _, out := range s.pageOutputs(page) {
+			sources[out] = page.Path
+		}
+	}
+
+	for _, file := range s.files {
+		if s.isPage(file.RelPath) {
+			continue
+		}
+		sources[file.RelPath] = file.RelPath
+		for _, name := range s.Images.Formats {
+			sources[convertedPath(file.RelPath, name)] = file.RelPath
+		}
+	}
+
+	entries, err := os.ReadDir(s.theme.CSSDir)
+	if err == nil {
+		for _, entry := range entries {
+			sources[cssDestDir+"/"+entry.Name()] = filepath.ToSlash(filepath.Join(s.theme.CSSDir, entry.Name()))
+		}
+	}
+	return sources
+}
+
+// outputModTime returns when a generated file new to the output changed:
+// for a file made from the content tree or the theme, when its source was
+// last modified, and otherwise when it was written. With no source given it
+// is when the file was written.
+func (s *Site) outputModTime(relPath, source string) time.Time {
+	if file, ok := s.filesByPath[source]; ok {
+		return file.Info.ModTime().UTC()
+	}
+	if source != "" {
+		if info, err := os.Stat(filepath.FromSlash(source)); err == nil {
+			return info.ModTime().UTC()
+		}
+	}
+
+	switch out := s.output.(type) {
+	case *memoryOutput:
+		return out.modTime.UTC()
+	case dirOutput:
+		info, err := os.Stat(filepath.Join(string(out), filepath.FromSlash(relPath)))
+		if err == nil {
+			return info.ModTime().UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// previousManifest reads the build manifest of the previous build in the
+// output directory, returning nil when there is none
+func (s *Site) previousManifest() (*buildManifest, error) {
+	if s.previousOutput == nil || !s.previousOutput.Exists(buildManifestFile) {
+		return nil, nil
+	}
+	data, err := s.previousOutput.ReadFile(buildManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var previous buildManifest
+	err = json.Unmarshal(data, &previous)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", buildManifestFile, err)
+	}
+	return &previous, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// SiteOption customises a Site when it is created
+type SiteOption func(*Site)
+
+// WithGoldmarkOptions adds options to the goldmark converter used to render
+// the site's markdown, such as parser or renderer options
+func WithGoldmarkOptions(opts ...goldmark.Option) SiteOption {
+	return func(s *Site) {
+		s.goldmarkOptions = append(s.goldmarkOptions, opts...)
+	}
+}
+
+// WithExtensions adds goldmark extensions to the markdown conversion pipeline
+func WithExtensions(exts ...goldmark.Extender) SiteOption {
+	return WithGoldmarkOptions(goldmark.WithExtensions(exts...))
+}
+
+// newMarkdown creates a goldmark converter for the site, adding any extra
+// options after the site's own. Links between pages are always rewritten to
+// the URLs of the generated pages, and footnotes, citations, abbreviations
+// and glossary terms are always understood.
+func (s *Site) newMarkdown(extra ...goldmark.Option) goldmark.Markdown {
+	opts := append(s.goldmarkOptions[:len(s.goldmarkOptions):len(s.goldmarkOptions)], extra...)
+	opts = append(opts, goldmark.WithParserOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(linkRewriter{site: s}, 500),
+			util.Prioritized(imageTransformer{site: s}, 550),
+			util.Prioritized(glossaryMarker{site: s}, 600),
+			util.Prioritized(abbreviationMarker{site: s}, 650),
+			util.Prioritized(referencesAdder{}, 700),
+		),
+		parser.WithBlockParsers(
+			util.Prioritized(shortcodeParser{}, 50),
+			util.Prioritized(abbreviationParser{}, 50),
+			util.Prioritized(containerParser{}, 50),
+		),
+		parser.WithInlineParsers(util.Prioritized(citationParser{site: s}, 150)),
+	), goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(shortcodeRenderer{site: s}, 50),
+			util.Prioritized(glossaryRenderer{site: s}, 50),
+			util.Prioritized(citationRenderer{site: s}, 50),
+			util.Prioritized(abbreviationRenderer{}, 50),
+			util.Prioritized(containerRenderer{site: s}, 50),
+			util.Prioritized(codeBlockRenderer{site: s}, 50),
+			util.Prioritized(figureRenderer{}, 50),
+			util.Prioritized(pictureRenderer{}, 50),
+			util.Prioritized(inlineSVGRenderer{}, 50),
+		),
+	), goldmark.WithExtensions(extension.Footnote))
+	return goldmark.New(opts...)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// MediaConfig decides how video and audio are put on pages
+type MediaConfig struct {
+	NoThirdParty bool `yaml:"noThirdParty"` // Link to videos and recordings on other sites instead of embedding their players
+}
+
+// mediaID matches the id of a video on YouTube or Vimeo
+var mediaID = regexp.MustCompile(`^[\w-]+$`)
+
+// videoShortcode shows a video file with the browser's player, given as
+// {{< video src="demo.mp4" poster="demo.jpg" captions="demo.vtt" >}}
+func (s *Site) videoShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	src := args["src"]
+	if src == "" {
+		return "", fmt.Errorf("no src given")
+	}
+
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	out.WriteString(`<video class="video" controls preload="metadata"`)
+	for _, attr := range []string{"poster", "width", "height", "title"} {
+		if args[attr] != "" {
+			fmt.Fprintf(&out, ` %s="%s"`, attr, esc(args[attr]))
+		}
+	}
+	fmt.Fprintf(&out, `><source src="%s">`, esc(src))
+	if captions := args["captions"]; captions != "" {
+		lang := args["srclang"]
+		if lang == "" {
+			lang = s.Language
+		}
+		label := args["label"]
+		if label == "" {
+			label = s.translate("captions")
+		}
+		fmt.Fprintf(&out, `<track kind="captions" src="%s" srclang="%s" label="%s" default>`, esc(captions), esc(lang), esc(label))
+	}
+	fmt.Fprintf(&out, `<a href="%s">%s</a></video>`, esc(src), esc(s.translate("downloadVideo")))
+	return template.HTML(out.String()), nil
+}
+
+// audioShortcode plays an audio file with the browser's player, given as
+// {{< audio src="episode.mp3" >}}
+func (s *Site) audioShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	src := args["src"]
+	if src == "" {
+		return "", fmt.Errorf("no src given")
+	}
+
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	out.WriteString(`<audio class="audio" controls preload="metadata"`)
+	if args["title"] != "" {
+		fmt.Fprintf(&out, ` title="%s"`, esc(args["title"]))
+	}
+	fmt.Fprintf(&out, ` src="%s"><a href="%s">%s</a></audio>`, esc(src), esc(src), esc(s.translate("downloadAudio")))
+	return template.HTML(out.String()), nil
+}
+
+// youtubeShortcode embeds a YouTube video in privacy-enhanced mode, which
+// sets no cookies until it is played, given as {{< youtube id="..." >}}
+func (s *Site) youtubeShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	return s.embedVideo(args,
+		"https://www.youtube-nocookie.com/embed/%s",
+		"https://www.youtube.com/watch?v=%s")
+}
+
+// vimeoShortcode embeds a Vimeo video, asking Vimeo not to track the
+// viewer, given as {{< vimeo id="..." >}}
+func (s *Site) vimeoShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	return s.embedVideo(args,
+		"https://player.vimeo.com/video/%s?dnt=1",
+		"https://vimeo.com/%s")
+}
+
+// embedVideo embeds the player of a video site in a frame, or links to the
+// video when the site doesn't embed third-party players
+func (s *Site) embedVideo(args map[string]string, playerURL, pageURL string) (template.HTML, error) {
+	id := args["id"]
+	if !mediaID.MatchString(id) {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+	title := args["title"]
+	if s.Media.NoThirdParty {
+		text := title
+		if text == "" {
+			text = s.translate("watchVideo")
+		}
+		return externalMediaLink(fmt.Sprintf(pageURL, id), text), nil
+	}
+	if title == "" {
+		title = s.translate("video")
+	}
+
+	esc := template.HTMLEscapeString
+	return template.HTML(fmt.Sprintf(`<div class="video-embed"><iframe src="%s" title="%s" loading="lazy" allow="autoplay; encrypted-media; fullscreen; picture-in-picture" allowfullscreen></iframe></div>`,
+		esc(fmt.Sprintf(playerURL, id)), esc(title))), nil
+}
+
+// externalMediaLink links to media on another site in place of its player
+func externalMediaLink(url, text string) template.HTML {
+	esc := template.HTMLEscapeString
+	return template.HTML(fmt.Sprintf(`<p class="media-link"><a href="%s">%s</a></p>`, esc(url), esc(text)))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsPath = "/metrics" // Endpoint of the Prometheus metrics
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets request
+// durations are counted in
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics holds the figures the metrics endpoint reports
+var metrics = newServerMetrics()
+
+// serverMetrics counts the requests the server answers and records the
+// outcome of every build
+type serverMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]int           // Requests answered, by handler and status
+	latency  map[string]*latencyHistogram // Time taken to answer requests, by handler
+	builds   map[string]map[bool]int      // Builds finished, by site and whether they succeeded
+	last     map[string]buildRecord       // Latest build of each site
+}
+
+// requestKey identifies a request counter
+type requestKey struct {
+	handler string // Pattern of the handler that answered the request
+	code    int    // Status code of the response
+}
+
+// latencyHistogram counts durations in cumulative buckets, the way
+// Prometheus histograms are reported
+type latencyHistogram struct {
+	counts []int // Durations at most each of latencyBuckets
+	count  int
+	sum    float64
+}
+
+// buildRecord is the outcome of a site's build
+type buildRecord struct {
+	duration time.Duration
+	ok       bool
+	finished time.Time
+}
+
+// newServerMetrics returns empty metrics
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: make(map[requestKey]int),
+		latency:  make(map[string]*latencyHistogram),
+		builds:   make(map[string]map[bool]int),
+		last:     make(map[string]buildRecord),
+	}
+}
+
+// recordRequest counts a request the server answered
+func (m *serverMetrics) recordRequest(handler string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{handler, code}]++
+	h := m.latency[handler]
+	if h == nil {
+		h = &latencyHistogram{counts: make([]int, len(latencyBuckets))}
+		m.latency[handler] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// recordBuild records a site's build once it has finished
+func (m *serverMetrics) recordBuild(site string, duration time.Duration, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.builds[site] == nil {
+		m.builds[site] = make(map[bool]int)
+	}
+	m.builds[site][ok]++
+	m.last[site] = buildRecord{duration: duration, ok: ok, finished: time.Now()}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP mindoc_http_requests_total Requests answered, by handler and status code.\n")
+	b.WriteString("# TYPE mindoc_http_requests_total counter\n")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		fmt.Fprintf(&b, "mindoc_http_requests_total{handler=%s,code=\"%d\"} %d\n", metricLabel(key.handler), key.code, m.requests[key])
+	}
+
+	b.WriteString("# HELP mindoc_http_request_duration_seconds Time taken to answer requests, by handler.\n")
+	b.WriteString("# TYPE mindoc_http_request_duration_seconds histogram\n")
+	for _, handler := range slices.Sorted(maps.Keys(m.latency)) {
+		h := m.latency[handler]
+		label := metricLabel(handler)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&b, "mindoc_http_request_duration_seconds_bucket{handler=%s,le=\"%s\"} %d\n", label, formatMetric(bound), h.counts[i])
+		}
+		fmt.Fprintf(&b, "mindoc_http_request_duration_seconds_bucket{handler=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "mindoc_http_request_duration_seconds_sum{handler=%s} %s\n", label, formatMetric(h.sum))
+		fmt.Fprintf(&b, "mindoc_http_request_duration_seconds_count{handler=%s} %d\n", label, h.count)
+	}
+
+	b.WriteString("# HELP mindoc_builds_total Builds finished, by site and result.\n")
+	b.WriteString("# TYPE mindoc_builds_total counter\n")
+	for _, site := range slices.Sorted(maps.Keys(m.builds)) {
+		for _, ok := range []bool{true, false} {
+			fmt.Fprintf(&b, "mindoc_builds_total{site=%s,result=\"%s\"} %d\n", metricLabel(site), buildResult(ok), m.builds[site][ok])
+		}
+	}
+
+	b.WriteString("# HELP mindoc_build_duration_seconds Time the latest build of each site took.\n")
+	b.WriteString("# TYPE mindoc_build_duration_seconds gauge\n")
+	for _, site := range slices.Sorted(maps.Keys(m.last)) {
+		fmt.Fprintf(&b, "mindoc_build_duration_seconds{site=%s} %s\n", metricLabel(site), formatMetric(m.last[site].duration.Seconds()))
+	}
+
+	b.WriteString("# HELP mindoc_build_success Whether the latest build of each site succeeded.\n")
+	b.WriteString("# TYPE mindoc_build_success gauge\n")
+	for _, site := range slices.Sorted(maps.Keys(m.last)) {
+		success := 0
+		if m.last[site].ok {
+			success = 1
+		}
+		fmt.Fprintf(&b, "mindoc_build_success{site=%s} %d\n", metricLabel(site), success)
+	}
+
+	b.WriteString("# HELP mindoc_build_timestamp_seconds When the latest build of each site finished.\n")
+	b.WriteString("# TYPE mindoc_build_timestamp_seconds gauge\n")
+	for _, site := range slices.Sorted(maps.Keys(m.last)) {
+		fmt.Fprintf(&b, "mindoc_build_timestamp_seconds{site=%s} %d\n", metricLabel(site), m.last[site].finished.Unix())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// buildResult names the result of a build in the metrics
+func buildResult(ok bool) string {
+	if ok {
+		return "success"
+	}
+	return "failure"
+}
+
+// metricLabel quotes a label value for the Prometheus text format
+func metricLabel(value string) string {
+	return strconv.Quote(value)
+}
+
+// formatMetric formats a sample value for the Prometheus text format
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// observeRequests counts the requests the server answers for the metrics,
+// and writes a line about each to the access log when there is one. The
+// mux tells which of its handlers a request is for.
+func observeRequests(mux *http.ServeMux, next http.Handler, accessLog *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		_, handler := mux.Handler(r)
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		metrics.recordRequest(handler, rec.status, duration)
+		if accessLog == nil {
+			return
+		}
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.RequestURI()),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("durationMs", float64(duration.Microseconds())/1000),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			attrs = append(attrs, slog.String("forwardedFor", forwarded))
+		}
+		if agent := r.UserAgent(); agent != "" {
+			attrs = append(attrs, slog.String("userAgent", agent))
+		}
+		if referer := r.Referer(); referer != "" {
+			attrs = append(attrs, slog.String("referer", referer))
+		}
+		accessLog.Info("request", attrs...)
+	})
+}
+
+// newAccessLog returns the logger of the access log format given with
+// -access-log, nil when it is off
+func newAccessLog(format string) (*slog.Logger, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown access log format %q, use text or json", format)
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(data)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap gives http.ResponseController the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
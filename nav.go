@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// NavItem is an entry of the navigation menus given to templates. A
+// directory becomes an item whose children are its pages and subdirectories,
+// linking to the directory's _index.md when there is one.
+type NavItem struct {
+	Title    string
+	URL      string
+	Path     string     // Page or directory path within the content tree
+	IsDir    bool       // Whether the item is a section directory
+	Active   bool       // The current page is this item or inside it
+	Current  bool       // This item is the current page
+	Children []*NavItem // Pages and subdirectories of a section
+}
+
+// buildNavTree arranges the pages shown in navigation into a tree of
+// directories, in page order
+func (s *Site) buildNavTree() []*NavItem {
+	root := &NavItem{IsDir: true, Path: "."}
+	dirs := map[string]*NavItem{".": root}
+
+	// dirItem returns the item for a directory, creating it and its parents
+	var dirItem func(dir string) *NavItem
+	dirItem = func(dir string) *NavItem {
+		if item, ok := dirs[dir]; ok {
+			return item
+		}
+		parent := dirItem(path.Dir(dir))
+		item := &NavItem{Title: humanize(path.Base(dir)), Path: dir, IsDir: true}
+		parent.Children = append(parent.Children, item)
+		dirs[dir] = item
+		return item
+	}
+
+	for _, page := range s.pages {
+		if !page.InNav() || !s.inNav(page.Path) {
+			continue
+		}
+
+		dir := path.Dir(page.Path)
+		if path.Base(page.Path) == sectionIndexFile && dir != "." {
+			item := dirItem(dir)
+			item.Title = page.navTitle()
+			item.URL = page.URL
+			continue
+		}
+
+		parent := dirItem(dir)
+		parent.Children = append(parent.Children, &NavItem{
+			Title: page.navTitle(),
+			URL:   page.URL,
+			Path:  page.Path,
+		})
+	}
+
+	return root.Children
+}
+
+// navTitle is the title shown for the page in navigation: its front matter
+// title, otherwise its file name without the extension
+func (p *Page) navTitle() string {
+	if title, ok := p.Params["title"].(string); ok && title != "" {
+		return title
+	}
+	name := path.Base(p.Path)
+	if name == sectionIndexFile {
+		if path.Dir(p.Path) == "." {
+			return "Home"
+		}
+		return humanize(path.Base(path.Dir(p.Path)))
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// markActive returns navigation items with the items on the way to the
+// current page marked active. Only those items are copied; the rest of the
+// tree is shared between pages and must not be changed.
+func markActive(items []*NavItem, current string) []*NavItem {
+	var marked []*NavItem
+	for i, item := range items {
+		isCurrent := !item.IsDir && item.Path == current
+		if !isCurrent && !(item.IsDir && strings.HasPrefix(current, item.Path+"/")) {
+			continue
+		}
+
+		if marked == nil {
+			marked = append([]*NavItem(nil), items...)
+		}
+		copied := *item
+		copied.Current = isCurrent
+		copied.Active = true
+		copied.Children = markActive(item.Children, current)
+		marked[i] = &copied
+	}
+	if marked == nil {
+		return items
+	}
+	return marked
+}
+
+// topMenu returns the top-level menu: the root pages and sections, without
+// their children
+func topMenu(tree []*NavItem) []*NavItem {
+	menu := make([]*NavItem, len(tree))
+	for i, item := range tree {
+		copied := *item
+		copied.Children = nil
+		menu[i] = &copied
+	}
+	return menu
+}
+
+// sidebar returns the navigation tree of the top-level section the current
+// page is in, or nothing for pages at the root
+func sidebar(tree []*NavItem) []*NavItem {
+	for _, item := range tree {
+		if item.IsDir && item.Active {
+			return item.Children
+		}
+	}
+	return nil
+}
+
+// SidebarConfig controls how the sidebar tree is rendered
+type SidebarConfig struct {
+	MaxDepth      int   `yaml:"maxDepth"`      // Levels of the tree shown, 0 for all
+	Collapsed     bool  `yaml:"collapsed"`     // Sections start collapsed
+	ExpandCurrent *bool `yaml:"expandCurrent"` // Keep the current page's sections open, defaults to true
+}
+
+// renderSidebar renders the sidebar tree as collapsible nested lists. The
+// classes and ARIA attributes give the initial state, which sidebar.js lets
+// readers change.
+func (s *Site) renderSidebar(items []*NavItem) template.HTML {
+	if len(items) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, `<nav class="sidebar" aria-label="%s"><ul>`, template.HTMLEscapeString(s.translate("sectionNavigation")))
+	s.renderSidebarList(&out, items, 1)
+	out.WriteString("</ul></nav>")
+	return template.HTML(out.String())
+}
+
+// renderSidebarList renders one level of the sidebar tree, stopping at the
+// configured depth
+func (s *Site) renderSidebarList(out *strings.Builder, items []*NavItem, depth int) {
+	for _, item := range items {
+		classes := []string{"sidebar-page"}
+		if item.IsDir {
+			classes[0] = "sidebar-section"
+		}
+		if item.Active {
+			classes = append(classes, "is-active")
+		}
+		if item.Current {
+			classes = append(classes, "is-current")
+		}
+
+		open := len(item.Children) > 0 && (s.Sidebar.MaxDepth == 0 || depth < s.Sidebar.MaxDepth)
+		expanded := !s.Sidebar.Collapsed || (item.Active && boolSetting(s.Sidebar.ExpandCurrent, true))
+		if open && expanded {
+			classes = append(classes, "is-expanded")
+		} else if open {
+			classes = append(classes, "is-collapsed")
+		}
+
+		fmt.Fprintf(out, `<li class="%s">`, strings.Join(classes, " "))
+
+		listID := "sidebar-" + slugify(item.Path)
+		title := template.HTMLEscapeString(item.Title)
+		if open {
+			fmt.Fprintf(out, `<button type="button" class="sidebar-toggle" aria-expanded="%t" aria-controls="%s" aria-label="%s"></button>`,
+				expanded, listID, template.HTMLEscapeString(s.translate("toggleSection", item.Title)))
+		}
+
+		switch {
+		case item.URL == "":
+			out.WriteString(title)
+		case item.Current:
+			fmt.Fprintf(out, `<a href="%s" aria-current="page">%s</a>`, template.HTMLEscapeString(item.URL), title)
+		default:
+			fmt.Fprintf(out, `<a href="%s">%s</a>`, template.HTMLEscapeString(item.URL), title)
+		}
+
+		if open {
+			hidden := ""
+			if !expanded {
+				hidden = " hidden"
+			}
+			fmt.Fprintf(out, `<ul id="%s"%s>`, listID, hidden)
+			s.renderSidebarList(out, item.Children, depth+1)
+			out.WriteString("</ul>")
+		}
+
+		out.WriteString("</li>")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+)
+
+const navJSONFile = "nav.json" // Navigation tree for client-side apps, at the root of the output
+
+// navJSONItem is an entry of the navigation tree written to nav.json
+type navJSONItem struct {
+	Title    string         `json:"title"`
+	URL      string         `json:"url,omitempty"` // Empty for sections without an _index.md
+	Path     string         `json:"path"`          // Page or directory path within the content tree
+	Section  bool           `json:"section,omitempty"`
+	Weight   int            `json:"weight"`
+	Children []*navJSONItem `json:"children,omitempty"`
+}
+
+// writeNavJSON writes the site's navigation tree as nav.json, with the
+// titles, URLs, weights and nesting of its sections and pages in the order
+// the navigation shows them, for single page apps and browser extensions
+// that would otherwise scrape the menus from the HTML
+func (s *Site) writeNavJSON() error {
+	if !s.NavJSON {
+		return nil
+	}
+
+	weights := make(map[string]int, len(s.pages))
+	for _, page := range s.pages {
+		weights[page.Path] = page.Weight
+	}
+	var convert func(items []*NavItem) []*navJSONItem
+	convert = func(items []*NavItem) []*navJSONItem {
+		list := make([]*navJSONItem, 0, len(items))
+		for _, item := range items {
+			entry := &navJSONItem{Title: item.Title, URL: item.URL, Path: item.Path, Section: item.IsDir, Weight: weights[item.Path]}
+			if item.IsDir {
+				entry.Weight = weights[path.Join(item.Path, sectionIndexFile)]
+				entry.Children = convert(item.Children)
+			}
+			list = append(list, entry)
+		}
+		return list
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Site  string         `json:"site"`
+		Items []*navJSONItem `json:"items"`
+	}{s.Name, convert(s.navTree)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.output.WriteFile(navJSONFile, data)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+const (
+	serviceWorkerFile    = "sw.js"                  // Service worker written to the output root
+	precacheManifestFile = "precache-manifest.json" // URLs the service worker caches on install
+)
+
+// serviceWorkerScript caches every URL of the precache manifest when it is
+// installed and answers from the cache first, falling back to the network.
+// Caches of older builds are removed once the new worker takes over.
+const serviceWorkerScript = `// Service worker generated by mindoc
+var CACHE = %q;
+var MANIFEST = %q;
+
+self.addEventListener("install", function (event) {
+  event.waitUntil(
+    fetch(MANIFEST)
+      .then(function (response) { return response.json(); })
+      .then(function (manifest) {
+        return caches.open(CACHE).then(function (cache) {
+          return cache.addAll(manifest.urls);
+        });
+      })
+      .then(function () { return self.skipWaiting(); })
+  );
+});
+
+self.addEventListener("activate", function (event) {
+  event.waitUntil(
+    caches.keys().then(function (keys) {
+      return Promise.all(keys.map(function (key) {
+        if (key !== CACHE && key.indexOf("mindoc-") === 0) {
+          return caches.delete(key);
+        }
+      }));
+    }).then(function () { return self.clients.claim(); })
+  );
+});
+
+self.addEventListener("fetch", function (event) {
+  if (event.request.method !== "GET") {
+    return;
+  }
+  event.respondWith(
+    caches.match(event.request, { ignoreSearch: true }).then(function (cached) {
+      return cached || fetch(event.request);
+    })
+  );
+});
+`
+
+// precacheManifest lists the files of a build for the service worker
+type precacheManifest struct {
+	Version string   `json:"version"` // Hash of every file, changing whenever the output does
+	URLs    []string `json:"urls"`
+}
+
+// writeServiceWorker writes the service worker and the manifest of every
+// generated file it precaches, so the site can be read offline
+func (s *Site) writeServiceWorker() error {
+	if !s.Offline {
+		return nil
+	}
+
+	// Files the host serves to no one, or only after a login, would fail
+	// the install of the service worker
+	unfetchable := make(map[string]bool)
+	for _, page := range s.pages {
+		if page.protected() {
+			for _, out := range s.pageOutputs(page) {
+				unfetchable[out] = true
+			}
+		}
+	}
+
+	hash := sha256.New()
+	var manifest precacheManifest
+	err := s.output.Walk(func(relPath string) error {
+		if relPath == serviceWorkerFile || relPath == precacheManifestFile || strings.HasSuffix(relPath, printSuffix) ||
+			unfetchable[relPath] || isHostFile(relPath) {
+			return nil
+		}
+
+		data, err := s.output.ReadFile(relPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00", relPath)
+		hash.Write(data)
+
+		manifest.URLs = append(manifest.URLs, s.url(relPath))
+		if strings.HasSuffix(relPath, "index.html") {
+			manifest.URLs = append(manifest.URLs, s.url(strings.TrimSuffix(relPath, "index.html")))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list generated files: %w", err)
+	}
+
+	sort.Strings(manifest.URLs)
+	manifest.Version = hex.EncodeToString(hash.Sum(nil))[:12]
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = s.output.WriteFile(precacheManifestFile, data)
+	if err != nil {
+		return fmt.Errorf("failed to write precache manifest: %w", err)
+	}
+
+	script := fmt.Sprintf(serviceWorkerScript, "mindoc-"+manifest.Version, s.url(precacheManifestFile))
+	err = s.output.WriteFile(serviceWorkerFile, []byte(script))
+	if err != nil {
+		return fmt.Errorf("failed to write service worker: %w", err)
+	}
+
+	return nil
+}
+
+// serviceWorkerTag returns the script registering the service worker
+func (s *Site) serviceWorkerTag() template.HTML {
+	if !s.Offline {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<script>if ("serviceWorker" in navigator) { navigator.serviceWorker.register(%q); }</script>`,
+		s.url(serviceWorkerFile)))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+const onThisPageDepth = 3 // Deepest heading level the "On this page" navigation lists
+
+// wantsOnThisPage reports whether the page shows the "On this page"
+// navigation next to its content. The page's onThisPage front matter wins
+// over its section's default.
+func (p *Page) wantsOnThisPage() bool {
+	if show, ok := p.Params["onThisPage"].(bool); ok {
+		return show
+	}
+	return boolSetting(p.settings.OnThisPage, false)
+}
+
+// renderOnThisPage renders the outline of a page as the sticky "On this
+// page" navigation, listing the headings with anchors from the second
+// level down to onThisPageDepth. onthispage.js highlights the heading of
+// the part being read.
+func (s *Site) renderOnThisPage(page *Page) template.HTML {
+	if !page.wantsOnThisPage() {
+		return ""
+	}
+
+	// The headings below a title heading are listed in its place
+	var headings []*OutlineHeading
+	for _, heading := range page.Outline {
+		if heading.Level == 1 {
+			headings = append(headings, heading.Children...)
+		} else {
+			headings = append(headings, heading)
+		}
+	}
+	var list strings.Builder
+	s.renderOnThisPageList(&list, headings)
+	if list.Len() == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, `<nav class="on-this-page" aria-label="%s"><p class="on-this-page-title">%s</p>%s</nav>`,
+		template.HTMLEscapeString(s.translate("onThisPage")), template.HTMLEscapeString(s.translate("onThisPage")), list.String())
+	fmt.Fprintf(&out, `<script src="%s" defer></script>`, template.HTMLEscapeString(s.url(cssDestDir+"/onthispage.js")))
+	return template.HTML(out.String())
+}
+
+// renderOnThisPageList renders the listed headings of one level of an
+// outline
+func (s *Site) renderOnThisPageList(out *strings.Builder, headings []*OutlineHeading) {
+	var items strings.Builder
+	for _, heading := range headings {
+		if heading.Level > onThisPageDepth || heading.ID == "" {
+			continue
+		}
+		fmt.Fprintf(&items, `<li><a href="#%s">%s</a>`, template.HTMLEscapeString(heading.ID), template.HTMLEscapeString(heading.Text))
+		s.renderOnThisPageList(&items, heading.Children)
+		items.WriteString("</li>")
+	}
+	if items.Len() > 0 {
+		out.WriteString("<ul>")
+		out.WriteString(items.String())
+		out.WriteString("</ul>")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// sortPages puts the pages in the order used by the navigation bar and
+// .Site.Pages. Within each directory the _index.md comes first, followed by
+// the entries named in its order list in that order, then the rest by
+// weight and finally by name. A subdirectory is placed using the weight of
+// its own _index.md.
+func (s *Site) sortPages() {
+	byPath := make(map[string]*Page)
+	orders := make(map[string]map[string]int)
+	for _, page := range s.pages {
+		byPath[page.Path] = page
+
+		list, ok := page.Params["order"].([]interface{})
+		if !ok || path.Base(page.Path) != sectionIndexFile {
+			continue
+		}
+		order := make(map[string]int)
+		for i, name := range list {
+			order[strings.Trim(fmt.Sprint(name), "/")] = i
+		}
+		orders[path.Dir(page.Path)] = order
+	}
+
+	// rank returns the sort keys of an entry in a directory
+	rank := func(dir, name string, isFile bool) (int, int) {
+		// The section's own page leads its directory
+		if isFile && name == sectionIndexFile {
+			return -1, 0
+		}
+
+		position := -1
+		if order, ok := orders[dir]; ok {
+			if i, ok := order[name]; ok {
+				position = i
+			} else if i, ok := order[strings.TrimSuffix(name, path.Ext(name))]; ok && isFile {
+				position = i
+			}
+		}
+		if position < 0 {
+			position = len(orders[dir])
+		}
+
+		var weight int
+		if isFile {
+			weight = byPath[path.Join(dir, name)].Weight
+		} else if index, ok := byPath[path.Join(dir, name, sectionIndexFile)]; ok {
+			weight = index.Weight
+		}
+
+		return position, weight
+	}
+
+	sort.SliceStable(s.pages, func(i, j int) bool {
+		a := strings.Split(s.pages[i].Path, "/")
+		b := strings.Split(s.pages[j].Path, "/")
+
+		// Compare the first entries where the paths part ways
+		n := 0
+		for n < len(a)-1 && n < len(b)-1 && a[n] == b[n] {
+			n++
+		}
+		dir := path.Join(a[:n]...)
+		if dir == "" {
+			dir = "."
+		}
+
+		posA, weightA := rank(dir, a[n], n == len(a)-1)
+		posB, weightB := rank(dir, b[n], n == len(b)-1)
+		switch {
+		case posA != posB:
+			return posA < posB
+		case weightA != weightB:
+			return weightA < weightB
+		}
+		return a[n] < b[n]
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+const (
+	outlineFile   = "outline.json"  // Outline of every page, at the root of the output
+	outlineSuffix = ".outline.json" // Replaces .html in the path of a page's own outline
+)
+
+// OutlineHeading is a heading of a page with the headings below it, as
+// .Page.Outline gives them to templates and the outline files list them
+type OutlineHeading struct {
+	Level    int               `json:"level"`
+	Text     string            `json:"text"`
+	ID       string            `json:"id,omitempty"` // Anchor of the heading, empty when headings get no IDs
+	Children []*OutlineHeading `json:"children,omitempty"`
+}
+
+// pageOutline is the outline of a page as the outline files hold it
+type pageOutline struct {
+	Page     string            `json:"page"`
+	Title    string            `json:"title"`
+	URL      string            `json:"url"`
+	Headings []*OutlineHeading `json:"headings"`
+}
+
+// headingOutline arranges the headings of a parsed page into a tree, each
+// heading holding the deeper ones up to the next heading of its level or
+// above. A heading skipping levels goes below the closest one above it.
+func headingOutline(doc ast.Node, source []byte) []*OutlineHeading {
+	outline := []*OutlineHeading{}
+	var open []*OutlineHeading
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			continue
+		}
+
+		item := &OutlineHeading{Level: heading.Level, Text: strings.TrimSpace(string(heading.Text(source)))}
+		if id, ok := heading.AttributeString("id"); ok {
+			idBytes, _ := id.([]byte)
+			item.ID = string(idBytes)
+		}
+
+		for len(open) > 0 && open[len(open)-1].Level >= item.Level {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			outline = append(outline, item)
+		} else {
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, item)
+		}
+		open = append(open, item)
+	}
+	return outline
+}
+
+// outlinePath returns the path within the output of a page's outline file
+func outlinePath(htmlFileName string) string {
+	return strings.TrimSuffix(htmlFileName, ".html") + outlineSuffix
+}
+
+// writeOutlines writes the outline of every page next to it, and the
+// outlines of all of them to outline.json, for tools that need the
+// structure of the pages without parsing their HTML. Hidden and protected
+// pages are left out, as they are of the chunks export.
+func (s *Site) writeOutlines() error {
+	if !s.Outline {
+		return nil
+	}
+
+	outlines := []pageOutline{}
+	for _, page := range s.pages {
+		if page.Hidden || page.protected() || page.Outline == nil {
+			continue
+		}
+		outline := pageOutline{Page: page.Path, Title: page.Title, URL: page.URL, Headings: page.Outline}
+		data, err := json.MarshalIndent(outline, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = s.output.WriteFile(outlinePath(s.outputPath(page.Path)), data)
+		if err != nil {
+			return err
+		}
+		outlines = append(outlines, outline)
+	}
+
+	data, err := json.MarshalIndent(outlines, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.output.WriteFile(outlineFile, data)
+}
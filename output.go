@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildOutput receives the files generated by a build. Paths are slash
+// separated and relative to the root of the site.
+type buildOutput interface {
+	WriteFile(relPath string, data []byte) error
+	Create(relPath string) (io.WriteCloser, error)
+	CopyFile(relPath, srcPath string) error
+	ReadFile(relPath string) ([]byte, error)
+	Exists(relPath string) bool
+	Remove(relPath string) error
+	Walk(fn func(relPath string) error) error
+}
+
+// dirOutput writes the generated files into a directory
+type dirOutput string
+
+// WriteFile writes a file, creating its directory if needed
+func (d dirOutput) WriteFile(relPath string, data []byte) error {
+	destPath := filepath.Join(string(d), filepath.FromSlash(relPath))
+	err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	return ioutil.WriteFile(destPath, data, 0644)
+}
+
+// Create opens a file for writing, creating its directory if needed
+func (d dirOutput) Create(relPath string) (io.WriteCloser, error) {
+	destPath := filepath.Join(string(d), filepath.FromSlash(relPath))
+	err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directories: %w", err)
+	}
+	return os.Create(destPath)
+}
+
+// CopyFile copies a file into the directory
+func (d dirOutput) CopyFile(relPath, srcPath string) error {
+	return copyFile(srcPath, filepath.Join(string(d), filepath.FromSlash(relPath)))
+}
+
+// ReadFile reads a generated file
+func (d dirOutput) ReadFile(relPath string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(relPath)))
+}
+
+// Exists reports whether a file was generated
+func (d dirOutput) Exists(relPath string) bool {
+	info, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(relPath)))
+	return err == nil && !info.IsDir()
+}
+
+// Remove deletes a generated file, if there is one
+func (d dirOutput) Remove(relPath string) error {
+	err := os.Remove(filepath.Join(string(d), filepath.FromSlash(relPath)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Walk calls fn for every generated file in lexical order
+func (d dirOutput) Walk(fn func(relPath string) error) error {
+	return filepath.Walk(string(d), func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(string(d), filePath)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(relPath))
+	})
+}
+
+// memoryOutput keeps the generated files in memory, for previews that
+// shouldn't write to disk
+type memoryOutput struct {
+	files   map[string][]byte
+	modTime time.Time // When the build started, the modification time of every file
+}
+
+// newMemoryOutput creates an empty in-memory output
+func newMemoryOutput() *memoryOutput {
+	return &memoryOutput{files: make(map[string][]byte), modTime: time.Now()}
+}
+
+// WriteFile stores a file
+func (m *memoryOutput) WriteFile(relPath string, data []byte) error {
+	m.files[path.Clean(relPath)] = data
+	return nil
+}
+
+// memoryFile collects the data written to a file, stored once it is closed
+type memoryFile struct {
+	bytes.Buffer
+	output  *memoryOutput
+	relPath string
+}
+
+// Close stores the file's data
+func (f *memoryFile) Close() error {
+	return f.output.WriteFile(f.relPath, f.Bytes())
+}
+
+// Create returns a file that is stored once it is closed
+func (m *memoryOutput) Create(relPath string) (io.WriteCloser, error) {
+	return &memoryFile{output: m, relPath: relPath}, nil
+}
+
+// CopyFile stores a copy of a file from disk
+func (m *memoryOutput) CopyFile(relPath, srcPath string) error {
+	data, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read source file: %w", err)
+	}
+	return m.WriteFile(relPath, data)
+}
+
+// ReadFile returns a stored file
+func (m *memoryOutput) ReadFile(relPath string) ([]byte, error) {
+	data, ok := m.files[path.Clean(relPath)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+// Exists reports whether a file is stored
+func (m *memoryOutput) Exists(relPath string) bool {
+	_, ok := m.files[path.Clean(relPath)]
+	return ok
+}
+
+// Remove deletes a stored file, if there is one
+func (m *memoryOutput) Remove(relPath string) error {
+	delete(m.files, path.Clean(relPath))
+	return nil
+}
+
+// Walk calls fn for every stored file in lexical order
+func (m *memoryOutput) Walk(fn func(relPath string) error) error {
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := fn(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the stored files like a file server would serve them
+// from a directory, using index.html for directories
+func (m *memoryOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	data, ok := m.files[name]
+	if !ok {
+		index := path.Join(name, "index.html")
+		if _, ok := m.files[index]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+			return
+		}
+		name, data = index, m.files[index]
+	}
+
+	http.ServeContent(w, r, name, m.modTime, bytes.NewReader(data))
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const sectionIndexFile = "_index.md" // Page describing the directory it is in
+
+// Page is a page of the site
+type Page struct {
+	Path         string                 // Source file path within the content tree
+	Section      string                 // Top-level directory the page is in, "" for the root
+	Title        string                 // Title from front matter, or the file name
+	Date         time.Time              // Date from front matter
+	PublishDate  time.Time              // Time the page appears in builds from, zero when always
+	ExpiryDate   time.Time              // Time the page disappears from builds at, zero when never
+	Lastmod      time.Time              // Time the page was last changed from front matter, zero when unset
+	Weight       int                    // Ordering weight from front matter
+	Tags         []string               // Tags from front matter
+	Authors      []*Author              // Profiles of the authors named in front matter
+	Series       *Series                // Series the page is a part of, nil when none
+	SeriesPart   int                    // Position of the page in its series, from 1
+	Cover        string                 // Cover image from front matter, relative to the page
+	Layout       string                 // Template the page is rendered with, page.html when empty
+	Outputs      []string               // Formats the page is written in besides HTML, such as txt or json
+	Hidden       bool                   // Reachable by URL but left out of navigation and listings
+	Audience     []string               // Audiences the page is written for, everyone when empty
+	Visibility   string                 // public, or protected when the host should ask for a login
+	Aliases      []string               // URLs the page had before it moved, redirecting to it
+	Deprecated   bool                   // Documents something deprecated, from front matter
+	Since        string                 // Version the documented feature was added in, such as v2.1
+	Removed      string                 // Version the documented feature is removed in
+	Params       map[string]interface{} // Every front matter value
+	URL          string                 // URL of the generated page
+	Outline      []*OutlineHeading      // Headings of a markdown page as a tree, set once it is rendered
+	Translations []Translation          // The page in each language of the site's translations, itself included, empty when it has none
+	Outdated     *Translation           // The page in the source language when it changed after this translation, nil otherwise
+	Fallback     *Translation           // The page in the source language it was taken from, when the site has no translation of it
+	Stale        bool                   // Not updated for longer than the warnIfOlderThan setting
+
+	srcPath    string                 // File the page is read from
+	body       []byte                 // Source without the front matter
+	bodyLine   int                    // Line of the file the body starts on
+	cascade    map[string]interface{} // Defaults for descendant pages, set on _index.md
+	settings   SectionConfig          // Settings of the section the page is in
+	navExclude bool                   // Left out of the navigation bar only
+	authorIDs  []string               // Authors named in front matter
+	seriesName string                 // Series named in front matter
+	seriesPart int                    // Position asked for in front matter, 0 when unset
+
+	sitemap        sitemapSettings // Change frequency and priority in the sitemap from front matter
+	sitemapExclude bool            // Left out of the sitemap
+}
+
+// frontMatter holds the front matter keys mindoc understands
+type frontMatter struct {
+	Title      string   `yaml:"title"`
+	Weight     int      `yaml:"weight"`
+	Tags       []string `yaml:"tags"`
+	Layout     string   `yaml:"layout"`
+	Hidden     bool     `yaml:"hidden"`
+	NavExclude bool     `yaml:"navExclude"`
+	Outputs    []string `yaml:"outputs"`
+	Authors    []string `yaml:"authors"`
+	Series     string   `yaml:"series"`
+	SeriesPart int      `yaml:"seriesPart"`
+	Cover      string   `yaml:"cover"`
+	Visibility string   `yaml:"visibility"`
+	Aliases    []string `yaml:"aliases"`
+	Deprecated bool     `yaml:"deprecated"`
+	Since      string   `yaml:"since"`
+	Removed    string   `yaml:"removed"`
+
+	Sitemap        sitemapSettings `yaml:"sitemap"`
+	SitemapExclude bool            `yaml:"sitemapExclude"`
+}
+
+// Pages is a collection of pages usable from templates, for example
+// {{ range first 5 (.Site.Pages.InSection "tutorials").ByDate.Reverse }}
+type Pages []*Page
+
+// loadPages reads every page in the content tree
+func (s *Site) loadPages() error {
+	s.pages = nil
+	s.sections = make(map[string]SectionConfig)
+
+	err := s.scanContent()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range s.files {
+		if file.Info.Name() == sectionConfigFile {
+			err = s.loadSectionConfig(file.SrcPath, file.RelPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !s.isPage(file.RelPath) {
+			continue
+		}
+
+		page, err := s.loadPage(file.SrcPath, file.RelPath)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", file.SrcPath, err)
+		}
+		s.pages = append(s.pages, page)
+	}
+	err = s.loadFallbackPages()
+	if err != nil {
+		return err
+	}
+
+	for _, page := range s.pages {
+		err = s.loadSectionFrontMatter(page)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.applyCascades()
+	for _, page := range s.pages {
+		page.settings = s.sectionSettings(page.Path)
+		err = page.applyFrontMatter()
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", page.srcPath, err)
+		}
+		err = s.applyConditions(page)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", page.srcPath, err)
+		}
+		s.applyReplacements(page)
+	}
+
+	s.filterPublished(time.Now())
+	s.markStalePages(time.Now())
+	s.filterAudience()
+	s.sortPages()
+
+	err = s.resolveAuthors()
+	if err != nil {
+		return err
+	}
+	err = s.resolveSeries()
+	if err != nil {
+		return err
+	}
+	err = s.loadGlossary()
+	if err != nil {
+		return err
+	}
+	err = s.loadBibliography()
+	if err != nil {
+		return err
+	}
+	err = s.loadAbbreviations()
+	if err != nil {
+		return err
+	}
+
+	// Navigation only depends on the pages, so it is built once for all of them
+	s.navLinks = s.navEntries()
+	s.navTree = s.buildNavTree()
+
+	return nil
+}
+
+// loadPage reads a page file and its front matter
+func (s *Site) loadPage(srcPath, relPath string) (*Page, error) {
+	mdContent, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	params, body, err := parseFrontMatter(mdContent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	page := &Page{
+		Path:    relPath,
+		Params:  params,
+		URL:     s.pageURL(relPath),
+		srcPath: srcPath,
+		body:    body,
+	}
+	page.bodyLine = 1 + bytes.Count(mdContent, []byte("\n")) - bytes.Count(body, []byte("\n"))
+	if dir := path.Dir(relPath); dir != "." {
+		page.Section = strings.SplitN(dir, "/", 2)[0]
+	}
+
+	// A section's cascade block is kept apart from its own values
+	if cascade, ok := params["cascade"]; ok {
+		page.cascade, ok = cascade.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cascade must be a mapping of front matter values")
+		}
+		delete(params, "cascade")
+	}
+
+	return page, nil
+}
+
+// applyFrontMatter sets the page fields mindoc understands from the front
+// matter values
+func (p *Page) applyFrontMatter() error {
+	data, err := yaml.Marshal(p.Params)
+	if err != nil {
+		return err
+	}
+
+	var fm frontMatter
+	err = yaml.Unmarshal(data, &fm)
+	if err != nil {
+		return fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	p.Title = fm.Title
+	if date, ok := p.Params["date"]; ok {
+		p.Date, err = toTime(date)
+		if err != nil {
+			return fmt.Errorf("invalid date: %w", err)
+		}
+	}
+	if date, ok := p.Params["lastmod"]; ok {
+		p.Lastmod, err = toTime(date)
+		if err != nil {
+			return fmt.Errorf("invalid lastmod: %w", err)
+		}
+	}
+	if date, ok := p.Params["publishDate"]; ok {
+		p.PublishDate, err = toTime(date)
+		if err != nil {
+			return fmt.Errorf("invalid publishDate: %w", err)
+		}
+	}
+	if date, ok := p.Params["expiryDate"]; ok {
+		p.ExpiryDate, err = toTime(date)
+		if err != nil {
+			return fmt.Errorf("invalid expiryDate: %w", err)
+		}
+	}
+	p.Weight = fm.Weight
+	p.Tags = fm.Tags
+	p.Layout = fm.Layout
+	p.Hidden = fm.Hidden
+	p.navExclude = fm.NavExclude
+	p.authorIDs = fm.Authors
+	p.seriesName = strings.TrimSpace(fm.Series)
+	p.seriesPart = fm.SeriesPart
+	p.Cover = fm.Cover
+	p.Audience, err = parseAudience(p.Params["audience"])
+	if err != nil {
+		return err
+	}
+	p.Aliases = fm.Aliases
+	p.Deprecated = fm.Deprecated
+	p.Since = strings.TrimSpace(fm.Since)
+	p.Removed = strings.TrimSpace(fm.Removed)
+	p.sitemap = fm.Sitemap
+	p.sitemapExclude = fm.SitemapExclude
+	err = p.sitemap.validate()
+	if err != nil {
+		return err
+	}
+	p.Visibility = fm.Visibility
+	switch p.Visibility {
+	case "":
+		p.Visibility = visibilityPublic
+	case visibilityPublic, visibilityProtected:
+	default:
+		return fmt.Errorf("invalid visibility %q, use public or protected", p.Visibility)
+	}
+	p.Outputs, err = parseOutputs(fm.Outputs)
+	if err != nil {
+		return err
+	}
+	if p.Layout == "" {
+		p.Layout = p.settings.Layout
+	}
+	if p.Title == "" {
+		p.Title = filepath.Base(p.srcPath)
+	}
+
+	return nil
+}
+
+// applyCascades gives every page the default front matter values from the
+// cascade blocks of the _index.md files in the directories above it. Values
+// set by the page itself win, then those of the closest section.
+func (s *Site) applyCascades() {
+	cascades := make(map[string]map[string]interface{})
+	for _, page := range s.pages {
+		if path.Base(page.Path) == sectionIndexFile && page.cascade != nil {
+			cascades[path.Dir(page.Path)] = page.cascade
+		}
+	}
+	if len(cascades) == 0 {
+		return
+	}
+
+	for _, page := range s.pages {
+		dir := path.Dir(page.Path)
+
+		// A section's cascade applies to its descendants, not itself
+		if path.Base(page.Path) == sectionIndexFile {
+			if dir == "." {
+				continue
+			}
+			dir = path.Dir(dir)
+		}
+
+		for {
+			for key, value := range cascades[dir] {
+				if _, ok := page.Params[key]; !ok {
+					page.Params[key] = value
+				}
+			}
+			if dir == "." {
+				break
+			}
+			dir = path.Dir(dir)
+		}
+	}
+}
+
+// Pages returns every page of the site
+func (s *Site) Pages() Pages {
+	return s.pages
+}
+
+// InSection returns the pages in a top-level section
+func (p Pages) InSection(section string) Pages {
+	var result Pages
+	for _, page := range p {
+		if page.Section == section {
+			result = append(result, page)
+		}
+	}
+	return result
+}
+
+// Tagged returns the pages with a tag
+func (p Pages) Tagged(tag string) Pages {
+	var result Pages
+	for _, page := range p {
+		for _, t := range page.Tags {
+			if strings.EqualFold(t, tag) {
+				result = append(result, page)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// WithParam returns the pages whose front matter has a key set to a value
+func (p Pages) WithParam(key string, value interface{}) Pages {
+	var result Pages
+	for _, page := range p {
+		if v, ok := page.Params[key]; ok && compareValues(v, value) == 0 {
+			result = append(result, page)
+		}
+	}
+	return result
+}
+
+// sorted returns a sorted copy of the pages
+func (p Pages) sorted(less func(a, b *Page) bool) Pages {
+	result := make(Pages, len(p))
+	copy(result, p)
+	sort.SliceStable(result, func(i, j int) bool {
+		return less(result[i], result[j])
+	})
+	return result
+}
+
+// ByWeight sorts the pages by weight, then title
+func (p Pages) ByWeight() Pages {
+	return p.sorted(func(a, b *Page) bool {
+		if a.Weight != b.Weight {
+			return a.Weight < b.Weight
+		}
+		return a.Title < b.Title
+	})
+}
+
+// ByDate sorts the pages from oldest to newest
+func (p Pages) ByDate() Pages {
+	return p.sorted(func(a, b *Page) bool {
+		return a.Date.Before(b.Date)
+	})
+}
+
+// ByTitle sorts the pages alphabetically by title
+func (p Pages) ByTitle() Pages {
+	return p.sorted(func(a, b *Page) bool {
+		return a.Title < b.Title
+	})
+}
+
+// Reverse returns the pages in the opposite order
+func (p Pages) Reverse() Pages {
+	result := make(Pages, len(p))
+	for i, page := range p {
+		result[len(p)-1-i] = page
+	}
+	return result
+}
+
+// InNav reports whether the page is shown in the navigation bar
+func (p *Page) InNav() bool {
+	return !p.Hidden && !p.navExclude
+}
+
+// updated returns when the page last changed: its lastmod, or its date
+// without one
+func (p *Page) updated() time.Time {
+	if !p.Lastmod.IsZero() {
+		return p.Lastmod
+	}
+	return p.Date
+}
+
+// Visible returns the pages that aren't hidden, for use in listings
+func (p Pages) Visible() Pages {
+	var result Pages
+	for _, page := range p {
+		if !page.Hidden {
+			result = append(result, page)
+		}
+	}
+	return result
+}
+
+// Param returns a front matter value of the page
+func (p *Page) Param(key string) interface{} {
+	return p.Params[key]
+}
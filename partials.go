@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+)
+
+const partialsDir = "partials" // Directory of the layout directory with the partials pages can call
+
+// partialData is what a partial template called from a page is executed
+// with
+type partialData struct {
+	Args map[string]string // Arguments of the shortcode, besides name and data
+	Data interface{}       // Front matter value named by the data argument, nil without one
+	Page *Page             // Page calling the partial
+	Site *Site             // Site the page belongs to
+}
+
+// loadPartials parses the templates of the partials directory into the
+// page templates, named by their path such as partials/pricing.html, so
+// pages and layouts can both call them
+func (t *Theme) loadPartials() error {
+	paths, err := filepath.Glob(filepath.Join(t.LayoutDir, partialsDir, "*.html"))
+	if err != nil {
+		return fmt.Errorf("failed to list partials: %w", err)
+	}
+	for _, partialPath := range paths {
+		data, err := ioutil.ReadFile(partialPath)
+		if err != nil {
+			return fmt.Errorf("failed to read partial: %w", err)
+		}
+		_, err = t.page.New(partialsDir + "/" + filepath.Base(partialPath)).Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse partial %s: %w", partialPath, err)
+		}
+	}
+	return nil
+}
+
+// partialShortcode renders a partial template of the layout directory in a
+// page, given as {{< partial name="pricing" data="plans" >}}. The partial
+// gets the other arguments as .Args, the page's front matter value named
+// by data as .Data, and .Page and .Site, so structured components such as
+// pricing tables can be written as front matter.
+func (s *Site) partialShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	name := args["name"]
+	if name == "" {
+		return "", fmt.Errorf("no name given")
+	}
+	tmpl := s.page.Lookup(partialsDir + "/" + name + ".html")
+	if tmpl == nil {
+		return "", fmt.Errorf("no partial %s.html in %s", name, filepath.Join(s.theme.LayoutDir, partialsDir))
+	}
+
+	pd := partialData{Args: make(map[string]string), Site: s}
+	for key, value := range args {
+		if key != "name" && key != "data" {
+			pd.Args[key] = value
+		}
+	}
+	for _, page := range s.pages {
+		if page.Path == pagePath {
+			pd.Page = page
+			break
+		}
+	}
+	if key := args["data"]; key != "" {
+		if pd.Page == nil || pd.Page.Params[key] == nil {
+			return "", fmt.Errorf("the page has no %s front matter", key)
+		}
+		pd.Data = pd.Page.Params[key]
+	}
+
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, pd)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// usesPartials reports whether a page body calls partials
+func usesPartials(body []byte) bool {
+	for _, m := range fileShortcode.FindAllSubmatch(body, -1) {
+		if name, _, ok := parseShortcode(string(m[1])); ok && name == "partial" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	previewPath = "/preview/"        // URL path the branch previews are served under
+	previewDir  = ".mindoc/previews" // Directory holding a git worktree of each previewed branch
+)
+
+// previewIndexTemplate lists the previewed branches at previewPath
+var previewIndexTemplate = template.Must(template.New("previews").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Branch previews</title>
+</head>
+<body>
+    <h1>Branch previews</h1>
+    {{ if . }}<ul>{{ range . }}
+        <li><a href="{{ .URL }}">{{ .Branch }}</a> <code>{{ .Commit }}</code></li>{{ end }}
+    </ul>{{ else }}
+    <p>No branch has been previewed yet.</p>{{ end }}
+</body>
+</html>
+`))
+
+// PreviewConfig enables the previews of the branches of the content
+// repository, built next to the sites and served under /preview/<branch>/
+type PreviewConfig struct {
+	Enabled  bool     `yaml:"enabled"`  // Build and serve a preview of every branch
+	Branches []string `yaml:"branches"` // Patterns of the branches to preview, such as docs/*, every branch when unset
+	Remote   string   `yaml:"remote"`   // Remote the branches are fetched from, origin when unset
+}
+
+// preview is the latest build of the sites from a branch
+type preview struct {
+	branch  string
+	commit  string
+	sites   []*Site
+	handler http.Handler
+}
+
+// previewer builds the sites from every branch of the repository holding
+// their content, each from a worktree of its own, and serves them from
+// memory. Branches are fetched and the previews of branches that changed
+// rebuilt on every refresh.
+type previewer struct {
+	cfg      *Config
+	repo     string // Top-level directory of the content repository
+	remote   string
+	patterns []string
+
+	mu       sync.RWMutex
+	previews map[string]*preview // By the branch's slug in the URL
+}
+
+// newPreviewer creates the previewer of the repository the first site's
+// content is in
+func newPreviewer(cfg *Config, sites []*Site) (*previewer, error) {
+	mounts := sites[0].localMounts()
+	repo, err := git(mounts[0].Source, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("the content of %s is not in a git repository: %w", strings.ToLower(sites[0].label()), err)
+	}
+	remote := cfg.Previews.Remote
+	if remote == "" {
+		remote = "origin"
+	}
+	for _, pattern := range cfg.Previews.Branches {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+		}
+	}
+	return &previewer{
+		cfg:      cfg,
+		repo:     repo,
+		remote:   remote,
+		patterns: cfg.Previews.Branches,
+		previews: make(map[string]*preview),
+	}, nil
+}
+
+// refresh fetches the branches and rebuilds the previews of those that
+// moved since their last build, dropping the previews of deleted branches.
+// A branch that fails to build keeps its previous preview.
+func (p *previewer) refresh() {
+	// Repositories without the remote preview their local branches
+	if _, err := git(p.repo, "remote", "get-url", p.remote); err == nil {
+		if _, err := git(p.repo, "fetch", "--quiet", "--prune", p.remote); err != nil {
+			log.Printf("Failed to fetch the branches to preview: %v", err)
+		}
+	}
+	refs, err := p.branches()
+	if err != nil {
+		log.Printf("Failed to list the branches to preview: %v", err)
+		return
+	}
+
+	branches := make([]string, 0, len(refs))
+	for branch := range refs {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	previewed := make(map[string]bool)
+	for _, branch := range branches {
+		slug := slugify(branch)
+		if slug == "" || previewed[slug] {
+			log.Printf("Not previewing branch %s: its URL %s%s/ is taken", branch, previewPath, slug)
+			continue
+		}
+		previewed[slug] = true
+
+		err := p.update(branch, slug, refs[branch])
+		if err != nil {
+			log.Printf("Failed to preview branch %s: %v", branch, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for slug, pv := range p.previews {
+		if previewed[slug] {
+			continue
+		}
+		delete(p.previews, slug)
+		if _, err := git(p.repo, "worktree", "remove", "--force", filepath.Join(previewDir, slug)); err != nil {
+			log.Printf("Failed to remove the preview of %s: %v", pv.branch, err)
+		}
+	}
+}
+
+// branches returns the refs of the branches to preview by name. A branch
+// on the remote wins over the local branch of the same name, which is
+// usually behind it.
+func (p *previewer) branches() (map[string]string, error) {
+	output, err := git(p.repo, "for-each-ref", "--format=%(refname)", "refs/heads", "refs/remotes/"+p.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string]string)
+	for _, ref := range strings.Split(output, "\n") {
+		if branch, ok := strings.CutPrefix(ref, "refs/remotes/"+p.remote+"/"); ok && branch != "HEAD" && p.wants(branch) {
+			refs[branch] = ref
+		}
+	}
+	for _, ref := range strings.Split(output, "\n") {
+		if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok && refs[branch] == "" && p.wants(branch) {
+			refs[branch] = ref
+		}
+	}
+	return refs, nil
+}
+
+// wants reports whether a branch matches the patterns of the branches to
+// preview
+func (p *previewer) wants(branch string) bool {
+	if len(p.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// update checks out a branch into its worktree and builds its preview,
+// unless the preview is already of its latest commit
+func (p *previewer) update(branch, slug, ref string) error {
+	commit, err := git(p.repo, "rev-parse", ref+"^{commit}")
+	if err != nil {
+		return err
+	}
+	p.mu.RLock()
+	current := p.previews[slug]
+	p.mu.RUnlock()
+	if current != nil && current.commit == commit {
+		return nil
+	}
+
+	worktree, err := filepath.Abs(filepath.Join(previewDir, slug))
+	if err != nil {
+		return err
+	}
+	if _, statErr := os.Stat(worktree); statErr != nil {
+		_, err = git(p.repo, "worktree", "add", "--quiet", "--force", "--detach", worktree, commit)
+	} else {
+		_, err = git(worktree, "checkout", "--quiet", "--force", "--detach", commit)
+	}
+	if err != nil {
+		return err
+	}
+
+	sites, err := newSites(p.previewConfig(worktree, slug))
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	mux := http.NewServeMux()
+	for _, site := range sites {
+		site.indexing = true
+		err = site.generateInMemory()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+		fs := site.guardOutput(site.servePrintVariants(site.serveMemory()))
+		mux.Handle(site.basePath, http.StripPrefix(strings.TrimSuffix(site.basePath, "/"), fs))
+		mux.Handle(site.url(searchPath), site.serveSearch())
+	}
+
+	p.mu.Lock()
+	p.previews[slug] = &preview{branch: branch, commit: commit, sites: sites, handler: mux}
+	p.mu.Unlock()
+	log.Printf("Preview of %s updated to %.7s at %s%s/", branch, commit, previewPath, slug)
+	return nil
+}
+
+// previewConfig returns the settings of the sites for the worktree of a
+// branch: the directories within the repository are taken from the
+// worktree, and the sites are served under the branch's preview path.
+// Bleve indexes are kept by site name, so previews search from memory only.
+func (p *previewer) previewConfig(worktree, slug string) *Config {
+	cfg := *p.cfg
+	cfg.ThemeDir = p.inWorktree(worktree, cfg.ThemeDir)
+	cfg.LayoutDir = p.inWorktree(worktree, cfg.LayoutDir)
+	cfg.I18nDir = p.inWorktree(worktree, cfg.I18nDir)
+	cfg.SiteConfig = p.previewSite(cfg.SiteConfig, worktree, slug)
+	if cfg.SiteConfig.BaseURL == "" {
+		cfg.SiteConfig.BaseURL = previewPath + slug + "/"
+	}
+	cfg.Sites = make([]SiteConfig, len(p.cfg.Sites))
+	for i, site := range p.cfg.Sites {
+		cfg.Sites[i] = p.previewSite(site, worktree, slug)
+	}
+	return &cfg
+}
+
+// previewSite returns the settings of a site for the worktree of a branch
+func (p *previewer) previewSite(site SiteConfig, worktree, slug string) SiteConfig {
+	site.ContentDir = p.inWorktree(worktree, site.ContentDir)
+	site.OutputDir = p.inWorktree(worktree, site.OutputDir)
+	mounts := make([]Mount, len(site.Mounts))
+	for i, mount := range site.Mounts {
+		mounts[i] = Mount{Source: p.inWorktree(worktree, mount.Source), Target: mount.Target}
+	}
+	site.Mounts = mounts
+	if len(site.GoDoc.Packages) > 0 {
+		dir := site.GoDoc.Dir
+		if dir == "" {
+			dir = "."
+		}
+		site.GoDoc.Dir = p.inWorktree(worktree, dir)
+	}
+	refs := make([]CLIReference, len(site.CLI))
+	for i, ref := range site.CLI {
+		refs[i] = ref
+		refs[i].File = p.inWorktree(worktree, ref.File)
+	}
+	site.CLI = refs
+
+	// Data files are read from the branch too, their defaults included
+	site.dataDir = p.inWorktree(worktree, ".")
+	site.Glossary.File = p.inWorktree(worktree, site.Glossary.File)
+	site.Authors.File = p.inWorktree(worktree, site.Authors.File)
+	site.Abbreviations = p.inWorktree(worktree, site.Abbreviations)
+	site.Bibliography = p.inWorktree(worktree, site.Bibliography)
+	site.Icons.Logo = p.inWorktree(worktree, site.Icons.Logo)
+
+	if site.BaseURL != "" {
+		site.BaseURL = previewBaseURL(site.BaseURL, slug)
+	}
+	site.Search.Bleve = false
+	return site
+}
+
+// inWorktree returns the path in the worktree of a directory within the
+// repository, and any other directory as it is
+func (p *previewer) inWorktree(worktree, dir string) string {
+	if dir == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	rel, err := filepath.Rel(p.repo, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return dir
+	}
+	return filepath.Join(worktree, rel)
+}
+
+// previewBaseURL moves a base URL under the preview path of a branch, so
+// https://docs.example.com/guide/ becomes
+// https://docs.example.com/preview/<branch>/guide/
+func previewBaseURL(baseURL, slug string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return previewPath + slug + "/"
+	}
+	u.Path = strings.TrimSuffix(previewPath+slug+path.Clean("/"+u.Path), "/") + "/"
+	return u.String()
+}
+
+// ServeHTTP serves the preview of the branch named by the first part of
+// the path below previewPath, or the list of previews at previewPath
+func (p *previewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slug, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, previewPath), "/")
+	p.mu.RLock()
+	pv := p.previews[slug]
+	p.mu.RUnlock()
+	if pv != nil {
+		pv.handler.ServeHTTP(w, r)
+		return
+	}
+	if slug != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type entry struct{ Branch, Commit, URL string }
+	var entries []entry
+	p.mu.RLock()
+	for _, pv := range p.previews {
+		entries = append(entries, entry{pv.branch, pv.commit[:7], pv.sites[0].basePath})
+	}
+	p.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Branch < entries[j].Branch
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	previewIndexTemplate.Execute(w, entries)
+}
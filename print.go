@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const printSuffix = ".print.html" // Ending of the print variant of a page
+
+var detailsTag = regexp.MustCompile(`<details(\s|>)`)
+
+// printName returns the file the print variant of a page is written to
+func printName(htmlPath string) string {
+	return strings.TrimSuffix(htmlPath, ".html") + printSuffix
+}
+
+// writePrintPage writes the print variant of a page: no navigation, every
+// details element expanded and the print stylesheet applied on screen too
+func (s *Site) writePrintPage(data pageData, htmlFileName string) error {
+	data.Print = true
+	data.NavBar = ""
+	data.SidebarHTML = ""
+	data.Content = template.HTML(detailsTag.ReplaceAllString(string(data.Content), "<details open$1"))
+
+	printHTML, err := s.renderPage(data)
+	if err != nil {
+		return err
+	}
+
+	err = s.output.WriteFile(printName(htmlFileName), []byte(printHTML))
+	if err != nil {
+		return fmt.Errorf("failed to write print page: %w", err)
+	}
+	return nil
+}
+
+// servePrintVariants serves the print variant of a page when the request
+// has a print query parameter, as in /guide/install.html?print
+func (s *Site) servePrintVariants(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("print") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := r.URL.Path
+		if strings.HasSuffix(name, "/") {
+			name += "index.html"
+		}
+		if path.Ext(name) == ".html" {
+			printPath := printName(path.Clean("/" + name))
+			if s.servedOutput().Exists(strings.TrimPrefix(printPath, "/")) {
+				r = r.Clone(r.Context())
+				r.URL.Path = printPath
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
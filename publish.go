@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// isPublished reports whether the page is part of a build made at the
+// given time, which is after its publishDate and before its expiryDate
+func (p *Page) isPublished(now time.Time) bool {
+	if !p.PublishDate.IsZero() && now.Before(p.PublishDate) {
+		return false
+	}
+	if !p.ExpiryDate.IsZero() && !now.Before(p.ExpiryDate) {
+		return false
+	}
+	return true
+}
+
+// filterPublished removes the pages that aren't published at the time of
+// the build, keeping them aside for the report
+func (s *Site) filterPublished(now time.Time) {
+	s.upcoming, s.expired = nil, nil
+	published := s.pages[:0]
+	for _, page := range s.pages {
+		switch {
+		case page.isPublished(now):
+			published = append(published, page)
+		case now.Before(page.PublishDate):
+			s.upcoming = append(s.upcoming, page)
+		default:
+			s.expired = append(s.expired, page)
+		}
+	}
+	s.pages = published
+}
+
+// reportSchedule lists the pages left out of the build because they are
+// due to be published later or have expired
+func (s *Site) reportSchedule() {
+	if len(s.upcoming) > 0 {
+		fmt.Printf("%s: %d page(s) scheduled for later:\n", s.label(), len(s.upcoming))
+		for _, page := range s.upcoming.sorted(func(a, b *Page) bool { return a.PublishDate.Before(b.PublishDate) }) {
+			fmt.Printf("  %s  %s\n", page.PublishDate.Format(time.RFC3339), page.Path)
+		}
+	}
+	if len(s.expired) > 0 {
+		fmt.Printf("%s: %d expired page(s) left out:\n", s.label(), len(s.expired))
+		for _, page := range s.expired.sorted(func(a, b *Page) bool { return a.ExpiryDate.Before(b.ExpiryDate) }) {
+			fmt.Printf("  %s  %s\n", page.ExpiryDate.Format(time.RFC3339), page.Path)
+		}
+	}
+}
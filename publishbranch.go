@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// keptBranchFiles are files of the publish branch that are kept when the
+// build doesn't generate them, since the host reads its settings from them
+var keptBranchFiles = []string{"CNAME"}
+
+// publishBranch builds the sites and commits the output to a branch of the
+// repository in the working directory, such as gh-pages, through a
+// temporary worktree so the checkout being worked in is left alone. With
+// several sites, each one goes into a directory named after it.
+func publishBranch(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	branch := fs.String("branch", "gh-pages", "branch the output is committed to, created when missing")
+	remote := fs.String("remote", "origin", "remote the branch is taken from when missing locally, and pushed to")
+	push := fs.Bool("push", false, "push the branch after committing")
+	fs.Parse(args)
+
+	repo, err := git(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("not in a git repository: %w", err)
+	}
+	commit, err := git(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to find the source commit: %w", err)
+	}
+	source := commit[:min(len(commit), 12)]
+	if status, err := git(repo, "status", "--porcelain"); err == nil && status != "" {
+		// Uncommitted changes are part of the build
+		source += "-dirty"
+		commit += " with uncommitted changes"
+	}
+
+	for _, site := range sites {
+		err = site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+	}
+
+	worktree, err := os.MkdirTemp("", "mindoc-publish-")
+	if err != nil {
+		return fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	os.Remove(worktree)
+	err = addBranchWorktree(repo, worktree, *branch, *remote)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		git(repo, "worktree", "remove", "--force", worktree)
+		os.RemoveAll(worktree)
+	}()
+
+	err = replaceBranchFiles(worktree, sites)
+	if err != nil {
+		return err
+	}
+
+	_, err = git(worktree, "add", "--all")
+	if err != nil {
+		return err
+	}
+	// The build manifests, at the root of each site's output, hold times
+	// that can change without anything else changing
+	if _, err := git(worktree, "diff", "--cached", "--quiet", "--", ".", ":(exclude,glob)**/"+buildManifestFile); err == nil {
+		fmt.Printf("Branch %s is already up to date with %s.\n", *branch, source)
+		return nil
+	}
+
+	message := fmt.Sprintf("Publish %s\n\nBuilt from commit %s at %s.", source, commit, time.Now().UTC().Format(time.RFC3339))
+	_, err = git(worktree, "commit", "--quiet", "--message", message)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Committed the output of %s to %s.\n", source, *branch)
+
+	if *push {
+		_, err = git(worktree, "push", "--quiet", *remote, *branch)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pushed %s to %s.\n", *branch, *remote)
+	}
+	return nil
+}
+
+// addBranchWorktree checks out a branch into a new worktree. A branch that
+// only exists on the remote is created tracking it, and a branch that
+// doesn't exist at all is created without history.
+func addBranchWorktree(repo, worktree, branch, remote string) error {
+	if _, err := git(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		_, err = git(repo, "worktree", "add", "--quiet", worktree, branch)
+		return err
+	}
+
+	git(repo, "fetch", "--quiet", remote, branch)
+	remoteRef := "refs/remotes/" + remote + "/" + branch
+	if _, err := git(repo, "rev-parse", "--verify", "--quiet", remoteRef); err == nil {
+		_, err = git(repo, "worktree", "add", "--quiet", "-b", branch, worktree, remoteRef)
+		return err
+	}
+
+	_, err := git(repo, "worktree", "add", "--quiet", "--detach", worktree)
+	if err == nil {
+		_, err = git(worktree, "checkout", "--quiet", "--orphan", branch)
+	}
+	if err == nil {
+		_, err = git(worktree, "rm", "-r", "--quiet", "--force", "--cached", ".")
+	}
+	return err
+}
+
+// replaceBranchFiles empties a worktree, apart from the files the host
+// reads its settings from, and copies the output of the sites into it. The
+// .nojekyll file stops GitHub Pages from leaving out files starting with
+// an underscore.
+func replaceBranchFiles(worktree string, sites []*Site) error {
+	kept := make(map[string][]byte)
+	for _, name := range keptBranchFiles {
+		if data, err := ioutil.ReadFile(filepath.Join(worktree, name)); err == nil {
+			kept[name] = data
+		}
+	}
+
+	entries, err := os.ReadDir(worktree)
+	if err != nil {
+		return fmt.Errorf("failed to list worktree: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(worktree, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to empty worktree: %w", err)
+		}
+	}
+
+	dest := dirOutput(worktree)
+	for name, data := range kept {
+		err = dest.WriteFile(name, data)
+		if err != nil {
+			return err
+		}
+	}
+	err = dest.WriteFile(".nojekyll", nil)
+	if err != nil {
+		return err
+	}
+
+	for _, site := range sites {
+		prefix := ""
+		if len(sites) > 1 {
+			prefix = site.Name + "/"
+		}
+		out := site.servedOutput()
+		err = out.Walk(func(relPath string) error {
+			data, err := out.ReadFile(relPath)
+			if err != nil {
+				return err
+			}
+			return dest.WriteFile(prefix+relPath, data)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy the output of %s: %w", site.label(), err)
+		}
+	}
+	return nil
+}
+
+// git runs a git command in a directory and returns its output
+func git(dir string, args ...string) (string, error) {
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rebuildHookPath = "/hooks/rebuild" // Endpoint of the rebuild webhook
+
+// RebuildHookConfig enables the webhook that rebuilds the sites while
+// they are served, such as on every push to the content repository
+type RebuildHookConfig struct {
+	Secret  string `yaml:"secret"`  // Token or webhook secret, with $VARIABLES expanded; the hook is off without one
+	GitPull bool   `yaml:"gitPull"` // Pull the git repositories holding the content before rebuilding
+}
+
+// rebuilder regenerates the sites on request. Requests arriving during a
+// rebuild are combined into one more rebuild once it finishes.
+type rebuilder struct {
+	sites    []*Site
+	gitPull  bool
+	secret   string
+	previews *previewer // Branch previews refreshed with the sites, nil when off
+
+	mu      sync.Mutex
+	running bool // A rebuild is in progress
+	pending bool // Another rebuild was asked for during the current one
+}
+
+// newRebuilder creates the rebuilder of the served sites
+func newRebuilder(cfg *Config, sites []*Site) *rebuilder {
+	return &rebuilder{
+		sites:   sites,
+		gitPull: cfg.RebuildHook.GitPull,
+		secret:  os.ExpandEnv(cfg.RebuildHook.Secret),
+	}
+}
+
+// trigger starts a rebuild in the background, or queues one when a rebuild
+// is already running
+func (rb *rebuilder) trigger(reason string) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.running {
+		rb.pending = true
+		return
+	}
+	rb.running = true
+	go rb.run(reason)
+}
+
+// run rebuilds the sites until no more rebuilds are pending
+func (rb *rebuilder) run(reason string) {
+	for {
+		log.Printf("Rebuilding: %s", reason)
+		rb.rebuild()
+
+		rb.mu.Lock()
+		if !rb.pending {
+			rb.running = false
+			rb.mu.Unlock()
+			return
+		}
+		rb.pending = false
+		rb.mu.Unlock()
+		reason = "requested during the last rebuild"
+	}
+}
+
+// every triggers a rebuild at each interval, for content that changes
+// without a push, such as remote content or pages due to be published
+func (rb *rebuilder) every(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rb.trigger("every " + interval.String())
+	}
+}
+
+// rebuild pulls the content when configured to and regenerates every site,
+// then the branch previews. A site that fails to build keeps serving its
+// previous output.
+func (rb *rebuilder) rebuild() {
+	if rb.gitPull {
+		for _, dir := range rb.contentRepos() {
+			err := gitPull(dir)
+			if err != nil {
+				log.Printf("Failed to pull %s: %v", dir, err)
+			}
+		}
+	}
+
+	for _, site := range rb.sites {
+		err := site.generate()
+		if err != nil {
+			log.Printf("Failed to rebuild %s: %v", site.label(), err)
+		}
+	}
+	if rb.previews != nil {
+		rb.previews.refresh()
+	}
+}
+
+// contentRepos returns the top-level directories of the git repositories
+// the sites' local mounts are in. Remote content is fetched by the build.
+func (rb *rebuilder) contentRepos() []string {
+	var repos []string
+	seen := make(map[string]bool)
+	for _, site := range rb.sites {
+		mounts := site.Mounts
+		if len(mounts) == 0 {
+			mounts = []Mount{{Source: site.ContentDir}}
+		}
+
+		for _, mount := range mounts {
+			output, err := exec.Command("git", "-C", mount.Source, "rev-parse", "--show-toplevel").Output()
+			if err != nil {
+				continue
+			}
+			repo := strings.TrimSpace(string(output))
+			if !seen[repo] {
+				seen[repo] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+	return repos
+}
+
+// gitPull fast-forwards a repository to its upstream branch
+func gitPull(dir string) error {
+	output, err := exec.Command("git", "-C", dir, "pull", "--ff-only", "--quiet").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git pull: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// serveHook answers the rebuild webhook. Requests are authenticated by a
+// bearer token, a GitLab token or a GitHub signature made with the secret.
+// The rebuild runs in the background so the sender isn't kept waiting.
+func (rb *rebuilder) serveHook() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !rb.authorized(r, body) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("X-GitHub-Event") == "ping" {
+			fmt.Fprintln(w, "pong")
+			return
+		}
+
+		rb.trigger("webhook from " + r.RemoteAddr)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "rebuild started")
+	})
+}
+
+// authorized reports whether a webhook request carries the secret
+func (rb *rebuilder) authorized(r *http.Request, body []byte) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(rb.secret)) == 1
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(rb.secret)) == 1
+	}
+	if signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		mac := hmac.New(sha256.New, []byte(rb.secret))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+	return false
+}
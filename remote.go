@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const remoteCacheDir = ".mindoc/cache/remote" // Directory where remote content is cached
+
+// Remote is content pulled from outside the local tree, either a git
+// repository at a ref or a single file fetched over HTTPS
+type Remote struct {
+	Git    string `yaml:"git"`    // Repository to clone
+	Ref    string `yaml:"ref"`    // Branch, tag or commit, defaults to HEAD
+	Path   string `yaml:"path"`   // Directory within the repository to mount
+	URL    string `yaml:"url"`    // File to download
+	SHA256 string `yaml:"sha256"` // Hex SHA-256 checksum the downloaded file must match, required for plain http URLs
+	Target string `yaml:"target"` // Where the content is placed in the content tree
+}
+
+// name describes the remote in log output
+func (r Remote) name() string {
+	if r.Git != "" {
+		return r.Git
+	}
+	return r.URL
+}
+
+// cacheDir returns the local directory the remote is cached in. The
+// target and checksum are part of it, so a copy cached for other settings
+// is never used in their place.
+func (r Remote) cacheDir() string {
+	sum := sha256.Sum256([]byte(r.Git + "\x00" + r.Ref + "\x00" + r.URL + "\x00" + r.Target + "\x00" + strings.ToLower(r.SHA256)))
+	return filepath.Join(remoteCacheDir, hex.EncodeToString(sum[:8]))
+}
+
+// fetchRemotes updates the local copies of the site's remote content and
+// mounts them into the content tree. A remote that cannot be fetched falls
+// back to its cached copy when there is one.
+func (s *Site) fetchRemotes() error {
+	s.remoteMounts = nil
+
+	for _, remote := range s.Remotes {
+		var mount Mount
+		var err error
+
+		switch {
+		case remote.Git != "" && remote.URL != "":
+			return fmt.Errorf("remote %s sets both git and url", remote.name())
+		case remote.Git != "":
+			mount, err = fetchGitRemote(remote)
+		case remote.URL != "":
+			mount, err = fetchURLRemote(remote)
+		default:
+			return fmt.Errorf("remote has neither git nor url set")
+		}
+
+		if err != nil {
+			if _, statErr := os.Stat(mount.Source); mount.Source == "" || statErr != nil {
+				return fmt.Errorf("failed to fetch %s: %w", remote.name(), err)
+			}
+			log.Printf("Failed to fetch %s, using cached copy: %v", remote.name(), err)
+		}
+
+		s.remoteMounts = append(s.remoteMounts, mount)
+	}
+
+	return nil
+}
+
+// fetchGitRemote checks out the requested ref of a git repository into the cache
+func fetchGitRemote(remote Remote) (Mount, error) {
+	dir := remote.cacheDir()
+	mount := Mount{Source: filepath.Join(dir, filepath.FromSlash(remote.Path)), Target: remote.Target}
+
+	ref := remote.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return mount, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	commands := [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", remote.Git, ref},
+		{"checkout", "--quiet", "--force", "FETCH_HEAD"},
+	}
+	for _, args := range commands {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return mount, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return mount, nil
+}
+
+// fetchURLRemote downloads a single file into the cache. When the
+// download fails the cached copy is only kept if it still matches the
+// checksum.
+func fetchURLRemote(remote Remote) (Mount, error) {
+	dir := remote.cacheDir()
+
+	u, err := url.Parse(remote.URL)
+	if err != nil {
+		return Mount{}, fmt.Errorf("invalid url: %w", err)
+	}
+	// Without TLS nothing vouches for the file but its checksum
+	if u.Scheme != "https" && remote.SHA256 == "" {
+		return Mount{}, fmt.Errorf("url %s is not https and has no sha256 checksum", remote.URL)
+	}
+
+	// The target names the file in the content tree; without one the file
+	// keeps its name and is placed at the root
+	target := path.Clean("/" + filepath.ToSlash(remote.Target))
+	if remote.Target == "" || strings.HasSuffix(remote.Target, "/") {
+		target = path.Join(target, path.Base(u.Path))
+	}
+	mount := Mount{Source: dir, Target: path.Dir(target)}
+	destPath := filepath.Join(dir, path.Base(target))
+
+	err = downloadRemote(remote, destPath)
+	if err != nil {
+		if _, statErr := os.Stat(destPath); statErr != nil {
+			return Mount{}, err
+		}
+		if remote.SHA256 != "" {
+			if cacheErr := verifyChecksum(destPath, remote.SHA256); cacheErr != nil {
+				return Mount{}, fmt.Errorf("%w, and the cached copy is unusable: %v", err, cacheErr)
+			}
+		}
+	}
+	return mount, err
+}
+
+// downloadRemote downloads the file of a remote to destPath, verifying it
+// against the remote's checksum when it has one
+func downloadRemote(remote Remote, destPath string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(remote.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	dir := filepath.Dir(destPath)
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write to a temporary file first so a failed download keeps the old
+	// copy. It sits next to the mount rather than in it, so an interrupted
+	// download never shows up in the content tree.
+	tmpFile, err := os.CreateTemp(filepath.Dir(dir), ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), resp.Body)
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to download: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write cache file: %w", closeErr)
+	}
+	if remote.SHA256 != "" {
+		sum := hex.EncodeToString(hash.Sum(nil))
+		if !strings.EqualFold(sum, remote.SHA256) {
+			return fmt.Errorf("checksum mismatch: got sha256 %s, want %s", sum, remote.SHA256)
+		}
+	}
+
+	err = os.Rename(tmpFile.Name(), destPath)
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// verifyChecksum checks that a file has the given hex SHA-256 checksum
+func verifyChecksum(file, want string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, want) {
+		return fmt.Errorf("checksum mismatch: got sha256 %s, want %s", sum, want)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Renderer types that can be mapped to file extensions
+const (
+	rendererMarkdown = "markdown" // goldmark
+	rendererText     = "text"     // Preformatted plain text
+	rendererHTML     = "html"     // HTML used as the page body as it is
+	rendererGraphQL  = "graphql"  // GraphQL schema, rendered as reference pages next to it
+	rendererNone     = "none"     // Not a page, copied to the output like other files
+)
+
+// RendererConfig describes how files with an extension are turned into pages
+type RendererConfig struct {
+	Renderer string `yaml:"renderer"` // "markdown", "text", "html", "graphql" or "none"
+	GFM      bool   `yaml:"gfm"`      // Enable GitHub Flavored Markdown (markdown only)
+	Unsafe   bool   `yaml:"unsafe"`   // Pass raw HTML through (markdown only)
+}
+
+// contentRenderer converts the body of a page to HTML
+type contentRenderer func(source []byte, w io.Writer) error
+
+// defaultRenderers is used for extensions the config does not mention
+var defaultRenderers = map[string]RendererConfig{
+	".md":   {Renderer: rendererMarkdown},
+	".html": {Renderer: rendererHTML},
+}
+
+// setupRenderers creates the renderer for every page extension
+func (s *Site) setupRenderers() error {
+	configs := make(map[string]RendererConfig)
+	for ext, rc := range defaultRenderers {
+		configs[ext] = rc
+	}
+	for ext, rc := range s.Renderers {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		configs[strings.ToLower(ext)] = rc
+	}
+
+	s.renderers = make(map[string]contentRenderer)
+	s.markdownConfigs = make(map[string]RendererConfig)
+	s.converters = make(map[markdownFlavour]goldmark.Markdown)
+	s.graphqlExts = make(map[string]bool)
+	for ext, rc := range configs {
+		switch rc.Renderer {
+		case rendererMarkdown, "":
+			s.markdownConfigs[ext] = rc
+		case rendererText:
+			s.renderers[ext] = renderText
+		case rendererHTML:
+			s.renderers[ext] = renderHTML
+		case rendererGraphQL:
+			s.graphqlExts[ext] = true
+		case rendererNone:
+		default:
+			return fmt.Errorf("unknown renderer %q for %s files", rc.Renderer, ext)
+		}
+	}
+
+	return nil
+}
+
+// markdownFlavour is the combination of options a markdown converter is made with
+type markdownFlavour struct {
+	GFM        bool
+	Unsafe     bool
+	HeadingIDs bool
+}
+
+// converter returns the goldmark converter for a flavour of markdown,
+// creating it the first time it is needed
+func (s *Site) converter(flavour markdownFlavour) goldmark.Markdown {
+	if flavour == (markdownFlavour{}) {
+		return s.markdown
+	}
+	if md, ok := s.converters[flavour]; ok {
+		return md
+	}
+
+	var opts []goldmark.Option
+	if flavour.GFM {
+		opts = append(opts, goldmark.WithExtensions(extension.GFM))
+	}
+	if flavour.Unsafe {
+		opts = append(opts, goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()))
+	}
+	if flavour.HeadingIDs {
+		opts = append(opts, goldmark.WithParserOptions(parser.WithAutoHeadingID()))
+	}
+
+	md := s.newMarkdown(opts...)
+	s.converters[flavour] = md
+	return md
+}
+
+// renderHTML outputs an HTML page body unchanged
+func renderHTML(source []byte, w io.Writer) error {
+	_, err := w.Write(source)
+	return err
+}
+
+// renderText outputs plain text as a preformatted block
+func renderText(source []byte, w io.Writer) error {
+	_, err := fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(string(source)))
+	return err
+}
+
+// isPage reports whether a file in the content tree is rendered as a page
+func (s *Site) isPage(relPath string) bool {
+	_, ok := s.renderers[strings.ToLower(path.Ext(relPath))]
+	return ok || s.isMarkdown(relPath)
+}
+
+// isMarkdown reports whether a page is rendered from markdown
+func (s *Site) isMarkdown(relPath string) bool {
+	_, ok := s.markdownConfigs[strings.ToLower(path.Ext(relPath))]
+	return ok
+}
+
+// bodyWriter writes the HTML of a page body
+type bodyWriter func(w io.Writer) error
+
+// prepareBody readies the body of a page for conversion to HTML with the
+// renderer for its extension, returning a function that writes the HTML so
+// it can be streamed to where it is needed. Markdown pages also get a table
+// of contents when their section settings or front matter ask for one, and
+// their outline.
+func (s *Site) prepareBody(page *Page) (bodyWriter, template.HTML, error) {
+	ext := strings.ToLower(path.Ext(page.Path))
+
+	rc, ok := s.markdownConfigs[ext]
+	if !ok {
+		render, ok := s.renderers[ext]
+		if !ok {
+			return nil, "", fmt.Errorf("no renderer for %s", page.Path)
+		}
+		return func(w io.Writer) error {
+			return render(page.body, w)
+		}, "", nil
+	}
+
+	wantTOC := page.wantsTOC()
+	flavour := markdownFlavour{
+		GFM:        boolSetting(page.settings.GFM, rc.GFM),
+		Unsafe:     boolSetting(page.settings.Unsafe, rc.Unsafe),
+		HeadingIDs: wantTOC || page.wantsOnThisPage() || s.collectsChunks() || s.Outline,
+	}
+
+	// Partials can read anything of the site, so pages calling them are
+	// always rendered
+	cached := s.cache != nil && !usesPartials(page.body)
+	var cacheKey string
+	if cached {
+		cacheKey = s.renderCacheKey(page, flavour)
+		if entry, ok := s.cache.get(cacheKey); ok {
+			page.Outline = entry.Outline
+			return func(w io.Writer) error {
+				_, err := w.Write(entry.HTML)
+				return err
+			}, entry.TOC, nil
+		}
+	}
+
+	md := s.converter(flavour)
+
+	pc := parser.NewContext()
+	pc.Set(pagePathKey, page.Path)
+	doc := md.Parser().Parse(text.NewReader(page.body), parser.WithContext(pc))
+	writeBody := func(w io.Writer) error {
+		return md.Renderer().Render(w, page.body, doc)
+	}
+
+	var toc template.HTML
+	if wantTOC {
+		toc = tableOfContents(doc, page.body)
+	}
+	page.Outline = headingOutline(doc, page.body)
+	if cached {
+		writeBody = s.cachedBody(cacheKey, toc, page.Outline, writeBody)
+	}
+
+	return writeBody, toc, nil
+}
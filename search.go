@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	searchStateDir  = ".mindoc/index" // Directory keeping the hashes of the records pushed to each index
+	searchBatchSize = 500             // Records sent to the search service per request
+)
+
+// SearchConfig describes the search service the index command pushes the
+// site's records to
+type SearchConfig struct {
+	Provider string `yaml:"provider"` // algolia, meilisearch or typesense
+	URL      string `yaml:"url"`      // Address of the Meilisearch or Typesense server
+	AppID    string `yaml:"appID"`    // Algolia application ID
+	Index    string `yaml:"index"`    // Name of the index, or of the Typesense collection
+	APIKey   string `yaml:"apiKey"`   // Key allowed to write to the index, with $VARIABLES expanded
+	Static   string `yaml:"static"`   // Output path of a JSON file of the records for searching in the browser, none when unset
+	Bleve    bool   `yaml:"bleve"`    // Index the records with bleve every build, for the server's api/search endpoint
+}
+
+// searchRecord is a searchable part of a page, as pushed to the service
+type searchRecord struct {
+	ID       string   `json:"id"`
+	URL      string   `json:"url"`
+	Page     string   `json:"page"`
+	Title    string   `json:"title"`
+	Section  string   `json:"section,omitempty"`
+	Headings []string `json:"headings"`
+	Tags     []string `json:"tags,omitempty"`
+	Text     string   `json:"text"`
+}
+
+// searchProvider writes records to a search service and removes them
+type searchProvider interface {
+	upsert(records []searchRecord) error
+	delete(ids []string) error
+}
+
+// indexSites builds each site and pushes its records to its search service.
+// Only records that changed since the last push are sent, unless -full is
+// given; records of removed content are deleted either way.
+func indexSites(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	provider := fs.String("provider", "", "search service to push to: algolia, meilisearch or typesense (overrides the config)")
+	full := fs.Bool("full", false, "push every record, not only the ones that changed since the last push")
+	dryRun := fs.Bool("dry-run", false, "report the changes without pushing them")
+	fs.Parse(args)
+
+	for _, site := range sites {
+		cfg := site.Search
+		if *provider != "" {
+			cfg.Provider = *provider
+		}
+		if cfg.Provider == "" {
+			continue
+		}
+		if cfg.Index == "" {
+			return fmt.Errorf("%s: search index name is not set", site.label())
+		}
+
+		service, err := newSearchProvider(cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+
+		site.indexing = true
+		err = site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+
+		err = site.pushSearchRecords(service, cfg, *full, *dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+	}
+
+	return nil
+}
+
+// newSearchProvider returns the client of a search service
+func newSearchProvider(cfg SearchConfig) (searchProvider, error) {
+	client := &searchClient{http: &http.Client{Timeout: time.Minute}, apiKey: os.ExpandEnv(cfg.APIKey)}
+
+	switch cfg.Provider {
+	case "algolia":
+		if cfg.AppID == "" {
+			return nil, fmt.Errorf("algolia needs an appID")
+		}
+		client.base = fmt.Sprintf("https://%s.algolia.net/1/indexes/%s", cfg.AppID, url.PathEscape(cfg.Index))
+		client.headers = map[string]string{"X-Algolia-Application-Id": cfg.AppID, "X-Algolia-API-Key": client.apiKey}
+		return algoliaIndex{client}, nil
+	case "meilisearch":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("meilisearch needs a url")
+		}
+		client.base = strings.TrimSuffix(cfg.URL, "/") + "/indexes/" + url.PathEscape(cfg.Index)
+		client.headers = map[string]string{"Authorization": "Bearer " + client.apiKey}
+		return meilisearchIndex{client}, nil
+	case "typesense":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("typesense needs a url")
+		}
+		client.base = strings.TrimSuffix(cfg.URL, "/") + "/collections"
+		client.headers = map[string]string{"X-TYPESENSE-API-KEY": client.apiKey}
+		return &typesenseCollection{searchClient: client, name: cfg.Index}, nil
+	}
+
+	return nil, fmt.Errorf("unknown search provider %q", cfg.Provider)
+}
+
+// searchRecords turns the chunks of the last build into search records,
+// with IDs every provider accepts
+func (s *Site) searchRecords() []searchRecord {
+	records := make([]searchRecord, len(s.chunks))
+	for i, chunk := range s.chunks {
+		id := sha256.Sum256([]byte(chunk.ID))
+		records[i] = searchRecord{
+			ID:       hex.EncodeToString(id[:16]),
+			URL:      chunk.URL,
+			Page:     chunk.Page,
+			Title:    chunk.Title,
+			Section:  chunk.Section,
+			Headings: chunk.Headings,
+			Tags:     chunk.Tags,
+			Text:     chunk.Text,
+		}
+	}
+	return records
+}
+
+// pushSearchRecords sends the records that changed since the last push and
+// deletes the ones that are gone, then remembers what the index now holds
+func (s *Site) pushSearchRecords(service searchProvider, cfg SearchConfig, full, dryRun bool) error {
+	statePath := filepath.Join(searchStateDir, slugify(cfg.Provider+"-"+cfg.Index+"-"+s.Name)+".json")
+	pushed := make(map[string]string)
+	data, err := ioutil.ReadFile(statePath)
+	if err == nil {
+		err = json.Unmarshal(data, &pushed)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read search index state: %w", err)
+	}
+
+	hashes := make(map[string]string)
+	var changed []searchRecord
+	for _, record := range s.searchRecords() {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hashes[record.ID] = hex.EncodeToString(sum[:])
+		if full || pushed[record.ID] != hashes[record.ID] {
+			changed = append(changed, record)
+		}
+	}
+
+	var removed []string
+	for id := range pushed {
+		if _, ok := hashes[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+
+	fmt.Printf("%s: %d record(s), %d to update and %d to delete in %s index %q\n",
+		s.label(), len(hashes), len(changed), len(removed), cfg.Provider, cfg.Index)
+	if dryRun {
+		return nil
+	}
+
+	for start := 0; start < len(changed); start += searchBatchSize {
+		err := service.upsert(changed[start:min(start+searchBatchSize, len(changed))])
+		if err != nil {
+			return fmt.Errorf("failed to update records: %w", err)
+		}
+	}
+	for start := 0; start < len(removed); start += searchBatchSize {
+		err := service.delete(removed[start:min(start+searchBatchSize, len(removed))])
+		if err != nil {
+			return fmt.Errorf("failed to delete records: %w", err)
+		}
+	}
+
+	data, err = json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(statePath), os.ModePerm)
+	if err == nil {
+		err = ioutil.WriteFile(statePath, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save search index state: %w", err)
+	}
+
+	return nil
+}
+
+// searchClient sends requests to a search service's API
+type searchClient struct {
+	http    *http.Client
+	base    string            // URL the request paths are relative to
+	apiKey  string            // Key after expanding environment variables
+	headers map[string]string // Authentication headers
+}
+
+// send makes a request with a JSON or JSONL body and returns the response,
+// failing unless the service answers with a success status
+func (c *searchClient) send(method, path string, body []byte, contentType string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message := strings.TrimSpace(string(data[:min(len(data), 1024)]))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, req.URL.Path, resp.Status, message)
+	}
+	return data, nil
+}
+
+// sendJSON makes a request with a value encoded as JSON
+func (c *searchClient) sendJSON(method, path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.send(method, path, body, "application/json")
+	return err
+}
+
+// algoliaIndex pushes records to an Algolia index with batch requests
+type algoliaIndex struct {
+	*searchClient
+}
+
+// algoliaRecord is a record with the objectID Algolia identifies it by
+type algoliaRecord struct {
+	ObjectID string `json:"objectID"`
+	searchRecord
+}
+
+func (a algoliaIndex) upsert(records []searchRecord) error {
+	requests := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		requests[i] = map[string]interface{}{"action": "updateObject", "body": algoliaRecord{record.ID, record}}
+	}
+	return a.sendJSON(http.MethodPost, "/batch", map[string]interface{}{"requests": requests})
+}
+
+func (a algoliaIndex) delete(ids []string) error {
+	requests := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		requests[i] = map[string]interface{}{"action": "deleteObject", "body": map[string]string{"objectID": id}}
+	}
+	return a.sendJSON(http.MethodPost, "/batch", map[string]interface{}{"requests": requests})
+}
+
+// meilisearchIndex pushes records to a Meilisearch index, which is created
+// on the first push
+type meilisearchIndex struct {
+	*searchClient
+}
+
+func (m meilisearchIndex) upsert(records []searchRecord) error {
+	return m.sendJSON(http.MethodPost, "/documents?primaryKey=id", records)
+}
+
+func (m meilisearchIndex) delete(ids []string) error {
+	return m.sendJSON(http.MethodPost, "/documents/delete-batch", ids)
+}
+
+// typesenseCollection pushes records to a Typesense collection, creating it
+// with an automatic schema when it doesn't exist yet
+type typesenseCollection struct {
+	*searchClient
+	name    string
+	checked bool // Whether the collection is known to exist
+}
+
+func (t *typesenseCollection) upsert(records []searchRecord) error {
+	if !t.checked {
+		_, err := t.send(http.MethodGet, "/"+url.PathEscape(t.name), nil, "")
+		if err != nil {
+			schema := map[string]interface{}{
+				"name":   t.name,
+				"fields": []map[string]string{{"name": ".*", "type": "auto"}},
+			}
+			err = t.sendJSON(http.MethodPost, "", schema)
+			if err != nil {
+				return fmt.Errorf("failed to create collection: %w", err)
+			}
+		}
+		t.checked = true
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		err := encoder.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := t.send(http.MethodPost, "/"+url.PathEscape(t.name)+"/documents/import?action=upsert", body.Bytes(), "text/plain")
+	if err != nil {
+		return err
+	}
+
+	// The import succeeds as a whole and reports each document on a line
+	for _, line := range strings.Split(strings.TrimSpace(string(result)), "\n") {
+		var status struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		}
+		if json.Unmarshal([]byte(line), &status) == nil && !status.Success {
+			return fmt.Errorf("document rejected: %s", status.Error)
+		}
+	}
+	return nil
+}
+
+func (t *typesenseCollection) delete(ids []string) error {
+	filter := url.QueryEscape("id:[" + strings.Join(ids, ",") + "]")
+	_, err := t.send(http.MethodDelete, "/"+url.PathEscape(t.name)+"/documents?filter_by="+filter, nil, "")
+	return err
+}
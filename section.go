@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"gopkg.in/yaml.v3"
+)
+
+const sectionConfigFile = "_config.yaml" // Settings for the directory it is in and everything below
+
+// SectionConfig overrides rendering settings for a subtree of the content.
+// It is read from a _config.yaml file or the config block of an _index.md's
+// front matter; settings left unset are inherited from the parent directory.
+type SectionConfig struct {
+	Unsafe          *bool  `yaml:"unsafe"`          // Pass raw HTML in markdown through
+	GFM             *bool  `yaml:"gfm"`             // Enable GitHub Flavored Markdown
+	TOC             *bool  `yaml:"toc"`             // Generate a table of contents by default
+	Layout          string `yaml:"layout"`          // Default template for the pages
+	Nav             *bool  `yaml:"nav"`             // Show the pages in the navigation bar
+	Comments        *bool  `yaml:"comments"`        // Embed comments on the pages by default
+	OnThisPage      *bool  `yaml:"onThisPage"`      // Show the sticky "On this page" navigation next to the pages
+	WarnIfOlderThan *Age   `yaml:"warnIfOlderThan"` // Age after which the pages may be outdated, 0d for never
+}
+
+// merge returns the settings with those set in over taking precedence
+func (c SectionConfig) merge(over SectionConfig) SectionConfig {
+	if over.Unsafe != nil {
+		c.Unsafe = over.Unsafe
+	}
+	if over.GFM != nil {
+		c.GFM = over.GFM
+	}
+	if over.TOC != nil {
+		c.TOC = over.TOC
+	}
+	if over.Layout != "" {
+		c.Layout = over.Layout
+	}
+	if over.Nav != nil {
+		c.Nav = over.Nav
+	}
+	if over.Comments != nil {
+		c.Comments = over.Comments
+	}
+	if over.OnThisPage != nil {
+		c.OnThisPage = over.OnThisPage
+	}
+	if over.WarnIfOlderThan != nil {
+		c.WarnIfOlderThan = over.WarnIfOlderThan
+	}
+	return c
+}
+
+// boolSetting returns a setting when set, otherwise the fallback
+func boolSetting(setting *bool, fallback bool) bool {
+	if setting == nil {
+		return fallback
+	}
+	return *setting
+}
+
+// loadSectionConfig reads a _config.yaml file into the section settings
+func (s *Site) loadSectionConfig(srcPath, relPath string) error {
+	data, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	var cfg SectionConfig
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return fmt.Errorf("invalid section config %s: %w", srcPath, err)
+	}
+
+	dir := path.Dir(relPath)
+	s.sections[dir] = s.sections[dir].merge(cfg)
+	return nil
+}
+
+// loadSectionFrontMatter reads the config block of a section's _index.md,
+// which takes precedence over the section's _config.yaml
+func (s *Site) loadSectionFrontMatter(page *Page) error {
+	raw, ok := page.Params["config"]
+	if !ok || path.Base(page.Path) != sectionIndexFile {
+		return nil
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	var cfg SectionConfig
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return fmt.Errorf("invalid section config in %s: %w", page.srcPath, err)
+	}
+
+	dir := path.Dir(page.Path)
+	s.sections[dir] = s.sections[dir].merge(cfg)
+	return nil
+}
+
+// sectionSettings returns the settings that apply to a path in the content
+// tree, combining every directory from the root down to it
+func (s *Site) sectionSettings(relPath string) SectionConfig {
+	var dirs []string
+	for dir := path.Dir(relPath); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+
+	var settings SectionConfig
+	for i := len(dirs) - 1; i >= 0; i-- {
+		settings = settings.merge(s.sections[dirs[i]])
+	}
+	return settings
+}
+
+// inNav reports whether a page is shown in the navigation bar
+func (s *Site) inNav(relPath string) bool {
+	return boolSetting(s.sectionSettings(relPath).Nav, true)
+}
+
+// wantsTOC reports whether a table of contents is generated for the page.
+// The page's toc front matter wins over its section's default.
+func (p *Page) wantsTOC() bool {
+	if toc, ok := p.Params["toc"].(bool); ok {
+		return toc
+	}
+	return boolSetting(p.settings.TOC, false)
+}
+
+// tableOfContents lists the second and third level headings of a page
+func tableOfContents(doc ast.Node, source []byte) template.HTML {
+	var toc strings.Builder
+	depth := 0
+
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		heading, ok := n.(*ast.Heading)
+		if !ok || heading.Level < 2 || heading.Level > 3 {
+			continue
+		}
+
+		// Open nested lists inside the previous item, or close the
+		// previous item and any deeper lists
+		level := heading.Level - 1
+		if depth < level {
+			for depth < level {
+				toc.WriteString("<ul>")
+				if depth+1 < level {
+					toc.WriteString("<li>")
+				}
+				depth++
+			}
+		} else {
+			toc.WriteString("</li>")
+			for depth > level {
+				toc.WriteString("</ul></li>")
+				depth--
+			}
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		fmt.Fprintf(&toc, `<li><a href="#%s">%s</a>`,
+			template.HTMLEscapeString(string(idBytes)), template.HTMLEscapeString(string(heading.Text(source))))
+	}
+	for depth > 0 {
+		toc.WriteString("</li></ul>")
+		depth--
+	}
+
+	return template.HTML(toc.String())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// securityIssue is a problem found in a generated page that strict content
+// security policies or reviews object to
+type securityIssue struct {
+	Page    string // Source path of the page within the content tree
+	Message string
+}
+
+// subresourceAttributes are the attributes of elements the browser loads
+// along with the page, which make mixed content when they use plain HTTP
+var subresourceAttributes = map[atom.Atom][]string{
+	atom.Script: {"src"},
+	atom.Img:    {"src", "srcset"},
+	atom.Source: {"src", "srcset"},
+	atom.Iframe: {"src"},
+	atom.Video:  {"src", "poster"},
+	atom.Audio:  {"src"},
+	atom.Track:  {"src"},
+	atom.Embed:  {"src"},
+	atom.Object: {"data"},
+	atom.Form:   {"action"},
+}
+
+// subresourceLinks are the link relations whose targets are loaded with
+// the page, unlike those of links such as canonical or alternate
+var subresourceLinks = map[string]bool{
+	"stylesheet":       true,
+	"icon":             true,
+	"apple-touch-icon": true,
+	"manifest":         true,
+	"preload":          true,
+	"modulepreload":    true,
+}
+
+// scriptURLAttributes are the attributes holding URLs that could run a
+// script when followed
+var scriptURLAttributes = []string{"href", "src", "action", "formaction", "xlink:href"}
+
+// checkSecurity looks for problems in the pages written by the last build
+// that content security policies or security reviews flag: inline event
+// handlers, javascript: URLs, resources loaded over plain HTTP and links
+// opening a new window without rel=noopener
+func (s *Site) checkSecurity() ([]securityIssue, error) {
+	var issues []securityIssue
+
+	// Plain HTTP resources only make mixed content on a site served over HTTPS
+	checkMixed := true
+	if u, err := url.Parse(s.BaseURL); err == nil && u.Scheme == "http" {
+		checkMixed = false
+	}
+
+	for _, meta := range s.renderedPages {
+		f, err := os.Open(meta.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", meta.Output, err)
+		}
+		doc, err := html.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", meta.Output, err)
+		}
+
+		for _, message := range securityProblems(doc, checkMixed) {
+			issues = append(issues, securityIssue{Page: s.checkedPage(meta), Message: message})
+		}
+	}
+
+	return issues, nil
+}
+
+// securityProblems returns the security problems of a parsed HTML page
+func securityProblems(doc *html.Node, checkMixed bool) []string {
+	var problems []string
+
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, a := range n.Attr {
+				if strings.HasPrefix(a.Key, "on") {
+					problems = append(problems, fmt.Sprintf("<%s> has an inline %s handler", n.Data, a.Key))
+				}
+			}
+			for _, key := range scriptURLAttributes {
+				if value, ok := attrValue(n, key); ok && isScriptURL(value) {
+					problems = append(problems, fmt.Sprintf("<%s> has a script URL in %s", n.Data, key))
+				}
+			}
+
+			if checkMixed {
+				keys := subresourceAttributes[n.DataAtom]
+				if n.DataAtom == atom.Link {
+					for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+						if subresourceLinks[rel] {
+							keys = []string{"href"}
+						}
+					}
+				}
+				for _, key := range keys {
+					// srcset lists several URLs separated by commas
+					for _, value := range strings.Split(attr(n, key), ",") {
+						if value = strings.TrimSpace(value); strings.HasPrefix(strings.ToLower(value), "http://") {
+							problems = append(problems, fmt.Sprintf("<%s> loads %q over plain HTTP", n.Data, strings.Fields(value)[0]))
+						}
+					}
+				}
+			}
+
+			if n.DataAtom == atom.A || n.DataAtom == atom.Area {
+				target := strings.ToLower(attr(n, "target"))
+				rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+				if target != "" && target != "_self" && target != "_parent" && target != "_top" && !hasWord(rel, "noopener") && !hasWord(rel, "noreferrer") {
+					problems = append(problems, fmt.Sprintf("<%s> opening %q in a new window has no rel=noopener", n.Data, attr(n, "href")))
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+
+	return problems
+}
+
+// hasWord reports whether a list of words holds a word
+func hasWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// auditSites builds the sites without serving them and checks the
+// generated pages for security problems, failing when any is found
+func auditSites(sites []*Site) error {
+	problems := 0
+	for _, site := range sites {
+		err := site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+
+		issues, err := site.checkSecurity()
+		if err != nil {
+			return fmt.Errorf("failed to check security: %w", err)
+		}
+		if len(issues) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s: found %d security problem(s):\n", site.label(), len(issues))
+		for _, issue := range issues {
+			fmt.Printf("  %s: %s\n", issue.Page, issue.Message)
+		}
+		problems += len(issues)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+
+	fmt.Println("No problems found.")
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	seriesPath       = "series"      // Directory of the generated series pages
+	seriesLayoutFile = "series.html" // Template of the series pages, page.html when missing
+)
+
+// Series is a sequence of pages read in order, grouped by their series
+// front matter
+type Series struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"` // URL of the series page
+	Pages Pages  `json:"-"`   // Parts of the series in reading order
+	slug  string
+}
+
+// resolveSeries groups the pages into their series. Parts are ordered by
+// their seriesPart front matter, then in page order.
+func (s *Site) resolveSeries() error {
+	byName := make(map[string]*Series)
+	s.series = nil
+	for _, page := range s.pages {
+		page.Series, page.SeriesPart = nil, 0
+		if page.seriesName == "" {
+			continue
+		}
+		if page.seriesPart < 0 {
+			return fmt.Errorf("%s: seriesPart must be a number from 1", page.srcPath)
+		}
+
+		series, ok := byName[page.seriesName]
+		if !ok {
+			series = &Series{Name: page.seriesName, slug: slugify(page.seriesName)}
+			series.URL = s.pageURL(path.Join(seriesPath, series.slug+".md"))
+			byName[page.seriesName] = series
+			s.series = append(s.series, series)
+		}
+		series.Pages = append(series.Pages, page)
+		page.Series = series
+	}
+
+	for _, series := range s.series {
+		// Numbered parts come first, the others keep the page order
+		sort.SliceStable(series.Pages, func(i, j int) bool {
+			a, b := series.Pages[i].seriesPart, series.Pages[j].seriesPart
+			if a == 0 || b == 0 {
+				return a != 0 && b == 0
+			}
+			return a < b
+		})
+		for i, page := range series.Pages {
+			page.SeriesPart = i + 1
+		}
+	}
+	sort.Slice(s.series, func(i, j int) bool {
+		return s.series[i].Name < s.series[j].Name
+	})
+	return nil
+}
+
+// SeriesList returns every series by name, as in {{ range .Site.SeriesList }}
+func (s *Site) SeriesList() []*Series {
+	return s.series
+}
+
+// PrevInSeries returns the part before the page in its series, or nil
+func (p *Page) PrevInSeries() *Page {
+	if p.Series == nil || p.SeriesPart < 2 {
+		return nil
+	}
+	return p.Series.Pages[p.SeriesPart-2]
+}
+
+// NextInSeries returns the part after the page in its series, or nil
+func (p *Page) NextInSeries() *Page {
+	if p.Series == nil || p.SeriesPart >= len(p.Series.Pages) {
+		return nil
+	}
+	return p.Series.Pages[p.SeriesPart]
+}
+
+// writeSeriesPages generates a page for every series listing its parts
+func (s *Site) writeSeriesPages() error {
+	for _, series := range s.series {
+		page := s.generatedPage(path.Join(seriesPath, series.slug+".md"), series.Name, seriesLayoutFile)
+		data := s.newPageData(page)
+		data.Series = series
+		data.Content = s.seriesListing(series)
+
+		err := s.writeGeneratedPage(data)
+		if err != nil {
+			return fmt.Errorf("failed to write the page of series %q: %w", series.Name, err)
+		}
+	}
+	return nil
+}
+
+// seriesListing returns the parts of a series as a numbered list, the
+// content of the series page with the default layout
+func (s *Site) seriesListing(series *Series) template.HTML {
+	esc := template.HTMLEscapeString
+	var out strings.Builder
+	fmt.Fprintf(&out, "<h1>%s</h1>\n<ol class=\"series-parts\">\n", esc(series.Name))
+	for _, page := range series.Pages {
+		fmt.Fprintf(&out, "<li>%s<a href=\"%s\">%s</a></li>\n", s.thumbnailTag(page), esc(page.URL), esc(page.Title))
+	}
+	out.WriteString("</ol>\n")
+	return template.HTML(out.String())
+}
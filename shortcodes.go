@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// shortcodeFunc renders a shortcode used on a page, given as its content
+// tree path
+type shortcodeFunc func(s *Site, pagePath string, args map[string]string) (template.HTML, error)
+
+// shortcodes are the shortcodes markdown pages can use, on a line of their
+// own as {{< name key="value" >}}
+var shortcodes = map[string]shortcodeFunc{
+	"feedback":  (*Site).feedbackShortcode,
+	"snippet":   (*Site).snippetShortcode,
+	"asciinema": (*Site).asciinemaShortcode,
+	"video":     (*Site).videoShortcode,
+	"audio":     (*Site).audioShortcode,
+	"youtube":   (*Site).youtubeShortcode,
+	"vimeo":     (*Site).vimeoShortcode,
+	"partial":   (*Site).partialShortcode,
+}
+
+var (
+	shortcodeName = regexp.MustCompile(`^\s*([A-Za-z][\w-]*)`)
+	shortcodeArg  = regexp.MustCompile(`^\s+([A-Za-z][\w-]*)="([^"]*)"`)
+)
+
+// kindShortcode is the AST node kind of shortcodes
+var kindShortcode = ast.NewNodeKind("Shortcode")
+
+// shortcodeNode is a shortcode found in a page
+type shortcodeNode struct {
+	ast.BaseBlock
+	Name string
+	Args map[string]string
+	Page string // Path of the page the shortcode is on, "" when unknown
+}
+
+// Kind returns the node kind of shortcodes
+func (n *shortcodeNode) Kind() ast.NodeKind {
+	return kindShortcode
+}
+
+// Dump prints the shortcode for debugging
+func (n *shortcodeNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name}, nil)
+}
+
+// parseShortcode reads the name and arguments between {{< and >}}
+func parseShortcode(inner string) (string, map[string]string, bool) {
+	m := shortcodeName.FindStringSubmatch(inner)
+	if m == nil {
+		return "", nil, false
+	}
+	name := m[1]
+	rest := inner[len(m[0]):]
+
+	args := make(map[string]string)
+	for {
+		m = shortcodeArg.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		args[m[1]] = m[2]
+		rest = rest[len(m[0]):]
+	}
+	if strings.TrimSpace(rest) != "" {
+		return "", nil, false
+	}
+	return name, args, true
+}
+
+// shortcodeParser finds shortcodes written on a line of their own
+type shortcodeParser struct{}
+
+func (shortcodeParser) Trigger() []byte {
+	return []byte{'{'}
+}
+
+func (shortcodeParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("{{<")) || !bytes.HasSuffix(trimmed, []byte(">}}")) {
+		return nil, parser.NoChildren
+	}
+	name, args, ok := parseShortcode(string(trimmed[3 : len(trimmed)-3]))
+	if !ok {
+		return nil, parser.NoChildren
+	}
+
+	node := &shortcodeNode{Name: name, Args: args}
+	if page, ok := pc.Get(pagePathKey).(string); ok {
+		node.Page = page
+	}
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+func (shortcodeParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	return parser.Close
+}
+
+func (shortcodeParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (shortcodeParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (shortcodeParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// shortcodeRenderer writes the HTML of shortcodes
+type shortcodeRenderer struct {
+	site *Site
+}
+
+// RegisterFuncs registers the shortcode renderer with goldmark
+func (r shortcodeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindShortcode, r.render)
+}
+
+func (r shortcodeRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	node := n.(*shortcodeNode)
+	fn, ok := shortcodes[node.Name]
+	if !ok {
+		return ast.WalkStop, fmt.Errorf("unknown shortcode %q", node.Name)
+	}
+	out, err := fn(r.site, node.Page, node.Args)
+	if err != nil {
+		return ast.WalkStop, fmt.Errorf("shortcode %s: %w", node.Name, err)
+	}
+
+	w.WriteString(string(out))
+	w.WriteByte('\n')
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const sitemapFile = "sitemap.xml" // Sitemap of the pages for search engines, at the root of the output
+
+// sitemapFrequencies are the values changefreq may have
+var sitemapFrequencies = setOf("always", "hourly", "daily", "weekly", "monthly", "yearly", "never")
+
+// SitemapConfig controls the sitemap and the defaults of its entries,
+// which pages change with sitemap front matter
+type SitemapConfig struct {
+	Enabled    bool     `yaml:"enabled"`    // Write sitemap.xml, which needs a baseURL with a host
+	ChangeFreq string   `yaml:"changefreq"` // How often pages change, such as weekly, left out when unset
+	Priority   *float64 `yaml:"priority"`   // Priority of pages from 0 to 1, left out when unset
+}
+
+// sitemapSettings are the sitemap values of a page's front matter, given
+// as sitemap: {priority: 0.8, changefreq: weekly}
+type sitemapSettings struct {
+	ChangeFreq string   `yaml:"changefreq"`
+	Priority   *float64 `yaml:"priority"`
+}
+
+// sitemapURL is an entry of sitemap.xml
+type sitemapURL struct {
+	Loc        string        `xml:"loc"`
+	LastMod    string        `xml:"lastmod,omitempty"`
+	ChangeFreq string        `xml:"changefreq,omitempty"`
+	Priority   string        `xml:"priority,omitempty"`
+	Links      []sitemapLink `xml:"xhtml:link"` // Translations of the page
+}
+
+// sitemapLink is an alternate link of a sitemap entry to a translation
+type sitemapLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// validate checks the sitemap values given for a page or the site
+func (c sitemapSettings) validate() error {
+	if c.ChangeFreq != "" && !sitemapFrequencies[c.ChangeFreq] {
+		return fmt.Errorf("invalid sitemap changefreq %q, use always, hourly, daily, weekly, monthly, yearly or never", c.ChangeFreq)
+	}
+	if c.Priority != nil && (*c.Priority < 0 || *c.Priority > 1) {
+		return fmt.Errorf("invalid sitemap priority %v, use a number from 0 to 1", *c.Priority)
+	}
+	return nil
+}
+
+// writeSitemap writes sitemap.xml, listing every page with the date it
+// last changed, and the change frequency and priority of its sitemap front
+// matter, or the site's defaults. Pages with sitemapExclude: true, protected
+// pages and pages taken from another language are left out. Like any front
+// matter, both can be set for a whole section with a cascade block. Pages
+// with translations list them as alternate links.
+func (s *Site) writeSitemap() error {
+	if !s.Sitemap.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(s.BaseURL); err != nil || u.Host == "" {
+		return fmt.Errorf("the sitemap needs a baseURL with a host, such as https://docs.example.com/")
+	}
+	defaults := sitemapSettings{ChangeFreq: s.Sitemap.ChangeFreq, Priority: s.Sitemap.Priority}
+	err := defaults.validate()
+	if err != nil {
+		return err
+	}
+
+	urls := []sitemapURL{}
+	translated := false
+	for _, page := range s.pages {
+		if page.sitemapExclude || page.protected() || page.Fallback != nil {
+			continue
+		}
+		entry := sitemapURL{Loc: s.absURL(page.URL), ChangeFreq: defaults.ChangeFreq}
+		if updated := page.updated(); !updated.IsZero() {
+			entry.LastMod = updated.Format("2006-01-02")
+		}
+		if page.sitemap.ChangeFreq != "" {
+			entry.ChangeFreq = page.sitemap.ChangeFreq
+		}
+		priority := defaults.Priority
+		if page.sitemap.Priority != nil {
+			priority = page.sitemap.Priority
+		}
+		if priority != nil {
+			entry.Priority = strconv.FormatFloat(*priority, 'f', -1, 64)
+		}
+		for _, t := range page.Translations {
+			entry.Links = append(entry.Links, sitemapLink{Rel: "alternate", Hreflang: t.Lang, Href: t.URL})
+			translated = true
+		}
+		urls = append(urls, entry)
+	}
+
+	urlset := struct {
+		XMLName    xml.Name     `xml:"urlset"`
+		XMLNS      string       `xml:"xmlns,attr"`
+		XMLNSXHTML string       `xml:"xmlns:xhtml,attr,omitempty"`
+		URLs       []sitemapURL `xml:"url"`
+	}{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: urls}
+	if translated {
+		urlset.XMLNSXHTML = "http://www.w3.org/1999/xhtml"
+	}
+	data, err := xml.MarshalIndent(urlset, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.output.WriteFile(sitemapFile, append([]byte(xml.Header), append(data, '\n')...))
+}
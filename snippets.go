@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// errMissingSnippet is returned for snippets of files or markers that don't
+// exist. Unlike other page errors it fails the build, as the docs quote
+// code that has moved or gone.
+var errMissingSnippet = errors.New("missing snippet")
+
+// fileShortcode matches shortcodes in page sources, to find the files a
+// page reads, such as the ones it quotes snippets of, before it is rendered
+var fileShortcode = regexp.MustCompile(`(?m)^\s*\{\{<(.*?)>\}\}\s*$`)
+
+// snippetShortcode embeds part of a source file as a code block, given as
+// {{< snippet file="examples/main.go" lines="10-20" >}} or with
+// marker="name" for the lines between [start:name] and [end:name]. The file
+// is relative to the working directory.
+func (s *Site) snippetShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	file := args["file"]
+	if file == "" {
+		return "", fmt.Errorf("no file given")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errMissingSnippet, err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	first, last := 1, len(lines)
+	switch {
+	case args["marker"] != "" && args["lines"] != "":
+		return "", fmt.Errorf("lines and marker can't be used together")
+	case args["marker"] != "":
+		first, last, err = markerRange(lines, args["marker"])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+	case args["lines"] != "":
+		first, last, err = lineRange(args["lines"], len(lines))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	ci := codeInfo{Language: args["lang"], LineNos: args["linenos"] == "true", LineStart: first}
+	if ci.Language == "" {
+		ci.Language = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	if args["hl_lines"] != "" {
+		ci.Highlight, err = parseLineRanges(args["hl_lines"])
+		if err != nil {
+			return "", err
+		}
+	}
+	return template.HTML(s.codeBlockHTML(ci, dedent(lines[first-1:last]))), nil
+}
+
+// markerRange returns the first and last line between the lines marking
+// the start and end of a named region, such as // [start:main] and
+// // [end:main]
+func markerRange(lines []string, name string) (int, int, error) {
+	start, end := "[start:"+name+"]", "[end:"+name+"]"
+	first := 0
+	for i, line := range lines {
+		switch {
+		case first == 0 && strings.Contains(line, start):
+			first = i + 2
+		case first > 0 && strings.Contains(line, end):
+			return first, i, nil
+		}
+	}
+	if first == 0 {
+		return 0, 0, fmt.Errorf("%w: no marker %s", errMissingSnippet, start)
+	}
+	return 0, 0, fmt.Errorf("%w: no marker %s", errMissingSnippet, end)
+}
+
+// lineRange reads a range of lines such as 10-20, 10- or 10
+func lineRange(spec string, count int) (int, int, error) {
+	from, to, isRange := strings.Cut(spec, "-")
+	first, err := strconv.Atoi(strings.TrimSpace(from))
+	last := first
+	if err == nil && isRange {
+		last = count
+		if strings.TrimSpace(to) != "" {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+		}
+	}
+	if err != nil || first < 1 || last < first {
+		return 0, 0, fmt.Errorf("invalid line range %q", spec)
+	}
+	if last > count {
+		return 0, 0, fmt.Errorf("%w: lines %s of a file with %d lines", errMissingSnippet, spec, count)
+	}
+	return first, last, nil
+}
+
+// dedent removes the indentation the lines have in common, so a region
+// from inside a function doesn't start far to the right
+func dedent(lines []string) []string {
+	var prefix string
+	found := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			prefix, found = indent, true
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if prefix == "" {
+		return lines
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, prefix)
+	}
+	return out
+}
+
+// shortcodeFileHashes returns a hash of every file the shortcodes of a page
+// read, given as their file argument, so cached renderings are redone when
+// the files change
+func shortcodeFileHashes(body []byte) map[string]string {
+	var hashes map[string]string
+	for _, m := range fileShortcode.FindAllSubmatch(body, -1) {
+		_, args, ok := parseShortcode(string(m[1]))
+		if !ok || args["file"] == "" {
+			continue
+		}
+		if hashes == nil {
+			hashes = make(map[string]string)
+		}
+		data, err := ioutil.ReadFile(args["file"])
+		if err != nil {
+			hashes[args["file"]] = ""
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hashes[args["file"]] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
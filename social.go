@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	socialDir      = "social"               // Output directory of the share images
+	socialCacheDir = ".mindoc/cache/social" // Directory where drawn share images are kept by content hash
+
+	socialWidth    = 1200 // Size of share images, as most sites crop them
+	socialHeight   = 630
+	socialMargin   = 80
+	socialLogoSize = 72
+)
+
+// SocialConfig decides whether pages get a share image and the og:image
+// tags pointing at it, and how the images look
+type SocialConfig struct {
+	Images     bool   `yaml:"images"`     // Draw a share image for every page
+	Format     string `yaml:"format"`     // png (the default) or svg, which fewer sites show
+	Background string `yaml:"background"` // Background color, the icons' theme color or "#1f2933" when unset
+	Color      string `yaml:"color"`      // Text color, white when unset
+}
+
+// socialFonts are the faces share images are drawn with, parsed once
+var socialFonts struct {
+	once         sync.Once
+	title, brand *opentype.Font
+	err          error
+}
+
+// loadSocialFonts parses the fonts share images are drawn with
+func loadSocialFonts() error {
+	socialFonts.once.Do(func() {
+		socialFonts.title, socialFonts.err = opentype.Parse(gobold.TTF)
+		if socialFonts.err == nil {
+			socialFonts.brand, socialFonts.err = opentype.Parse(goregular.TTF)
+		}
+	})
+	return socialFonts.err
+}
+
+// socialTags returns the Open Graph and Twitter card tags of a page,
+// drawing its share image when the site has them on
+func (s *Site) socialTags(page *Page) template.HTML {
+	if !s.Social.Images {
+		return ""
+	}
+
+	esc := template.HTMLEscapeString
+	tags := []string{
+		fmt.Sprintf(`<meta property="og:title" content="%s">`, esc(page.Title)),
+		fmt.Sprintf(`<meta property="og:site_name" content="%s">`, esc(s.Name)),
+		fmt.Sprintf(`<meta property="og:url" content="%s">`, esc(s.absURL(page.URL))),
+		`<meta property="og:type" content="article">`,
+	}
+
+	imagePath, err := s.writeSocialImage(page)
+	if err != nil {
+		log.Printf("Failed to draw the share image of %s: %v", page.Path, err)
+		return template.HTML(strings.Join(tags, "\n    "))
+	}
+	tags = append(tags,
+		fmt.Sprintf(`<meta property="og:image" content="%s">`, esc(s.absURL(s.url(imagePath)))),
+		fmt.Sprintf(`<meta property="og:image:width" content="%d">`, socialWidth),
+		fmt.Sprintf(`<meta property="og:image:height" content="%d">`, socialHeight),
+		fmt.Sprintf(`<meta property="og:image:alt" content="%s">`, esc(page.Title)),
+		`<meta name="twitter:card" content="summary_large_image">`,
+	)
+	return template.HTML(strings.Join(tags, "\n    "))
+}
+
+// writeSocialImage writes the share image of a page to the output and
+// returns its path there. Images are taken from the cache when nothing
+// they show has changed.
+func (s *Site) writeSocialImage(page *Page) (string, error) {
+	format := s.Social.Format
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		return "", fmt.Errorf("unknown share image format %q", format)
+	}
+	relPath := socialDir + "/" + strings.TrimSuffix(page.Path, filepath.Ext(page.Path)) + "." + format
+
+	background, err := parseHexColor(s.socialBackground())
+	if err != nil {
+		return "", err
+	}
+	foreground, err := parseHexColor(s.socialColor())
+	if err != nil {
+		return "", err
+	}
+
+	// The logo is part of the hash by its size and modification time
+	logo := ""
+	if s.Icons.Logo != "" {
+		info, err := os.Stat(s.Icons.Logo)
+		if err != nil {
+			return "", fmt.Errorf("failed to read logo: %w", err)
+		}
+		logo = fmt.Sprintf("%s %d %d", s.Icons.Logo, info.Size(), info.ModTime().UnixNano())
+	}
+	hash := sha256.Sum256([]byte(strings.Join([]string{format, page.Title, s.Name, s.Social.Background, s.Social.Color, s.Icons.ThemeColor, logo}, "\x00")))
+	cachePath := filepath.Join(socialCacheDir, hex.EncodeToString(hash[:])+"."+format)
+
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		card, err := s.drawSocialCard(page.Title, background, foreground)
+		if err != nil {
+			return "", err
+		}
+		if format == "svg" {
+			data, err = card.svg()
+		} else {
+			data, err = card.png()
+		}
+		if err != nil {
+			return "", err
+		}
+
+		err = os.MkdirAll(socialCacheDir, os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(cachePath, data, 0644)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to cache share image: %w", err)
+		}
+	}
+
+	err = s.output.WriteFile(relPath, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", relPath, err)
+	}
+	return relPath, nil
+}
+
+// socialBackground returns the background color of share images
+func (s *Site) socialBackground() string {
+	switch {
+	case s.Social.Background != "":
+		return s.Social.Background
+	case s.Icons.ThemeColor != "":
+		return s.Icons.ThemeColor
+	}
+	return "#1f2933"
+}
+
+// socialColor returns the text color of share images
+func (s *Site) socialColor() string {
+	if s.Social.Color != "" {
+		return s.Social.Color
+	}
+	return "#ffffff"
+}
+
+// socialCard is the layout of a share image: the page title in large type,
+// and the logo and site name along the bottom
+type socialCard struct {
+	background, foreground color.RGBA
+	title                  []string // Lines of the title
+	titleSize              float64
+	brand                  string
+	logo                   image.Image // Logo scaled to socialLogoSize, nil when the site has none
+}
+
+// socialTitleSizes are the font sizes tried for a title, largest first,
+// until it fits in socialTitleLines lines
+var socialTitleSizes = []float64{80, 68, 56}
+
+const socialTitleLines = 4
+
+// drawSocialCard lays out the share image of a page
+func (s *Site) drawSocialCard(title string, background, foreground color.RGBA) (*socialCard, error) {
+	err := loadSocialFonts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %w", err)
+	}
+
+	card := &socialCard{background: background, foreground: foreground, brand: s.Name}
+	for _, size := range socialTitleSizes {
+		face, err := opentype.NewFace(socialFonts.title, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, err
+		}
+		card.title, card.titleSize = wrapText(face, title, socialWidth-2*socialMargin), size
+		face.Close()
+		if len(card.title) <= socialTitleLines {
+			break
+		}
+	}
+	if len(card.title) > socialTitleLines {
+		card.title = card.title[:socialTitleLines]
+		card.title[socialTitleLines-1] += "…"
+	}
+
+	if s.Icons.Logo != "" {
+		f, err := os.Open(s.Icons.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open logo: %w", err)
+		}
+		logo, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode logo %s: %w", s.Icons.Logo, err)
+		}
+		card.logo = resizeIcon(logo, socialLogoSize)
+	}
+	return card, nil
+}
+
+// wrapText breaks text into lines no wider than width in a face. A word
+// wider than a line gets a line of its own.
+func wrapText(face font.Face, text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, next).Ceil() > width {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// brandBaseline returns where the site name and logo sit, and the size of
+// the site name
+func (c *socialCard) brandBaseline() (x, y int, size float64) {
+	x = socialMargin
+	if c.logo != nil {
+		x += socialLogoSize + 24
+	}
+	return x, socialHeight - socialMargin, 36
+}
+
+// png draws the card as a PNG image
+func (c *socialCard) png() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, socialWidth, socialHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c.background), image.Point{}, draw.Src)
+
+	titleFace, err := opentype.NewFace(socialFonts.title, &opentype.FaceOptions{Size: c.titleSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer titleFace.Close()
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c.foreground), Face: titleFace}
+	lineHeight := int(c.titleSize * 1.2)
+	for i, line := range c.title {
+		d.Dot = fixed.P(socialMargin, socialMargin+int(c.titleSize)+i*lineHeight)
+		d.DrawString(line)
+	}
+
+	x, y, size := c.brandBaseline()
+	brandFace, err := opentype.NewFace(socialFonts.brand, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer brandFace.Close()
+	d.Face = brandFace
+	d.Dot = fixed.P(x, y)
+	d.DrawString(c.brand)
+	if c.logo != nil {
+		top := y - socialLogoSize + socialLogoSize/4
+		draw.Draw(img, image.Rect(socialMargin, top, socialMargin+socialLogoSize, top+socialLogoSize), c.logo, image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode share image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// svg writes the card as an SVG image, with the text left to the viewer's
+// sans-serif font and the logo embedded as PNG
+func (c *socialCard) svg() ([]byte, error) {
+	esc := template.HTMLEscapeString
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", socialWidth, socialHeight, socialWidth, socialHeight)
+	fmt.Fprintf(&out, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(c.background))
+	fmt.Fprintf(&out, `<g fill="%s" font-family="Go, sans-serif">`+"\n", hexColor(c.foreground))
+	lineHeight := int(c.titleSize * 1.2)
+	for i, line := range c.title {
+		fmt.Fprintf(&out, `<text x="%d" y="%d" font-size="%g" font-weight="bold">%s</text>`+"\n", socialMargin, socialMargin+int(c.titleSize)+i*lineHeight, c.titleSize, esc(line))
+	}
+	x, y, size := c.brandBaseline()
+	fmt.Fprintf(&out, `<text x="%d" y="%d" font-size="%g">%s</text>`+"\n</g>\n", x, y, size, esc(c.brand))
+	if c.logo != nil {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, c.logo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode logo: %w", err)
+		}
+		fmt.Fprintf(&out, `<image x="%d" y="%d" width="%d" height="%d" href="data:image/png;base64,%s"/>`+"\n",
+			socialMargin, y-socialLogoSize+socialLogoSize/4, socialLogoSize, socialLogoSize, base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	out.WriteString("</svg>\n")
+	return out.Bytes(), nil
+}
+
+// parseHexColor reads a color written as #rgb or #rrggbb
+func parseHexColor(value string) (color.RGBA, error) {
+	digits := strings.TrimPrefix(value, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", value)
+	}
+	return color.RGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 0xff}, nil
+}
+
+// hexColor writes a color as #rrggbb
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
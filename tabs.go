@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+
+	"github.com/yuin/goldmark/util"
+)
+
+// renderTabs writes a set of tabs, with a tab for every tab block inside
+// it. Without scripts every panel is shown under its label; tabs.js turns
+// them into tabs and selects the same label in every set on the page.
+func (s *Site) renderTabs(w util.BufWriter, node *containerNode, entering bool) error {
+	if !entering {
+		fmt.Fprintf(w, "</div>\n<script src=\"%s\" defer></script>\n", template.HTMLEscapeString(s.url(cssDestDir+"/tabs.js")))
+		return nil
+	}
+
+	tabs, err := childContainers(node, "tab")
+	if err != nil {
+		return err
+	}
+	if len(tabs) == 0 {
+		return fmt.Errorf("has no tabs")
+	}
+
+	esc := template.HTMLEscapeString
+	id := fmt.Sprintf("tabs-%d", node.offset)
+	fmt.Fprintf(w, "<div class=\"tabs\" id=\"%s\">\n<div class=\"tab-list\" role=\"tablist\" hidden>", id)
+	for i, tab := range tabs {
+		label := containerTitle(tab)
+		if label == "" {
+			return fmt.Errorf("tab %d has no label", i+1)
+		}
+		selected, tabIndex := "false", "-1"
+		if i == 0 {
+			selected, tabIndex = "true", "0"
+		}
+		fmt.Fprintf(w, `<button type="button" role="tab" id="%s-tab-%d" aria-controls="%s-panel-%d" aria-selected="%s" tabindex="%s">%s</button>`,
+			id, i, id, i, selected, tabIndex, esc(label))
+	}
+	w.WriteString("</div>\n")
+	return nil
+}
+
+// renderTab writes a panel of a set of tabs
+func (s *Site) renderTab(w util.BufWriter, node *containerNode, entering bool) error {
+	if !entering {
+		w.WriteString("</div>\n")
+		return nil
+	}
+
+	parent, ok := node.Parent().(*containerNode)
+	if !ok || parent.Name != "tabs" {
+		return fmt.Errorf("must be inside a tabs block")
+	}
+	index := 0
+	for c := parent.FirstChild(); c != node; c = c.NextSibling() {
+		index++
+	}
+
+	esc := template.HTMLEscapeString
+	id := fmt.Sprintf("tabs-%d", parent.offset)
+	label := esc(containerTitle(node))
+	fmt.Fprintf(w, "<div class=\"tab-panel\" role=\"tabpanel\" id=\"%s-panel-%d\" aria-labelledby=\"%s-tab-%d\" data-tab=\"%s\" tabindex=\"0\">\n<p class=\"tab-label\">%s</p>\n",
+		id, index, id, index, label, label)
+	return nil
+}
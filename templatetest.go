@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const templateTestDir = "./testdata/templates" // Fixtures the template tests render, with their golden files
+
+// templateFixture is the page data a template test renders a layout with,
+// read from a YAML file. The expected output is in the HTML file of the
+// same name next to it.
+type templateFixture struct {
+	Site        string                 `yaml:"site"`        // Name of the site, the first one when unset
+	Path        string                 `yaml:"path"`        // Path of the page in the content tree, "index.md" when unset
+	FrontMatter map[string]interface{} `yaml:"frontMatter"` // Front matter of the page, such as its title and layout
+	Content     string                 `yaml:"content"`     // HTML of the page body
+	Print       bool                   `yaml:"print"`       // Render the print variant
+}
+
+// testTemplates renders the theme's layouts with every fixture of the
+// template test directory and compares the results with the golden files,
+// or rewrites the golden files with -update
+func testTemplates(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("template test", flag.ExitOnError)
+	dir := fs.String("dir", templateTestDir, "directory of the fixtures and golden files")
+	update := fs.Bool("update", false, "write the rendered output to the golden files instead of comparing")
+	fs.Parse(args)
+
+	fixtures, err := filepath.Glob(filepath.Join(*dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	if len(fixtures) == 0 {
+		return fmt.Errorf("no fixtures in %s", *dir)
+	}
+
+	failed := 0
+	for _, fixturePath := range fixtures {
+		goldenPath := strings.TrimSuffix(fixturePath, ".yaml") + ".html"
+		output, err := renderFixture(sites, fixturePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fixturePath, err)
+		}
+
+		if *update {
+			err = ioutil.WriteFile(goldenPath, []byte(output), 0644)
+			if err != nil {
+				return fmt.Errorf("failed to write golden file: %w", err)
+			}
+			continue
+		}
+
+		golden, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read golden file, run with -update to write it: %w", err)
+		}
+		if diff := firstDifference(string(golden), output); diff != "" {
+			failed++
+			fmt.Printf("%s: output differs from %s\n%s", fixturePath, goldenPath, diff)
+		}
+	}
+
+	if *update {
+		fmt.Printf("%d golden file(s) written.\n", len(fixtures))
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d template test(s) failed", failed, len(fixtures))
+	}
+	fmt.Printf("%d template test(s) passed.\n", len(fixtures))
+	return nil
+}
+
+// renderFixture renders the layout of a fixture's page without building
+// the site, so the navigation and page collections are empty
+func renderFixture(sites []*Site, fixturePath string) (string, error) {
+	data, err := ioutil.ReadFile(fixturePath)
+	if err != nil {
+		return "", err
+	}
+	var fixture templateFixture
+	err = yaml.Unmarshal(data, &fixture)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse fixture: %w", err)
+	}
+
+	var site *Site
+	for _, s := range sites {
+		if fixture.Site == "" || s.Name == fixture.Site {
+			site = s
+			break
+		}
+	}
+	if site == nil {
+		return "", fmt.Errorf("unknown site %q", fixture.Site)
+	}
+	site.output = newMemoryOutput()
+	site.thumbnails = make(map[string]*Thumbnail)
+	site.externalAssets = make(map[string]*externalAsset)
+
+	relPath := fixture.Path
+	if relPath == "" {
+		relPath = "index.md"
+	}
+	page := &Page{Path: relPath, srcPath: relPath, Params: fixture.FrontMatter, URL: site.pageURL(relPath)}
+	if page.Params == nil {
+		page.Params = map[string]interface{}{}
+	}
+	page.settings = site.sectionSettings(relPath)
+	err = page.applyFrontMatter()
+	if err != nil {
+		return "", err
+	}
+
+	pd := site.newPageData(page)
+	pd.Content = template.HTML(fixture.Content)
+	pd.Print = fixture.Print
+	return site.renderPage(pd)
+}
+
+// firstDifference describes where two texts first differ line by line,
+// with the lines around it, or returns "" when they are the same
+func firstDifference(want, got string) string {
+	if want == got {
+		return ""
+	}
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	i := 0
+	for i < len(wantLines) && i < len(gotLines) && wantLines[i] == gotLines[i] {
+		i++
+	}
+
+	var out strings.Builder
+	start := i - 2
+	if start < 0 {
+		start = 0
+	}
+	for j := start; j < i; j++ {
+		fmt.Fprintf(&out, "    %4d   %s\n", j+1, wantLines[j])
+	}
+	for j := i; j < i+3 && j < len(wantLines); j++ {
+		fmt.Fprintf(&out, "    %4d - %s\n", j+1, wantLines[j])
+	}
+	for j := i; j < i+3 && j < len(gotLines); j++ {
+		fmt.Fprintf(&out, "    %4d + %s\n", j+1, gotLines[j])
+	}
+	return out.String()
+}
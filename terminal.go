@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// asciinemaID matches the id of a recording on asciinema.org
+var asciinemaID = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// asciinemaShortcode shows a terminal recording, either a cast file written
+// by asciinema rec, given as file="casts/install.cast" and shown as the text
+// the session left on the terminal, or a recording on asciinema.org given
+// as id="..." and embedded with asciinema's player
+func (s *Site) asciinemaShortcode(pagePath string, args map[string]string) (template.HTML, error) {
+	esc := template.HTMLEscapeString
+	if id := args["id"]; id != "" {
+		if !asciinemaID.MatchString(id) {
+			return "", fmt.Errorf("invalid id %q", id)
+		}
+		if s.Media.NoThirdParty {
+			return externalMediaLink("https://asciinema.org/a/"+id, s.translate("watchRecording")), nil
+		}
+		return template.HTML(fmt.Sprintf(`<div class="asciinema"><script async id="asciicast-%s" src="https://asciinema.org/a/%s.js"></script><noscript><a href="https://asciinema.org/a/%s">%s</a></noscript></div>`,
+			id, id, id, esc(s.translate("watchRecording")))), nil
+	}
+
+	file := args["file"]
+	if file == "" {
+		return "", fmt.Errorf("no file or id given")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cast: %w", err)
+	}
+	title, output, err := parseCast(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	if args["title"] != "" {
+		title = args["title"]
+	}
+
+	var out strings.Builder
+	out.WriteString(`<figure class="terminal">`)
+	if title != "" {
+		fmt.Fprintf(&out, "<figcaption>%s</figcaption>", esc(title))
+	}
+	fmt.Fprintf(&out, "<pre><samp>%s</samp></pre></figure>", terminalHTML(output))
+	return template.HTML(out.String()), nil
+}
+
+// parseCast returns the title and everything printed during a recording in
+// asciicast format, version 1 or 2
+func parseCast(data []byte) (string, string, error) {
+	var header struct {
+		Version int              `json:"version"`
+		Title   string           `json:"title"`
+		Stdout  [][2]interface{} `json:"stdout"` // Version 1 events
+	}
+
+	// Version 1 is a single JSON document
+	if json.Unmarshal(data, &header) == nil && header.Version == 1 {
+		var output strings.Builder
+		for _, event := range header.Stdout {
+			text, _ := event[1].(string)
+			output.WriteString(text)
+		}
+		return header.Title, output.String(), nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	if !scanner.Scan() {
+		return "", "", fmt.Errorf("empty cast")
+	}
+	err := json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cast header: %w", err)
+	}
+	if header.Version != 2 {
+		return "", "", fmt.Errorf("unsupported cast version %d", header.Version)
+	}
+
+	// Version 2 has a header line followed by an event per line
+	var output strings.Builder
+	for line := 2; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var event []interface{}
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil || len(event) < 3 {
+			return "", "", fmt.Errorf("invalid event on line %d", line)
+		}
+		if kind, _ := event[1].(string); kind == "o" {
+			text, _ := event[2].(string)
+			output.WriteString(text)
+		}
+	}
+	return header.Title, output.String(), scanner.Err()
+}
+
+// terminalCell is a character on the terminal with its style
+type terminalCell struct {
+	r     rune
+	style terminalStyle
+}
+
+// terminalStyle is the look SGR escape sequences give text
+type terminalStyle struct {
+	fg, bg int // Colours 0 to 15, -1 for the default
+	bold   bool
+}
+
+// terminalHTML replays what a program printed on a terminal and returns
+// the resulting text as HTML, keeping the colours and bold text. Carriage
+// returns, backspaces and erasing lines and the screen are followed, so
+// progress bars end up as they were left; cursor movements are ignored.
+func terminalHTML(output string) string {
+	lines := [][]terminalCell{nil}
+	row, col := 0, 0
+	style := terminalStyle{fg: -1, bg: -1}
+
+	runes := []rune(output)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '\n':
+			row, col = row+1, 0
+			if row == len(lines) {
+				lines = append(lines, nil)
+			}
+		case '\r':
+			col = 0
+		case '\b':
+			if col > 0 {
+				col--
+			}
+		case '\t':
+			col = (col/8 + 1) * 8
+		case 0x1b:
+			// Escape sequences: CSI ... final byte, OSC ... BEL or ST
+			if i+1 < len(runes) && runes[i+1] == '[' {
+				j := i + 2
+				for j < len(runes) && (runes[j] < 0x40 || runes[j] > 0x7e) {
+					j++
+				}
+				if j == len(runes) {
+					i = j
+					break
+				}
+				params := string(runes[i+2 : j])
+				switch runes[j] {
+				case 'm':
+					style = style.apply(params)
+				case 'K':
+					if params == "" || params == "0" {
+						if col < len(lines[row]) {
+							lines[row] = lines[row][:col]
+						}
+					} else if params == "2" {
+						lines[row] = nil
+					}
+				case 'J':
+					if params == "2" || params == "3" {
+						lines, row, col = [][]terminalCell{nil}, 0, 0
+					}
+				}
+				i = j
+			} else if i+1 < len(runes) && runes[i+1] == ']' {
+				j := i + 2
+				for j < len(runes) && runes[j] != 0x07 && !(runes[j] == 0x1b && j+1 < len(runes) && runes[j+1] == '\\') {
+					j++
+				}
+				if j < len(runes) && runes[j] == 0x1b {
+					j++
+				}
+				i = j
+			} else {
+				i++
+			}
+		default:
+			if r < 0x20 || r == 0x7f {
+				continue
+			}
+			for len(lines[row]) < col {
+				lines[row] = append(lines[row], terminalCell{r: ' ', style: terminalStyle{fg: -1, bg: -1}})
+			}
+			cell := terminalCell{r: r, style: style}
+			if col < len(lines[row]) {
+				lines[row][col] = cell
+			} else {
+				lines[row] = append(lines[row], cell)
+			}
+			col++
+		}
+	}
+
+	// Trailing empty lines, such as after the final prompt, are left out
+	for len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		for j := 0; j < len(line); {
+			k := j
+			var text strings.Builder
+			for k < len(line) && line[k].style == line[j].style {
+				text.WriteRune(line[k].r)
+				k++
+			}
+			if class := line[j].style.class(); class != "" {
+				fmt.Fprintf(&out, `<span class="%s">%s</span>`, class, template.HTMLEscapeString(text.String()))
+			} else {
+				out.WriteString(template.HTMLEscapeString(text.String()))
+			}
+			j = k
+		}
+	}
+	return out.String()
+}
+
+// apply returns the style after an SGR sequence with the given parameters
+func (st terminalStyle) apply(params string) terminalStyle {
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil && codes[i] != "" {
+			continue
+		}
+		switch {
+		case code == 0:
+			st = terminalStyle{fg: -1, bg: -1}
+		case code == 1:
+			st.bold = true
+		case code == 22:
+			st.bold = false
+		case code >= 30 && code <= 37:
+			st.fg = code - 30
+		case code >= 90 && code <= 97:
+			st.fg = code - 90 + 8
+		case code == 39:
+			st.fg = -1
+		case code >= 40 && code <= 47:
+			st.bg = code - 40
+		case code >= 100 && code <= 107:
+			st.bg = code - 100 + 8
+		case code == 49:
+			st.bg = -1
+		case code == 38 || code == 48:
+			// 256 colour and RGB colours are left out, along with their
+			// arguments, except for the 16 basic colours
+			color := -1
+			if i+2 < len(codes) && codes[i+1] == "5" {
+				if n, err := strconv.Atoi(codes[i+2]); err == nil && n < 16 {
+					color = n
+				}
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == "2" {
+				i += 4
+			}
+			if code == 38 {
+				st.fg = color
+			} else {
+				st.bg = color
+			}
+		}
+	}
+	return st
+}
+
+// class returns the CSS classes of the style
+func (st terminalStyle) class() string {
+	var classes []string
+	if st.bold {
+		classes = append(classes, "ansi-bold")
+	}
+	if st.fg >= 0 {
+		classes = append(classes, fmt.Sprintf("ansi-fg-%d", st.fg))
+	}
+	if st.bg >= 0 {
+		classes = append(classes, fmt.Sprintf("ansi-bg-%d", st.bg))
+	}
+	return strings.Join(classes, " ")
+}
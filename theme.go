@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	layoutDir      = "./layouts" // Directory containing the page templates
+	pageLayoutFile = "page.html" // Template every page is rendered with
+)
+
+// defaultPageLayout is used when the layout directory has no page template
+const defaultPageLayout = `
+<!DOCTYPE html>
+<html lang="{{ .Lang }}" dir="{{ .Dir }}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{ .Title }}</title>
+    <link rel="stylesheet" href="{{ .CSS }}">
+    <link rel="stylesheet" href="{{ .Assets }}site.css">
+    <link rel="stylesheet" href="{{ .Assets }}print.css"{{ if not .Print }} media="print"{{ end }}>{{ if .SidebarHTML }}
+    <link rel="stylesheet" href="{{ .Assets }}sidebar.css">
+    <script src="{{ .Assets }}sidebar.js" defer></script>{{ end }}{{ if and .OnThisPage (not .Print) }}
+    <link rel="stylesheet" href="{{ .Assets }}onthispage.css">{{ end }}{{ with .Head }}
+    {{ . }}{{ end }}
+</head>
+<body{{ if .Print }} class="print"{{ end }}>
+    {{ if not .Print }}<a class="skip-link" href="#main">{{ T "skipToContent" }}</a>
+    {{ .NavBar }}{{ end }}
+    <div class="medium-container{{ if or .SidebarHTML (and .OnThisPage (not .Print)) }} layout{{ end }}">
+        {{ with .SidebarHTML }}{{ . }}
+        {{ end }}<main id="main" class="content"{{ with .Page.Fallback }} lang="{{ .Lang }}"{{ end }}>
+            {{ with .TOC }}<nav class="toc" aria-label="{{ T "onThisPage" }}">{{ . }}</nav>
+            {{ end }}{{ with .Page.Series }}<nav class="series" aria-label="{{ T "series" }}">
+                <p><a href="{{ .URL }}">{{ .Name }}</a>: {{ T "seriesPart" $.Page.SeriesPart (len .Pages) }}</p>{{ with $.Page.PrevInSeries }}
+                <a rel="prev" href="{{ .URL }}">{{ T "previousPart" }}: {{ .Title }}</a>{{ end }}{{ with $.Page.NextInSeries }}
+                <a rel="next" href="{{ .URL }}">{{ T "nextPart" }}: {{ .Title }}</a>{{ end }}
+            </nav>
+            {{ end }}{{ if and .Site.OutdatedBanner .Page.Outdated }}<p class="outdated-translation" role="note">{{ T "outdated" }} <a href="{{ .Page.Outdated.URL }}" hreflang="{{ .Page.Outdated.Lang }}">{{ T "readOriginal" }}</a></p>
+            {{ end }}{{ with .Badges }}{{ . }}
+            {{ end }}{{ if .Page.Stale }}<p class="stale-page" role="note">{{ T "mayBeOutdated" }}</p>
+            {{ end }}{{ if .Page.Fallback }}<p class="fallback-translation" role="note" lang="{{ .Lang }}">{{ T "notTranslated" }}</p>
+            {{ end }}{{ .Content }}{{ with .Page.Authors }}
+            <p class="byline">{{ T "writtenBy" }} {{ range $i, $a := . }}{{ if $i }}, {{ end }}<a href="{{ $a.URL }}">{{ $a.Name }}</a>{{ end }}</p>{{ end }}{{ if and .Comments (not .Print) }}
+            <section class="comments" aria-label="{{ T "comments" }}">{{ .Comments.HTML }}</section>{{ end }}
+        </main>{{ if and .OnThisPage (not .Print) }}
+        {{ .OnThisPage }}{{ end }}
+    </div>
+</body>
+</html>
+`
+
+// Theme is the look of the generated pages, shared by all sites
+type Theme struct {
+	CSSDir    string // Directory containing the CSS files
+	LayoutDir string // Directory containing the page templates
+
+	funcs        template.FuncMap
+	page         *template.Template
+	formats      *texttemplate.Template       // Templates of the output formats besides HTML
+	translations map[string]map[string]string // Theme strings by language
+}
+
+// pageData is what the page template is executed with
+type pageData struct {
+	Title       string
+	Lang        string        // Language of the site, for the lang attribute
+	Dir         string        // Text direction of the language, "ltr" or "rtl"
+	CSS         string        // URL of the stylesheet
+	Assets      string        // URL of the directory the theme's CSS and JavaScript files are copied to
+	Head        template.HTML // Extra tags for the head, such as the icon links
+	NavBar      template.HTML
+	Content     template.HTML
+	TOC         template.HTML // Table of contents, when enabled for the page
+	OnThisPage  template.HTML // Sticky outline of the page's headings, when enabled for the page
+	Badges      template.HTML // Version badges of the page, such as deprecated
+	Menu        []*NavItem    // Top-level pages and sections
+	Sidebar     []*NavItem    // Navigation tree of the current section
+	SidebarHTML template.HTML // Sidebar rendered as collapsible lists
+	Print       bool          // Rendering the print variant of the page
+	Comments    *commentsData // Comment embed, nil unless the page has comments
+	Author      *Author       // Author the page lists the pages of, on author pages
+	Series      *Series       // Series the page lists the parts of, on series pages
+	Page        *Page         // Page being rendered
+	Site        *Site         // Site the page belongs to, giving access to .Site.Pages
+}
+
+// loadTheme loads the custom template functions and parses the page templates
+func loadTheme(cfg *Config) (*Theme, error) {
+	theme := &Theme{CSSDir: cfg.ThemeDir, LayoutDir: cfg.LayoutDir}
+
+	translations, err := loadTranslations(cfg.I18nDir)
+	if err != nil {
+		return nil, err
+	}
+	theme.translations = translations
+
+	wasmFuncs, err := loadWasmFuncs(cfg.TemplateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template functions: %w", err)
+	}
+	// The built-in functions are bound to each site when its copy of the
+	// templates is made, so any site's versions serve for parsing
+	theme.funcs = (&Site{}).templateFuncs()
+	for name, fn := range wasmFuncs {
+		theme.funcs[name] = fn
+	}
+
+	theme.page = template.New("").Funcs(theme.funcs)
+
+	// Every template in the layout directory is available by its file
+	// name, either as a page layout or to be included by other templates
+	layoutPaths, err := filepath.Glob(filepath.Join(theme.LayoutDir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list page templates: %w", err)
+	}
+	for _, layoutPath := range layoutPaths {
+		data, err := ioutil.ReadFile(layoutPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page template: %w", err)
+		}
+
+		_, err = theme.page.New(filepath.Base(layoutPath)).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse page template %s: %w", layoutPath, err)
+		}
+	}
+
+	err = theme.loadPartials()
+	if err != nil {
+		return nil, err
+	}
+
+	if theme.page.Lookup(pageLayoutFile) == nil {
+		_, err = theme.page.New(pageLayoutFile).Parse(defaultPageLayout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse default page template: %w", err)
+		}
+	}
+
+	var formatPaths []string
+	for _, format := range outputFormats {
+		paths, err := filepath.Glob(filepath.Join(theme.LayoutDir, "*"+format.Ext))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list page templates: %w", err)
+		}
+		formatPaths = append(formatPaths, paths...)
+	}
+	err = theme.loadFormatLayouts(formatPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	return theme, nil
+}
+
+// templates returns a copy of the theme's page and output format templates
+// using the site's template functions
+func (t *Theme) templates(s *Site) (*template.Template, *texttemplate.Template, error) {
+	page, err := t.page.Clone()
+	if err != nil {
+		return nil, nil, err
+	}
+	formats, err := t.formats.Clone()
+	if err != nil {
+		return nil, nil, err
+	}
+	funcs := s.templateFuncs()
+	return page.Funcs(funcs), formats.Funcs(texttemplate.FuncMap(funcs)), nil
+}
+
+// headTags returns the extra tags the site's features add to the page head
+func (s *Site) headTags() template.HTML {
+	var tags []string
+	for _, tag := range []template.HTML{s.iconTags(), s.serviceWorkerTag(), s.printDetailsTag(), s.lightboxTag()} {
+		if tag != "" {
+			tags = append(tags, string(tag))
+		}
+	}
+	return template.HTML(strings.Join(tags, "\n    "))
+}
+
+// pageHeadTags returns the head tags of a page: the site's, then the links
+// to its translations and its own share tags
+func (s *Site) pageHeadTags(page *Page) template.HTML {
+	var tags []string
+	for _, t := range []template.HTML{s.headTags(), s.hreflangTags(page), s.socialTags(page)} {
+		if t != "" {
+			tags = append(tags, string(t))
+		}
+	}
+	return template.HTML(strings.Join(tags, "\n    "))
+}
+
+// renderPage executes the page's layout template, page.html unless the
+// page's front matter names another one
+func (s *Site) renderPage(data pageData) (string, error) {
+	layout := pageLayoutFile
+	if data.Page != nil && data.Page.Layout != "" {
+		layout = data.Page.Layout
+		if filepath.Ext(layout) == "" {
+			layout += ".html"
+		}
+	}
+
+	var out strings.Builder
+	err := s.page.ExecuteTemplate(&out, layout, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute page template: %w", err)
+	}
+	return s.secureExternalAssets(out.String()), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	thumbnailDir          = "thumbnails"               // Output directory of the thumbnails
+	thumbnailCacheDir     = ".mindoc/cache/thumbnails" // Directory where scaled covers are kept by source hash
+	listingThumbnailWidth = 320                        // Width of the thumbnails on author and series pages
+)
+
+// Thumbnail is a page's cover image scaled down for listings
+type Thumbnail struct {
+	URL    string
+	Width  int // Size in pixels, 0 when unknown, as for remote covers
+	Height int
+}
+
+// thumbnail returns the cover of a page scaled to a width, or nil when the
+// page has no cover, as in {{ with thumbnail 320 . }}. Covers no wider
+// than that are used as they are.
+func (s *Site) thumbnail(width int, page *Page) (*Thumbnail, error) {
+	if page == nil || page.Cover == "" {
+		return nil, nil
+	}
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid thumbnail width %d", width)
+	}
+	if strings.Contains(page.Cover, "://") {
+		return &Thumbnail{URL: page.Cover}, nil
+	}
+	file, ok := s.imageFile(page.Path, page.Cover)
+	if !ok {
+		return nil, fmt.Errorf("cover %s of %s is not in the content", page.Cover, page.Path)
+	}
+
+	key := fmt.Sprintf("%s %d", file.RelPath, width)
+	if thumb, ok := s.thumbnails[key]; ok {
+		return thumb, nil
+	}
+
+	data, err := ioutil.ReadFile(file.SrcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover %s: %w", file.RelPath, err)
+	}
+	if cfg.Width <= width {
+		thumb := &Thumbnail{URL: s.url(file.RelPath), Width: cfg.Width, Height: cfg.Height}
+		s.thumbnails[key] = thumb
+		return thumb, nil
+	}
+
+	// JPEG covers stay JPEG; everything else becomes PNG
+	ext := ".png"
+	if e := strings.ToLower(path.Ext(file.RelPath)); e == ".jpg" || e == ".jpeg" {
+		ext = ".jpg"
+	}
+	height := (cfg.Height*width + cfg.Width/2) / cfg.Width
+	if height < 1 {
+		height = 1
+	}
+
+	hash := sha256.Sum256(append(data, fmt.Sprintf("\x00%d", width)...))
+	cachePath := filepath.Join(thumbnailCacheDir, hex.EncodeToString(hash[:])+ext)
+	scaled, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		scaled, err = scaleCover(data, width, height, ext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scale cover %s: %w", file.RelPath, err)
+		}
+		err = os.MkdirAll(thumbnailCacheDir, os.ModePerm)
+		if err == nil {
+			err = ioutil.WriteFile(cachePath, scaled, 0644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to cache thumbnail: %w", err)
+		}
+	}
+
+	relPath := fmt.Sprintf("%s/%s-%d%s", thumbnailDir, strings.TrimSuffix(file.RelPath, path.Ext(file.RelPath)), width, ext)
+	err = s.output.WriteFile(relPath, scaled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", relPath, err)
+	}
+	thumb := &Thumbnail{URL: s.url(relPath), Width: width, Height: height}
+	s.thumbnails[key] = thumb
+	return thumb, nil
+}
+
+// scaleCover decodes an image and encodes it again at a smaller size
+func scaleCover(data []byte, width, height int, ext string) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if ext == ".jpg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnailTag returns the img element of a page's thumbnail in the
+// built-in listings, or nothing when the page has no cover
+func (s *Site) thumbnailTag(page *Page) string {
+	thumb, err := s.thumbnail(listingThumbnailWidth, page)
+	if err != nil {
+		log.Printf("Failed to make the thumbnail of %s: %v", page.Path, err)
+		return ""
+	}
+	if thumb == nil {
+		return ""
+	}
+	if thumb.Width == 0 {
+		return fmt.Sprintf(`<img class="thumbnail" src="%s" alt="" loading="lazy">`, template.HTMLEscapeString(thumb.URL))
+	}
+	return fmt.Sprintf(`<img class="thumbnail" src="%s" alt="" width="%d" height="%d" loading="lazy">`,
+		template.HTMLEscapeString(thumb.URL), thumb.Width, thumb.Height)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Replacement is a find and replace rule applied to page sources before
+// they are rendered
+type Replacement struct {
+	Find    string   `yaml:"find"`    // Text to find, or a regular expression
+	Replace string   `yaml:"replace"` // Replacement, which may use $1 or ${name} with a regular expression
+	Regex   bool     `yaml:"regex"`   // Find is a regular expression
+	Paths   []string `yaml:"paths"`   // Globs of the pages the rule applies to, all pages when empty
+}
+
+// replacer is a compiled replacement rule
+type replacer struct {
+	Replacement
+	re *regexp.Regexp
+}
+
+// compileReplacements prepares the site's replacement rules
+func (s *Site) compileReplacements() error {
+	s.replacers = nil
+	for i, r := range s.Replacements {
+		if r.Find == "" {
+			return fmt.Errorf("replacement %d has nothing to find", i+1)
+		}
+
+		rep := replacer{Replacement: r}
+		if r.Regex {
+			re, err := regexp.Compile(r.Find)
+			if err != nil {
+				return fmt.Errorf("invalid replacement pattern %q: %w", r.Find, err)
+			}
+			rep.re = re
+		}
+		s.replacers = append(s.replacers, rep)
+	}
+	return nil
+}
+
+// applyReplacements runs the replacement rules matching a page on its body
+func (s *Site) applyReplacements(page *Page) {
+	for _, rep := range s.replacers {
+		if !rep.appliesTo(page.Path) {
+			continue
+		}
+		if rep.re != nil {
+			page.body = rep.re.ReplaceAll(page.body, []byte(rep.Replace))
+		} else {
+			page.body = bytes.ReplaceAll(page.body, []byte(rep.Find), []byte(rep.Replace))
+		}
+	}
+}
+
+// appliesTo reports whether a rule applies to a page path
+func (r replacer) appliesTo(relPath string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, glob := range r.Paths {
+		if matchGlob(glob, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path against a glob where "**"
+// stands for any number of directories, such as "guides/**/*.md"
+func matchGlob(glob, relPath string) bool {
+	return matchSegments(strings.Split(glob, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against glob segments
+func matchSegments(glob, segments []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(glob[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		matched, err := path.Match(glob[0], segments[0])
+		if err != nil || !matched {
+			return false
+		}
+		glob, segments = glob[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
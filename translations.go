@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// compareWithSource marks a page outdated when the page it translates,
+// read from srcPath, changed after it did
+func (s *Site) compareWithSource(page *Page, srcPath string) error {
+	source := s.translations[0]
+	original, err := source.loadPage(srcPath, page.Path)
+	if err == nil {
+		err = original.applyFrontMatter()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", srcPath, err)
+	}
+	if updated := original.updated(); !updated.IsZero() && !page.updated().IsZero() && updated.After(page.updated()) {
+		page.Outdated = &Translation{Lang: source.Language, URL: source.absURL(original.URL), Updated: updated}
+	}
+	return nil
+}
+
+// loadFallbackPages adds the pages of the source language this site has no
+// translation of, with languageFallback on, so their URLs work in this
+// site too. They are rendered with this site's navigation and theme strings
+// and marked with the page they were taken from.
+func (s *Site) loadFallbackPages() error {
+	if !s.LanguageFallback || len(s.translations) < 2 || s == s.translations[0] {
+		return nil
+	}
+	source := s.translations[0]
+	return walkMounts(source.localMounts(), func(srcPath, relPath string, info os.FileInfo) error {
+		if _, ok := s.filesByPath[relPath]; ok || !source.isPage(relPath) || !s.isPage(relPath) {
+			return nil
+		}
+		page, err := s.loadPage(srcPath, relPath)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", srcPath, err)
+		}
+		page.Fallback = &Translation{Lang: source.Language, URL: source.absURL(source.pageURL(relPath))}
+		s.pages = append(s.pages, page)
+		return nil
+	})
+}
+
+// translationSites builds the sites with translations and reports, for each
+// site besides the source language, the pages it has no translation of and
+// the translations older than the page they translate
+func translationSites(sites []*Site) error {
+	problems := 0
+	for _, site := range sites {
+		if len(site.translations) < 2 || site == site.translations[0] {
+			continue
+		}
+		err := site.generate()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+		source := site.translations[0]
+
+		if len(site.missingTranslations) > 0 {
+			fmt.Printf("%s: %d page(s) of %s have no translation:\n", site.label(), len(site.missingTranslations), strings.ToLower(source.label()))
+			for _, p := range site.missingTranslations {
+				fmt.Printf("  %s\n", p)
+			}
+			problems += len(site.missingTranslations)
+		}
+
+		var outdated []*Page
+		for _, page := range site.pages {
+			if page.Outdated != nil {
+				outdated = append(outdated, page)
+			}
+		}
+		if len(outdated) > 0 {
+			fmt.Printf("%s: %d translation(s) are older than the page they translate:\n", site.label(), len(outdated))
+			for _, page := range outdated {
+				fmt.Printf("  %s: changed %s, the original %s\n", page.Path, page.updated().Format("2006-01-02"), page.Outdated.Updated.Format("2006-01-02"))
+			}
+			problems += len(outdated)
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+
+	fmt.Println("All translations are up to date.")
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// URLConfig controls the paths pages are written to and linked with
+type URLConfig struct {
+	TrailingSlash bool         `yaml:"trailingSlash"` // Write pages as <name>/index.html and link them as <name>/
+	Lowercase     bool         `yaml:"lowercase"`     // Lowercase every page path
+	Rewrites      []URLRewrite `yaml:"rewrites"`      // Prefix mappings from content paths to URL paths
+}
+
+// URLRewrite moves the pages under a content tree prefix to another URL
+// prefix, such as "docs/v1/" to "legacy/"
+type URLRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// pagePathKey holds the path of the page being parsed in the parser context
+var pagePathKey = parser.NewContextKey()
+
+// outputPath returns the slash-separated path within the output directory
+// of the HTML file generated for a page
+func (s *Site) outputPath(relPath string) string {
+	p := strings.TrimSuffix(relPath, path.Ext(relPath))
+
+	for _, rw := range s.URLs.Rewrites {
+		from := strings.TrimPrefix(rw.From, "/")
+		if strings.HasPrefix(p, from) {
+			p = strings.TrimPrefix(rw.To, "/") + strings.TrimPrefix(p, from)
+			break
+		}
+	}
+
+	if s.URLs.Lowercase {
+		p = strings.ToLower(p)
+	}
+
+	if !s.URLs.TrailingSlash {
+		return p + ".html"
+	}
+
+	// Index pages become the index of their directory, other pages get a
+	// directory of their own
+	name := path.Base(p)
+	if name == "index" || name == strings.TrimSuffix(sectionIndexFile, path.Ext(sectionIndexFile)) {
+		return path.Join(path.Dir(p), "index.html")
+	}
+	return path.Join(p, "index.html")
+}
+
+// pageURL returns the URL a page is linked with
+func (s *Site) pageURL(relPath string) string {
+	out := s.outputPath(relPath)
+	if s.URLs.TrailingSlash {
+		out = strings.TrimSuffix(out, "index.html")
+	}
+	return s.url(out)
+}
+
+// linkRewriter points links to other pages of the content tree, written
+// with their source file names, at the URLs those pages are generated at
+type linkRewriter struct {
+	site *Site
+}
+
+// Transform rewrites the link destinations of a parsed page
+func (lr linkRewriter) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	relPath, ok := pc.Get(pagePathKey).(string)
+	if !ok {
+		return
+	}
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering {
+			link.Destination = []byte(lr.site.rewriteLink(relPath, string(link.Destination)))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// rewriteLink returns the URL for a relative or site-absolute link to a
+// page file, keeping its fragment and query. Relative links to other files
+// follow the page when it moves, and any other link is left as it is.
+func (s *Site) rewriteLink(relPath, dest string) string {
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "//") ||
+		strings.Contains(dest, "://") || strings.HasPrefix(dest, "mailto:") {
+		return dest
+	}
+
+	target, suffix := dest, ""
+	if i := strings.IndexAny(dest, "#?"); i >= 0 {
+		target, suffix = dest[:i], dest[i:]
+	}
+
+	target = s.linkPath(relPath, target)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return dest
+	}
+	if !s.isPage(target) {
+		return s.fileURL(relPath, dest)
+	}
+	return s.pageURL(target) + suffix
+}
+
+// fileURL returns the destination of a relative link or image from a page
+// to a file that isn't a page. Files are copied to the output where they
+// are in the content tree, so when the page is written to another
+// directory, as with trailingSlash, rewrites or lowercase, the link is made
+// site-absolute to still lead to the file.
+func (s *Site) fileURL(relPath, dest string) string {
+	if dest == "" || strings.HasPrefix(dest, "#") || strings.HasPrefix(dest, "/") ||
+		strings.Contains(dest, ":") || path.Dir(s.outputPath(relPath)) == path.Dir(relPath) {
+		return dest
+	}
+
+	target, suffix := dest, ""
+	if i := strings.IndexAny(dest, "#?"); i >= 0 {
+		target, suffix = dest[:i], dest[i:]
+	}
+	target = path.Join(path.Dir(relPath), target)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return dest
+	}
+	return s.url(target) + suffix
+}
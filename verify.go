@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const goldenDir = "./testdata/expected" // Snapshot of the generated sites that mindoc verify compares builds with
+
+// goldenTextExtensions are the generated files whose differences are shown
+// line by line, other files are only reported as changed
+var goldenTextExtensions = setOf(".html", ".css", ".js", ".json", ".xml", ".txt", ".md", ".svg", ".webmanifest")
+
+// verifySites builds the sites into memory and compares the generated files
+// with a golden snapshot of the output, or rewrites the snapshot with
+// -update. With several sites, each one has a directory of the snapshot
+// named after it.
+func verifySites(sites []*Site, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	golden := fs.String("golden", goldenDir, "directory of the golden snapshot")
+	update := fs.Bool("update", false, "write the generated files to the snapshot instead of comparing")
+	fs.Parse(args)
+
+	changed := 0
+	for _, site := range sites {
+		dir := *golden
+		if len(sites) > 1 {
+			dir = filepath.Join(dir, site.Name)
+		}
+
+		out, err := site.buildSnapshot()
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", site.label(), err)
+		}
+
+		if *update {
+			err = updateSnapshot(dir, out)
+			if err != nil {
+				return fmt.Errorf("%s: %w", site.label(), err)
+			}
+			fmt.Printf("%s: snapshot written to %s.\n", site.label(), dir)
+			continue
+		}
+
+		diffs, err := compareSnapshot(dir, out)
+		if err != nil {
+			return fmt.Errorf("%s: %w", site.label(), err)
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s: %d file(s) differ from %s:\n", site.label(), len(diffs), dir)
+		for _, diff := range diffs {
+			fmt.Printf("  %s\n", diff)
+		}
+		changed += len(diffs)
+	}
+
+	if *update {
+		return nil
+	}
+	if changed > 0 {
+		return fmt.Errorf("%d file(s) differ from the snapshot, run with -update to accept the changes", changed)
+	}
+	fmt.Println("Output matches the snapshot.")
+	return nil
+}
+
+// buildSnapshot builds the site into memory, leaving the output directory
+// and the pages being served alone
+func (s *Site) buildSnapshot() (*memoryOutput, error) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+
+	out := newMemoryOutput()
+	s.output = out
+	err := s.build()
+	s.output = dirOutput(s.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// compareSnapshot describes the files of a build that differ from the
+// snapshot in a directory: those that changed, are new or are missing
+func compareSnapshot(dir string, out *memoryOutput) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no snapshot in %s, run with -update to write it", dir)
+	}
+	want, err := snapshotFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	err = out.Walk(func(relPath string) error {
+		// The build manifest holds the time of the build
+		if relPath == buildManifestFile {
+			delete(want, relPath)
+			return nil
+		}
+		got, _ := out.ReadFile(relPath)
+		if !want[relPath] {
+			diffs = append(diffs, relPath+": not in the snapshot")
+			return nil
+		}
+		delete(want, relPath)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if bytes.Equal(data, got) {
+			return nil
+		}
+		if goldenTextExtensions[path.Ext(relPath)] {
+			diffs = append(diffs, relPath+": changed\n"+strings.TrimSuffix(firstDifference(string(data), string(got)), "\n"))
+		} else {
+			diffs = append(diffs, relPath+": changed")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0, len(want))
+	for relPath := range want {
+		missing = append(missing, relPath)
+	}
+	sort.Strings(missing)
+	for _, relPath := range missing {
+		diffs = append(diffs, relPath+": no longer generated")
+	}
+	return diffs, nil
+}
+
+// snapshotFiles returns the slash separated paths of the files in a
+// snapshot directory
+func snapshotFiles(dir string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := dirOutput(dir).Walk(func(relPath string) error {
+		files[relPath] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return files, nil
+}
+
+// updateSnapshot writes the files of a build to a snapshot directory and
+// removes the files of the snapshot the build no longer generates
+func updateSnapshot(dir string, out *memoryOutput) error {
+	stale := make(map[string]bool)
+	if _, err := os.Stat(dir); err == nil {
+		stale, err = snapshotFiles(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := out.Walk(func(relPath string) error {
+		delete(stale, relPath)
+		if relPath == buildManifestFile {
+			return nil
+		}
+		data, _ := out.ReadFile(relPath)
+		return dirOutput(dir).WriteFile(relPath, data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	for relPath := range stale {
+		err = os.Remove(filepath.Join(dir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return fmt.Errorf("failed to remove %s from snapshot: %w", relPath, err)
+		}
+	}
+	return nil
+}
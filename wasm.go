@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// TemplateFunc is a custom template function implemented as a WASM module.
+//
+// The module must export its memory, an "alloc(size i32) i32" function used
+// to pass the input string in, and the function itself with the signature
+// "(ptr i32, len i32) i64". The result packs the pointer to the output
+// string in the high 32 bits and its length in the low 32 bits.
+type TemplateFunc struct {
+	Name   string `yaml:"name"`   // Name the function is called by in templates
+	Wasm   string `yaml:"wasm"`   // Path to the .wasm file
+	Export string `yaml:"export"` // Exported function to call, defaults to Name
+}
+
+// wasmFunc is a loaded WASM template function
+type wasmFunc struct {
+	mu     sync.Mutex // WASM module instances are not safe for concurrent use
+	name   string
+	memory api.Memory
+	alloc  api.Function
+	fn     api.Function
+}
+
+// loadWasmFuncs compiles and instantiates the WASM modules of the custom
+// template functions and returns them ready to be added to a FuncMap
+func loadWasmFuncs(funcs []TemplateFunc) (map[string]interface{}, error) {
+	if len(funcs) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	loaded := make(map[string]interface{})
+	for _, tf := range funcs {
+		if tf.Name == "" || tf.Wasm == "" {
+			return nil, fmt.Errorf("template function needs both a name and a wasm file")
+		}
+
+		export := tf.Export
+		if export == "" {
+			export = tf.Name
+		}
+
+		wasmBytes, err := ioutil.ReadFile(tf.Wasm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", tf.Wasm, err)
+		}
+
+		// Each function gets its own instance so modules can't clash
+		config := wazero.NewModuleConfig().WithName(tf.Name).WithStartFunctions("_initialize")
+		module, err := runtime.InstantiateWithConfig(ctx, wasmBytes, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to instantiate %s: %w", tf.Wasm, err)
+		}
+
+		wf := &wasmFunc{
+			name:   tf.Name,
+			memory: module.Memory(),
+			alloc:  module.ExportedFunction("alloc"),
+			fn:     module.ExportedFunction(export),
+		}
+		switch {
+		case wf.memory == nil:
+			return nil, fmt.Errorf("%s does not export its memory", tf.Wasm)
+		case wf.alloc == nil:
+			return nil, fmt.Errorf("%s does not export alloc", tf.Wasm)
+		case wf.fn == nil:
+			return nil, fmt.Errorf("%s does not export %s", tf.Wasm, export)
+		}
+
+		loaded[tf.Name] = wf.call
+	}
+
+	return loaded, nil
+}
+
+// call runs the WASM function with its arguments formatted as one string
+func (wf *wasmFunc) call(args ...interface{}) (string, error) {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+
+	input := fmt.Sprint(args...)
+	ctx := context.Background()
+
+	results, err := wf.alloc.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return "", fmt.Errorf("%s: alloc failed: %w", wf.name, err)
+	}
+	ptr := uint32(results[0])
+
+	if !wf.memory.Write(ptr, []byte(input)) {
+		return "", fmt.Errorf("%s: input out of memory range", wf.name)
+	}
+
+	results, err = wf.fn.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", wf.name, err)
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := wf.memory.Read(outPtr, outLen)
+	if !ok {
+		return "", fmt.Errorf("%s: output out of memory range", wf.name)
+	}
+
+	return string(output), nil
+}